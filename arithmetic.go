@@ -0,0 +1,792 @@
+package imagetk
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"reflect"
+)
+
+// Voxel-wise arithmetic operations.
+const (
+	opAdd = iota
+	opSubtract
+	opMultiply
+	opDivide
+	opMin
+	opMax
+	opPow
+)
+
+// Voxel-wise comparisons.
+const (
+	compareGreater = iota
+	compareGreaterEqual
+	compareLess
+	compareLessEqual
+	compareEqual
+	compareNotEqual
+)
+
+// geometryTolerance is the largest difference between the spacing, origin and
+// direction of two images that are treated as occupying the same space.
+const geometryTolerance = 1e-6
+
+// Add returns the voxel-wise sum a + b.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar such as 2 or 0.5
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+//
+// Images of different pixel types are promoted to a type that holds both,
+// e.g. UInt8 and Int8 to Int16 and Int16 and Float32 to Float32. Integer
+// scalars keep the pixel type of a and must fit in it; floating point scalars
+// turn integer images into Float64 images. Integer results wrap around on
+// overflow.
+func Add(a *Image, b any) (*Image, error) {
+	return arithmetic(opAdd, a, b)
+}
+
+// Subtract returns the voxel-wise difference a - b. Operands and pixel types
+// are handled as for Add.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+func Subtract(a *Image, b any) (*Image, error) {
+	return arithmetic(opSubtract, a, b)
+}
+
+// Multiply returns the voxel-wise product a * b. Operands and pixel types
+// are handled as for Add.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+func Multiply(a *Image, b any) (*Image, error) {
+	return arithmetic(opMultiply, a, b)
+}
+
+// Divide returns the voxel-wise quotient a / b. Integer operands are divided
+// as Float64, so the result is a Float64 image unless an operand is a
+// floating point or complex image. Division by zero gives +Inf, -Inf or NaN.
+//
+// Parameters:
+//   - a: The dividend
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+func Divide(a *Image, b any) (*Image, error) {
+	return arithmetic(opDivide, a, b)
+}
+
+// Min returns the voxel-wise minimum of a and b. Operands and pixel types are
+// handled as for Add.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if the images do not match, b is not a supported operand or an operand is complex
+func Min(a *Image, b any) (*Image, error) {
+	return arithmetic(opMin, a, b)
+}
+
+// Max returns the voxel-wise maximum of a and b. Operands and pixel types are
+// handled as for Add.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if the images do not match, b is not a supported operand or an operand is complex
+func Max(a *Image, b any) (*Image, error) {
+	return arithmetic(opMax, a, b)
+}
+
+// Pow returns a raised to the power b, voxel by voxel. The result has a
+// floating point or complex pixel type, as for Divide.
+//
+// Parameters:
+//   - a: The base
+//   - b: The exponent, an image with the same geometry as a or a scalar
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+func Pow(a *Image, b any) (*Image, error) {
+	return arithmetic(opPow, a, b)
+}
+
+// Abs returns the absolute value of every voxel. Complex images give their
+// modulus as a Float32 or Float64 image; other images keep their pixel type.
+//
+// Parameters:
+//   - a: The input image
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if creating the image fails
+func Abs(a *Image) (*Image, error) {
+	if isComplexPixelType(a.pixelType) {
+		return a.complexPart(cmplx.Abs)
+	}
+	out, err := newImageLike(a, a.pixelType, a.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+	switch a.pixelType {
+	case PixelTypeUInt8, PixelTypeUInt16, PixelTypeUInt32, PixelTypeUInt64:
+		copy(out.pixels, a.pixels)
+	case PixelTypeInt8:
+		setPixelsOf(out, absValues(pixelsOf[int8](a)))
+	case PixelTypeInt16:
+		setPixelsOf(out, absValues(pixelsOf[int16](a)))
+	case PixelTypeInt32:
+		setPixelsOf(out, absValues(pixelsOf[int32](a)))
+	case PixelTypeInt64:
+		setPixelsOf(out, absValues(pixelsOf[int64](a)))
+	case PixelTypeFloat32:
+		setPixelsOf(out, absValues(pixelsOf[float32](a)))
+	case PixelTypeFloat64:
+		setPixelsOf(out, absValues(pixelsOf[float64](a)))
+	}
+	return out, nil
+}
+
+// Sqrt returns the square root of every voxel. Integer images give Float64
+// images; floating point and complex images keep their pixel type. Negative
+// real values give NaN.
+//
+// Parameters:
+//   - a: The input image
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if creating the image fails
+func Sqrt(a *Image) (*Image, error) {
+	return mathFunction(a, math.Sqrt, cmplx.Sqrt)
+}
+
+// Exp returns e raised to the power of every voxel, with the pixel types of Sqrt.
+//
+// Parameters:
+//   - a: The input image
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if creating the image fails
+func Exp(a *Image) (*Image, error) {
+	return mathFunction(a, math.Exp, cmplx.Exp)
+}
+
+// Log returns the natural logarithm of every voxel, with the pixel types of
+// Sqrt. Zero gives -Inf and negative real values give NaN.
+//
+// Parameters:
+//   - a: The input image
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of a
+//   - error: Error if creating the image fails
+func Log(a *Image) (*Image, error) {
+	return mathFunction(a, math.Log, cmplx.Log)
+}
+
+// And returns a mask that is 1 where both a and b are non-zero and 0 elsewhere.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+func And(a *Image, b any) (*Image, error) {
+	return logical(a, b, func(x, y bool) bool { return x && y })
+}
+
+// Or returns a mask that is 1 where a or b is non-zero and 0 elsewhere.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+func Or(a *Image, b any) (*Image, error) {
+	return logical(a, b, func(x, y bool) bool { return x || y })
+}
+
+// Xor returns a mask that is 1 where exactly one of a and b is non-zero and 0 elsewhere.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+func Xor(a *Image, b any) (*Image, error) {
+	return logical(a, b, func(x, y bool) bool { return x != y })
+}
+
+// Not returns a mask that is 1 where a is zero and 0 elsewhere.
+//
+// Parameters:
+//   - a: The input image
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if creating the image fails
+func Not(a *Image) (*Image, error) {
+	return logical(a, 0, func(x, _ bool) bool { return !x })
+}
+
+// Greater returns a mask that is 1 where a > b and 0 elsewhere.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if the images do not match, b is not a supported operand or an operand is complex
+func Greater(a *Image, b any) (*Image, error) {
+	return compare(compareGreater, a, b)
+}
+
+// GreaterEqual returns a mask that is 1 where a >= b and 0 elsewhere.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if the images do not match, b is not a supported operand or an operand is complex
+func GreaterEqual(a *Image, b any) (*Image, error) {
+	return compare(compareGreaterEqual, a, b)
+}
+
+// Less returns a mask that is 1 where a < b and 0 elsewhere.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if the images do not match, b is not a supported operand or an operand is complex
+func Less(a *Image, b any) (*Image, error) {
+	return compare(compareLess, a, b)
+}
+
+// LessEqual returns a mask that is 1 where a <= b and 0 elsewhere.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if the images do not match, b is not a supported operand or an operand is complex
+func LessEqual(a *Image, b any) (*Image, error) {
+	return compare(compareLessEqual, a, b)
+}
+
+// Equal returns a mask that is 1 where a == b and 0 elsewhere.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+func Equal(a *Image, b any) (*Image, error) {
+	return compare(compareEqual, a, b)
+}
+
+// NotEqual returns a mask that is 1 where a != b and 0 elsewhere.
+//
+// Parameters:
+//   - a: The first operand
+//   - b: An image with the same geometry as a, or a scalar
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of a
+//   - error: Error if the images do not match or b is not a supported operand
+func NotEqual(a *Image, b any) (*Image, error) {
+	return compare(compareNotEqual, a, b)
+}
+
+// arithmetic applies an arithmetic operation to a and b in their common pixel type.
+func arithmetic(op int, a *Image, b any) (*Image, error) {
+	pixelType, err := operandPixelType(a, b)
+	if err != nil {
+		return nil, err
+	}
+	if op == opDivide || op == opPow {
+		pixelType = floatPixelType(pixelType)
+	}
+	if (op == opMin || op == opMax) && isComplexPixelType(pixelType) {
+		return nil, fmt.Errorf("complex values cannot be ordered")
+	}
+	x, y, err := convertOperands(a, b, pixelType)
+	if err != nil {
+		return nil, err
+	}
+	out, err := newImageLike(a, pixelType, a.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+
+	switch pixelType {
+	case PixelTypeUInt8:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[uint8](x), pixelsOf[uint8](y)))
+	case PixelTypeInt8:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[int8](x), pixelsOf[int8](y)))
+	case PixelTypeUInt16:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[uint16](x), pixelsOf[uint16](y)))
+	case PixelTypeInt16:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[int16](x), pixelsOf[int16](y)))
+	case PixelTypeUInt32:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[uint32](x), pixelsOf[uint32](y)))
+	case PixelTypeInt32:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[int32](x), pixelsOf[int32](y)))
+	case PixelTypeUInt64:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[uint64](x), pixelsOf[uint64](y)))
+	case PixelTypeInt64:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[int64](x), pixelsOf[int64](y)))
+	case PixelTypeFloat32:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[float32](x), pixelsOf[float32](y)))
+	case PixelTypeFloat64:
+		setPixelsOf(out, arithmeticValues(op, pixelsOf[float64](x), pixelsOf[float64](y)))
+	case PixelTypeComplex64, PixelTypeComplex128:
+		step := broadcastStep(y)
+		parallelFor(len(out.pixels)/out.bytesPerPixel, func(start, end int) {
+			for i := start; i < end; i++ {
+				out.setLinearComplexPixel(i, complexArithmetic(op, x.getLinearPixelAsComplex128(i), y.getLinearPixelAsComplex128(i*step)))
+			}
+		})
+	}
+	return out, nil
+}
+
+// arithmeticValues applies op to the values of x and y, where y holds either
+// one value per value of x or a single value used for all of them. Division
+// is only used with floating point types.
+func arithmeticValues[T Number](op int, x, y []T) []T {
+	out := make([]T, len(x))
+	step := 1
+	if len(y) == 1 {
+		step = 0
+	}
+	parallelFor(len(out), func(start, end int) {
+		switch op {
+		case opAdd:
+			for i := start; i < end; i++ {
+				out[i] = x[i] + y[i*step]
+			}
+		case opSubtract:
+			for i := start; i < end; i++ {
+				out[i] = x[i] - y[i*step]
+			}
+		case opMultiply:
+			for i := start; i < end; i++ {
+				out[i] = x[i] * y[i*step]
+			}
+		case opDivide:
+			for i := start; i < end; i++ {
+				out[i] = x[i] / y[i*step]
+			}
+		case opMin:
+			for i := start; i < end; i++ {
+				out[i] = min(x[i], y[i*step])
+			}
+		case opMax:
+			for i := start; i < end; i++ {
+				out[i] = max(x[i], y[i*step])
+			}
+		case opPow:
+			for i := start; i < end; i++ {
+				out[i] = T(math.Pow(float64(x[i]), float64(y[i*step])))
+			}
+		}
+	})
+	return out
+}
+
+// complexArithmetic applies op, other than opMin and opMax, to complex values.
+func complexArithmetic(op int, x, y complex128) complex128 {
+	switch op {
+	case opAdd:
+		return x + y
+	case opSubtract:
+		return x - y
+	case opMultiply:
+		return x * y
+	case opDivide:
+		return x / y
+	default:
+		return cmplx.Pow(x, y)
+	}
+}
+
+// absValues returns the absolute values of x.
+func absValues[T Number](x []T) []T {
+	out := make([]T, len(x))
+	for i, value := range x {
+		if value < 0 {
+			value = -value
+		}
+		out[i] = value
+	}
+	return out
+}
+
+// mathFunction applies fn to every value of a real image, or complexFn to
+// every value of a complex image.
+func mathFunction(a *Image, fn func(float64) float64, complexFn func(complex128) complex128) (*Image, error) {
+	out, err := newImageLike(a, floatPixelType(a.pixelType), a.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+	parallelFor(len(out.pixels)/out.bytesPerPixel, func(start, end int) {
+		for i := start; i < end; i++ {
+			if isComplexPixelType(a.pixelType) {
+				out.setLinearComplexPixel(i, complexFn(a.getLinearPixelAsComplex128(i)))
+			} else {
+				out.setLinearPixelFromFloat64(i, fn(a.getLinearPixelAsFloat64(i)))
+			}
+		}
+	})
+	return out, nil
+}
+
+// logical combines the truth values of a and b, where non-zero values are true.
+func logical(a *Image, b any, fn func(x, y bool) bool) (*Image, error) {
+	pixelType, err := operandPixelType(a, b)
+	if err != nil {
+		return nil, err
+	}
+	_, y, err := convertOperands(a, b, pixelType)
+	if err != nil {
+		return nil, err
+	}
+	out, err := newImageLike(a, PixelTypeUInt8, a.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+	step := broadcastStep(y)
+	parallelFor(len(out.pixels), func(start, end int) {
+		for i := start; i < end; i++ {
+			if fn(a.getLinearPixelAsComplex128(i) != 0, y.getLinearPixelAsComplex128(i*step) != 0) {
+				out.pixels[i] = 1
+			}
+		}
+	})
+	return out, nil
+}
+
+// compare compares a and b in their common pixel type.
+func compare(op int, a *Image, b any) (*Image, error) {
+	pixelType, err := operandPixelType(a, b)
+	if err != nil {
+		return nil, err
+	}
+	x, y, err := convertOperands(a, b, pixelType)
+	if err != nil {
+		return nil, err
+	}
+	out, err := newImageLike(a, PixelTypeUInt8, a.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+
+	switch pixelType {
+	case PixelTypeUInt8:
+		compareValues(op, pixelsOf[uint8](x), pixelsOf[uint8](y), out.pixels)
+	case PixelTypeInt8:
+		compareValues(op, pixelsOf[int8](x), pixelsOf[int8](y), out.pixels)
+	case PixelTypeUInt16:
+		compareValues(op, pixelsOf[uint16](x), pixelsOf[uint16](y), out.pixels)
+	case PixelTypeInt16:
+		compareValues(op, pixelsOf[int16](x), pixelsOf[int16](y), out.pixels)
+	case PixelTypeUInt32:
+		compareValues(op, pixelsOf[uint32](x), pixelsOf[uint32](y), out.pixels)
+	case PixelTypeInt32:
+		compareValues(op, pixelsOf[int32](x), pixelsOf[int32](y), out.pixels)
+	case PixelTypeUInt64:
+		compareValues(op, pixelsOf[uint64](x), pixelsOf[uint64](y), out.pixels)
+	case PixelTypeInt64:
+		compareValues(op, pixelsOf[int64](x), pixelsOf[int64](y), out.pixels)
+	case PixelTypeFloat32:
+		compareValues(op, pixelsOf[float32](x), pixelsOf[float32](y), out.pixels)
+	case PixelTypeFloat64:
+		compareValues(op, pixelsOf[float64](x), pixelsOf[float64](y), out.pixels)
+	case PixelTypeComplex64, PixelTypeComplex128:
+		if op != compareEqual && op != compareNotEqual {
+			return nil, fmt.Errorf("complex values cannot be ordered")
+		}
+		step := broadcastStep(y)
+		parallelFor(len(out.pixels), func(start, end int) {
+			for i := start; i < end; i++ {
+				equal := x.getLinearPixelAsComplex128(i) == y.getLinearPixelAsComplex128(i*step)
+				if equal == (op == compareEqual) {
+					out.pixels[i] = 1
+				}
+			}
+		})
+	}
+	return out, nil
+}
+
+// compareValues sets mask[i] to 1 where x[i] op y[i] holds, broadcasting y
+// if it holds a single value.
+func compareValues[T Number](op int, x, y []T, mask []uint8) {
+	step := 1
+	if len(y) == 1 {
+		step = 0
+	}
+	parallelFor(len(mask), func(start, end int) {
+		for i := start; i < end; i++ {
+			var result bool
+			switch op {
+			case compareGreater:
+				result = x[i] > y[i*step]
+			case compareGreaterEqual:
+				result = x[i] >= y[i*step]
+			case compareLess:
+				result = x[i] < y[i*step]
+			case compareLessEqual:
+				result = x[i] <= y[i*step]
+			case compareEqual:
+				result = x[i] == y[i*step]
+			case compareNotEqual:
+				result = x[i] != y[i*step]
+			}
+			if result {
+				mask[i] = 1
+			}
+		}
+	})
+}
+
+// operandPixelType returns the pixel type in which a and b, an image or a
+// scalar, are combined.
+func operandPixelType(a *Image, b any) (int, error) {
+	switch b := b.(type) {
+	case *Image:
+		if err := checkSameGeometry(a, b); err != nil {
+			return 0, err
+		}
+		return promotePixelTypes(a.pixelType, b.pixelType), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		if !integerFitsPixelType(b, a.pixelType) {
+			return 0, fmt.Errorf("scalar %v does not fit pixel type %d", b, a.pixelType)
+		}
+		return a.pixelType, nil
+	case float32, float64:
+		if isComplexPixelType(a.pixelType) || a.pixelType == PixelTypeFloat32 || a.pixelType == PixelTypeFloat64 {
+			return a.pixelType, nil
+		}
+		return PixelTypeFloat64, nil
+	case complex64, complex128:
+		switch a.pixelType {
+		case PixelTypeComplex64, PixelTypeComplex128:
+			return a.pixelType, nil
+		case PixelTypeFloat32:
+			return PixelTypeComplex64, nil
+		default:
+			return PixelTypeComplex128, nil
+		}
+	default:
+		return 0, fmt.Errorf("unsupported operand type %T", b)
+	}
+}
+
+// convertOperands converts a and b to pixelType. Scalars become single-pixel
+// images whose value is used for every voxel of a.
+func convertOperands(a *Image, b any, pixelType int) (*Image, *Image, error) {
+	x, err := a.AsType(pixelType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if img, ok := b.(*Image); ok {
+		y, err := img.AsType(pixelType)
+		if err != nil {
+			return nil, nil, err
+		}
+		return x, y, nil
+	}
+	if value, ok := b.(uint); ok {
+		b = uint64(value)
+	}
+	value, err := getValueAsPixelType(b, pixelType)
+	if err != nil {
+		return nil, nil, err
+	}
+	valueBytes, err := getValueAsBytes(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	y, err := newImageHeader([]uint32{1, 1}, pixelType)
+	if err != nil {
+		return nil, nil, err
+	}
+	y.pixels = valueBytes
+	return x, y, nil
+}
+
+// broadcastStep returns the step through the values of an operand, 0 for
+// single-value operands that are used for every voxel.
+func broadcastStep(operand *Image) int {
+	if len(operand.pixels) == operand.bytesPerPixel {
+		return 0
+	}
+	return 1
+}
+
+// checkSameGeometry returns an error unless a and b have the same size and
+// components, and the same spacing, origin and direction up to geometryTolerance.
+func checkSameGeometry(a, b *Image) error {
+	if !reflect.DeepEqual(a.size, b.size) {
+		return fmt.Errorf("image sizes differ: %v and %v", a.size, b.size)
+	}
+	if a.GetNumberOfComponentsPerPixel() != b.GetNumberOfComponentsPerPixel() {
+		return fmt.Errorf("images have %d and %d components", a.GetNumberOfComponentsPerPixel(), b.GetNumberOfComponentsPerPixel())
+	}
+	for i := range a.spacing {
+		if math.Abs(a.spacing[i]-b.spacing[i]) > geometryTolerance*a.spacing[i] {
+			return fmt.Errorf("image spacings differ: %v and %v", a.spacing, b.spacing)
+		}
+		if math.Abs(a.origin[i]-b.origin[i]) > geometryTolerance*a.spacing[i] {
+			return fmt.Errorf("image origins differ: %v and %v", a.origin, b.origin)
+		}
+	}
+	directionA, directionB := a.GetDirectionMatrix(), b.GetDirectionMatrix()
+	for i := range directionA {
+		if math.Abs(directionA[i]-directionB[i]) > geometryTolerance {
+			return fmt.Errorf("image directions differ: %v and %v", directionA, directionB)
+		}
+	}
+	return nil
+}
+
+// integerFitsPixelType reports whether an integer value can be stored in
+// pixelType without wrapping around.
+func integerFitsPixelType(value any, pixelType int) bool {
+	lowest, highest, ok := integerPixelTypeRange(pixelType)
+	if !ok {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	if v.CanInt() {
+		n := v.Int()
+		return n >= lowest && (n < 0 || uint64(n) <= highest)
+	}
+	return v.Uint() <= highest
+}
+
+// promotePixelTypes returns the smallest pixel type that holds the values of
+// both pixel types, using Float64 where no integer type does.
+func promotePixelTypes(p, q int) int {
+	if p == q {
+		return p
+	}
+	if isComplexPixelType(p) || isComplexPixelType(q) {
+		if promotePixelTypes(realPixelType(p), realPixelType(q)) == PixelTypeFloat32 {
+			return PixelTypeComplex64
+		}
+		return PixelTypeComplex128
+	}
+	if p == PixelTypeFloat32 || p == PixelTypeFloat64 || q == PixelTypeFloat32 || q == PixelTypeFloat64 {
+		// Float32 holds integers of up to 16 bits exactly.
+		for _, t := range []int{p, q} {
+			if bytes, _ := getBytesPerPixel(t); t == PixelTypeFloat64 || (t != PixelTypeFloat32 && bytes > 2) {
+				return PixelTypeFloat64
+			}
+		}
+		return PixelTypeFloat32
+	}
+
+	pBytes, _ := getBytesPerPixel(p)
+	qBytes, _ := getBytesPerPixel(q)
+	pSigned, qSigned := isSignedPixelType(p), isSignedPixelType(q)
+	if pSigned == qSigned {
+		if pBytes > qBytes {
+			return p
+		}
+		return q
+	}
+	// A signed type holds an unsigned one if it is wider.
+	signedBytes, unsignedBytes := pBytes, qBytes
+	if qSigned {
+		signedBytes, unsignedBytes = qBytes, pBytes
+	}
+	switch max(signedBytes, 2*unsignedBytes) {
+	case 2:
+		return PixelTypeInt16
+	case 4:
+		return PixelTypeInt32
+	case 8:
+		return PixelTypeInt64
+	default:
+		return PixelTypeFloat64
+	}
+}
+
+// isSignedPixelType reports whether pixelType is a signed integer type.
+func isSignedPixelType(pixelType int) bool {
+	switch pixelType {
+	case PixelTypeInt8, PixelTypeInt16, PixelTypeInt32, PixelTypeInt64:
+		return true
+	default:
+		return false
+	}
+}
+
+// realPixelType returns the pixel type of the parts of a complex pixel type,
+// or pixelType itself for real pixel types.
+func realPixelType(pixelType int) int {
+	switch pixelType {
+	case PixelTypeComplex64:
+		return PixelTypeFloat32
+	case PixelTypeComplex128:
+		return PixelTypeFloat64
+	default:
+		return pixelType
+	}
+}
+
+// floatPixelType returns Float64 for integer pixel types and pixelType itself
+// for floating point and complex pixel types.
+func floatPixelType(pixelType int) int {
+	switch pixelType {
+	case PixelTypeFloat32, PixelTypeFloat64, PixelTypeComplex64, PixelTypeComplex128:
+		return pixelType
+	default:
+		return PixelTypeFloat64
+	}
+}
@@ -0,0 +1,247 @@
+package imagetk
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestArithmetic(t *testing.T) {
+	a, err := GetImageFromArray([][]int16{{1, -2, 3}, {4, 5, -6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetSpacing([]float64{0.5, 2})
+	a.SetMetaData("Modality", "CT")
+	b, err := GetImageFromArray([][]uint8{{2, 2, 0}, {1, 10, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetSpacing([]float64{0.5, 2})
+
+	tests := []struct {
+		name      string
+		fn        func() (*Image, error)
+		pixelType int
+		want      []float64
+	}{
+		{"add", func() (*Image, error) { return Add(a, b) }, PixelTypeInt16, []float64{3, 0, 3, 5, 15, -3}},
+		{"subtract", func() (*Image, error) { return Subtract(a, b) }, PixelTypeInt16, []float64{-1, -4, 3, 3, -5, -9}},
+		{"multiply", func() (*Image, error) { return Multiply(a, b) }, PixelTypeInt16, []float64{2, -4, 0, 4, 50, -18}},
+		{"divide", func() (*Image, error) { return Divide(a, 2) }, PixelTypeFloat64, []float64{0.5, -1, 1.5, 2, 2.5, -3}},
+		{"min", func() (*Image, error) { return Min(a, b) }, PixelTypeInt16, []float64{1, -2, 0, 1, 5, -6}},
+		{"max", func() (*Image, error) { return Max(a, 0) }, PixelTypeInt16, []float64{1, 0, 3, 4, 5, 0}},
+		{"pow", func() (*Image, error) { return Pow(a, 2) }, PixelTypeFloat64, []float64{1, 4, 9, 16, 25, 36}},
+		{"add float", func() (*Image, error) { return Add(b, 0.5) }, PixelTypeFloat64, []float64{2.5, 2.5, 0.5, 1.5, 10.5, 3.5}},
+		{"abs", func() (*Image, error) { return Abs(a) }, PixelTypeInt16, []float64{1, 2, 3, 4, 5, 6}},
+		{"sqrt", func() (*Image, error) { return Sqrt(b) }, PixelTypeFloat64, []float64{math.Sqrt2, math.Sqrt2, 0, 1, math.Sqrt(10), math.Sqrt(3)}},
+		{"exp", func() (*Image, error) { return Exp(b) }, PixelTypeFloat64, []float64{math.Exp(2), math.Exp(2), 1, math.E, math.Exp(10), math.Exp(3)}},
+		{"log", func() (*Image, error) { return Log(b) }, PixelTypeFloat64, []float64{math.Ln2, math.Ln2, math.Inf(-1), 0, math.Log(10), math.Log(3)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.fn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.GetPixelType() != tt.pixelType {
+				t.Fatalf("expected pixel type %d, got %d", tt.pixelType, out.GetPixelType())
+			}
+			if !reflect.DeepEqual(out.GetSpacing(), a.GetSpacing()) {
+				t.Errorf("expected spacing %v, got %v", a.GetSpacing(), out.GetSpacing())
+			}
+			for i, want := range tt.want {
+				if got := out.getLinearPixelAsFloat64(i); !almostEqual(got, want, 1e-12) && got != want {
+					t.Errorf("pixel %d: expected %v, got %v", i, want, got)
+				}
+			}
+		})
+	}
+
+	sum, _ := Add(b, a)
+	if modality, _ := sum.GetMetaData("Modality"); modality != "" {
+		t.Errorf("expected the metadata of the first operand, got %q", modality)
+	}
+
+	// Large images are processed in parallel chunks.
+	large, err := NewImage([]uint32{256, 128}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(large.NumPixels()); i++ {
+		large.setLinearPixelFromFloat64(i, float64(i))
+	}
+	doubled, err := Add(large, large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(large.NumPixels()); i++ {
+		if got := doubled.getLinearPixelAsFloat64(i); got != float64(2*i) {
+			t.Fatalf("pixel %d: expected %d, got %v", i, 2*i, got)
+		}
+	}
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	a, err := NewImage([]uint32{3, 2}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewImage([]uint32{2, 3}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(a, other); err == nil {
+		t.Errorf("expected error for mismatched sizes")
+	}
+	shifted, err := NewImage([]uint32{3, 2}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shifted.SetOrigin([]float64{1, 0})
+	if _, err := Multiply(a, shifted); err == nil {
+		t.Errorf("expected error for mismatched origins")
+	}
+	vector, err := NewVectorImage([]uint32{3, 2}, PixelTypeUInt8, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Subtract(a, vector); err == nil {
+		t.Errorf("expected error for mismatched components")
+	}
+	if _, err := Add(a, 300); err == nil {
+		t.Errorf("expected error for a scalar that does not fit UInt8")
+	}
+	if _, err := Add(a, "1"); err == nil {
+		t.Errorf("expected error for a string operand")
+	}
+	z, err := NewImage([]uint32{3, 2}, PixelTypeComplex64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Max(z, 1); err == nil {
+		t.Errorf("expected error for the maximum of complex values")
+	}
+	if _, err := Less(z, 1); err == nil {
+		t.Errorf("expected error ordering complex values")
+	}
+}
+
+func TestPromotePixelTypes(t *testing.T) {
+	tests := []struct {
+		p, q int
+		want int
+	}{
+		{PixelTypeUInt8, PixelTypeUInt8, PixelTypeUInt8},
+		{PixelTypeUInt8, PixelTypeUInt16, PixelTypeUInt16},
+		{PixelTypeUInt8, PixelTypeInt8, PixelTypeInt16},
+		{PixelTypeUInt16, PixelTypeInt32, PixelTypeInt32},
+		{PixelTypeUInt32, PixelTypeInt16, PixelTypeInt64},
+		{PixelTypeUInt64, PixelTypeInt8, PixelTypeFloat64},
+		{PixelTypeInt16, PixelTypeFloat32, PixelTypeFloat32},
+		{PixelTypeInt32, PixelTypeFloat32, PixelTypeFloat64},
+		{PixelTypeFloat32, PixelTypeFloat64, PixelTypeFloat64},
+		{PixelTypeUInt8, PixelTypeComplex64, PixelTypeComplex64},
+		{PixelTypeFloat64, PixelTypeComplex64, PixelTypeComplex128},
+	}
+	for _, tt := range tests {
+		if got := promotePixelTypes(tt.p, tt.q); got != tt.want {
+			t.Errorf("promotePixelTypes(%d, %d): expected %d, got %d", tt.p, tt.q, tt.want, got)
+		}
+		if got := promotePixelTypes(tt.q, tt.p); got != tt.want {
+			t.Errorf("promotePixelTypes(%d, %d): expected %d, got %d", tt.q, tt.p, tt.want, got)
+		}
+	}
+}
+
+func TestLogicalAndCompare(t *testing.T) {
+	a, err := GetImageFromArray([][]float32{{0, 1.5, -2}, {3, 0, 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GetImageFromArray([][]float32{{0, 0, 1}, {3, 2, 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func() (*Image, error)
+		want []uint8
+	}{
+		{"and", func() (*Image, error) { return And(a, b) }, []uint8{0, 0, 1, 1, 0, 1}},
+		{"or", func() (*Image, error) { return Or(a, b) }, []uint8{0, 1, 1, 1, 1, 1}},
+		{"xor", func() (*Image, error) { return Xor(a, b) }, []uint8{0, 1, 0, 0, 1, 0}},
+		{"not", func() (*Image, error) { return Not(a) }, []uint8{1, 0, 0, 0, 1, 0}},
+		{"greater", func() (*Image, error) { return Greater(a, b) }, []uint8{0, 1, 0, 0, 0, 0}},
+		{"greater equal", func() (*Image, error) { return GreaterEqual(a, b) }, []uint8{1, 1, 0, 1, 0, 0}},
+		{"less", func() (*Image, error) { return Less(a, 1) }, []uint8{1, 0, 1, 0, 1, 0}},
+		{"less equal", func() (*Image, error) { return LessEqual(a, 1.5) }, []uint8{1, 1, 1, 0, 1, 0}},
+		{"equal", func() (*Image, error) { return Equal(a, b) }, []uint8{1, 0, 0, 1, 0, 0}},
+		{"not equal", func() (*Image, error) { return NotEqual(a, 0) }, []uint8{0, 1, 1, 1, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mask, err := tt.fn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mask.GetPixelType() != PixelTypeUInt8 {
+				t.Fatalf("expected a UInt8 mask, got pixel type %d", mask.GetPixelType())
+			}
+			if !reflect.DeepEqual(mask.pixels, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, mask.pixels)
+			}
+		})
+	}
+}
+
+func TestComplexArithmetic(t *testing.T) {
+	img := newComplexTestImage(t)
+	product, err := Multiply(img, 2i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := Add(img, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magnitude, err := Abs(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal, err := Equal(img, product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.GetPixelType() != PixelTypeComplex128 || magnitude.GetPixelType() != PixelTypeFloat64 {
+		t.Fatalf("unexpected pixel types %d and %d", product.GetPixelType(), magnitude.GetPixelType())
+	}
+	for i := 0; i < int(img.NumPixels()); i++ {
+		value := img.getLinearPixelAsComplex128(i)
+		if got := product.getLinearPixelAsComplex128(i); got != value*2i {
+			t.Errorf("pixel %d: expected %v, got %v", i, value*2i, got)
+		}
+		if got := sum.getLinearPixelAsComplex128(i); got != 2*value {
+			t.Errorf("pixel %d: expected %v, got %v", i, 2*value, got)
+		}
+		if equal.pixels[i] != 0 {
+			t.Errorf("pixel %d: expected %v and %v to differ", i, value, value*2i)
+		}
+	}
+
+	realImg, err := GetImageFromArray([][]float32{{1, 2}, {3, 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shifted, err := Add(realImg, 1i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shifted.GetPixelType() != PixelTypeComplex64 {
+		t.Errorf("expected Complex64 for a Float32 image and a complex scalar, got %d", shifted.GetPixelType())
+	}
+	if value, _ := shifted.GetPixel([]uint32{1, 1}); value != complex64(4+1i) {
+		t.Errorf("expected 4+1i, got %v", value)
+	}
+}
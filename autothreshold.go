@@ -0,0 +1,633 @@
+package imagetk
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Automatic threshold methods for ComputeThreshold and AutoThresholdImage.
+const (
+	// ThresholdOtsu maximizes the variance between the two classes.
+	ThresholdOtsu = iota
+	// ThresholdLi minimizes the cross entropy between the image and the
+	// segmentation with the iterative method of Li and Tam.
+	ThresholdLi
+	// ThresholdHuang minimizes the fuzzy entropy of the class memberships.
+	ThresholdHuang
+	// ThresholdTriangle finds the bin farthest from the line between the
+	// histogram peak and the end of its longer tail.
+	ThresholdTriangle
+	// ThresholdYen maximizes the entropic correlation of the two classes.
+	ThresholdYen
+	// ThresholdIsoData iterates until the threshold lies halfway between the
+	// class means (Ridler and Calvard).
+	ThresholdIsoData
+	// ThresholdKittlerIllingworth minimizes the classification error of a
+	// mixture of two Gaussians.
+	ThresholdKittlerIllingworth
+	// ThresholdMaxEntropy maximizes the sum of the class entropies (Kapur).
+	ThresholdMaxEntropy
+	// ThresholdMoments preserves the first three moments of the histogram (Tsai).
+	ThresholdMoments
+)
+
+// ThresholdOptions configures the histogram of the automatic threshold methods.
+type ThresholdOptions struct {
+	// Bins is the number of histogram bins between the smallest and largest
+	// intensity. Zero selects 256.
+	Bins int
+	// Mask restricts the histogram to voxels where it is non-zero. It must
+	// have the geometry of the image; nil uses every voxel.
+	Mask *Image
+}
+
+// ComputeThreshold computes an automatic threshold from the histogram of an
+// image. The histogram spans the intensity range of the image, so negative
+// values such as CT Hounsfield units are handled.
+//
+// Parameters:
+//   - image: The input image
+//   - method: One of ThresholdOtsu, ThresholdLi, ThresholdHuang, ThresholdTriangle, ThresholdYen,
+//     ThresholdIsoData, ThresholdKittlerIllingworth, ThresholdMaxEntropy and ThresholdMoments
+//   - options: The number of histogram bins and an optional mask
+//
+// Returns:
+//   - float64: The largest intensity of the background class; voxels above it are foreground
+//   - error: Error if the method or options are invalid, the image is complex or no voxel is selected
+func ComputeThreshold(image *Image, method int, options ThresholdOptions) (float64, error) {
+	hist, err := newThresholdHistogram(image, options)
+	if err != nil {
+		return 0, err
+	}
+	var bin int
+	switch method {
+	case ThresholdOtsu:
+		bin = otsuBin(hist.counts)
+	case ThresholdLi:
+		bin = liBin(hist.counts)
+	case ThresholdHuang:
+		bin = huangBin(hist.counts)
+	case ThresholdTriangle:
+		bin = triangleBin(hist.counts)
+	case ThresholdYen:
+		bin = yenBin(hist.counts)
+	case ThresholdIsoData:
+		bin = isoDataBin(hist.counts)
+	case ThresholdKittlerIllingworth:
+		bin = kittlerIllingworthBin(hist.counts)
+	case ThresholdMaxEntropy:
+		bin = maxEntropyBin(hist.counts)
+	case ThresholdMoments:
+		bin = momentsBin(hist.counts)
+	default:
+		return 0, fmt.Errorf("unsupported threshold method: %d", method)
+	}
+	return hist.threshold(bin), nil
+}
+
+// AutoThresholdImage segments an image with an automatic threshold.
+//
+// Parameters:
+//   - image: The input image
+//   - method: The threshold method, as for ComputeThreshold
+//   - options: The number of histogram bins and an optional mask
+//
+// Returns:
+//   - *Image: A UInt8 mask that is 1 above the threshold and inside options.Mask, and 0 elsewhere
+//   - error: Error if the threshold cannot be computed
+func AutoThresholdImage(image *Image, method int, options ThresholdOptions) (*Image, error) {
+	threshold, err := ComputeThreshold(image, method, options)
+	if err != nil {
+		return nil, err
+	}
+	mask, err := mapIntensities(image, PixelTypeUInt8, func(v float64) float64 {
+		if v > threshold {
+			return 1
+		}
+		return 0
+	})
+	if err != nil || options.Mask == nil {
+		return mask, err
+	}
+	return And(mask, options.Mask)
+}
+
+// MultiOtsuThresholds computes the thresholds that split the histogram of an
+// image into classes with the largest variance between them.
+//
+// Parameters:
+//   - image: The input image
+//   - classes: The number of classes, at least 2
+//   - options: The number of histogram bins and an optional mask
+//
+// Returns:
+//   - []float64: The classes-1 thresholds in increasing order, each the smallest intensity of the class above it
+//   - error: Error if classes or options are invalid, the image is complex, or
+//     fewer histogram bins than classes hold selected voxels
+//
+// Every class holds at least one voxel, so the thresholds are strictly
+// increasing. Pass them to Threshold to get a label map of the classes.
+func MultiOtsuThresholds(image *Image, classes int, options ThresholdOptions) ([]float64, error) {
+	if classes < 2 {
+		return nil, fmt.Errorf("invalid number of classes: %d", classes)
+	}
+	hist, err := newThresholdHistogram(image, options)
+	if err != nil {
+		return nil, err
+	}
+	occupied := 0
+	for _, count := range hist.counts {
+		if count > 0 {
+			occupied++
+		}
+	}
+	if classes > occupied {
+		return nil, fmt.Errorf("%d classes need at least as many distinct intensities in separate histogram bins, got %d of %d bins occupied", classes, occupied, len(hist.counts))
+	}
+	bins := multiOtsuBins(hist.counts, classes)
+	thresholds := make([]float64, len(bins))
+	for i, bin := range bins {
+		thresholds[i] = hist.cutoff(bin)
+	}
+	return thresholds, nil
+}
+
+// thresholdHistogram is a histogram whose bins are centred on evenly spaced
+// intensities from the smallest to the largest selected intensity.
+type thresholdHistogram struct {
+	counts []float64
+	// smallest and largest hold the smallest and largest intensity that fell
+	// into each bin.
+	smallest []float64
+	largest  []float64
+	lowest   float64
+	width    float64
+}
+
+// newThresholdHistogram computes the histogram of the real intensities of
+// image, ignoring NaN, infinite values and voxels outside options.Mask.
+func newThresholdHistogram(image *Image, options ThresholdOptions) (*thresholdHistogram, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	bins := options.Bins
+	if bins == 0 {
+		bins = 256
+	}
+	if bins < 2 {
+		return nil, fmt.Errorf("invalid number of histogram bins: %d", bins)
+	}
+	mask := options.Mask
+	if mask != nil {
+		if err := checkSameGeometry(image, mask); err != nil {
+			return nil, fmt.Errorf("invalid threshold mask: %v", err)
+		}
+	}
+	selected := func(i int) bool {
+		return mask == nil || mask.getLinearPixelAsComplex128(i) != 0
+	}
+
+	numValues := len(image.pixels) / image.bytesPerPixel
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for i := 0; i < numValues; i++ {
+		if v := image.getLinearPixelAsFloat64(i); isFinite(v) && selected(i) {
+			lowest = min(lowest, v)
+			highest = max(highest, v)
+		}
+	}
+	if lowest > highest {
+		return nil, fmt.Errorf("no voxels to compute a threshold from")
+	}
+
+	hist := &thresholdHistogram{
+		counts:   make([]float64, bins),
+		smallest: make([]float64, bins),
+		largest:  make([]float64, bins),
+		lowest:   lowest,
+		width:    (highest - lowest) / float64(bins-1),
+	}
+	for i := 0; i < numValues; i++ {
+		v := image.getLinearPixelAsFloat64(i)
+		if !isFinite(v) || !selected(i) {
+			continue
+		}
+		bin := 0
+		if hist.width > 0 {
+			bin = min(int(math.Round((v-lowest)/hist.width)), bins-1)
+		}
+		if hist.counts[bin] == 0 || v < hist.smallest[bin] {
+			hist.smallest[bin] = v
+		}
+		if hist.counts[bin] == 0 || v > hist.largest[bin] {
+			hist.largest[bin] = v
+		}
+		hist.counts[bin]++
+	}
+	return hist, nil
+}
+
+// threshold returns the largest intensity in the bins up to bin, so that
+// exactly the voxels in later bins lie above it.
+func (hist *thresholdHistogram) threshold(bin int) float64 {
+	for k := min(max(bin, 0), len(hist.counts)-1); k >= 0; k-- {
+		if hist.counts[k] > 0 {
+			return hist.largest[k]
+		}
+	}
+	return hist.lowest
+}
+
+// cutoff returns the smallest intensity in the bins after bin, so that
+// exactly the voxels in those bins lie at or above it, as Threshold expects.
+func (hist *thresholdHistogram) cutoff(bin int) float64 {
+	for k := max(bin+1, 0); k < len(hist.counts); k++ {
+		if hist.counts[k] > 0 {
+			return hist.smallest[k]
+		}
+	}
+	return math.Inf(1)
+}
+
+// The functions below return the last bin of the background class of a
+// histogram, following the reference implementations in ImageJ's Auto
+// Threshold plugin.
+
+// otsuBin maximizes the variance between the classes.
+func otsuBin(h []float64) int {
+	total, sum := 0.0, 0.0
+	for k, c := range h {
+		total += c
+		sum += float64(k) * c
+	}
+	best, bestVariance := 0, -1.0
+	wB, sumB := 0.0, 0.0
+	for t := 0; t < len(h)-1; t++ {
+		wB += h[t]
+		sumB += float64(t) * h[t]
+		wF := total - wB
+		if wB == 0 || wF == 0 {
+			continue
+		}
+		mB, mF := sumB/wB, (sum-sumB)/wF
+		if variance := wB * wF * (mB - mF) * (mB - mF); variance > bestVariance {
+			best, bestVariance = t, variance
+		}
+	}
+	return best
+}
+
+// multiOtsuBins maximizes the variance between classes contiguous bin ranges
+// by dynamic programming, which is equivalent to maximizing the sum of
+// S²/W over the classes for the class weights W and intensity sums S. Empty
+// classes are not allowed, so h must have at least classes nonzero bins.
+func multiOtsuBins(h []float64, classes int) []int {
+	n := len(h)
+	w := make([]float64, n+1)
+	s := make([]float64, n+1)
+	for k, c := range h {
+		w[k+1] = w[k] + c
+		s[k+1] = s[k] + float64(k)*c
+	}
+	score := func(a, b int) float64 {
+		if weight := w[b] - w[a]; weight > 0 {
+			sum := s[b] - s[a]
+			return sum * sum / weight
+		}
+		return math.Inf(-1)
+	}
+
+	// best[c][j] is the best score of c+1 classes covering bins [0, j), and
+	// start[c][j] is where the last of those classes starts.
+	best := make([][]float64, classes)
+	start := make([][]int, classes)
+	for c := range best {
+		best[c] = make([]float64, n+1)
+		start[c] = make([]int, n+1)
+	}
+	for j := 1; j <= n; j++ {
+		best[0][j] = score(0, j)
+	}
+	for c := 1; c < classes; c++ {
+		for j := c + 1; j <= n; j++ {
+			best[c][j] = math.Inf(-1)
+			for i := c; i < j; i++ {
+				if value := best[c-1][i] + score(i, j); value > best[c][j] {
+					best[c][j], start[c][j] = value, i
+				}
+			}
+		}
+	}
+
+	bins := make([]int, classes-1)
+	end := n
+	for c := classes - 1; c > 0; c-- {
+		end = start[c][end]
+		bins[c-1] = end - 1
+	}
+	return bins
+}
+
+// liBin minimizes the cross entropy iteratively. Bin k is treated as
+// intensity k+1 so that the logarithms of the class means are defined.
+func liBin(h []float64) int {
+	classMeans := func(t float64) (float64, float64, bool) {
+		var wB, sB, wF, sF float64
+		for k, c := range h {
+			if v := float64(k + 1); v <= t {
+				wB += c
+				sB += v * c
+			} else {
+				wF += c
+				sF += v * c
+			}
+		}
+		return sB / wB, sF / wF, wB > 0 && wF > 0
+	}
+	total, sum := 0.0, 0.0
+	for k, c := range h {
+		total += c
+		sum += float64(k+1) * c
+	}
+	t := sum / total
+	for iteration := 0; iteration < 1000; iteration++ {
+		mB, mF, ok := classMeans(t)
+		if !ok {
+			break
+		}
+		next := (mF - mB) / (math.Log(mF) - math.Log(mB))
+		if math.Abs(next-t) < 0.5 {
+			t = next
+			break
+		}
+		t = next
+	}
+	return int(math.Floor(t)) - 1
+}
+
+// huangBin minimizes the fuzzy entropy of the memberships of each bin in its class.
+func huangBin(h []float64) int {
+	first, last := nonZeroBins(h)
+	if first == last {
+		return first
+	}
+	w := make([]float64, len(h))
+	s := make([]float64, len(h))
+	for k := first; k <= last; k++ {
+		w[k], s[k] = h[k], float64(k)*h[k]
+		if k > first {
+			w[k] += w[k-1]
+			s[k] += s[k-1]
+		}
+	}
+	scale := 1 / float64(last-first)
+	entropy := func(mean float64, from, to int) float64 {
+		sum := 0.0
+		for k := from; k <= to; k++ {
+			mu := 1 / (1 + scale*math.Abs(float64(k)-mean))
+			if mu > 1e-6 && mu < 0.999999 {
+				sum += h[k] * (-mu*math.Log(mu) - (1-mu)*math.Log(1-mu))
+			}
+		}
+		return sum
+	}
+
+	best, bestEntropy := first, math.Inf(1)
+	for t := first; t < last; t++ {
+		mB := s[t] / w[t]
+		mF := (s[last] - s[t]) / (w[last] - w[t])
+		if value := entropy(mB, first, t) + entropy(mF, t+1, last); value < bestEntropy {
+			best, bestEntropy = t, value
+		}
+	}
+	return best
+}
+
+// triangleBin finds the bin farthest from the line between the histogram
+// peak and the end of its longer tail.
+func triangleBin(h []float64) int {
+	n := len(h)
+	first, last := nonZeroBins(h)
+	if first > 0 {
+		first--
+	}
+	if last < n-1 {
+		last++
+	}
+	peak := 0
+	for k, c := range h {
+		if c > h[peak] {
+			peak = k
+		}
+	}
+
+	// Put the longer tail on the left of the peak.
+	data := h
+	inverted := peak-first < last-peak
+	if inverted {
+		data = slices.Clone(h)
+		slices.Reverse(data)
+		first, peak = n-1-last, n-1-peak
+	}
+	split := first
+	if first != peak {
+		nx, ny := data[peak], float64(first-peak)
+		d := math.Hypot(nx, ny)
+		nx, ny = nx/d, ny/d
+		d = nx*float64(first) + ny*data[first]
+		splitDistance := 0.0
+		for k := first + 1; k <= peak; k++ {
+			if distance := nx*float64(k) + ny*data[k] - d; distance > splitDistance {
+				split, splitDistance = k, distance
+			}
+		}
+		split--
+	}
+	if inverted {
+		// The tail lies above the peak, so the background is below the mirrored split.
+		split = n - 1 - split
+	}
+	return min(max(split, 0), n-1)
+}
+
+// yenBin maximizes the entropic correlation of the classes.
+func yenBin(h []float64) int {
+	n := len(h)
+	total := 0.0
+	for _, c := range h {
+		total += c
+	}
+	p1 := make([]float64, n)
+	p1Squared := make([]float64, n)
+	p2Squared := make([]float64, n)
+	for k, c := range h {
+		p := c / total
+		p1[k], p1Squared[k] = p, p*p
+		if k > 0 {
+			p1[k] += p1[k-1]
+			p1Squared[k] += p1Squared[k-1]
+		}
+	}
+	for k := n - 2; k >= 0; k-- {
+		p := h[k+1] / total
+		p2Squared[k] = p2Squared[k+1] + p*p
+	}
+
+	best, bestCriterion := 0, math.Inf(-1)
+	for t := 0; t < n; t++ {
+		criterion := 0.0
+		if product := p1Squared[t] * p2Squared[t]; product > 0 {
+			criterion -= math.Log(product)
+		}
+		if product := p1[t] * (1 - p1[t]); product > 0 {
+			criterion += 2 * math.Log(product)
+		}
+		if criterion > bestCriterion {
+			best, bestCriterion = t, criterion
+		}
+	}
+	return best
+}
+
+// isoDataBin iterates until the threshold lies halfway between the class means.
+func isoDataBin(h []float64) int {
+	total, sum := 0.0, 0.0
+	for k, c := range h {
+		total += c
+		sum += float64(k) * c
+	}
+	t := int(sum / total)
+	for iteration := 0; iteration < 1000; iteration++ {
+		var wB, sB float64
+		for k := 0; k <= t; k++ {
+			wB += h[k]
+			sB += float64(k) * h[k]
+		}
+		wF := total - wB
+		if wB == 0 || wF == 0 {
+			break
+		}
+		next := int((sB/wB + (sum-sB)/wF) / 2)
+		if next == t {
+			break
+		}
+		t = next
+	}
+	return t
+}
+
+// kittlerIllingworthBin minimizes the classification error of a mixture of
+// two Gaussians fitted to the classes.
+func kittlerIllingworthBin(h []float64) int {
+	best, bestCriterion := 0, math.Inf(1)
+	var wB, sB, qB float64
+	var wT, sT, qT float64
+	for k, c := range h {
+		wT += c
+		sT += float64(k) * c
+		qT += float64(k) * float64(k) * c
+	}
+	for t := 0; t < len(h)-1; t++ {
+		wB += h[t]
+		sB += float64(t) * h[t]
+		qB += float64(t) * float64(t) * h[t]
+		wF, sF, qF := wT-wB, sT-sB, qT-qB
+		if wB == 0 || wF == 0 {
+			continue
+		}
+		// A uniform spread of 1/12 within each bin keeps the variance of
+		// classes of a single bin positive.
+		varianceB := qB/wB - (sB/wB)*(sB/wB) + 1.0/12
+		varianceF := qF/wF - (sF/wF)*(sF/wF) + 1.0/12
+		pB, pF := wB/wT, wF/wT
+		criterion := pB*math.Log(varianceB) + pF*math.Log(varianceF) - 2*(pB*math.Log(pB)+pF*math.Log(pF))
+		if criterion < bestCriterion {
+			best, bestCriterion = t, criterion
+		}
+	}
+	return best
+}
+
+// maxEntropyBin maximizes the sum of the entropies of the classes.
+func maxEntropyBin(h []float64) int {
+	total := 0.0
+	for _, c := range h {
+		total += c
+	}
+	entropy := func(from, to int, weight float64) float64 {
+		sum := 0.0
+		for k := from; k <= to; k++ {
+			if h[k] > 0 {
+				p := h[k] / weight
+				sum -= p * math.Log(p)
+			}
+		}
+		return sum
+	}
+
+	best, bestEntropy := 0, math.Inf(-1)
+	wB := 0.0
+	for t := 0; t < len(h)-1; t++ {
+		wB += h[t]
+		wF := total - wB
+		if wB == 0 || wF == 0 {
+			continue
+		}
+		if value := entropy(0, t, wB) + entropy(t+1, len(h)-1, wF); value > bestEntropy {
+			best, bestEntropy = t, value
+		}
+	}
+	return best
+}
+
+// momentsBin chooses the threshold for which a two-level image has the
+// first three moments of the histogram.
+func momentsBin(h []float64) int {
+	total := 0.0
+	for _, c := range h {
+		total += c
+	}
+	var m1, m2, m3 float64
+	for k, c := range h {
+		p, x := c/total, float64(k)
+		m1 += x * p
+		m2 += x * x * p
+		m3 += x * x * x * p
+	}
+	cd := m2 - m1*m1
+	if cd == 0 {
+		return int(m1)
+	}
+	c0 := (-m2*m2 + m1*m3) / cd
+	c1 := (m1*m2 - m3) / cd
+	root := math.Sqrt(c1*c1 - 4*c0)
+	z0, z1 := 0.5*(-c1-root), 0.5*(-c1+root)
+	// p0 is the fraction of the background class.
+	p0 := (z1 - m1) / (z1 - z0)
+
+	sum := 0.0
+	for k, c := range h {
+		sum += c / total
+		if sum > p0 {
+			return k
+		}
+	}
+	return len(h) - 1
+}
+
+// isFinite reports whether v is neither NaN nor infinite.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// nonZeroBins returns the first and last bins with a non-zero count.
+func nonZeroBins(h []float64) (int, int) {
+	first, last := 0, len(h)-1
+	for first < last && h[first] == 0 {
+		first++
+	}
+	for last > first && h[last] == 0 {
+		last--
+	}
+	return first, last
+}
@@ -0,0 +1,229 @@
+package imagetk
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// newClustersTestImage returns a 64x64 Float32 image whose rows are split
+// evenly between clusters of intensities spread around the given centres.
+func newClustersTestImage(t *testing.T, centres ...float64) *Image {
+	t.Helper()
+	img, err := NewImage([]uint32{64, 64}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	rowsPerCluster := 64 / len(centres)
+	for i := 0; i < int(img.NumPixels()); i++ {
+		centre := centres[min(i/64/rowsPerCluster, len(centres)-1)]
+		img.setLinearPixelFromFloat64(i, centre+rng.NormFloat64()*20)
+	}
+	return img
+}
+
+func TestComputeThreshold(t *testing.T) {
+	// Air and soft tissue in Hounsfield units.
+	img := newClustersTestImage(t, -1000, 40)
+	// Triangle and maximum entropy thresholds may cut into the tail of a
+	// cluster, so only the other methods are expected to separate them exactly.
+	methods := []struct {
+		name      string
+		method    int
+		separates bool
+	}{
+		{"otsu", ThresholdOtsu, true},
+		{"li", ThresholdLi, true},
+		{"huang", ThresholdHuang, true},
+		{"triangle", ThresholdTriangle, false},
+		{"yen", ThresholdYen, true},
+		{"isodata", ThresholdIsoData, true},
+		{"kittler-illingworth", ThresholdKittlerIllingworth, true},
+		{"max entropy", ThresholdMaxEntropy, false},
+		{"moments", ThresholdMoments, true},
+	}
+	for _, tt := range methods {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, bins := range []int{0, 64, 1000} {
+				threshold, err := ComputeThreshold(img, tt.method, ThresholdOptions{Bins: bins})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if threshold < -950 || threshold > -10 {
+					t.Errorf("%d bins: expected a threshold between the clusters, got %v", bins, threshold)
+				}
+			}
+
+			threshold, err := ComputeThreshold(img, tt.method, ThresholdOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mask, err := AutoThresholdImage(img, tt.method, ThresholdOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, value := range mask.pixels {
+				want := uint8(i / 64 / 32)
+				if !tt.separates {
+					want = 0
+					if img.getLinearPixelAsFloat64(i) > threshold {
+						want = 1
+					}
+				}
+				if value != want {
+					t.Fatalf("pixel %d: expected %d, got %d", i, want, value)
+				}
+			}
+		})
+	}
+}
+
+func TestThresholdOptions(t *testing.T) {
+	img := newClustersTestImage(t, 0, 100, 1000)
+
+	// Without the top rows only the two lower clusters remain.
+	roi, err := NewImage([]uint32{64, 64}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 64*42; i++ {
+		roi.pixels[i] = 1
+	}
+	threshold, err := ComputeThreshold(img, ThresholdOtsu, ThresholdOptions{Mask: roi})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threshold < 20 || threshold > 80 {
+		t.Errorf("expected a threshold between the masked clusters, got %v", threshold)
+	}
+	mask, err := AutoThresholdImage(img, ThresholdOtsu, ThresholdOptions{Mask: roi})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mask.pixels[64*63] != 0 || mask.pixels[64*30] != 1 {
+		t.Errorf("expected the mask to be limited to the region")
+	}
+
+	if _, err := ComputeThreshold(img, ThresholdOtsu, ThresholdOptions{Bins: 1}); err == nil {
+		t.Errorf("expected error for a single bin")
+	}
+	if _, err := ComputeThreshold(img, 42, ThresholdOptions{}); err == nil {
+		t.Errorf("expected error for an unknown method")
+	}
+	small, err := NewImage([]uint32{2, 2}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ComputeThreshold(img, ThresholdOtsu, ThresholdOptions{Mask: small}); err == nil {
+		t.Errorf("expected error for a mask of another size")
+	}
+	empty, err := NewImage([]uint32{64, 64}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ComputeThreshold(img, ThresholdOtsu, ThresholdOptions{Mask: empty}); err == nil {
+		t.Errorf("expected error for an empty mask")
+	}
+	if _, err := ComputeThreshold(newComplexTestImage(t), ThresholdOtsu, ThresholdOptions{}); err == nil {
+		t.Errorf("expected error for a complex image")
+	}
+
+	constant, err := NewImage([]uint32{3, 3}, PixelTypeInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []int{ThresholdOtsu, ThresholdLi, ThresholdTriangle, ThresholdMoments} {
+		if threshold, err := ComputeThreshold(constant, method, ThresholdOptions{}); err != nil || threshold != 0 {
+			t.Errorf("method %d: expected threshold 0 for a constant image, got %v (%v)", method, threshold, err)
+		}
+	}
+}
+
+func TestMultiOtsuThresholds(t *testing.T) {
+	img := newClustersTestImage(t, -1000, 0, 400, 1500)
+	thresholds, err := MultiOtsuThresholds(img, 4, ThresholdOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thresholds) != 3 {
+		t.Fatalf("expected 3 thresholds, got %v", thresholds)
+	}
+	for i, bounds := range [][2]float64{{-900, 0}, {100, 400}, {500, 1500}} {
+		if thresholds[i] < bounds[0] || thresholds[i] > bounds[1] {
+			t.Errorf("threshold %d: expected a value in %v, got %v", i, bounds, thresholds[i])
+		}
+	}
+
+	labels, err := Threshold(img, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range labels.pixels {
+		if want := uint8(i / 64 / 16); value != want {
+			t.Fatalf("pixel %d: expected label %d, got %d", i, want, value)
+		}
+	}
+
+	two, err := MultiOtsuThresholds(img, 2, ThresholdOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoLabels, err := Threshold(img, two)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otsu, err := AutoThresholdImage(img, ThresholdOtsu, ThresholdOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(twoLabels.pixels, otsu.pixels) {
+		t.Errorf("expected two classes to match Otsu's threshold")
+	}
+	if _, err := MultiOtsuThresholds(img, 1, ThresholdOptions{}); err == nil {
+		t.Errorf("expected error for a single class")
+	}
+	if _, err := MultiOtsuThresholds(img, 5, ThresholdOptions{Bins: 4}); err == nil {
+		t.Errorf("expected error for more classes than bins")
+	}
+}
+
+func TestMultiOtsuThresholdsSparse(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []float64
+		bins    int
+		wantErr bool
+	}{
+		{name: "enough bins", values: []float64{0, 1, 2, 3, 0, 0, 0, 100}},
+		{name: "empty bins", values: []float64{0, 1, 2, 3, 0, 0, 0, 100}, bins: 4, wantErr: true},
+		{name: "two values", values: []float64{10, 10, 10, 10, 20, 20, 20, 20}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := NewImage([]uint32{uint32(len(tt.values)), 1}, PixelTypeFloat32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, v := range tt.values {
+				img.setLinearPixelFromFloat64(i, v)
+			}
+			thresholds, err := MultiOtsuThresholds(img, 3, ThresholdOptions{Bins: tt.bins})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got thresholds %v", thresholds)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(thresholds) != 2 || thresholds[1] != 100 {
+				t.Errorf("expected 2 thresholds ending at 100, got %v", thresholds)
+			}
+			if _, err := Threshold(img, thresholds); err != nil {
+				t.Errorf("thresholds %v rejected by Threshold: %v", thresholds, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package imagetk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"sort"
+)
+
+// PNGWriteOptions controls how pixel values are mapped to PNG intensities.
+type PNGWriteOptions struct {
+	// BitDepth is the PNG bit depth, 8 or 16. Zero selects 16 for 16-bit pixel types and 8 otherwise.
+	BitDepth int
+	// WindowMin and WindowMax give an explicit intensity window mapped to the full output
+	// range. The window is computed from percentiles when WindowMax is not greater than WindowMin.
+	WindowMin float64
+	WindowMax float64
+	// LowerPercentile and UpperPercentile give the window as percentiles of the pixel
+	// values, between 0 and 1. Both zero selects the full range from 0 to 1.
+	LowerPercentile float64
+	UpperPercentile float64
+}
+
+// decodeBitmap decodes a PNG, JPEG, GIF or BMP file.
+func decodeBitmap(filename string) (image.Image, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image file: %v", err)
+	}
+	if bytes.HasPrefix(data, []byte("BM")) {
+		return decodeBMP(data)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image file: %v", err)
+	}
+	return src, nil
+}
+
+// isBitmap16Bit reports whether the decoded image holds 16-bit samples.
+func isBitmap16Bit(src image.Image) bool {
+	switch src.ColorModel() {
+	case color.Gray16Model, color.RGBA64Model, color.NRGBA64Model, color.Alpha16Model:
+		return true
+	default:
+		return false
+	}
+}
+
+func readImageTypeBitmap(filename string) (*Image, error) {
+	src, err := decodeBitmap(filename)
+	if err != nil {
+		return nil, err
+	}
+	return newGrayImageFromBitmap(src)
+}
+
+// newGrayImageFromBitmap converts a decoded image to a grayscale Image, keeping
+// 16-bit precision if the source has it.
+func newGrayImageFromBitmap(src image.Image) (*Image, error) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	sixteenBit := isBitmap16Bit(src)
+	pixelType := PixelTypeUInt8
+	if sixteenBit {
+		pixelType = PixelTypeUInt16
+	}
+	img, err := NewImage([]uint32{uint32(width), uint32(height)}, pixelType)
+	if err != nil {
+		return nil, err
+	}
+
+	switch src := src.(type) {
+	case *image.Gray:
+		for y := 0; y < height; y++ {
+			copy(img.pixels[y*width:(y+1)*width], src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):])
+		}
+		return img, nil
+	case *image.Gray16:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				i := src.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+				binary.LittleEndian.PutUint16(img.pixels[(y*width+x)*2:], uint16(src.Pix[i])<<8|uint16(src.Pix[i+1]))
+			}
+		}
+		return img, nil
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			c := src.At(bounds.Min.X+x, bounds.Min.Y+y)
+			if sixteenBit {
+				binary.LittleEndian.PutUint16(img.pixels[i*2:], color.Gray16Model.Convert(c).(color.Gray16).Y)
+			} else {
+				img.pixels[i] = color.GrayModel.Convert(c).(color.Gray).Y
+			}
+		}
+	}
+	return img, nil
+}
+
+// ReadImageChannels reads a PNG, JPEG, GIF or BMP file into one 2D image per
+// color channel.
+//
+// Parameters:
+//   - filename: Path to the image file to read
+//
+// Returns:
+//   - []*Image: The channel images; a single image for grayscale files, otherwise red,
+//     green and blue, followed by alpha if the file is not fully opaque
+//   - error: Error if reading fails
+//
+// Channels are UInt16 for 16-bit files and UInt8 otherwise. Color values are not
+// premultiplied by alpha.
+func ReadImageChannels(filename string) ([]*Image, error) {
+	src, err := decodeBitmap(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch src.ColorModel() {
+	case color.GrayModel, color.Gray16Model:
+		img, err := newGrayImageFromBitmap(src)
+		if err != nil {
+			return nil, err
+		}
+		return []*Image{img}, nil
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	numChannels := 4
+	if opaque, ok := src.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		numChannels = 3
+	}
+	pixelType := PixelTypeUInt8
+	if isBitmap16Bit(src) {
+		pixelType = PixelTypeUInt16
+	}
+	channels := make([]*Image, numChannels)
+	for i := range channels {
+		if channels[i], err = NewImage([]uint32{uint32(width), uint32(height)}, pixelType); err != nil {
+			return nil, err
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA64Model.Convert(src.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA64)
+			values := [4]uint16{c.R, c.G, c.B, c.A}
+			for k, channel := range channels {
+				if pixelType == PixelTypeUInt16 {
+					binary.LittleEndian.PutUint16(channel.pixels[(y*width+x)*2:], values[k])
+				} else {
+					channel.pixels[y*width+x] = uint8(values[k] >> 8)
+				}
+			}
+		}
+	}
+	return channels, nil
+}
+
+// WritePNG writes a 2D image as a grayscale PNG file, mapping the pixel values
+// in an intensity window linearly to the output range.
+//
+// Parameters:
+//   - img: The image to write
+//   - filename: Path to the output file
+//   - options: The bit depth and intensity window
+//
+// Returns:
+//   - error: Error if writing fails
+//
+// Values below the window map to black and values above it to white.
+func WritePNG(img *Image, filename string, options PNGWriteOptions) error {
+	if img.dimension != 2 {
+		return fmt.Errorf("PNG files can only hold 2D images")
+	}
+	if img.GetNumberOfComponentsPerPixel() > 1 {
+		return fmt.Errorf("writing multi-component images to PNG files is not supported")
+	}
+	if isComplexPixelType(img.pixelType) {
+		return fmt.Errorf("writing complex images to PNG files is not supported")
+	}
+	bitDepth := options.BitDepth
+	if bitDepth == 0 {
+		bitDepth = 8
+		if img.pixelType == PixelTypeUInt16 || img.pixelType == PixelTypeInt16 {
+			bitDepth = 16
+		}
+	}
+	if bitDepth != 8 && bitDepth != 16 {
+		return fmt.Errorf("unsupported PNG bit depth: %d", bitDepth)
+	}
+
+	low, high := options.WindowMin, options.WindowMax
+	if high <= low {
+		lower, upper := options.LowerPercentile, options.UpperPercentile
+		if lower == 0 && upper == 0 {
+			upper = 1
+		}
+		if lower < 0 || upper > 1 || lower > upper {
+			return fmt.Errorf("invalid percentile window: %v to %v", lower, upper)
+		}
+		low, high = img.getPercentiles(lower, upper)
+	}
+
+	width, height := int(img.size[0]), int(img.size[1])
+	maxOutput := float64(int(1)<<bitDepth - 1)
+	mapValue := func(value float64) float64 {
+		if high <= low {
+			if value > low {
+				return maxOutput
+			}
+			return 0
+		}
+		return math.Round(math.Max(0, math.Min(1, (value-low)/(high-low))) * maxOutput)
+	}
+
+	var dst image.Image
+	if bitDepth == 8 {
+		gray := image.NewGray(image.Rect(0, 0, width, height))
+		for i := range gray.Pix {
+			gray.Pix[i] = uint8(mapValue(img.getLinearPixelAsFloat64(i)))
+		}
+		dst = gray
+	} else {
+		gray := image.NewGray16(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			binary.BigEndian.PutUint16(gray.Pix[i*2:], uint16(mapValue(img.getLinearPixelAsFloat64(i))))
+		}
+		dst = gray
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create PNG file: %v", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	if err := png.Encode(writer, dst); err != nil {
+		return fmt.Errorf("failed to encode PNG file: %v", err)
+	}
+	return writer.Flush()
+}
+
+// saveImageTypePNG writes UInt8 and UInt16 images unchanged and maps other
+// pixel types from their full range to 8 bits.
+func (img *Image) saveImageTypePNG(filename string) error {
+	options := PNGWriteOptions{}
+	switch img.pixelType {
+	case PixelTypeUInt8:
+		options = PNGWriteOptions{BitDepth: 8, WindowMin: 0, WindowMax: math.MaxUint8}
+	case PixelTypeUInt16:
+		options = PNGWriteOptions{BitDepth: 16, WindowMin: 0, WindowMax: math.MaxUint16}
+	default:
+		options.BitDepth = 8
+	}
+	return WritePNG(img, filename, options)
+}
+
+// getPercentiles returns the pixel values at two percentiles between 0 and 1,
+// interpolating linearly between the sorted values.
+func (img *Image) getPercentiles(lower, upper float64) (float64, float64) {
+	numPixels := int(img.NumPixels())
+	values := make([]float64, numPixels)
+	for i := range values {
+		values[i] = img.getLinearPixelAsFloat64(i)
+	}
+	sort.Float64s(values)
+	percentile := func(p float64) float64 {
+		position := p * float64(numPixels-1)
+		index := int(position)
+		if index >= numPixels-1 {
+			return values[numPixels-1]
+		}
+		return values[index] + (position-float64(index))*(values[index+1]-values[index])
+	}
+	return percentile(lower), percentile(upper)
+}
@@ -0,0 +1,180 @@
+package imagetk
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestBitmap(t *testing.T, filename string, encode func(*os.File) error) {
+	t.Helper()
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := encode(file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadBitmap(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_bitmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	gray := image.NewGray(image.Rect(0, 0, 3, 2))
+	gray16 := image.NewGray16(image.Rect(0, 0, 3, 2))
+	rgba := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	palette := color.Palette{color.RGBA{0, 0, 0, 255}, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	paletted := image.NewPaletted(image.Rect(0, 0, 3, 2), palette)
+	for i := 0; i < 6; i++ {
+		x, y := i%3, i/3
+		gray.SetGray(x, y, color.Gray{Y: uint8(i * 40)})
+		gray16.SetGray16(x, y, color.Gray16{Y: uint16(i * 10000)})
+		rgba.SetNRGBA(x, y, color.NRGBA{R: uint8(i), G: uint8(i * 2), B: uint8(i * 3), A: uint8(255 - i)})
+		paletted.SetColorIndex(x, y, uint8(i%3))
+	}
+	grayPNG := filepath.Join(tempDir, "gray.png")
+	gray16PNG := filepath.Join(tempDir, "gray16.png")
+	rgbaPNG := filepath.Join(tempDir, "rgba.png")
+	grayJPEG := filepath.Join(tempDir, "gray.jpg")
+	palettedGIF := filepath.Join(tempDir, "paletted.gif")
+	writeTestBitmap(t, grayPNG, func(f *os.File) error { return png.Encode(f, gray) })
+	writeTestBitmap(t, gray16PNG, func(f *os.File) error { return png.Encode(f, gray16) })
+	writeTestBitmap(t, rgbaPNG, func(f *os.File) error { return png.Encode(f, rgba) })
+	writeTestBitmap(t, grayJPEG, func(f *os.File) error { return jpeg.Encode(f, gray, &jpeg.Options{Quality: 100}) })
+	writeTestBitmap(t, palettedGIF, func(f *os.File) error { return gif.Encode(f, paletted, nil) })
+
+	tests := []struct {
+		name        string
+		filename    string
+		imageType   int
+		pixelType   int
+		numChannels int
+		index       []uint32
+		expected    float64
+		tolerance   float64
+	}{
+		{"gray png", grayPNG, ImageTypePNG, PixelTypeUInt8, 1, []uint32{2, 1}, 200, 0},
+		{"gray16 png", gray16PNG, ImageTypePNG, PixelTypeUInt16, 1, []uint32{1, 1}, 40000, 0},
+		{"rgba png", rgbaPNG, ImageTypePNG, PixelTypeUInt8, 4, []uint32{0, 0}, 0, 0},
+		{"gray jpeg", grayJPEG, ImageTypeJPEG, PixelTypeUInt8, 1, []uint32{2, 1}, 200, 2},
+		{"paletted gif", palettedGIF, ImageTypeGIF, PixelTypeUInt8, 3, []uint32{1, 0}, 76, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := ReadImage(tt.filename, tt.imageType, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if img.GetPixelType() != tt.pixelType || img.GetDimension() != 2 || img.GetSize()[0] != 3 || img.GetSize()[1] != 2 {
+				t.Fatalf("expected 3x2 image of pixel type %d, got %v of pixel type %d", tt.pixelType, img.GetSize(), img.GetPixelType())
+			}
+			value, err := img.GetPixelAsFloat64(tt.index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !almostEqual(value, tt.expected, tt.tolerance) {
+				t.Errorf("pixel %v: expected %v, got %v", tt.index, tt.expected, value)
+			}
+			channels, err := ReadImageChannels(tt.filename)
+			if err != nil {
+				t.Fatalf("failed to read channels: %v", err)
+			}
+			if len(channels) != tt.numChannels {
+				t.Errorf("expected %d channels, got %d", tt.numChannels, len(channels))
+			}
+		})
+	}
+
+	channels, err := ReadImageChannels(rgbaPNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, expected := range []uint8{5, 10, 15, 250} {
+		if value, _ := channels[k].GetPixelAsUInt8([]uint32{2, 1}); value != expected {
+			t.Errorf("channel %d: expected %d, got %d", k, expected, value)
+		}
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_bitmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img, err := NewImage([]uint32{5, 2}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		img.setLinearPixelFromFloat64(i, float64(i)*10-20)
+	}
+
+	tests := []struct {
+		name      string
+		options   PNGWriteOptions
+		pixelType int
+		expected  []float64
+	}{
+		{"full range", PNGWriteOptions{}, PixelTypeUInt8, []float64{0, 28, 57, 85, 113, 142, 170, 198, 227, 255}},
+		{"explicit window", PNGWriteOptions{WindowMin: 0, WindowMax: 40}, PixelTypeUInt8, []float64{0, 0, 0, 64, 128, 191, 255, 255, 255, 255}},
+		{"percentile window 16 bit", PNGWriteOptions{BitDepth: 16, LowerPercentile: 0.25, UpperPercentile: 0.75}, PixelTypeUInt16, []float64{0, 0, 0, 10923, 25486, 40049, 54613, 65535, 65535, 65535}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, "test.png")
+			if err := WritePNG(img, filename, tt.options); err != nil {
+				t.Fatalf("failed to write PNG: %v", err)
+			}
+			readImg, err := ReadImage(filename, ImageTypePNG, nil)
+			if err != nil {
+				t.Fatalf("failed to read PNG: %v", err)
+			}
+			if readImg.GetPixelType() != tt.pixelType {
+				t.Fatalf("expected pixel type %d, got %d", tt.pixelType, readImg.GetPixelType())
+			}
+			for i, expected := range tt.expected {
+				if value := readImg.getLinearPixelAsFloat64(i); value != expected {
+					t.Errorf("pixel %d: expected %v, got %v", i, expected, value)
+				}
+			}
+		})
+	}
+
+	// UInt16 images are saved without remapping.
+	img16, err := NewImage([]uint32{2, 2}, PixelTypeUInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img16.SetPixels([]uint16{1, 300, 40000, 65535})
+	filename := filepath.Join(tempDir, "test16.png")
+	if err := img16.Save(filename, ImageTypePNG); err != nil {
+		t.Fatalf("failed to save PNG: %v", err)
+	}
+	readImg, err := ReadImage(filename, ImageTypePNG, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readImg.pixels, img16.pixels) {
+		t.Errorf("pixel data mismatch")
+	}
+
+	if err := WritePNG(newNIfTITestImage(t), filename, PNGWriteOptions{}); err == nil {
+		t.Errorf("expected error writing a 3D image")
+	}
+	if err := WritePNG(img, filename, PNGWriteOptions{BitDepth: 12}); err == nil {
+		t.Errorf("expected error for unsupported bit depth")
+	}
+}
@@ -0,0 +1,174 @@
+package imagetk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+)
+
+const (
+	bmpCompressionRGB            = 0
+	bmpCompressionBitFields      = 3
+	bmpCompressionAlphaBitFields = 6
+)
+
+// decodeBMP decodes an uncompressed Windows bitmap with 1, 4, 8, 16, 24 or 32
+// bits per pixel. Palette images with only gray entries are returned as
+// *image.Gray, other palette images as *image.Paletted and the rest as *image.NRGBA.
+func decodeBMP(data []byte) (image.Image, error) {
+	if len(data) < 26 || string(data[0:2]) != "BM" {
+		return nil, fmt.Errorf("not a BMP file")
+	}
+	dataOffset := int(binary.LittleEndian.Uint32(data[10:]))
+	headerSize := int(binary.LittleEndian.Uint32(data[14:]))
+	if 14+headerSize > len(data) || headerSize < 12 {
+		return nil, fmt.Errorf("invalid BMP header size: %d", headerSize)
+	}
+
+	var width, height, bitsPerPixel, compression, colorsUsed int
+	paletteEntrySize := 4
+	if headerSize == 12 {
+		width = int(binary.LittleEndian.Uint16(data[18:]))
+		height = int(binary.LittleEndian.Uint16(data[20:]))
+		bitsPerPixel = int(binary.LittleEndian.Uint16(data[24:]))
+		paletteEntrySize = 3
+	} else {
+		if headerSize < 40 {
+			return nil, fmt.Errorf("invalid BMP header size: %d", headerSize)
+		}
+		width = int(int32(binary.LittleEndian.Uint32(data[18:])))
+		height = int(int32(binary.LittleEndian.Uint32(data[22:])))
+		bitsPerPixel = int(binary.LittleEndian.Uint16(data[28:]))
+		compression = int(binary.LittleEndian.Uint32(data[30:]))
+		colorsUsed = int(binary.LittleEndian.Uint32(data[46:]))
+	}
+	topDown := height < 0
+	if topDown {
+		height = -height
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid BMP image size: %dx%d", width, height)
+	}
+
+	// Channel masks come from the header, or follow a 40-byte header.
+	var masks [4]uint32
+	switch compression {
+	case bmpCompressionRGB:
+		switch bitsPerPixel {
+		case 16:
+			masks = [4]uint32{0x7C00, 0x03E0, 0x001F, 0}
+		case 24, 32:
+			masks = [4]uint32{0xFF0000, 0x00FF00, 0x0000FF, 0}
+		}
+	case bmpCompressionBitFields, bmpCompressionAlphaBitFields:
+		if bitsPerPixel != 16 && bitsPerPixel != 32 {
+			return nil, fmt.Errorf("invalid BMP bit fields for %d bits per pixel", bitsPerPixel)
+		}
+		numMasks := 3
+		if compression == bmpCompressionAlphaBitFields || headerSize >= 56 {
+			numMasks = 4
+		}
+		if 14+40+numMasks*4 > len(data) {
+			return nil, fmt.Errorf("BMP file is truncated")
+		}
+		for i := 0; i < numMasks; i++ {
+			masks[i] = binary.LittleEndian.Uint32(data[54+i*4:])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported BMP compression: %d", compression)
+	}
+
+	rowSize := (bitsPerPixel*width + 31) / 32 * 4
+	if dataOffset < 14+headerSize || dataOffset+rowSize*height > len(data) {
+		return nil, fmt.Errorf("BMP file is truncated")
+	}
+	row := func(y int) []byte {
+		if !topDown {
+			y = height - 1 - y
+		}
+		return data[dataOffset+y*rowSize : dataOffset+(y+1)*rowSize]
+	}
+
+	switch bitsPerPixel {
+	case 1, 4, 8:
+		numColors := colorsUsed
+		if numColors == 0 || numColors > 1<<bitsPerPixel {
+			numColors = 1 << bitsPerPixel
+		}
+		paletteOffset := 14 + headerSize
+		if paletteOffset+numColors*paletteEntrySize > dataOffset {
+			return nil, fmt.Errorf("BMP palette is truncated")
+		}
+		palette := make(color.Palette, numColors)
+		gray := true
+		for i := range palette {
+			entry := data[paletteOffset+i*paletteEntrySize:]
+			palette[i] = color.RGBA{R: entry[2], G: entry[1], B: entry[0], A: 0xFF}
+			gray = gray && entry[0] == entry[1] && entry[1] == entry[2]
+		}
+
+		indices := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		pixelsPerByte := 8 / bitsPerPixel
+		for y := 0; y < height; y++ {
+			line := row(y)
+			for x := 0; x < width; x++ {
+				shift := uint(8 - bitsPerPixel*(x%pixelsPerByte+1))
+				index := line[x/pixelsPerByte] >> shift & byte(1<<bitsPerPixel-1)
+				if int(index) >= numColors {
+					return nil, fmt.Errorf("BMP palette index out of range: %d", index)
+				}
+				indices.Pix[y*indices.Stride+x] = index
+			}
+		}
+		if !gray {
+			return indices, nil
+		}
+		grayImage := image.NewGray(indices.Rect)
+		for i, index := range indices.Pix {
+			grayImage.Pix[i] = palette[index].(color.RGBA).R
+		}
+		return grayImage, nil
+
+	case 16, 24, 32:
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		bytesPerPixel := bitsPerPixel / 8
+		for y := 0; y < height; y++ {
+			line := row(y)
+			for x := 0; x < width; x++ {
+				var value uint32
+				switch bytesPerPixel {
+				case 2:
+					value = uint32(binary.LittleEndian.Uint16(line[x*2:]))
+				case 3:
+					value = uint32(line[x*3]) | uint32(line[x*3+1])<<8 | uint32(line[x*3+2])<<16
+				case 4:
+					value = binary.LittleEndian.Uint32(line[x*4:])
+				}
+				i := y*dst.Stride + x*4
+				for c := 0; c < 3; c++ {
+					dst.Pix[i+c] = extractBMPChannel(value, masks[c])
+				}
+				dst.Pix[i+3] = 0xFF
+				if masks[3] != 0 {
+					dst.Pix[i+3] = extractBMPChannel(value, masks[3])
+				}
+			}
+		}
+		return dst, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported BMP bits per pixel: %d", bitsPerPixel)
+	}
+}
+
+// extractBMPChannel returns the masked bits of value scaled to 8 bits.
+func extractBMPChannel(value, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	maxValue := mask >> uint(shift)
+	return uint8((uint64(value&mask>>uint(shift))*0xFF + uint64(maxValue)/2) / uint64(maxValue))
+}
@@ -0,0 +1,114 @@
+package imagetk
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encodeTestBMP builds a bitmap with a 40-byte or larger info header followed
+// by the extra bytes (masks or palette) and the rows as given.
+func encodeTestBMP(headerSize int, width, height int32, bitsPerPixel uint16, compression uint32, extra []byte, rows []byte) []byte {
+	dataOffset := 14 + headerSize + len(extra)
+	data := []byte("BM")
+	data = binary.LittleEndian.AppendUint32(data, uint32(dataOffset+len(rows)))
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, uint32(dataOffset))
+	header := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(header[0:], uint32(headerSize))
+	binary.LittleEndian.PutUint32(header[4:], uint32(width))
+	binary.LittleEndian.PutUint32(header[8:], uint32(height))
+	binary.LittleEndian.PutUint16(header[12:], 1)
+	binary.LittleEndian.PutUint16(header[14:], bitsPerPixel)
+	binary.LittleEndian.PutUint32(header[16:], compression)
+	if bitsPerPixel <= 8 {
+		binary.LittleEndian.PutUint32(header[32:], uint32(len(extra)/4))
+	}
+	data = append(data, header...)
+	data = append(data, extra...)
+	return append(data, rows...)
+}
+
+func TestReadBMP(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	grayPalette := []byte{0, 0, 0, 0, 100, 100, 100, 0, 200, 200, 200, 0}
+	colorPalette := []byte{0, 0, 0, 0, 0, 0, 255, 0, 255, 0, 0, 0}
+	masks565 := binary.LittleEndian.AppendUint32(nil, 0xF800)
+	masks565 = binary.LittleEndian.AppendUint32(masks565, 0x07E0)
+	masks565 = binary.LittleEndian.AppendUint32(masks565, 0x001F)
+
+	// Each image is 3x2; rows are padded to 4 bytes and stored bottom-up for a
+	// positive height. The expected values are the red channel, row by row.
+	tests := []struct {
+		name     string
+		data     []byte
+		channels int
+		expected []uint8
+	}{
+		{
+			name:     "24-bit",
+			data:     encodeTestBMP(40, 3, 2, 24, bmpCompressionRGB, nil, []byte{0, 0, 40, 0, 0, 50, 0, 0, 60, 0, 0, 0, 0, 0, 10, 0, 0, 20, 0, 0, 30, 0, 0, 0}),
+			channels: 3,
+			expected: []uint8{10, 20, 30, 40, 50, 60},
+		},
+		{
+			name:     "8-bit gray palette top-down",
+			data:     encodeTestBMP(40, 3, -2, 8, bmpCompressionRGB, grayPalette, []byte{0, 1, 2, 0, 2, 1, 0, 0}),
+			channels: 1,
+			expected: []uint8{0, 100, 200, 200, 100, 0},
+		},
+		{
+			name:     "4-bit color palette",
+			data:     encodeTestBMP(40, 3, 2, 4, bmpCompressionRGB, colorPalette, []byte{0x21, 0x00, 0, 0, 0x12, 0x00, 0, 0}),
+			channels: 3,
+			expected: []uint8{255, 0, 0, 0, 255, 0},
+		},
+		{
+			name:     "16-bit bit fields",
+			data:     encodeTestBMP(40, 3, 2, 16, bmpCompressionBitFields, masks565, []byte{0, 0xF8, 0, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}),
+			channels: 3,
+			expected: []uint8{0, 0, 0, 255, 132, 0},
+		},
+		{
+			name:     "32-bit alpha in V4 header",
+			data:     encodeTestBMP(108, 3, 2, 32, bmpCompressionRGB, nil, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24}),
+			channels: 3,
+			expected: []uint8{15, 19, 23, 3, 7, 11},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, "test.bmp")
+			if err := os.WriteFile(filename, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			channels, err := ReadImageChannels(filename)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if len(channels) != tt.channels {
+				t.Fatalf("expected %d channels, got %d", tt.channels, len(channels))
+			}
+			for i, expected := range tt.expected {
+				if channels[0].pixels[i] != expected {
+					t.Errorf("pixel %d: expected %d, got %d", i, expected, channels[0].pixels[i])
+				}
+			}
+		})
+	}
+
+	invalid := encodeTestBMP(40, 3, 2, 8, 1, grayPalette, make([]byte, 8))
+	filename := filepath.Join(tempDir, "rle.bmp")
+	if err := os.WriteFile(filename, invalid, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadImage(filename, ImageTypeBMP, nil); err == nil {
+		t.Errorf("expected error for RLE compression")
+	}
+}
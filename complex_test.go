@@ -0,0 +1,269 @@
+package imagetk
+
+import (
+	"bytes"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newComplexTestImage returns a 4x3x2 Complex128 image with distinct values.
+func newComplexTestImage(t *testing.T) *Image {
+	t.Helper()
+	img := newTestImage(t, []uint32{4, 3, 2}, PixelTypeComplex128, 1, nil)
+	for i := 0; i < int(img.NumPixels()); i++ {
+		img.setLinearComplexPixel(i, complex(float64(i)-5, 0.5*float64(i)))
+	}
+	return img
+}
+
+func TestComplexImage(t *testing.T) {
+	tests := []struct {
+		pixelType     int
+		bytesPerPixel int
+		value         any
+	}{
+		{PixelTypeComplex64, 8, complex64(complex(1.5, -2))},
+		{PixelTypeComplex128, 16, complex(1.5, -2)},
+	}
+	for _, tt := range tests {
+		img, err := NewImage([]uint32{3, 2}, tt.pixelType)
+		if err != nil {
+			t.Fatalf("failed to create image: %v", err)
+		}
+		if len(img.pixels) != 6*tt.bytesPerPixel {
+			t.Errorf("pixel type %d: expected %d bytes, got %d", tt.pixelType, 6*tt.bytesPerPixel, len(img.pixels))
+		}
+		if err := img.SetPixel([]uint32{2, 1}, tt.value); err != nil {
+			t.Fatalf("failed to set pixel: %v", err)
+		}
+		value, err := img.GetPixel([]uint32{2, 1})
+		if err != nil {
+			t.Fatalf("failed to get pixel: %v", err)
+		}
+		if value != tt.value {
+			t.Errorf("pixel type %d: expected %v, got %v", tt.pixelType, tt.value, value)
+		}
+	}
+
+	if _, err := getValueAsPixelType(complex(1, 1), PixelTypeFloat64); err == nil {
+		t.Errorf("expected error converting a complex value to a real pixel type")
+	}
+	if value, err := getValueAsPixelType(3, PixelTypeComplex64); err != nil || value != complex64(3) {
+		t.Errorf("expected complex64(3), got %v (%v)", value, err)
+	}
+}
+
+func TestComplexAsType(t *testing.T) {
+	img := newComplexTestImage(t)
+
+	single, err := img.AsType(PixelTypeComplex64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single.GetPixelType() != PixelTypeComplex64 || len(single.pixels) != 8*int(img.NumPixels()) {
+		t.Fatalf("expected Complex64 pixel data")
+	}
+	realImg, err := img.AsType(PixelTypeInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := realImg.AsType(PixelTypeComplex128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(img.NumPixels()); i++ {
+		want := img.getLinearPixelAsComplex128(i)
+		if got := single.getLinearPixelAsComplex128(i); got != want {
+			t.Errorf("pixel %d: expected %v as Complex64, got %v", i, want, got)
+		}
+		if got := realImg.getLinearPixelAsFloat64(i); got != real(want) {
+			t.Errorf("pixel %d: expected real part %v, got %v", i, real(want), got)
+		}
+		if got := back.getLinearPixelAsComplex128(i); got != complex(real(want), 0) {
+			t.Errorf("pixel %d: expected %v, got %v", i, complex(real(want), 0), got)
+		}
+	}
+	if !reflect.DeepEqual(back.GetSpacing(), img.GetSpacing()) || !reflect.DeepEqual(back.GetOrigin(), img.GetOrigin()) {
+		t.Errorf("AsType did not preserve the geometry")
+	}
+}
+
+func TestComplexArray(t *testing.T) {
+	data := [][]complex64{
+		{1 + 2i, 3 - 1i},
+		{-4i, 5},
+	}
+	img, err := GetImageFromArray(data)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	if img.GetPixelType() != PixelTypeComplex64 {
+		t.Fatalf("expected PixelTypeComplex64, got %d", img.GetPixelType())
+	}
+	array, err := GetArrayFromImage(img)
+	if err != nil {
+		t.Fatalf("failed to get array: %v", err)
+	}
+	if !reflect.DeepEqual(array, data) {
+		t.Errorf("expected %v, got %v", data, array)
+	}
+
+	img128, err := GetImageFromArray([][]complex128{{1i, 2}, {3, 4i}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := img128.GetPixel([]uint32{0, 0}); value != 1i {
+		t.Errorf("expected 1i, got %v", value)
+	}
+}
+
+func TestComplexParts(t *testing.T) {
+	img := newComplexTestImage(t)
+	realImg, err := img.Real()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imagImg, err := img.Imag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	magnitude, err := img.Magnitude()
+	if err != nil {
+		t.Fatal(err)
+	}
+	phase, err := img.Phase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []*Image{realImg, imagImg, magnitude, phase} {
+		if part.GetPixelType() != PixelTypeFloat64 || !reflect.DeepEqual(part.GetSpacing(), img.GetSpacing()) {
+			t.Fatalf("expected a Float64 image with the input geometry")
+		}
+	}
+	for i := 0; i < int(img.NumPixels()); i++ {
+		value := img.getLinearPixelAsComplex128(i)
+		if got := realImg.getLinearPixelAsFloat64(i); got != real(value) {
+			t.Errorf("pixel %d: expected real part %v, got %v", i, real(value), got)
+		}
+		if got := imagImg.getLinearPixelAsFloat64(i); got != imag(value) {
+			t.Errorf("pixel %d: expected imaginary part %v, got %v", i, imag(value), got)
+		}
+		if got := magnitude.getLinearPixelAsFloat64(i); !almostEqual(got, cmplx.Abs(value), 1e-12) {
+			t.Errorf("pixel %d: expected magnitude %v, got %v", i, cmplx.Abs(value), got)
+		}
+		if got := phase.getLinearPixelAsFloat64(i); !almostEqual(got, cmplx.Phase(value), 1e-12) {
+			t.Errorf("pixel %d: expected phase %v, got %v", i, cmplx.Phase(value), got)
+		}
+	}
+
+	single, err := img.AsType(PixelTypeComplex64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if part, err := single.Imag(); err != nil || part.GetPixelType() != PixelTypeFloat32 {
+		t.Errorf("expected a Float32 imaginary part for Complex64 images")
+	}
+
+	scalar := newNIfTITestImage(t)
+	if _, err := scalar.Real(); err == nil {
+		t.Errorf("expected error for the real part of a real image")
+	}
+	negative, err := GetImageFromArray([][]float64{{-2, 3}, {0, -1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phase, err = negative.Phase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float64{math.Pi, 0, 0, math.Pi} {
+		if got := phase.getLinearPixelAsFloat64(i); got != want {
+			t.Errorf("pixel %d: expected phase %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestComplexImageIO(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_complex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newComplexTestImage(t)
+	single, err := img.AsType(PixelTypeComplex64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		filename  string
+		imageType int
+		img       *Image
+	}{
+		{"test.mhd", ImageTypeMHD, img},
+		{"test.mha", ImageTypeMHD, single},
+		{"test.nii", ImageTypeNIfTI, img},
+		{"test.nii.gz", ImageTypeNIfTI, single},
+	} {
+		t.Run(tt.filename, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := WriteImage(tt.img, filename, tt.imageType); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			readImg, err := ReadImage(filename, tt.imageType, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if readImg.GetPixelType() != tt.img.GetPixelType() || readImg.GetNumberOfComponentsPerPixel() != 1 {
+				t.Fatalf("expected pixel type %d with 1 component, got %d with %d",
+					tt.img.GetPixelType(), readImg.GetPixelType(), readImg.GetNumberOfComponentsPerPixel())
+			}
+			if !bytes.Equal(readImg.pixels, tt.img.pixels) {
+				t.Errorf("pixel data mismatch")
+			}
+		})
+	}
+
+	// MetaImage stores complex pixels as real and imaginary channels.
+	header, err := os.ReadFile(filepath.Join(tempDir, "test.mhd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"ElementComplex = True", "ElementNumberOfChannels = 2", "ElementType = MET_DOUBLE"} {
+		if !strings.Contains(string(header), line+"\n") {
+			t.Errorf("expected %q in MHD header", line)
+		}
+	}
+
+	region, err := ReadImageRegion(filepath.Join(tempDir, "test.mhd"), ImageTypeMHD, []uint32{1, 1, 1}, []uint32{2, 2, 1})
+	if err != nil {
+		t.Fatalf("failed to read region: %v", err)
+	}
+	if value, _ := region.GetPixel([]uint32{0, 0, 0}); value != img.getLinearComplexPixel(17) {
+		t.Errorf("expected region pixel %v, got %v", img.getLinearComplexPixel(17), value)
+	}
+
+	for _, tt := range []struct {
+		filename  string
+		imageType int
+	}{
+		{"test.tif", ImageTypeTIFF},
+		{"test.nrrd", ImageTypeNRRD},
+		{"test.vti", ImageTypeVTK},
+	} {
+		if err := WriteImage(img, filepath.Join(tempDir, tt.filename), tt.imageType); err == nil {
+			t.Errorf("%s: expected error writing a complex image", tt.filename)
+		}
+	}
+	if err := WriteDICOMSeries(img, filepath.Join(tempDir, "dicom"), nil); err == nil {
+		t.Errorf("expected error writing a complex image as DICOM")
+	}
+	if _, err := img.Resample(NearestInterpolator{}); err == nil {
+		t.Errorf("expected error resampling a complex image")
+	}
+}
@@ -0,0 +1,218 @@
+package imagetk
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// newImageLike creates an image with the geometry and metadata of src and the
+// given pixel type and number of components.
+func newImageLike(src *Image, pixelType int, components int) (*Image, error) {
+	img, err := NewVectorImage(append([]uint32(nil), src.size...), pixelType, components)
+	if err != nil {
+		return nil, err
+	}
+	img.copyGeometry(src)
+	img.copyMetaData(src)
+	return img, nil
+}
+
+// ExtractComponent returns one component of a multi-component image as a
+// scalar image.
+//
+// Parameters:
+//   - component: The index of the component, starting at 0
+//
+// Returns:
+//   - *Image: A scalar image with the geometry and pixel type of the image
+//   - error: Error if the component does not exist
+func (img *Image) ExtractComponent(component int) (*Image, error) {
+	components := img.GetNumberOfComponentsPerPixel()
+	if component < 0 || component >= components {
+		return nil, fmt.Errorf("component %d out of range for %d components", component, components)
+	}
+	newImg, err := newImageLike(img, img.pixelType, 1)
+	if err != nil {
+		return nil, err
+	}
+	width := img.bytesPerPixel
+	for i := 0; i < int(img.NumPixels()); i++ {
+		start := (i*components + component) * width
+		copy(newImg.pixels[i*width:(i+1)*width], img.pixels[start:start+width])
+	}
+	return newImg, nil
+}
+
+// ComposeImages combines scalar images into a multi-component image, using
+// the pixels of the i-th image as the i-th component.
+//
+// Parameters:
+//   - images: The component images, with the same size and pixel type
+//
+// Returns:
+//   - *Image: The multi-component image, with the geometry and metadata of the first image
+//   - error: Error if no images are given or they do not match
+func ComposeImages(images ...*Image) (*Image, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images to compose")
+	}
+	first := images[0]
+	for _, img := range images {
+		if img.GetNumberOfComponentsPerPixel() != 1 {
+			return nil, fmt.Errorf("composed images must be scalar images")
+		}
+		if img.pixelType != first.pixelType {
+			return nil, fmt.Errorf("composed images must have the same pixel type")
+		}
+		if !reflect.DeepEqual(img.size, first.size) {
+			return nil, fmt.Errorf("composed images must have the same size, got %v and %v", first.size, img.size)
+		}
+	}
+
+	components := len(images)
+	newImg, err := newImageLike(first, first.pixelType, components)
+	if err != nil {
+		return nil, err
+	}
+	width := first.bytesPerPixel
+	for c, img := range images {
+		for i := 0; i < int(first.NumPixels()); i++ {
+			start := (i*components + c) * width
+			copy(newImg.pixels[start:start+width], img.pixels[i*width:(i+1)*width])
+		}
+	}
+	return newImg, nil
+}
+
+// Magnitude returns the Euclidean norm of the components of each pixel, such
+// as the length of displacement vectors, or the modulus of complex pixels.
+//
+// Returns:
+//   - *Image: A scalar Float64 image with the geometry of the image
+//   - error: Error if creating the image fails
+//
+// For scalar images the result holds the absolute pixel values.
+// Complex components contribute their squared modulus to the norm.
+func (img *Image) Magnitude() (*Image, error) {
+	newImg, err := newImageLike(img, PixelTypeFloat64, 1)
+	if err != nil {
+		return nil, err
+	}
+	components := img.GetNumberOfComponentsPerPixel()
+	for i := 0; i < int(img.NumPixels()); i++ {
+		sum := 0.0
+		for c := 0; c < components; c++ {
+			value := img.getLinearPixelAsComplex128(i*components + c)
+			sum += real(value)*real(value) + imag(value)*imag(value)
+		}
+		newImg.setLinearPixelFromFloat64(i, math.Sqrt(sum))
+	}
+	return newImg, nil
+}
+
+// getVectorPixel returns the components of the pixel at a linear index as a
+// slice of the Go type of the pixel type.
+func (img *Image) getVectorPixel(i int) any {
+	switch img.pixelType {
+	case PixelTypeUInt8:
+		return vectorPixel[uint8](img, i)
+	case PixelTypeInt8:
+		return vectorPixel[int8](img, i)
+	case PixelTypeUInt16:
+		return vectorPixel[uint16](img, i)
+	case PixelTypeInt16:
+		return vectorPixel[int16](img, i)
+	case PixelTypeUInt32:
+		return vectorPixel[uint32](img, i)
+	case PixelTypeInt32:
+		return vectorPixel[int32](img, i)
+	case PixelTypeUInt64:
+		return vectorPixel[uint64](img, i)
+	case PixelTypeInt64:
+		return vectorPixel[int64](img, i)
+	case PixelTypeFloat32:
+		return vectorPixel[float32](img, i)
+	case PixelTypeFloat64:
+		return vectorPixel[float64](img, i)
+	case PixelTypeComplex64:
+		return complexVectorPixel[complex64](img, i)
+	case PixelTypeComplex128:
+		return complexVectorPixel[complex128](img, i)
+	default:
+		return nil
+	}
+}
+
+// vectorPixel returns a copy of the components of the pixel at a linear index.
+func vectorPixel[T Number](img *Image, i int) []T {
+	components := make([]T, img.GetNumberOfComponentsPerPixel())
+	data := pixelBytes(components)
+	copy(data, img.pixels[i*len(data):])
+	if !hostIsLittleEndian {
+		img.swapPixelBytes(data)
+	}
+	return components
+}
+
+// complexVectorPixel returns a copy of the complex components of the pixel at a linear index.
+func complexVectorPixel[T complex64 | complex128](img *Image, i int) []T {
+	components := make([]T, img.GetNumberOfComponentsPerPixel())
+	for c := range components {
+		components[c] = T(img.getLinearPixelAsComplex128(i*len(components) + c))
+	}
+	return components
+}
+
+// setVectorPixel stores value, a slice holding one number per component, in
+// the pixel at a linear index. Each number is converted to the pixel type.
+func (img *Image) setVectorPixel(i int, value any) error {
+	components := img.GetNumberOfComponentsPerPixel()
+	v := reflect.ValueOf(value)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() != components {
+		return fmt.Errorf("expected a slice of %d components, got %T", components, value)
+	}
+	data := make([]byte, 0, components*img.bytesPerPixel)
+	for c := 0; c < components; c++ {
+		component, err := getValueAsPixelType(v.Index(c).Interface(), img.pixelType)
+		if err != nil {
+			return err
+		}
+		componentBytes, err := getValueAsBytes(component)
+		if err != nil {
+			return err
+		}
+		data = append(data, componentBytes...)
+	}
+	copy(img.pixels[i*len(data):], data)
+	return nil
+}
+
+// interleaveComponents converts pixel data stored one block per component
+// into pixel data with the components of each pixel next to each other.
+func interleaveComponents(data []byte, components, width int) []byte {
+	interleaved := make([]byte, len(data))
+	numPixels := len(data) / width / components
+	for c := 0; c < components; c++ {
+		for i := 0; i < numPixels; i++ {
+			src := (c*numPixels + i) * width
+			dst := (i*components + c) * width
+			copy(interleaved[dst:dst+width], data[src:src+width])
+		}
+	}
+	return interleaved
+}
+
+// planarizeComponents is the inverse of interleaveComponents.
+func planarizeComponents(data []byte, components, width int) []byte {
+	planar := make([]byte, len(data))
+	numPixels := len(data) / width / components
+	for c := 0; c < components; c++ {
+		for i := 0; i < numPixels; i++ {
+			src := (i*components + c) * width
+			dst := (c*numPixels + i) * width
+			copy(planar[dst:dst+width], data[src:src+width])
+		}
+	}
+	return planar
+}
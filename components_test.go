@@ -0,0 +1,251 @@
+package imagetk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newVectorTestImage returns a 4x3x2 Float32 image with 3 components whose
+// values encode the pixel and component index.
+func newVectorTestImage(t *testing.T) *Image {
+	return newTestImage(t, []uint32{4, 3, 2}, PixelTypeFloat32, 3, func(i int) float64 { return float64(i/3) + float64(i%3)*0.25 - 2 })
+}
+
+func TestVectorImage(t *testing.T) {
+	img, err := NewVectorImage([]uint32{3, 2}, PixelTypeUInt8, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.GetNumberOfComponentsPerPixel() != 3 || len(img.pixels) != 18 {
+		t.Fatalf("expected 3 components and 18 bytes, got %d and %d", img.GetNumberOfComponentsPerPixel(), len(img.pixels))
+	}
+	if err := img.SetPixel([]uint32{2, 1}, []uint8{10, 20, 30}); err != nil {
+		t.Fatalf("failed to set pixel: %v", err)
+	}
+	if err := img.SetPixel([]uint32{1, 1}, []float64{1, 2, 3}); err != nil {
+		t.Fatalf("failed to set pixel from float64 values: %v", err)
+	}
+	value, err := img.GetPixel([]uint32{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, []uint8{10, 20, 30}) {
+		t.Errorf("expected [10 20 30], got %v", value)
+	}
+	if !bytes.Equal(img.pixels[12:], []byte{1, 2, 3, 10, 20, 30}) {
+		t.Errorf("expected interleaved components, got %v", img.pixels)
+	}
+
+	converted, err := img.AsType(PixelTypeInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := converted.GetPixel([]uint32{2, 1}); !reflect.DeepEqual(value, []int16{10, 20, 30}) {
+		t.Errorf("expected converted pixel [10 20 30], got %v", value)
+	}
+
+	view, err := NewView[uint8](img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vector := view.Vector([]uint32{2, 1}); !reflect.DeepEqual(vector, []uint8{10, 20, 30}) {
+		t.Errorf("expected view vector [10 20 30], got %v", vector)
+	}
+	var last []uint32
+	count := 0
+	view.ForEach(func(index []uint32, value uint8) {
+		last = append(last[:0], index...)
+		count++
+	})
+	if count != 18 || !reflect.DeepEqual(last, []uint32{2, 1}) {
+		t.Errorf("expected 18 values ending at [2 1], got %d ending at %v", count, last)
+	}
+
+	invalid := []struct {
+		name  string
+		value any
+	}{
+		{"too few components", []uint8{1, 2}},
+		{"scalar", uint8(1)},
+		{"strings", []string{"a", "b", "c"}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := img.SetPixel([]uint32{0, 0}, tt.value); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+	if _, err := NewVectorImage([]uint32{3, 2}, PixelTypeUInt8, 0); err == nil {
+		t.Errorf("expected error for zero components")
+	}
+	if _, err := GetArrayFromImage(img); err == nil {
+		t.Errorf("expected error converting a multi-component image to an array")
+	}
+	if _, err := img.Resample(NearestInterpolator{}); err == nil {
+		t.Errorf("expected error resampling a multi-component image")
+	}
+}
+
+func TestComponentOperations(t *testing.T) {
+	img := newVectorTestImage(t)
+	img.SetMetaData("Modality", "MR")
+
+	var parts []*Image
+	for c := 0; c < 3; c++ {
+		part, err := img.ExtractComponent(c)
+		if err != nil {
+			t.Fatalf("failed to extract component %d: %v", c, err)
+		}
+		if part.GetNumberOfComponentsPerPixel() != 1 || part.GetDirection() != img.GetDirection() {
+			t.Fatalf("expected a scalar image with the input geometry")
+		}
+		for i := 0; i < int(part.NumPixels()); i++ {
+			if value := part.getLinearPixelAsFloat64(i); value != img.getLinearPixelAsFloat64(i*3+c) {
+				t.Fatalf("component %d pixel %d: expected %v, got %v", c, i, img.getLinearPixelAsFloat64(i*3+c), value)
+			}
+		}
+		parts = append(parts, part)
+	}
+
+	composed, err := ComposeImages(parts...)
+	if err != nil {
+		t.Fatalf("failed to compose images: %v", err)
+	}
+	if !bytes.Equal(composed.pixels, img.pixels) || composed.GetNumberOfComponentsPerPixel() != 3 {
+		t.Errorf("composed image does not match the original")
+	}
+	if modality, _ := composed.GetMetaData("Modality"); modality != "MR" {
+		t.Errorf("expected metadata of the first image, got %q", modality)
+	}
+
+	magnitude, err := img.Magnitude()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(magnitude.NumPixels()); i++ {
+		x, y, z := img.getLinearPixelAsFloat64(i*3), img.getLinearPixelAsFloat64(i*3+1), img.getLinearPixelAsFloat64(i*3+2)
+		if value := magnitude.getLinearPixelAsFloat64(i); !almostEqual(value, math.Sqrt(x*x+y*y+z*z), 1e-9) {
+			t.Errorf("pixel %d: expected magnitude %v, got %v", i, math.Sqrt(x*x+y*y+z*z), value)
+		}
+	}
+
+	if _, err := img.ExtractComponent(3); err == nil {
+		t.Errorf("expected error for component out of range")
+	}
+	if _, err := ComposeImages(); err == nil {
+		t.Errorf("expected error for no images")
+	}
+	if _, err := ComposeImages(parts[0], newNIfTITestImage(t)); err == nil {
+		t.Errorf("expected error for mismatched images")
+	}
+	if _, err := ComposeImages(img); err == nil {
+		t.Errorf("expected error for multi-component input")
+	}
+}
+
+func TestVectorImageIO(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_components")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newVectorTestImage(t)
+	for _, tt := range []struct {
+		filename  string
+		imageType int
+	}{
+		{"test.mhd", ImageTypeMHD},
+		{"test.mha", ImageTypeMHD},
+		{"test.nii", ImageTypeNIfTI},
+		{"test.nii.gz", ImageTypeNIfTI},
+		{"pair.hdr", ImageTypeNIfTI},
+	} {
+		t.Run(tt.filename, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := WriteImage(img, filename, tt.imageType); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			readImg, err := ReadImage(filename, tt.imageType, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if readImg.GetNumberOfComponentsPerPixel() != 3 || !reflect.DeepEqual(readImg.GetSize(), img.GetSize()) {
+				t.Fatalf("expected 3 components and size %v, got %d and %v", img.GetSize(), readImg.GetNumberOfComponentsPerPixel(), readImg.GetSize())
+			}
+			if !bytes.Equal(readImg.pixels, img.pixels) {
+				t.Errorf("pixel data mismatch")
+			}
+		})
+	}
+
+	// NIfTI stores the components along the fifth dimension with a vector intent.
+	data, err := os.ReadFile(filepath.Join(tempDir, "test.nii"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dims := []uint16{}
+	for i := 0; i < 6; i++ {
+		dims = append(dims, binary.LittleEndian.Uint16(data[40+i*2:]))
+	}
+	if !reflect.DeepEqual(dims, []uint16{5, 4, 3, 2, 1, 3}) || binary.LittleEndian.Uint16(data[68:]) != niftiIntentVector {
+		t.Errorf("expected dim [5 4 3 2 1 3] and vector intent, got %v and %d", dims, binary.LittleEndian.Uint16(data[68:]))
+	}
+	readImg, _ := ReadImage(filepath.Join(tempDir, "test.nii"), ImageTypeNIfTI, nil)
+	if code, _ := readImg.GetMetaData("intent_code"); code != "1007" {
+		t.Errorf("expected intent_code 1007, got %q", code)
+	}
+
+	region, err := ReadImageRegion(filepath.Join(tempDir, "test.mha"), ImageTypeMHD, []uint32{1, 1, 1}, []uint32{2, 2, 1})
+	if err != nil {
+		t.Fatalf("failed to read region: %v", err)
+	}
+	if value, _ := region.GetPixel([]uint32{1, 0, 0}); !reflect.DeepEqual(value, []float32{16, 16.25, 16.5}) {
+		t.Errorf("expected region pixel [16 16.25 16.5], got %v", value)
+	}
+	if _, err := ReadImageRegion(filepath.Join(tempDir, "test.nii"), ImageTypeNIfTI, []uint32{0, 0, 0}, []uint32{1, 1, 1}); err == nil {
+		t.Errorf("expected error reading a region of a NIfTI vector image")
+	}
+	if err := WriteImage(img, filepath.Join(tempDir, "test.tif"), ImageTypeTIFF); err == nil {
+		t.Errorf("expected error writing a multi-component TIFF")
+	}
+}
+
+func TestReadNIfTIRGB(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_components")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img, err := NewImage([]uint32{2, 2}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := img.encodeNIfTIHeader(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint16(header[70:], niftiTypeRGB24)
+	binary.LittleEndian.PutUint16(header[72:], 24)
+	pixels := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	data := append(append(header, 0, 0, 0, 0), pixels...)
+	filename := filepath.Join(tempDir, "rgb.nii")
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	readImg, err := ReadImage(filename, ImageTypeNIfTI, nil)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	if readImg.GetPixelType() != PixelTypeUInt8 || readImg.GetNumberOfComponentsPerPixel() != 3 || !bytes.Equal(readImg.pixels, pixels) {
+		t.Errorf("expected 3-component uint8 pixels %v, got type %d components %d pixels %v", pixels, readImg.GetPixelType(), readImg.GetNumberOfComponentsPerPixel(), readImg.pixels)
+	}
+}
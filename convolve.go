@@ -0,0 +1,351 @@
+package imagetk
+
+import (
+	"fmt"
+	"math"
+)
+
+// Output regions of Convolve and Correlate.
+const (
+	// OutputRegionSame returns an image of the size and geometry of the input.
+	OutputRegionSame = iota
+	// OutputRegionValid returns only the voxels whose neighbourhood lies
+	// entirely inside the image.
+	OutputRegionValid
+	// OutputRegionFull returns every voxel whose neighbourhood overlaps the image.
+	OutputRegionFull
+)
+
+// Methods of Convolve and Correlate.
+const (
+	// ConvolutionAuto picks the faster of the direct and FFT methods from the
+	// sizes of the image and kernel.
+	ConvolutionAuto = iota
+	// ConvolutionDirect sums the weighted neighbours of each voxel.
+	ConvolutionDirect
+	// ConvolutionFFT multiplies the Fourier transforms of the image and kernel.
+	ConvolutionFFT
+)
+
+// ConvolutionOptions configures Convolve and Correlate.
+type ConvolutionOptions struct {
+	// Boundary is the boundary condition; the zero value is BoundaryReplicate.
+	Boundary int
+	// Constant is the value outside the image for BoundaryConstant.
+	Constant float64
+	// Normalize divides the kernel by the sum of its weights.
+	Normalize bool
+	// OutputRegion is the region of the result; the zero value is OutputRegionSame.
+	OutputRegion int
+	// Method is the convolution method; the zero value is ConvolutionAuto.
+	Method int
+}
+
+// Convolve convolves an image with a kernel image.
+//
+// Parameters:
+//   - image: The input image
+//   - kernel: A real scalar image of the same dimension, with weights per voxel
+//   - options: The boundary condition, normalisation, output region and method
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options or kernel are invalid, or the image is complex
+//
+// The centre of the kernel is the voxel at index size/2 along each axis, and
+// the kernel spacing is ignored. The components of multi-component images are
+// convolved separately. The result of OutputRegionValid and OutputRegionFull
+// starts at the physical position of its first voxel relative to the image,
+// and voxels of the full region outside the image use the boundary condition.
+func Convolve(image, kernel *Image, options ConvolutionOptions) (*Image, error) {
+	return convolution(image, kernel, options, true)
+}
+
+// Correlate correlates an image with a kernel image, which is convolution with
+// the kernel mirrored about its centre.
+//
+// Parameters:
+//   - image: The input image
+//   - kernel: A real scalar image of the same dimension, with weights per voxel
+//   - options: The boundary condition, normalisation, output region and method
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options or kernel are invalid, or the image is complex
+//
+// Correlation weights the neighbour at offset k from the centre of the kernel
+// with the kernel voxel at the same offset; see Convolve for the other details.
+func Correlate(image, kernel *Image, options ConvolutionOptions) (*Image, error) {
+	return convolution(image, kernel, options, false)
+}
+
+// convolution convolves or correlates image with kernel. Convolution is
+// computed as correlation with the mirrored kernel.
+func convolution(image, kernel *Image, options ConvolutionOptions, convolve bool) (*Image, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	if err := requireRealImage(kernel); err != nil {
+		return nil, fmt.Errorf("invalid kernel: %w", err)
+	}
+	if err := requireScalarImage(kernel); err != nil {
+		return nil, fmt.Errorf("invalid kernel: %w", err)
+	}
+	if kernel.dimension != image.dimension {
+		return nil, fmt.Errorf("kernel dimension %d does not match image dimension %d", kernel.dimension, image.dimension)
+	}
+	if err := checkBoundary(options.Boundary); err != nil {
+		return nil, err
+	}
+	if options.Method < ConvolutionAuto || options.Method > ConvolutionFFT {
+		return nil, fmt.Errorf("unsupported convolution method: %d", options.Method)
+	}
+
+	dimension := int(image.dimension)
+	size := make([]int, dimension)
+	kernelSize := make([]int, dimension)
+	center := make([]int, dimension)
+	for k := range size {
+		size[k] = int(image.size[k])
+		kernelSize[k] = int(kernel.size[k])
+		center[k] = kernelSize[k] / 2
+	}
+	weights := imageValues(kernel)
+	if options.Normalize {
+		sum := 0.0
+		for _, w := range weights {
+			sum += w
+		}
+		if sum == 0 || math.IsNaN(sum) {
+			return nil, fmt.Errorf("cannot normalize a kernel whose weights sum to %g", sum)
+		}
+		for i := range weights {
+			weights[i] /= sum
+		}
+	}
+	if convolve {
+		// Reversing the weights mirrors the kernel along every axis.
+		for i, j := 0, len(weights)-1; i < j; i, j = i+1, j-1 {
+			weights[i], weights[j] = weights[j], weights[i]
+		}
+		for k := range center {
+			center[k] = kernelSize[k] - 1 - center[k]
+		}
+	}
+
+	// The output voxel at index o is centred on image index start+o.
+	outSize := make([]uint32, dimension)
+	start := make([]int, dimension)
+	for k := range size {
+		switch options.OutputRegion {
+		case OutputRegionSame:
+			outSize[k] = uint32(size[k])
+		case OutputRegionValid:
+			if kernelSize[k] > size[k] {
+				return nil, fmt.Errorf("kernel size %v exceeds image size %v for the valid region", kernel.size, image.size)
+			}
+			start[k] = center[k]
+			outSize[k] = uint32(size[k] - kernelSize[k] + 1)
+		case OutputRegionFull:
+			start[k] = center[k] - kernelSize[k] + 1
+			outSize[k] = uint32(size[k] + kernelSize[k] - 1)
+		default:
+			return nil, fmt.Errorf("unsupported output region: %d", options.OutputRegion)
+		}
+	}
+
+	components := image.GetNumberOfComponentsPerPixel()
+	out, err := NewVectorImage(outSize, floatPixelType(image.pixelType), components)
+	if err != nil {
+		return nil, err
+	}
+	out.copyGeometry(image)
+	out.copyMetaData(image)
+	for j := range out.origin {
+		for k := range start {
+			out.origin[j] += float64(start[k]) * image.spacing[k] * image.directionAt(k, j)
+		}
+	}
+
+	padded, paddedSize := extendImage(imageValues(image), size, components, start, kernelSize, center, outSize, options.Boundary, options.Constant)
+	var values []float64
+	if options.Method == ConvolutionFFT || (options.Method == ConvolutionAuto && preferFFT(paddedSize, outSize, weights)) {
+		values = correlateFFT(padded, paddedSize, components, weights, kernelSize, outSize)
+	} else {
+		values = correlateDirect(padded, paddedSize, components, weights, kernelSize, outSize)
+	}
+	if out.pixelType == PixelTypeFloat64 {
+		setPixelsOf(out, values)
+	} else {
+		parallelFor(len(values), func(start, end int) {
+			for i := start; i < end; i++ {
+				out.setLinearPixelFromFloat64(i, values[i])
+			}
+		})
+	}
+	return out, nil
+}
+
+// extendImage returns the values of the image around the output region, so
+// that output voxel o is the correlation of the kernel with the padded values
+// from index o onwards. The padded array holds outSize+kernelSize-1 voxels
+// along each axis; voxels outside the image follow the boundary condition.
+func extendImage(values []float64, size []int, components int, start, kernelSize, center []int, outSize []uint32, boundary int, constant float64) ([]float64, []int) {
+	paddedSize := make([]int, len(size))
+	total := 1
+	for k := range size {
+		paddedSize[k] = int(outSize[k]) + kernelSize[k] - 1
+		total *= paddedSize[k]
+	}
+	fill := 0.0
+	if boundary == BoundaryConstant {
+		fill = constant
+	}
+	padded := make([]float64, total*components)
+	parallelFor(total, func(first, end int) {
+		for p := first; p < end; p++ {
+			rest, source, stride, inside := p, 0, 1, true
+			for k := range size {
+				index, ok := boundaryIndex(rest%paddedSize[k]+start[k]-center[k], size[k], boundary)
+				if !ok {
+					inside = false
+					break
+				}
+				rest /= paddedSize[k]
+				source += index * stride
+				stride *= size[k]
+			}
+			for c := 0; c < components; c++ {
+				if inside {
+					padded[p*components+c] = values[source*components+c]
+				} else {
+					padded[p*components+c] = fill
+				}
+			}
+		}
+	})
+	return padded, paddedSize
+}
+
+// preferFFT estimates whether correlating by FFT is faster than summing the
+// non-zero weights of the kernel for every output voxel.
+func preferFFT(paddedSize []int, outSize []uint32, weights []float64) bool {
+	direct, transform := 0.0, 1.0
+	for _, w := range weights {
+		if w != 0 {
+			direct++
+		}
+	}
+	for k, n := range paddedSize {
+		direct *= float64(outSize[k])
+		transform *= float64(nextPowerOfTwo(n))
+	}
+	// Three transforms of complex values cost about 3*5/2 operations per
+	// element and level.
+	return direct > 8*transform*math.Log2(transform)
+}
+
+// correlateDirect correlates the padded values with the kernel weights by
+// summing the weighted neighbours of each output voxel.
+func correlateDirect(padded []float64, paddedSize []int, components int, weights []float64, kernelSize []int, outSize []uint32) []float64 {
+	var offsets []int
+	var nonZero []float64
+	for i, w := range weights {
+		if w == 0 {
+			continue
+		}
+		offset, stride, rest := 0, 1, i
+		for k, n := range kernelSize {
+			offset += rest % n * stride
+			rest /= n
+			stride *= paddedSize[k]
+		}
+		offsets = append(offsets, offset*components)
+		nonZero = append(nonZero, w)
+	}
+
+	total := 1
+	for _, n := range outSize {
+		total *= int(n)
+	}
+	values := make([]float64, total*components)
+	parallelForCost(total, len(offsets)*components, func(first, end int) {
+		for o := first; o < end; o++ {
+			base, stride, rest := 0, 1, o
+			for k, n := range outSize {
+				base += rest % int(n) * stride
+				rest /= int(n)
+				stride *= paddedSize[k]
+			}
+			for c := 0; c < components; c++ {
+				sum := 0.0
+				for j, offset := range offsets {
+					sum += nonZero[j] * padded[base*components+c+offset]
+				}
+				values[o*components+c] = sum
+			}
+		}
+	})
+	return values
+}
+
+// correlateFFT correlates the padded values with the kernel weights by
+// multiplying their Fourier transforms, zero padded to powers of two so that
+// the circular correlation does not wrap around into the output region.
+func correlateFFT(padded []float64, paddedSize []int, components int, weights []float64, kernelSize []int, outSize []uint32) []float64 {
+	fftSize := make([]int, len(paddedSize))
+	total := 1
+	for k, n := range paddedSize {
+		fftSize[k] = nextPowerOfTwo(n)
+		total *= fftSize[k]
+	}
+	// scatter copies an array of the given size into the start of an array of fftSize.
+	scatter := func(dst []complex128, size []int, value func(i int) float64) {
+		count := 1
+		for _, n := range size {
+			count *= n
+		}
+		for i := 0; i < count; i++ {
+			target, stride, rest := 0, 1, i
+			for k, n := range size {
+				target += rest % n * stride
+				rest /= n
+				stride *= fftSize[k]
+			}
+			dst[target] = complex(value(i), 0)
+		}
+	}
+
+	kernelSpectrum := make([]complex128, total)
+	scatter(kernelSpectrum, kernelSize, func(i int) float64 { return weights[i] })
+	fftND(kernelSpectrum, fftSize, 0, false)
+
+	outSizeInt := make([]int, len(outSize))
+	outTotal := 1
+	for k, n := range outSize {
+		outSizeInt[k] = int(n)
+		outTotal *= int(n)
+	}
+	values := make([]float64, outTotal*components)
+	spectrum := make([]complex128, total)
+	for c := 0; c < components; c++ {
+		clear(spectrum)
+		scatter(spectrum, paddedSize, func(i int) float64 { return padded[i*components+c] })
+		fftND(spectrum, fftSize, 0, false)
+		for i := range spectrum {
+			k := kernelSpectrum[i]
+			spectrum[i] *= complex(real(k), -imag(k))
+		}
+		fftND(spectrum, fftSize, 0, true)
+		for o := 0; o < outTotal; o++ {
+			source, stride, rest := 0, 1, o
+			for k, n := range outSizeInt {
+				source += rest % n * stride
+				rest /= n
+				stride *= fftSize[k]
+			}
+			values[o*components+c] = real(spectrum[source])
+		}
+	}
+	return values
+}
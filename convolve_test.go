@@ -0,0 +1,268 @@
+package imagetk
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// newRandomTestImage returns a Float64 image of the given size and components
+// with reproducible random values.
+func newRandomTestImage(t *testing.T, size []uint32, components int, seed int64) *Image {
+	t.Helper()
+	img, err := NewVectorImage(size, PixelTypeFloat64, components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < len(img.pixels)/8; i++ {
+		img.setLinearPixelFromFloat64(i, rng.Float64()*10-5)
+	}
+	return img
+}
+
+// referenceConvolution convolves a scalar 2D image with a kernel voxel by
+// voxel, following the definition with the kernel centre at size/2.
+func referenceConvolution(img, kernel *Image, options ConvolutionOptions, convolve bool) [][]float64 {
+	n0, n1 := int(img.size[0]), int(img.size[1])
+	m0, m1 := int(kernel.size[0]), int(kernel.size[1])
+	c0, c1 := m0/2, m1/2
+	value := func(i, j int) float64 {
+		i, okI := boundaryIndex(i, n0, options.Boundary)
+		j, okJ := boundaryIndex(j, n1, options.Boundary)
+		switch {
+		case okI && okJ:
+			return img.getLinearPixelAsFloat64(j*n0 + i)
+		case options.Boundary == BoundaryConstant:
+			return options.Constant
+		default:
+			return 0
+		}
+	}
+	first0, first1, last0, last1 := 0, 0, n0-1, n1-1
+	switch options.OutputRegion {
+	case OutputRegionValid:
+		first0, first1, last0, last1 = m0-1, m1-1, n0-1, n1-1
+	case OutputRegionFull:
+		last0, last1 = n0+m0-2, n1+m1-2
+	}
+	var result [][]float64
+	for y := first1; y <= last1; y++ {
+		row := []float64{}
+		for x := first0; x <= last0; x++ {
+			sum := 0.0
+			for kj := 0; kj < m1; kj++ {
+				for ki := 0; ki < m0; ki++ {
+					w := kernel.getLinearPixelAsFloat64(kj*m0 + ki)
+					// Same-region voxel x is centred on x; the valid and full
+					// regions index the result of a full convolution.
+					i, j := x-ki+c0, y-kj+c1
+					if options.OutputRegion != OutputRegionSame {
+						i, j = x-ki, y-kj
+					}
+					if !convolve {
+						i, j = x+ki-c0, y+kj-c1
+						if options.OutputRegion != OutputRegionSame {
+							i, j = x-(m0-1-ki), y-(m1-1-kj)
+						}
+					}
+					sum += w * value(i, j)
+				}
+			}
+			row = append(row, sum)
+		}
+		result = append(result, row)
+	}
+	return result
+}
+
+func TestConvolveMatchesReference(t *testing.T) {
+	img := newRandomTestImage(t, []uint32{13, 11}, 1, 1)
+	// An even, asymmetric kernel checks the centre and the mirroring.
+	kernel := newRandomTestImage(t, []uint32{4, 3}, 1, 2)
+
+	for _, region := range []int{OutputRegionSame, OutputRegionValid, OutputRegionFull} {
+		for boundary := BoundaryReplicate; boundary <= BoundaryPeriodic; boundary++ {
+			for _, method := range []int{ConvolutionDirect, ConvolutionFFT} {
+				for _, convolve := range []bool{true, false} {
+					options := ConvolutionOptions{Boundary: boundary, Constant: 2.5, OutputRegion: region, Method: method}
+					filter := Correlate
+					if convolve {
+						filter = Convolve
+					}
+					out, err := filter(img, kernel, options)
+					if err != nil {
+						t.Fatal(err)
+					}
+					want := referenceConvolution(img, kernel, options, convolve)
+					if got := out.GetSize(); int(got[0]) != len(want[0]) || int(got[1]) != len(want) {
+						t.Fatalf("%+v: expected size %dx%d, got %v", options, len(want[0]), len(want), got)
+					}
+					for y, row := range want {
+						for x, value := range row {
+							if got := out.getLinearPixelAsFloat64(y*len(row) + x); !almostEqual(got, value, 1e-9) {
+								t.Fatalf("%+v, convolve %v: at (%d, %d) expected %v, got %v", options, convolve, x, y, value, got)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestConvolveImpulse(t *testing.T) {
+	img := newImpulseTestImage(t, []uint32{5, 5}, []uint32{2, 2})
+	kernel, err := GetImageFromArray([][]float64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	convolved, err := Convolve(img, kernel, ConvolutionOptions{Boundary: BoundaryZero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	correlated, err := Correlate(img, kernel, ConvolutionOptions{Boundary: BoundaryZero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Convolving an impulse reproduces the kernel; correlating mirrors it.
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			want := float64(y*3 + x + 1)
+			if got := convolved.getLinearPixelAsFloat64((y+1)*5 + x + 1); got != want {
+				t.Errorf("convolution at (%d, %d): expected %v, got %v", x, y, want, got)
+			}
+			if got := correlated.getLinearPixelAsFloat64((3-y)*5 + 3 - x); got != want {
+				t.Errorf("correlation at (%d, %d): expected %v, got %v", x, y, want, got)
+			}
+		}
+	}
+}
+
+func TestConvolveGeometry(t *testing.T) {
+	img, err := NewImage([]uint32{6, 5}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.SetOrigin([]float64{10, 20})
+	img.SetSpacing([]float64{2, 3})
+	for i := range img.pixels {
+		img.pixels[i] = 7
+	}
+	kernel, err := GetImageFromArray([][]float32{{1, 1, 1}, {1, 1, 1}, {1, 1, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		region int
+		size   []uint32
+		origin []float64
+	}{
+		{OutputRegionSame, []uint32{6, 5}, []float64{10, 20}},
+		{OutputRegionValid, []uint32{4, 3}, []float64{12, 23}},
+		{OutputRegionFull, []uint32{8, 7}, []float64{8, 17}},
+	}
+	for _, tt := range tests {
+		out, err := Convolve(img, kernel, ConvolutionOptions{Normalize: true, OutputRegion: tt.region})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.GetPixelType() != PixelTypeFloat64 {
+			t.Errorf("region %d: expected a Float64 image, got pixel type %d", tt.region, out.GetPixelType())
+		}
+		size, origin := out.GetSize(), out.GetOrigin()
+		if size[0] != tt.size[0] || size[1] != tt.size[1] || origin[0] != tt.origin[0] || origin[1] != tt.origin[1] {
+			t.Errorf("region %d: expected size %v and origin %v, got %v and %v", tt.region, tt.size, tt.origin, size, origin)
+		}
+		// A normalised box filter keeps a constant image with replicated edges.
+		for i := 0; i < int(out.NumPixels()); i++ {
+			if got := out.getLinearPixelAsFloat64(i); !almostEqual(got, 7, 1e-9) {
+				t.Fatalf("region %d: expected 7, got %v", tt.region, got)
+			}
+		}
+	}
+}
+
+func TestConvolveMethods(t *testing.T) {
+	tests := []struct {
+		name       string
+		image      *Image
+		kernelSize []uint32
+	}{
+		{"large 2D kernel", newRandomTestImage(t, []uint32{64, 48}, 1, 3), []uint32{31, 25}},
+		{"3D vector image", newRandomTestImage(t, []uint32{12, 10, 9}, 2, 4), []uint32{5, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kernel := newRandomTestImage(t, tt.kernelSize, 1, 5)
+			var results []*Image
+			for _, method := range []int{ConvolutionAuto, ConvolutionDirect, ConvolutionFFT} {
+				out, err := Convolve(tt.image, kernel, ConvolutionOptions{Boundary: BoundaryMirror, Method: method})
+				if err != nil {
+					t.Fatal(err)
+				}
+				results = append(results, out)
+			}
+			for i := 0; i < len(results[0].pixels)/8; i++ {
+				direct := results[1].getLinearPixelAsFloat64(i)
+				for _, out := range []*Image{results[0], results[2]} {
+					if got := out.getLinearPixelAsFloat64(i); !almostEqual(got, direct, 1e-8) {
+						t.Fatalf("value %d: expected %v, got %v", i, direct, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConvolveErrors(t *testing.T) {
+	img, err := NewImage([]uint32{4, 4}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kernel, err := NewImage([]uint32{3, 3}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := NewImage([]uint32{5, 3}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume, err := NewImage([]uint32{3, 3, 3}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vector, err := NewVectorImage([]uint32{3, 3}, PixelTypeFloat32, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		image   *Image
+		kernel  *Image
+		options ConvolutionOptions
+	}{
+		{"complex image", newComplexTestImage(t), kernel, ConvolutionOptions{}},
+		{"kernel dimension", img, volume, ConvolutionOptions{}},
+		{"vector kernel", img, vector, ConvolutionOptions{}},
+		{"boundary", img, kernel, ConvolutionOptions{Boundary: 8}},
+		{"output region", img, kernel, ConvolutionOptions{OutputRegion: 3}},
+		{"method", img, kernel, ConvolutionOptions{Method: 3}},
+		{"valid region of a larger kernel", img, large, ConvolutionOptions{OutputRegion: OutputRegionValid}},
+		{"normalizing a zero kernel", img, kernel, ConvolutionOptions{Normalize: true}},
+	}
+	for _, tt := range tests {
+		if _, err := Convolve(tt.image, tt.kernel, tt.options); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+
+	out, err := Correlate(img, kernel, ConvolutionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.GetPixelType() != PixelTypeFloat32 {
+		t.Errorf("expected a Float32 image, got pixel type %d", out.GetPixelType())
+	}
+}
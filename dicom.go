@@ -0,0 +1,1272 @@
+package imagetk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DICOMTag identifies a DICOM data element by its group and element numbers,
+// stored as 0xGGGGEEEE.
+type DICOMTag uint32
+
+// NewDICOMTag returns the tag with the given group and element numbers.
+func NewDICOMTag(group, element uint16) DICOMTag {
+	return DICOMTag(uint32(group)<<16 | uint32(element))
+}
+
+// Group returns the group number of the tag.
+func (tag DICOMTag) Group() uint16 {
+	return uint16(tag >> 16)
+}
+
+// Element returns the element number of the tag.
+func (tag DICOMTag) Element() uint16 {
+	return uint16(tag)
+}
+
+// String returns the tag formatted as (gggg,eeee).
+func (tag DICOMTag) String() string {
+	return fmt.Sprintf("(%04X,%04X)", tag.Group(), tag.Element())
+}
+
+// DICOMAttribute is the value of a DICOM data element as text, together with
+// its value representation (VR).
+type DICOMAttribute struct {
+	// VR is the two-letter value representation, such as "PN" or "US". When
+	// writing, an empty VR is looked up in a dictionary of common attributes.
+	VR string
+	// Value holds the values separated by backslashes, with binary numbers
+	// formatted in decimal.
+	Value string
+}
+
+const (
+	dicomTagFileMetaInformationGroupLength DICOMTag = 0x00020000
+	dicomTagFileMetaInformationVersion     DICOMTag = 0x00020001
+	dicomTagMediaStorageSOPClassUID        DICOMTag = 0x00020002
+	dicomTagMediaStorageSOPInstanceUID     DICOMTag = 0x00020003
+	dicomTagTransferSyntaxUID              DICOMTag = 0x00020010
+	dicomTagImplementationClassUID         DICOMTag = 0x00020012
+	dicomTagImageType                      DICOMTag = 0x00080008
+	dicomTagSOPClassUID                    DICOMTag = 0x00080016
+	dicomTagSOPInstanceUID                 DICOMTag = 0x00080018
+	dicomTagModality                       DICOMTag = 0x00080060
+	dicomTagConversionType                 DICOMTag = 0x00080064
+	dicomTagPatientName                    DICOMTag = 0x00100010
+	dicomTagPatientID                      DICOMTag = 0x00100020
+	dicomTagSliceThickness                 DICOMTag = 0x00180050
+	dicomTagSpacingBetweenSlices           DICOMTag = 0x00180088
+	dicomTagStudyInstanceUID               DICOMTag = 0x0020000D
+	dicomTagSeriesInstanceUID              DICOMTag = 0x0020000E
+	dicomTagInstanceNumber                 DICOMTag = 0x00200013
+	dicomTagImagePositionPatient           DICOMTag = 0x00200032
+	dicomTagImageOrientationPatient        DICOMTag = 0x00200037
+	dicomTagFrameOfReferenceUID            DICOMTag = 0x00200052
+	dicomTagSliceLocation                  DICOMTag = 0x00201041
+	dicomTagSamplesPerPixel                DICOMTag = 0x00280002
+	dicomTagPhotometricInterpretation      DICOMTag = 0x00280004
+	dicomTagNumberOfFrames                 DICOMTag = 0x00280008
+	dicomTagRows                           DICOMTag = 0x00280010
+	dicomTagColumns                        DICOMTag = 0x00280011
+	dicomTagPixelSpacing                   DICOMTag = 0x00280030
+	dicomTagBitsAllocated                  DICOMTag = 0x00280100
+	dicomTagBitsStored                     DICOMTag = 0x00280101
+	dicomTagHighBit                        DICOMTag = 0x00280102
+	dicomTagPixelRepresentation            DICOMTag = 0x00280103
+	dicomTagRescaleIntercept               DICOMTag = 0x00281052
+	dicomTagRescaleSlope                   DICOMTag = 0x00281053
+	dicomTagPixelData                      DICOMTag = 0x7FE00010
+	dicomTagItem                           DICOMTag = 0xFFFEE000
+	dicomTagItemDelimitation               DICOMTag = 0xFFFEE00D
+	dicomTagSequenceDelimitation           DICOMTag = 0xFFFEE0DD
+)
+
+const (
+	dicomImplicitVRLittleEndian  = "1.2.840.10008.1.2"
+	dicomExplicitVRLittleEndian  = "1.2.840.10008.1.2.1"
+	dicomSecondaryCaptureStorage = "1.2.840.10008.5.1.4.1.1.7"
+	// dicomImplementationClassUID identifies files written by this package.
+	dicomImplementationClassUID = "2.25.156848632549306738416512924393604657416"
+)
+
+// dicomVRs holds the value representation of common tags, needed to decode
+// implicit VR data sets and to encode attributes given without a VR. Implicit
+// VR tags missing from the dictionary are read as text if they look like text.
+var dicomVRs = map[DICOMTag]string{
+	dicomTagFileMetaInformationGroupLength: "UL",
+	dicomTagFileMetaInformationVersion:     "OB",
+	dicomTagMediaStorageSOPClassUID:        "UI",
+	dicomTagMediaStorageSOPInstanceUID:     "UI",
+	dicomTagTransferSyntaxUID:              "UI",
+	dicomTagImplementationClassUID:         "UI",
+	dicomTagImageType:                      "CS",
+	dicomTagSOPClassUID:                    "UI",
+	dicomTagSOPInstanceUID:                 "UI",
+	0x00080020:                             "DA", // StudyDate
+	0x00080021:                             "DA", // SeriesDate
+	0x00080023:                             "DA", // ContentDate
+	0x00080030:                             "TM", // StudyTime
+	0x00080031:                             "TM", // SeriesTime
+	0x00080033:                             "TM", // ContentTime
+	0x00080050:                             "SH", // AccessionNumber
+	dicomTagModality:                       "CS",
+	dicomTagConversionType:                 "CS",
+	0x00080070:                             "LO", // Manufacturer
+	0x00080080:                             "LO", // InstitutionName
+	0x00080090:                             "PN", // ReferringPhysicianName
+	0x00081030:                             "LO", // StudyDescription
+	0x0008103E:                             "LO", // SeriesDescription
+	0x00081150:                             "UI", // ReferencedSOPClassUID
+	0x00081155:                             "UI", // ReferencedSOPInstanceUID
+	dicomTagPatientName:                    "PN",
+	dicomTagPatientID:                      "LO",
+	0x00100030:                             "DA", // PatientBirthDate
+	0x00100040:                             "CS", // PatientSex
+	0x00101010:                             "AS", // PatientAge
+	0x00180015:                             "CS", // BodyPartExamined
+	dicomTagSliceThickness:                 "DS",
+	dicomTagSpacingBetweenSlices:           "DS",
+	0x00181030:                             "LO", // ProtocolName
+	0x00181310:                             "US", // AcquisitionMatrix
+	dicomTagStudyInstanceUID:               "UI",
+	dicomTagSeriesInstanceUID:              "UI",
+	0x00200010:                             "SH", // StudyID
+	0x00200011:                             "IS", // SeriesNumber
+	dicomTagInstanceNumber:                 "IS",
+	0x00200020:                             "CS", // PatientOrientation
+	dicomTagImagePositionPatient:           "DS",
+	dicomTagImageOrientationPatient:        "DS",
+	dicomTagFrameOfReferenceUID:            "UI",
+	dicomTagSliceLocation:                  "DS",
+	dicomTagSamplesPerPixel:                "US",
+	dicomTagPhotometricInterpretation:      "CS",
+	0x00280006:                             "US", // PlanarConfiguration
+	dicomTagNumberOfFrames:                 "IS",
+	dicomTagRows:                           "US",
+	dicomTagColumns:                        "US",
+	dicomTagPixelSpacing:                   "DS",
+	dicomTagBitsAllocated:                  "US",
+	dicomTagBitsStored:                     "US",
+	dicomTagHighBit:                        "US",
+	dicomTagPixelRepresentation:            "US",
+	0x00281050:                             "DS", // WindowCenter
+	0x00281051:                             "DS", // WindowWidth
+	dicomTagRescaleIntercept:               "DS",
+	dicomTagRescaleSlope:                   "DS",
+	0x00281054:                             "LO", // RescaleType
+	dicomTagPixelData:                      "OW",
+}
+
+// isDICOMTextVR reports whether values of the VR are character strings.
+func isDICOMTextVR(vr string) bool {
+	switch vr {
+	case "AE", "AS", "CS", "DA", "DS", "DT", "IS", "LO", "LT", "PN", "SH", "ST", "TM", "UC", "UI", "UR", "UT":
+		return true
+	default:
+		return false
+	}
+}
+
+// dicomElement is a single decoded data element.
+type dicomElement struct {
+	vr    string
+	value []byte
+}
+
+// dicomDataSet holds the top-level data elements of a DICOM file. Sequences are
+// skipped.
+type dicomDataSet struct {
+	elements map[DICOMTag]*dicomElement
+}
+
+// dicomParser decodes data elements from a little endian byte stream.
+type dicomParser struct {
+	data     []byte
+	offset   int
+	explicit bool
+}
+
+func readDICOMFile(filename string) (*dicomDataSet, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DICOM file: %v", err)
+	}
+	return parseDICOM(data)
+}
+
+// parseDICOM decodes a DICOM Part 10 file. Files without the 128-byte preamble
+// and "DICM" prefix are accepted as raw data sets.
+func parseDICOM(data []byte) (*dicomDataSet, error) {
+	ds := &dicomDataSet{elements: make(map[DICOMTag]*dicomElement)}
+	p := &dicomParser{data: data}
+	if len(data) >= 132 && string(data[128:132]) == "DICM" {
+		p.offset = 132
+		p.explicit = true
+	} else if len(data) >= 8 && isDICOMVR(data[4:6]) {
+		p.explicit = true
+	} else if len(data) < 8 || binary.LittleEndian.Uint16(data) > 0x0008 {
+		return nil, fmt.Errorf("not a DICOM file")
+	}
+
+	// The file meta information group is always explicit VR little endian.
+	metaExplicit := p.explicit
+	for p.offset+4 <= len(data) && binary.LittleEndian.Uint16(data[p.offset:]) == 0x0002 {
+		p.explicit = true
+		tag, vr, value, err := p.readElement()
+		if err != nil {
+			return nil, err
+		}
+		ds.elements[tag] = &dicomElement{vr: vr, value: value}
+	}
+	p.explicit = metaExplicit
+
+	if _, ok := ds.elements[dicomTagTransferSyntaxUID]; ok {
+		switch ds.getString(dicomTagTransferSyntaxUID) {
+		case dicomImplicitVRLittleEndian:
+			p.explicit = false
+		case dicomExplicitVRLittleEndian:
+			p.explicit = true
+		default:
+			return nil, fmt.Errorf("unsupported DICOM transfer syntax: %s", ds.getString(dicomTagTransferSyntaxUID))
+		}
+	}
+
+	for p.offset < len(data) {
+		tag, vr, value, err := p.readElement()
+		if err != nil {
+			return nil, err
+		}
+		if vr == "SQ" {
+			continue
+		}
+		ds.elements[tag] = &dicomElement{vr: vr, value: value}
+	}
+	return ds, nil
+}
+
+func isDICOMVR(vr []byte) bool {
+	return len(vr) == 2 && vr[0] >= 'A' && vr[0] <= 'Z' && vr[1] >= 'A' && vr[1] <= 'Z'
+}
+
+// hasLongDICOMLength reports whether the explicit VR uses a 4-byte value length.
+func hasLongDICOMLength(vr string) bool {
+	switch vr {
+	case "OB", "OD", "OF", "OL", "OV", "OW", "SQ", "SV", "UC", "UN", "UR", "UT", "UV":
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *dicomParser) readTag() (DICOMTag, error) {
+	if p.offset+4 > len(p.data) {
+		return 0, fmt.Errorf("DICOM data is truncated")
+	}
+	group := binary.LittleEndian.Uint16(p.data[p.offset:])
+	element := binary.LittleEndian.Uint16(p.data[p.offset+2:])
+	p.offset += 4
+	return NewDICOMTag(group, element), nil
+}
+
+// peekTag returns the next tag without consuming it, or 0 at the end of data.
+func (p *dicomParser) peekTag() DICOMTag {
+	if p.offset+4 > len(p.data) {
+		return 0
+	}
+	return NewDICOMTag(binary.LittleEndian.Uint16(p.data[p.offset:]), binary.LittleEndian.Uint16(p.data[p.offset+2:]))
+}
+
+func (p *dicomParser) readUint32() (uint32, error) {
+	if p.offset+4 > len(p.data) {
+		return 0, fmt.Errorf("DICOM data is truncated")
+	}
+	value := binary.LittleEndian.Uint32(p.data[p.offset:])
+	p.offset += 4
+	return value, nil
+}
+
+// readElement decodes the next data element. Sequences are skipped and
+// returned with the VR "SQ" and no value.
+func (p *dicomParser) readElement() (DICOMTag, string, []byte, error) {
+	tag, err := p.readTag()
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	var vr string
+	var length uint32
+	if p.explicit && tag.Group() != 0xFFFE {
+		if p.offset+4 > len(p.data) {
+			return 0, "", nil, fmt.Errorf("DICOM data is truncated")
+		}
+		vr = string(p.data[p.offset : p.offset+2])
+		if hasLongDICOMLength(vr) {
+			p.offset += 4
+			if length, err = p.readUint32(); err != nil {
+				return 0, "", nil, err
+			}
+		} else {
+			length = uint32(binary.LittleEndian.Uint16(p.data[p.offset+2:]))
+			p.offset += 4
+		}
+	} else {
+		vr = dicomVRs[tag]
+		if length, err = p.readUint32(); err != nil {
+			return 0, "", nil, err
+		}
+	}
+
+	if length == 0xFFFFFFFF {
+		if tag == dicomTagPixelData {
+			return 0, "", nil, fmt.Errorf("unsupported DICOM transfer syntax: encapsulated pixel data")
+		}
+		if err := p.skipSequence(); err != nil {
+			return 0, "", nil, err
+		}
+		return tag, "SQ", nil, nil
+	}
+	if p.offset+int(length) > len(p.data) {
+		return 0, "", nil, fmt.Errorf("DICOM element %s is truncated", tag)
+	}
+	value := p.data[p.offset : p.offset+int(length)]
+	p.offset += int(length)
+	if vr == "SQ" {
+		return tag, "SQ", nil, nil
+	}
+	return tag, vr, value, nil
+}
+
+// skipSequence skips the items of a sequence of undefined length, up to and
+// including the sequence delimitation item.
+func (p *dicomParser) skipSequence() error {
+	for {
+		tag, err := p.readTag()
+		if err != nil {
+			return err
+		}
+		length, err := p.readUint32()
+		if err != nil {
+			return err
+		}
+		switch tag {
+		case dicomTagSequenceDelimitation:
+			return nil
+		case dicomTagItem:
+			if length != 0xFFFFFFFF {
+				p.offset += int(length)
+				continue
+			}
+			// Items of undefined length end with an item delimitation element.
+			for {
+				if p.peekTag() == dicomTagItemDelimitation {
+					p.offset += 8
+					break
+				}
+				if _, _, _, err := p.readElement(); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("invalid DICOM sequence item %s", tag)
+		}
+	}
+}
+
+// getString returns the value of a text element with padding removed.
+func (ds *dicomDataSet) getString(tag DICOMTag) string {
+	element, ok := ds.elements[tag]
+	if !ok {
+		return ""
+	}
+	return strings.TrimRight(string(element.value), " \x00")
+}
+
+// getFloats returns the values of a multi-valued decimal string or binary
+// floating point element.
+func (ds *dicomDataSet) getFloats(tag DICOMTag) ([]float64, bool) {
+	element, ok := ds.elements[tag]
+	if !ok || len(element.value) == 0 {
+		return nil, false
+	}
+	var values []float64
+	switch element.vr {
+	case "FD":
+		for i := 0; i+8 <= len(element.value); i += 8 {
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(element.value[i:])))
+		}
+	case "FL":
+		for i := 0; i+4 <= len(element.value); i += 4 {
+			values = append(values, float64(math.Float32frombits(binary.LittleEndian.Uint32(element.value[i:]))))
+		}
+	default:
+		for _, s := range strings.Split(ds.getString(tag), "\\") {
+			value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, false
+			}
+			values = append(values, value)
+		}
+	}
+	return values, true
+}
+
+// getInt returns the first value of an integer or integer string element.
+func (ds *dicomDataSet) getInt(tag DICOMTag) (int, bool) {
+	element, ok := ds.elements[tag]
+	if !ok || len(element.value) == 0 {
+		return 0, false
+	}
+	switch element.vr {
+	case "US", "SS":
+		if len(element.value) < 2 {
+			return 0, false
+		}
+		value := binary.LittleEndian.Uint16(element.value)
+		if element.vr == "SS" {
+			return int(int16(value)), true
+		}
+		return int(value), true
+	case "UL", "SL":
+		if len(element.value) < 4 {
+			return 0, false
+		}
+		value := binary.LittleEndian.Uint32(element.value)
+		if element.vr == "SL" {
+			return int(int32(value)), true
+		}
+		return int(value), true
+	default:
+		value, err := strconv.Atoi(strings.TrimSpace(strings.Split(ds.getString(tag), "\\")[0]))
+		return value, err == nil
+	}
+}
+
+// ReadDICOMSeriesIDs returns the sorted SeriesInstanceUIDs of the DICOM images
+// found in the directory. Files that are not DICOM images are ignored.
+//
+// Parameters:
+//   - directory: Path to the directory to scan
+//
+// Returns:
+//   - []string: The SeriesInstanceUIDs of the series in the directory
+//   - error: Error if the directory cannot be read
+func ReadDICOMSeriesIDs(directory string) ([]string, error) {
+	series, err := scanDICOMDirectory(directory)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(series))
+	for id := range series {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ReadDICOMSeries reads the slices of a DICOM series from a directory into a
+// 3D image. The slices are sorted by their ImagePositionPatient projected on
+// the slice normal, RescaleSlope and RescaleIntercept are applied, and the
+// origin, spacing and direction are taken from ImagePositionPatient,
+// PixelSpacing and ImageOrientationPatient.
+//
+// Parameters:
+//   - directory: Path to the directory holding the series
+//   - seriesInstanceUID: The series to read, or "" if the directory holds a single series
+//
+// Returns:
+//   - *Image: The loaded image object
+//   - error: Error if reading fails
+//
+// Only uncompressed pixel data with explicit or implicit VR little endian
+// transfer syntaxes is supported.
+func ReadDICOMSeries(directory string, seriesInstanceUID string) (*Image, error) {
+	series, err := scanDICOMDirectory(directory)
+	if err != nil {
+		return nil, err
+	}
+	if seriesInstanceUID == "" {
+		if len(series) != 1 {
+			return nil, fmt.Errorf("directory contains %d DICOM series, a SeriesInstanceUID must be specified", len(series))
+		}
+		for id := range series {
+			seriesInstanceUID = id
+		}
+	}
+	filenames, ok := series[seriesInstanceUID]
+	if !ok {
+		return nil, fmt.Errorf("DICOM series not found: %s", seriesInstanceUID)
+	}
+	return readDICOMSlices(filenames)
+}
+
+// scanDICOMDirectory groups the DICOM image files of a directory by SeriesInstanceUID.
+func scanDICOMDirectory(directory string) (map[string][]string, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DICOM directory: %v", err)
+	}
+	series := make(map[string][]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		filename := filepath.Join(directory, entry.Name())
+		ds, err := readDICOMFile(filename)
+		if err != nil {
+			continue
+		}
+		if _, ok := ds.elements[dicomTagPixelData]; !ok {
+			continue
+		}
+		id := ds.getString(dicomTagSeriesInstanceUID)
+		series[id] = append(series[id], filename)
+	}
+	return series, nil
+}
+
+func readImageTypeDICOM(filename string) (*Image, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DICOM file: %v", err)
+	}
+	if info.IsDir() {
+		return ReadDICOMSeries(filename, "")
+	}
+	return readDICOMSlices([]string{filename})
+}
+
+// dicomSlice is a single image of a series with its sort key.
+type dicomSlice struct {
+	ds             *dicomDataSet
+	position       []float64
+	distance       float64
+	instanceNumber int
+}
+
+// readDICOMSlices assembles the given single-frame DICOM files into a 3D image.
+func readDICOMSlices(filenames []string) (*Image, error) {
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no DICOM files to read")
+	}
+
+	slices := make([]*dicomSlice, 0, len(filenames))
+	for _, filename := range filenames {
+		ds, err := readDICOMFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		if _, ok := ds.elements[dicomTagPixelData]; !ok {
+			return nil, fmt.Errorf("%s: DICOM file has no pixel data", filename)
+		}
+		if frames, ok := ds.getInt(dicomTagNumberOfFrames); ok && frames > 1 {
+			return nil, fmt.Errorf("%s: multi-frame DICOM files are not supported", filename)
+		}
+		if samples, ok := ds.getInt(dicomTagSamplesPerPixel); ok && samples != 1 {
+			return nil, fmt.Errorf("%s: unsupported DICOM samples per pixel: %d", filename, samples)
+		}
+		slice := &dicomSlice{ds: ds}
+		slice.position, _ = ds.getFloats(dicomTagImagePositionPatient)
+		slice.instanceNumber, _ = ds.getInt(dicomTagInstanceNumber)
+		slices = append(slices, slice)
+	}
+
+	first := slices[0].ds
+	rowDirection := []float64{1, 0, 0}
+	columnDirection := []float64{0, 1, 0}
+	if orientation, ok := first.getFloats(dicomTagImageOrientationPatient); ok && len(orientation) == 6 {
+		rowDirection = orientation[0:3]
+		columnDirection = orientation[3:6]
+	}
+	normal := []float64{
+		rowDirection[1]*columnDirection[2] - rowDirection[2]*columnDirection[1],
+		rowDirection[2]*columnDirection[0] - rowDirection[0]*columnDirection[2],
+		rowDirection[0]*columnDirection[1] - rowDirection[1]*columnDirection[0],
+	}
+
+	// Sort along the slice normal; fall back to InstanceNumber without positions.
+	havePositions := true
+	for _, slice := range slices {
+		if len(slice.position) != 3 {
+			havePositions = false
+			break
+		}
+		slice.distance = slice.position[0]*normal[0] + slice.position[1]*normal[1] + slice.position[2]*normal[2]
+	}
+	sort.SliceStable(slices, func(i, j int) bool {
+		if havePositions {
+			return slices[i].distance < slices[j].distance
+		}
+		return slices[i].instanceNumber < slices[j].instanceNumber
+	})
+
+	rows, _ := first.getInt(dicomTagRows)
+	columns, _ := first.getInt(dicomTagColumns)
+	bitsAllocated, _ := first.getInt(dicomTagBitsAllocated)
+	bitsStored, ok := first.getInt(dicomTagBitsStored)
+	if !ok || bitsStored <= 0 || bitsStored > bitsAllocated {
+		bitsStored = bitsAllocated
+	}
+	pixelRepresentation, _ := first.getInt(dicomTagPixelRepresentation)
+	if rows <= 0 || columns <= 0 {
+		return nil, fmt.Errorf("invalid DICOM image size: %dx%d", columns, rows)
+	}
+	storedType, err := getDICOMStoredPixelType(bitsAllocated, pixelRepresentation)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick an output type that holds the rescaled values of every slice.
+	storedMin, storedMax := 0.0, math.Exp2(float64(bitsStored))-1
+	if pixelRepresentation == 1 {
+		storedMin, storedMax = -math.Exp2(float64(bitsStored-1)), math.Exp2(float64(bitsStored-1))-1
+	}
+	slopes := make([]float64, len(slices))
+	intercepts := make([]float64, len(slices))
+	identity, integral := true, true
+	low, high := math.Inf(1), math.Inf(-1)
+	for i, slice := range slices {
+		slopes[i], intercepts[i] = 1, 0
+		if values, ok := slice.ds.getFloats(dicomTagRescaleSlope); ok && len(values) > 0 && values[0] != 0 {
+			slopes[i] = values[0]
+		}
+		if values, ok := slice.ds.getFloats(dicomTagRescaleIntercept); ok && len(values) > 0 {
+			intercepts[i] = values[0]
+		}
+		if slopes[i] != 1 || intercepts[i] != 0 {
+			identity = false
+		}
+		if slopes[i] != math.Trunc(slopes[i]) || intercepts[i] != math.Trunc(intercepts[i]) {
+			integral = false
+		}
+		a, b := storedMin*slopes[i]+intercepts[i], storedMax*slopes[i]+intercepts[i]
+		low, high = math.Min(low, math.Min(a, b)), math.Max(high, math.Max(a, b))
+	}
+	pixelType := storedType
+	if !identity {
+		pixelType = PixelTypeFloat32
+		if integral {
+			pixelType = getIntegerPixelTypeForRange(low, high)
+		}
+	}
+
+	img, err := NewImage([]uint32{uint32(columns), uint32(rows), uint32(len(slices))}, pixelType)
+	if err != nil {
+		return nil, err
+	}
+
+	spacing := []float64{1, 1, 1}
+	if values, ok := first.getFloats(dicomTagPixelSpacing); ok && len(values) == 2 {
+		spacing[0], spacing[1] = values[1], values[0]
+	}
+	if havePositions && len(slices) > 1 {
+		spacing[2] = (slices[len(slices)-1].distance - slices[0].distance) / float64(len(slices)-1)
+	} else if values, ok := first.getFloats(dicomTagSpacingBetweenSlices); ok && len(values) > 0 && values[0] > 0 {
+		spacing[2] = values[0]
+	} else if values, ok := first.getFloats(dicomTagSliceThickness); ok && len(values) > 0 && values[0] > 0 {
+		spacing[2] = values[0]
+	}
+	if spacing[2] <= 0 {
+		spacing[2] = 1
+	}
+	if err := img.SetSpacing(spacing); err != nil {
+		return nil, err
+	}
+	if havePositions {
+		img.SetOrigin(append([]float64(nil), slices[0].position...))
+	}
+	var direction [9]float64
+	copy(direction[0:3], rowDirection)
+	copy(direction[3:6], columnDirection)
+	copy(direction[6:9], normal)
+	img.SetDirection(direction)
+
+	// Decode each slice, masking the stored bits and applying the rescale.
+	stored, err := NewImage([]uint32{uint32(columns), uint32(rows)}, storedType)
+	if err != nil {
+		return nil, err
+	}
+	sliceSize := rows * columns
+	sliceBytes := sliceSize * stored.bytesPerPixel
+	mask := uint64(1)<<uint(bitsStored) - 1
+	for k, slice := range slices {
+		if value, _ := slice.ds.getInt(dicomTagRows); value != rows {
+			return nil, fmt.Errorf("DICOM slices have different sizes")
+		}
+		if value, _ := slice.ds.getInt(dicomTagColumns); value != columns {
+			return nil, fmt.Errorf("DICOM slices have different sizes")
+		}
+		if value, _ := slice.ds.getInt(dicomTagBitsAllocated); value != bitsAllocated {
+			return nil, fmt.Errorf("DICOM slices have different pixel types")
+		}
+		pixelData := slice.ds.elements[dicomTagPixelData].value
+		if len(pixelData) < sliceBytes {
+			return nil, fmt.Errorf("DICOM pixel data is truncated: expected %d bytes, got %d", sliceBytes, len(pixelData))
+		}
+		stored.pixels = pixelData[:sliceBytes]
+		for i := 0; i < sliceSize; i++ {
+			value := stored.getLinearPixelAsFloat64(i)
+			if bitsStored < bitsAllocated {
+				raw := uint64(int64(value)) & mask
+				if pixelRepresentation == 1 && raw&(1<<uint(bitsStored-1)) != 0 {
+					value = float64(int64(raw) - int64(1)<<uint(bitsStored))
+				} else {
+					value = float64(raw)
+				}
+			}
+			img.setLinearPixelFromFloat64(k*sliceSize+i, value*slopes[k]+intercepts[k])
+		}
+	}
+
+	// The attributes of the first slice describe the series.
+	for tag, attribute := range first.getTags() {
+		img.setDICOMMetaData(tag, attribute)
+	}
+	return img, nil
+}
+
+func getDICOMStoredPixelType(bitsAllocated, pixelRepresentation int) (int, error) {
+	signed := pixelRepresentation == 1
+	switch bitsAllocated {
+	case 8:
+		if signed {
+			return PixelTypeInt8, nil
+		}
+		return PixelTypeUInt8, nil
+	case 16:
+		if signed {
+			return PixelTypeInt16, nil
+		}
+		return PixelTypeUInt16, nil
+	case 32:
+		if signed {
+			return PixelTypeInt32, nil
+		}
+		return PixelTypeUInt32, nil
+	default:
+		return PixelTypeUnknown, fmt.Errorf("unsupported DICOM bits allocated: %d", bitsAllocated)
+	}
+}
+
+// getIntegerPixelTypeForRange returns the smallest integer pixel type holding
+// every value in [low, high], or PixelTypeFloat64 if none does.
+func getIntegerPixelTypeForRange(low, high float64) int {
+	switch {
+	case low >= 0 && high <= math.MaxUint8:
+		return PixelTypeUInt8
+	case low >= math.MinInt8 && high <= math.MaxInt8:
+		return PixelTypeInt8
+	case low >= 0 && high <= math.MaxUint16:
+		return PixelTypeUInt16
+	case low >= math.MinInt16 && high <= math.MaxInt16:
+		return PixelTypeInt16
+	case low >= 0 && high <= math.MaxUint32:
+		return PixelTypeUInt32
+	case low >= math.MinInt32 && high <= math.MaxInt32:
+		return PixelTypeInt32
+	default:
+		return PixelTypeFloat64
+	}
+}
+
+// getText returns the value of an element as text. Binary numbers are
+// formatted in decimal; other binary values are not returned.
+func (ds *dicomDataSet) getText(tag DICOMTag) (string, bool) {
+	element, ok := ds.elements[tag]
+	if !ok {
+		return "", false
+	}
+	var values []string
+	switch element.vr {
+	case "US":
+		for i := 0; i+2 <= len(element.value); i += 2 {
+			values = append(values, strconv.FormatUint(uint64(binary.LittleEndian.Uint16(element.value[i:])), 10))
+		}
+	case "SS":
+		for i := 0; i+2 <= len(element.value); i += 2 {
+			values = append(values, strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(element.value[i:]))), 10))
+		}
+	case "UL":
+		for i := 0; i+4 <= len(element.value); i += 4 {
+			values = append(values, strconv.FormatUint(uint64(binary.LittleEndian.Uint32(element.value[i:])), 10))
+		}
+	case "SL":
+		for i := 0; i+4 <= len(element.value); i += 4 {
+			values = append(values, strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(element.value[i:]))), 10))
+		}
+	case "FL", "FD":
+		floats, _ := ds.getFloats(tag)
+		for _, value := range floats {
+			values = append(values, strconv.FormatFloat(value, 'g', -1, 64))
+		}
+	case "", "UN":
+		// Elements of unknown VR are kept if they look like text.
+		for _, c := range element.value {
+			if (c < 0x20 || c > 0x7E) && c != 0 && c != '\t' && c != '\n' && c != '\r' && c != 0x1B {
+				return "", false
+			}
+		}
+		return ds.getString(tag), true
+	default:
+		if !isDICOMTextVR(element.vr) {
+			return "", false
+		}
+		return ds.getString(tag), true
+	}
+	return strings.Join(values, "\\"), true
+}
+
+// ReadDICOMTags reads the attributes of a DICOM file as text, for example to
+// copy them from a source series to a derived series with WriteDICOMSeries.
+//
+// Parameters:
+//   - filename: Path to the DICOM file
+//
+// Returns:
+//   - map[DICOMTag]DICOMAttribute: The attribute values and their VRs
+//   - error: Error if reading fails
+//
+// Binary numbers are formatted in decimal and keep their VR, so that they are
+// written back as binary numbers. Text attributes of unknown VR get the VR
+// "UN". The file meta information, pixel data, sequences and other binary
+// attributes are omitted.
+func ReadDICOMTags(filename string) (map[DICOMTag]DICOMAttribute, error) {
+	ds, err := readDICOMFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ds.getTags(), nil
+}
+
+// getTags returns the attributes of the data set that can be represented as
+// text, without the file meta information and pixel data.
+func (ds *dicomDataSet) getTags() map[DICOMTag]DICOMAttribute {
+	tags := make(map[DICOMTag]DICOMAttribute)
+	for tag, element := range ds.elements {
+		if tag.Group() == 0x0002 || tag == dicomTagPixelData {
+			continue
+		}
+		if value, ok := ds.getText(tag); ok {
+			vr := element.vr
+			if vr == "" {
+				vr = "UN"
+			}
+			tags[tag] = DICOMAttribute{VR: vr, Value: value}
+		}
+	}
+	return tags
+}
+
+// dicomMetaDataKey returns the metadata key of a tag, such as "0010|0010".
+func dicomMetaDataKey(tag DICOMTag) string {
+	return fmt.Sprintf("%04x|%04x", tag.Group(), tag.Element())
+}
+
+// setDICOMMetaData stores a DICOM attribute in the metadata, recording its VR
+// so that it is written back with the same VR.
+func (img *Image) setDICOMMetaData(tag DICOMTag, attribute DICOMAttribute) {
+	key := dicomMetaDataKey(tag)
+	img.SetMetaData(key, attribute.Value)
+	if img.metadataVRs == nil {
+		img.metadataVRs = make(map[string]string)
+	}
+	img.metadataVRs[key] = attribute.VR
+}
+
+// getDICOMMetaDataTags returns the attributes stored in the metadata under
+// keys of the form "0010|0010", with the VRs of attributes read from DICOM files.
+func (img *Image) getDICOMMetaDataTags() map[DICOMTag]DICOMAttribute {
+	tags := make(map[DICOMTag]DICOMAttribute)
+	for key, value := range img.metadata {
+		var group, element uint16
+		if len(key) != 9 || key[4] != '|' {
+			continue
+		}
+		if _, err := fmt.Sscanf(key, "%04x|%04x", &group, &element); err == nil {
+			tags[NewDICOMTag(group, element)] = DICOMAttribute{VR: img.metadataVRs[key], Value: value}
+		}
+	}
+	return tags
+}
+
+// WriteDICOMSeries writes the image as a DICOM series with one file per slice,
+// named IM00001.dcm, IM00002.dcm and so on in the directory, which is created
+// if it does not exist.
+//
+// Parameters:
+//   - img: The image to write
+//   - directory: Path to the output directory
+//   - tags: Attributes to include in every file, for example from ReadDICOMTags; can be nil
+//
+// Returns:
+//   - error: Error if writing fails, or if an attribute has no VR and is not in the dictionary
+//
+// The files use the explicit VR little endian transfer syntax. New SOP and series
+// instance UIDs are generated, and the pixel description (rows, columns, pixel
+// spacing, bits, pixel representation and rescale), ImagePositionPatient,
+// ImageOrientationPatient, InstanceNumber and slice spacing attributes are derived
+// from the image, replacing any supplied values. Other attributes, such as
+// WindowCenter and WindowWidth, are kept. The study and frame of reference UIDs
+// are kept from the tags so the derived series stays in the source study, and
+// generated otherwise. Missing attributes default to a secondary capture image.
+// Integer images of up to 32 bits are stored as is; other images are stored as
+// 16-bit integers with RescaleSlope and RescaleIntercept restoring their values.
+func WriteDICOMSeries(img *Image, directory string, tags map[DICOMTag]DICOMAttribute) error {
+	if img.GetNumberOfComponentsPerPixel() > 1 {
+		return fmt.Errorf("writing multi-component images to DICOM files is not supported")
+	}
+	if img.dimension > 3 {
+		return fmt.Errorf("writing %dD images to DICOM files is not supported", img.dimension)
+	}
+	return img.saveImageTypeDICOM(directory, tags)
+}
+
+// isDICOMWriterTag reports whether the writer derives the attribute itself.
+// NumberOfFrames is dropped as every file holds a single frame.
+func isDICOMWriterTag(tag DICOMTag) bool {
+	switch tag {
+	case dicomTagSOPInstanceUID, dicomTagSeriesInstanceUID, dicomTagInstanceNumber,
+		dicomTagImagePositionPatient, dicomTagImageOrientationPatient, dicomTagSliceLocation,
+		dicomTagSliceThickness, dicomTagSpacingBetweenSlices,
+		dicomTagSamplesPerPixel, dicomTagPhotometricInterpretation, dicomTagNumberOfFrames,
+		dicomTagRows, dicomTagColumns, dicomTagPixelSpacing, dicomTagBitsAllocated,
+		dicomTagBitsStored, dicomTagHighBit, dicomTagPixelRepresentation,
+		dicomTagRescaleIntercept, dicomTagRescaleSlope:
+		return true
+	}
+	group := tag.Group()
+	return group == 0x0002 || group == 0x7FE0 || group == 0xFFFE
+}
+
+func (img *Image) saveImageTypeDICOM(directory string, tags map[DICOMTag]DICOMAttribute) error {
+	if isComplexPixelType(img.pixelType) {
+		return fmt.Errorf("writing complex images to DICOM files is not supported")
+	}
+	size := img.GetSize()
+	columns, rows, numSlices := size[0], size[1], uint32(1)
+	if img.dimension == 3 {
+		numSlices = size[2]
+	}
+	if columns > math.MaxUint16 || rows > math.MaxUint16 {
+		return fmt.Errorf("image size %dx%d exceeds the DICOM limit", columns, rows)
+	}
+
+	stored, slope, intercept, err := img.getDICOMStoredImage()
+	if err != nil {
+		return err
+	}
+	bitsAllocated := stored.bytesPerPixel * 8
+	pixelRepresentation := "0"
+	switch stored.pixelType {
+	case PixelTypeInt8, PixelTypeInt16, PixelTypeInt32:
+		pixelRepresentation = "1"
+	}
+
+	// Geometry in LPS, with 2D images lying in the axial plane.
+	d := img.direction
+	rowDirection := []float64{d[0], d[1], d[2]}
+	columnDirection := []float64{d[3], d[4], d[5]}
+	normal := []float64{d[6], d[7], d[8]}
+	spacing := []float64{img.spacing[0], img.spacing[1], 1}
+	origin := []float64{img.origin[0], img.origin[1], 0}
+	if img.dimension == 3 {
+		spacing[2] = img.spacing[2]
+		origin[2] = img.origin[2]
+	} else {
+		rowDirection = []float64{d[0], d[1], 0}
+		columnDirection = []float64{d[3], d[4], 0}
+		normal = []float64{0, 0, 1}
+	}
+
+	generated := map[DICOMTag]string{
+		dicomTagImageType:                 "DERIVED\\SECONDARY",
+		dicomTagSOPClassUID:               dicomSecondaryCaptureStorage,
+		0x00080020:                        "", // StudyDate
+		0x00080030:                        "", // StudyTime
+		0x00080050:                        "", // AccessionNumber
+		dicomTagModality:                  "OT",
+		dicomTagConversionType:            "WSD",
+		0x00080090:                        "", // ReferringPhysicianName
+		dicomTagPatientName:               "",
+		dicomTagPatientID:                 "",
+		0x00100030:                        "", // PatientBirthDate
+		0x00100040:                        "", // PatientSex
+		dicomTagStudyInstanceUID:          newDICOMUID(),
+		0x00200010:                        "", // StudyID
+		0x00200011:                        "", // SeriesNumber
+		dicomTagFrameOfReferenceUID:       newDICOMUID(),
+		0x00200020:                        "", // PatientOrientation
+		dicomTagSamplesPerPixel:           "1",
+		dicomTagPhotometricInterpretation: "MONOCHROME2",
+		dicomTagRows:                      strconv.Itoa(int(rows)),
+		dicomTagColumns:                   strconv.Itoa(int(columns)),
+		dicomTagPixelSpacing:              formatDICOMDecimal(spacing[1]) + "\\" + formatDICOMDecimal(spacing[0]),
+		dicomTagBitsAllocated:             strconv.Itoa(bitsAllocated),
+		dicomTagBitsStored:                strconv.Itoa(bitsAllocated),
+		dicomTagHighBit:                   strconv.Itoa(bitsAllocated - 1),
+		dicomTagPixelRepresentation:       pixelRepresentation,
+		dicomTagRescaleIntercept:          formatDICOMDecimal(intercept),
+		dicomTagRescaleSlope:              formatDICOMDecimal(slope),
+		dicomTagSeriesInstanceUID:         newDICOMUID(),
+		dicomTagImageOrientationPatient:   formatDICOMDecimals(append(append([]float64(nil), rowDirection...), columnDirection...)),
+		dicomTagSliceThickness:            formatDICOMDecimal(spacing[2]),
+	}
+	if numSlices > 1 {
+		generated[dicomTagSpacingBetweenSlices] = formatDICOMDecimal(spacing[2])
+	}
+	attributes := make(map[DICOMTag]DICOMAttribute, len(generated))
+	for tag, value := range generated {
+		attributes[tag] = DICOMAttribute{Value: value}
+	}
+	// Attributes from the metadata, typically read from a source series, are
+	// overridden by the explicitly supplied ones.
+	for _, source := range []map[DICOMTag]DICOMAttribute{img.getDICOMMetaDataTags(), tags} {
+		for tag, value := range source {
+			if !isDICOMWriterTag(tag) {
+				attributes[tag] = value
+			}
+		}
+	}
+
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return fmt.Errorf("failed to create DICOM directory: %v", err)
+	}
+	sliceBytes := int(columns) * int(rows) * stored.bytesPerPixel
+	for k := 0; k < int(numSlices); k++ {
+		position := make([]float64, 3)
+		for j := range position {
+			position[j] = origin[j] + float64(k)*spacing[2]*normal[j]
+		}
+		attributes[dicomTagSOPInstanceUID] = DICOMAttribute{Value: newDICOMUID()}
+		attributes[dicomTagInstanceNumber] = DICOMAttribute{Value: strconv.Itoa(k + 1)}
+		attributes[dicomTagImagePositionPatient] = DICOMAttribute{Value: formatDICOMDecimals(position)}
+		attributes[dicomTagSliceLocation] = DICOMAttribute{Value: formatDICOMDecimal(position[0]*normal[0] + position[1]*normal[1] + position[2]*normal[2])}
+
+		data, err := encodeDICOMFile(attributes, stored.pixels[k*sliceBytes:(k+1)*sliceBytes])
+		if err != nil {
+			return err
+		}
+		filename := filepath.Join(directory, fmt.Sprintf("IM%05d.dcm", k+1))
+		if err := os.WriteFile(filename, data, 0666); err != nil {
+			return fmt.Errorf("failed to write DICOM file: %v", err)
+		}
+	}
+	return nil
+}
+
+// getDICOMStoredImage returns the image converted to a pixel type DICOM can
+// store, with the rescale parameters mapping stored values back to the image.
+func (img *Image) getDICOMStoredImage() (*Image, float64, float64, error) {
+	switch img.pixelType {
+	case PixelTypeUInt8, PixelTypeInt8, PixelTypeUInt16, PixelTypeInt16, PixelTypeUInt32, PixelTypeInt32:
+		return img, 1, 0, nil
+	}
+
+	numPixels := int(img.NumPixels())
+	low, high := math.Inf(1), math.Inf(-1)
+	integral := true
+	for i := 0; i < numPixels; i++ {
+		value := img.getLinearPixelAsFloat64(i)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, 0, 0, fmt.Errorf("cannot write non-finite pixel values to DICOM")
+		}
+		low, high = math.Min(low, value), math.Max(high, value)
+		if value != math.Trunc(value) {
+			integral = false
+		}
+	}
+
+	// Integer values that fit 32 bits are stored without rescaling; anything
+	// else is mapped linearly onto the 16-bit signed range.
+	pixelType, slope, intercept := PixelTypeInt16, 1.0, 0.0
+	if integral {
+		pixelType = getIntegerPixelTypeForRange(low, high)
+	}
+	if pixelType == PixelTypeFloat64 || !integral {
+		pixelType = PixelTypeInt16
+		if high > low {
+			slope = (high - low) / (math.MaxInt16 - math.MinInt16)
+		}
+		intercept = low - math.MinInt16*slope
+	}
+
+	stored, err := NewImage(img.GetSize(), pixelType)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	for i := 0; i < numPixels; i++ {
+		value := math.Round((img.getLinearPixelAsFloat64(i) - intercept) / slope)
+		if pixelType == PixelTypeInt16 {
+			value = math.Max(math.MinInt16, math.Min(math.MaxInt16, value))
+		}
+		stored.setLinearPixelFromFloat64(i, value)
+	}
+	return stored, slope, intercept, nil
+}
+
+// encodeDICOMFile encodes a Part 10 file with the explicit VR little endian
+// transfer syntax. Attributes without a VR take the VR of the dictionary.
+func encodeDICOMFile(attributes map[DICOMTag]DICOMAttribute, pixelData []byte) ([]byte, error) {
+	meta := new(bytes.Buffer)
+	appendDICOMElement(meta, dicomTagFileMetaInformationVersion, "OB", true, []byte{0, 1})
+	for _, element := range []struct {
+		tag   DICOMTag
+		value string
+	}{
+		{dicomTagMediaStorageSOPClassUID, attributes[dicomTagSOPClassUID].Value},
+		{dicomTagMediaStorageSOPInstanceUID, attributes[dicomTagSOPInstanceUID].Value},
+		{dicomTagTransferSyntaxUID, dicomExplicitVRLittleEndian},
+		{dicomTagImplementationClassUID, dicomImplementationClassUID},
+	} {
+		value, _ := encodeDICOMValue("UI", element.value)
+		appendDICOMElement(meta, element.tag, "UI", true, value)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write(make([]byte, 128))
+	buf.WriteString("DICM")
+	appendDICOMElement(buf, dicomTagFileMetaInformationGroupLength, "UL", true, binary.LittleEndian.AppendUint32(nil, uint32(meta.Len())))
+	buf.Write(meta.Bytes())
+
+	sortedTags := make([]DICOMTag, 0, len(attributes))
+	for tag := range attributes {
+		sortedTags = append(sortedTags, tag)
+	}
+	sort.Slice(sortedTags, func(i, j int) bool { return sortedTags[i] < sortedTags[j] })
+	for _, tag := range sortedTags {
+		vr := attributes[tag].VR
+		if vr == "" {
+			vr = dicomVRs[tag]
+		}
+		if vr == "" {
+			return nil, fmt.Errorf("unknown VR of DICOM tag %s; set the VR of the attribute", tag)
+		}
+		value, err := encodeDICOMValue(vr, attributes[tag].Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for DICOM tag %s: %v", tag, err)
+		}
+		appendDICOMElement(buf, tag, vr, true, value)
+	}
+	if len(pixelData)%2 == 1 {
+		pixelData = append(pixelData[:len(pixelData):len(pixelData)], 0)
+	}
+	pixelVR := "OW"
+	if attributes[dicomTagBitsAllocated].Value == "8" {
+		pixelVR = "OB"
+	}
+	appendDICOMElement(buf, dicomTagPixelData, pixelVR, true, pixelData)
+	return buf.Bytes(), nil
+}
+
+func appendDICOMElement(buf *bytes.Buffer, tag DICOMTag, vr string, explicit bool, value []byte) {
+	binary.Write(buf, binary.LittleEndian, []uint16{tag.Group(), tag.Element()})
+	if !explicit {
+		binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	} else if hasLongDICOMLength(vr) {
+		buf.WriteString(vr)
+		buf.Write([]byte{0, 0})
+		binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	} else {
+		buf.WriteString(vr)
+		binary.Write(buf, binary.LittleEndian, uint16(len(value)))
+	}
+	buf.Write(value)
+}
+
+// encodeDICOMValue encodes a backslash separated text value for the VR,
+// padding text to an even length. Text of unknown VR ("UN") is stored as is.
+func encodeDICOMValue(vr string, value string) ([]byte, error) {
+	var buf []byte
+	switch vr {
+	case "US", "SS", "UL", "SL", "FL", "FD":
+		if value == "" {
+			return nil, nil
+		}
+		for _, s := range strings.Split(value, "\\") {
+			s = strings.TrimSpace(s)
+			var err error
+			switch vr {
+			case "US":
+				var n uint64
+				n, err = strconv.ParseUint(s, 10, 16)
+				buf = binary.LittleEndian.AppendUint16(buf, uint16(n))
+			case "SS":
+				var n int64
+				n, err = strconv.ParseInt(s, 10, 16)
+				buf = binary.LittleEndian.AppendUint16(buf, uint16(n))
+			case "UL":
+				var n uint64
+				n, err = strconv.ParseUint(s, 10, 32)
+				buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
+			case "SL":
+				var n int64
+				n, err = strconv.ParseInt(s, 10, 32)
+				buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
+			case "FL":
+				var f float64
+				f, err = strconv.ParseFloat(s, 32)
+				buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f)))
+			case "FD":
+				var f float64
+				f, err = strconv.ParseFloat(s, 64)
+				buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if !isDICOMTextVR(vr) && vr != "UN" {
+			return nil, fmt.Errorf("cannot encode values of VR %q", vr)
+		}
+		buf = []byte(value)
+		if len(buf)%2 == 1 {
+			if vr == "UI" {
+				buf = append(buf, 0)
+			} else {
+				buf = append(buf, ' ')
+			}
+		}
+	}
+	if !hasLongDICOMLength(vr) && len(buf) > math.MaxUint16 {
+		return nil, fmt.Errorf("value of %d bytes is too long for VR %s", len(buf), vr)
+	}
+	return buf, nil
+}
+
+// formatDICOMDecimal formats a value as a decimal string of at most 16 characters.
+func formatDICOMDecimal(value float64) string {
+	if value == 0 {
+		return "0"
+	}
+	s := strconv.FormatFloat(value, 'g', -1, 64)
+	for precision := 15; len(s) > 16 && precision > 0; precision-- {
+		s = strconv.FormatFloat(value, 'g', precision, 64)
+	}
+	return s
+}
+
+func formatDICOMDecimals(values []float64) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = formatDICOMDecimal(value)
+	}
+	return strings.Join(parts, "\\")
+}
+
+// newDICOMUID returns a UID derived from a random UUID under the 2.25 root.
+func newDICOMUID() string {
+	var uuid [16]byte
+	rand.Read(uuid[:])
+	uuid[6] = uuid[6]&0x0F | 0x40
+	uuid[8] = uuid[8]&0x3F | 0x80
+	return "2.25." + new(big.Int).SetBytes(uuid[:]).String()
+}
@@ -0,0 +1,416 @@
+package imagetk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testDICOMElement struct {
+	tag   DICOMTag
+	vr    string
+	value []byte
+}
+
+func testDICOMUS(value uint16) []byte {
+	return binary.LittleEndian.AppendUint16(nil, value)
+}
+
+// encodeTestDICOM encodes a Part 10 file with the given transfer syntax.
+func encodeTestDICOM(transferSyntax string, elements []testDICOMElement) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(make([]byte, 128))
+	buf.WriteString("DICM")
+	writeTestDICOMElement(buf, true, testDICOMElement{dicomTagTransferSyntaxUID, "UI", []byte(transferSyntax + "\x00")})
+	explicit := transferSyntax != dicomImplicitVRLittleEndian
+	for _, element := range elements {
+		writeTestDICOMElement(buf, explicit, element)
+	}
+	return buf.Bytes()
+}
+
+func writeTestDICOMTag(buf *bytes.Buffer, tag DICOMTag) {
+	binary.Write(buf, binary.LittleEndian, []uint16{tag.Group(), tag.Element()})
+}
+
+func writeTestDICOMElement(buf *bytes.Buffer, explicit bool, element testDICOMElement) {
+	value := element.value
+	if len(value)%2 == 1 {
+		value = append(value, ' ')
+	}
+	writeTestDICOMTag(buf, element.tag)
+	length := uint32(len(value))
+	if element.vr == "SQ" {
+		length = 0xFFFFFFFF
+	}
+	if explicit {
+		buf.WriteString(element.vr)
+		if hasLongDICOMLength(element.vr) {
+			buf.Write([]byte{0, 0})
+			binary.Write(buf, binary.LittleEndian, length)
+		} else {
+			binary.Write(buf, binary.LittleEndian, uint16(length))
+		}
+	} else {
+		binary.Write(buf, binary.LittleEndian, length)
+	}
+	buf.Write(value)
+}
+
+// testDICOMSequence returns the items of an undefined length sequence holding
+// one undefined length item with a single text element.
+func testDICOMSequence(explicit bool) []byte {
+	item := new(bytes.Buffer)
+	writeTestDICOMElement(item, explicit, testDICOMElement{0x00080100, "SH", []byte("CODE")})
+	buf := new(bytes.Buffer)
+	writeTestDICOMTag(buf, dicomTagItem)
+	binary.Write(buf, binary.LittleEndian, uint32(0xFFFFFFFF))
+	buf.Write(item.Bytes())
+	writeTestDICOMTag(buf, dicomTagItemDelimitation)
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	writeTestDICOMTag(buf, dicomTagSequenceDelimitation)
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	return buf.Bytes()
+}
+
+func testDICOMSlice(explicit bool, series, position, slope, intercept string, bitsStored uint16, pixels []uint16) []byte {
+	pixelData := new(bytes.Buffer)
+	binary.Write(pixelData, binary.LittleEndian, pixels)
+	transferSyntax := dicomImplicitVRLittleEndian
+	if explicit {
+		transferSyntax = dicomExplicitVRLittleEndian
+	}
+	return encodeTestDICOM(transferSyntax, []testDICOMElement{
+		{0x00081140, "SQ", testDICOMSequence(explicit)},
+		{dicomTagSliceThickness, "DS", []byte("2.5")},
+		{dicomTagSeriesInstanceUID, "UI", []byte(series)},
+		{dicomTagImagePositionPatient, "DS", []byte(position)},
+		{dicomTagImageOrientationPatient, "DS", []byte("0\\1\\0\\0\\0\\-1")},
+		{dicomTagSamplesPerPixel, "US", testDICOMUS(1)},
+		{dicomTagRows, "US", testDICOMUS(2)},
+		{dicomTagColumns, "US", testDICOMUS(3)},
+		{dicomTagPixelSpacing, "DS", []byte("0.5\\0.75")},
+		{dicomTagBitsAllocated, "US", testDICOMUS(16)},
+		{dicomTagBitsStored, "US", testDICOMUS(bitsStored)},
+		{dicomTagPixelRepresentation, "US", testDICOMUS(0)},
+		{dicomTagRescaleIntercept, "DS", []byte(intercept)},
+		{dicomTagRescaleSlope, "DS", []byte(slope)},
+		{dicomTagPixelData, "OW", pixelData.Bytes()},
+	})
+}
+
+func TestReadDICOMSeries(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_dicom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// The slice normal is (-1, 0, 0), so the slice at x = 10 comes first.
+	files := map[string][]byte{
+		"a.dcm":      testDICOMSlice(true, "1.2.3", "4\\-5\\6", "1", "-1024", 12, []uint16{10, 11, 12, 13, 14, 0xF000 | 15}),
+		"b.dcm":      testDICOMSlice(false, "1.2.3", "10\\-5\\6", "1", "-1024", 12, []uint16{0, 1, 2, 3, 4, 5}),
+		"c.dcm":      testDICOMSlice(true, "1.2.3", "7\\-5\\6", "1", "-1024", 12, []uint16{20, 21, 22, 23, 24, 25}),
+		"other.dcm":  testDICOMSlice(false, "4.5.6", "0\\0\\0", "0.5", "0", 16, []uint16{2, 4, 6, 8, 10, 12}),
+		"notes.txt":  []byte("not a DICOM file"),
+		"nopixel.dc": encodeTestDICOM(dicomExplicitVRLittleEndian, []testDICOMElement{{dicomTagSeriesInstanceUID, "UI", []byte("7.8.9")}}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err := ReadDICOMSeriesIDs(tempDir)
+	if err != nil {
+		t.Fatalf("failed to read series IDs: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "1.2.3" || ids[1] != "4.5.6" {
+		t.Fatalf("expected series [1.2.3 4.5.6], got %v", ids)
+	}
+	if _, err := ReadImage(tempDir, ImageTypeDICOM, nil); err == nil {
+		t.Errorf("expected error reading a directory with several series")
+	}
+
+	img, err := ReadDICOMSeries(tempDir, "1.2.3")
+	if err != nil {
+		t.Fatalf("failed to read series: %v", err)
+	}
+	if img.GetPixelType() != PixelTypeInt16 {
+		t.Errorf("expected pixel type %d, got %d", PixelTypeInt16, img.GetPixelType())
+	}
+	expectedSize := []uint32{3, 2, 3}
+	expectedSpacing := []float64{0.75, 0.5, 3}
+	expectedOrigin := []float64{10, -5, 6}
+	for i := 0; i < 3; i++ {
+		if img.GetSize()[i] != expectedSize[i] ||
+			!almostEqual(img.GetSpacing()[i], expectedSpacing[i], 1e-9) ||
+			!almostEqual(img.GetOrigin()[i], expectedOrigin[i], 1e-9) {
+			t.Fatalf("geometry mismatch: got size %v spacing %v origin %v", img.GetSize(), img.GetSpacing(), img.GetOrigin())
+		}
+	}
+	expectedDirection := [9]float64{0, 1, 0, 0, 0, -1, -1, 0, 0}
+	if img.GetDirection() != expectedDirection {
+		t.Errorf("expected direction %v, got %v", expectedDirection, img.GetDirection())
+	}
+
+	tests := []struct {
+		index    []uint32
+		expected int16
+	}{
+		{[]uint32{0, 0, 0}, -1024},
+		{[]uint32{2, 1, 0}, -1019},
+		{[]uint32{1, 0, 1}, -1003},
+		{[]uint32{2, 1, 2}, -1009},
+	}
+	for _, tt := range tests {
+		value, err := img.GetPixelAsInt16(tt.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != tt.expected {
+			t.Errorf("pixel %v: expected %d, got %d", tt.index, tt.expected, value)
+		}
+	}
+
+	// Non-integral rescale parameters produce floating point pixels.
+	img, err = ReadDICOMSeries(tempDir, "4.5.6")
+	if err != nil {
+		t.Fatalf("failed to read series: %v", err)
+	}
+	if img.GetPixelType() != PixelTypeFloat32 {
+		t.Fatalf("expected pixel type %d, got %d", PixelTypeFloat32, img.GetPixelType())
+	}
+	if img.GetSpacing()[2] != 2.5 {
+		t.Errorf("expected slice thickness spacing 2.5, got %v", img.GetSpacing()[2])
+	}
+	if value, _ := img.GetPixelAsFloat32([]uint32{2, 1, 0}); value != 6 {
+		t.Errorf("expected rescaled value 6, got %v", value)
+	}
+
+	// A single file reads as a one-slice volume.
+	img, err = ReadImage(filepath.Join(tempDir, "other.dcm"), ImageTypeDICOM, nil)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if img.GetSize()[2] != 1 {
+		t.Errorf("expected one slice, got size %v", img.GetSize())
+	}
+}
+
+func TestReadDICOMInvalidFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_dicom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	truncated := testDICOMSlice(true, "1.2.3", "0\\0\\0", "1", "0", 16, []uint16{1, 2, 3, 4, 5, 6})
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not dicom", []byte("hello world, this is text")},
+		{"truncated", truncated[:len(truncated)-4]},
+		{"compressed", encodeTestDICOM("1.2.840.10008.1.2.4.50", nil)},
+		{"short element", encodeTestDICOM(dicomExplicitVRLittleEndian, []testDICOMElement{
+			{dicomTagSeriesInstanceUID, "UI", []byte("1.2.3")},
+			{dicomTagSamplesPerPixel, "UL", testDICOMUS(1)},
+			{dicomTagRows, "US", testDICOMUS(2)},
+			{dicomTagColumns, "US", testDICOMUS(3)},
+			{dicomTagPixelData, "OW", make([]byte, 12)},
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, "test.dcm")
+			if err := os.WriteFile(filename, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ReadImage(filename, ImageTypeDICOM, nil); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestWriteDICOMSeries(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_dicom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	source := filepath.Join(tempDir, "source.dcm")
+	if err := os.WriteFile(source, testDICOMSlice(false, "1.2.3", "0\\0\\0", "1", "0", 16, []uint16{1, 2, 3, 4, 5, 6}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := ReadDICOMTags(source)
+	if err != nil {
+		t.Fatalf("failed to read tags: %v", err)
+	}
+	if tags[dicomTagSeriesInstanceUID].Value != "1.2.3" || tags[dicomTagRows] != (DICOMAttribute{"US", "2"}) || tags[dicomTagPixelSpacing].Value != "0.5\\0.75" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+	tags[dicomTagPatientName] = DICOMAttribute{Value: "Doe^Jane"}
+	tags[dicomTagStudyInstanceUID] = DICOMAttribute{Value: "1.2.99"}
+	// Binary attributes and window settings are written with their VR.
+	kept := map[DICOMTag]DICOMAttribute{
+		0x00181310: {"US", "0\\256\\256\\0"},
+		0x00091001: {"FD", "1.5\\-2"},
+		0x00091002: {"SL", "-7"},
+		0x00281050: {"DS", "40"},
+		0x00281051: {"DS", "400"},
+	}
+	for tag, attribute := range kept {
+		tags[tag] = attribute
+	}
+
+	floatImg := newTestImage(t, []uint32{4, 3, 2}, PixelTypeFloat32, 1, func(i int) float64 { return float64(i)*0.37 - 2 })
+
+	tests := []struct {
+		name      string
+		img       *Image
+		pixelType int
+		tolerance float64
+	}{
+		{name: "int16", img: newNIfTITestImage(t), pixelType: PixelTypeInt16},
+		{name: "float32", img: floatImg, pixelType: PixelTypeFloat32, tolerance: 1e-3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := filepath.Join(tempDir, tt.name)
+			if err := WriteDICOMSeries(tt.img, directory, tags); err != nil {
+				t.Fatalf("failed to write series: %v", err)
+			}
+			ids, err := ReadDICOMSeriesIDs(directory)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 1 || ids[0] == "1.2.3" {
+				t.Fatalf("expected one new series, got %v", ids)
+			}
+			readTags, err := ReadDICOMTags(filepath.Join(directory, "IM00002.dcm"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if readTags[dicomTagPatientName] != (DICOMAttribute{"PN", "Doe^Jane"}) || readTags[dicomTagStudyInstanceUID].Value != "1.2.99" || readTags[dicomTagInstanceNumber].Value != "2" {
+				t.Errorf("unexpected tags: %v", readTags)
+			}
+			for tag, attribute := range kept {
+				if readTags[tag] != attribute {
+					t.Errorf("tag %s: expected %v, got %v", tag, attribute, readTags[tag])
+				}
+			}
+			ds, err := readDICOMFile(filepath.Join(directory, "IM00001.dcm"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if syntax := ds.getString(dicomTagTransferSyntaxUID); syntax != dicomExplicitVRLittleEndian {
+				t.Errorf("expected explicit VR little endian, got %s", syntax)
+			}
+
+			readImg, err := ReadImage(directory, ImageTypeDICOM, nil)
+			if err != nil {
+				t.Fatalf("failed to read series: %v", err)
+			}
+			if readImg.GetPixelType() != tt.pixelType {
+				t.Errorf("expected pixel type %d, got %d", tt.pixelType, readImg.GetPixelType())
+			}
+			for i := range tt.img.GetSize() {
+				if readImg.GetSize()[i] != tt.img.GetSize()[i] ||
+					!almostEqual(readImg.GetSpacing()[i], tt.img.GetSpacing()[i], 1e-9) ||
+					!almostEqual(readImg.GetOrigin()[i], tt.img.GetOrigin()[i], 1e-9) {
+					t.Fatalf("geometry mismatch: got size %v spacing %v origin %v", readImg.GetSize(), readImg.GetSpacing(), readImg.GetOrigin())
+				}
+			}
+			if readImg.GetDirection() != tt.img.GetDirection() {
+				t.Errorf("expected direction %v, got %v", tt.img.GetDirection(), readImg.GetDirection())
+			}
+			for i := 0; i < int(tt.img.NumPixels()); i++ {
+				expected, got := tt.img.getLinearPixelAsFloat64(i), readImg.getLinearPixelAsFloat64(i)
+				if !almostEqual(expected, got, tt.tolerance) {
+					t.Fatalf("pixel %d: expected %v, got %v", i, expected, got)
+				}
+			}
+		})
+	}
+
+	invalid := []struct {
+		name string
+		tags map[DICOMTag]DICOMAttribute
+	}{
+		{name: "unknown VR", tags: map[DICOMTag]DICOMAttribute{0x00091003: {Value: "text"}}},
+		{name: "binary VR", tags: map[DICOMTag]DICOMAttribute{0x00091003: {"OB", "1"}}},
+		{name: "out of range", tags: map[DICOMTag]DICOMAttribute{0x00181310: {"US", "70000"}}},
+	}
+	for _, tt := range invalid {
+		if err := WriteDICOMSeries(floatImg, filepath.Join(tempDir, "invalid"), tt.tags); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+
+	// A 2D image is written as a single axial slice.
+	img2D, err := NewImage([]uint32{3, 2}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory := filepath.Join(tempDir, "2d")
+	if err := img2D.Save(directory, ImageTypeDICOM); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	readImg, err := ReadImage(filepath.Join(directory, "IM00001.dcm"), ImageTypeDICOM, nil)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	if size := readImg.GetSize(); size[0] != 3 || size[1] != 2 || size[2] != 1 {
+		t.Errorf("expected size [3 2 1], got %v", size)
+	}
+}
+
+func TestDICOMMetaData(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_dicom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	source := filepath.Join(tempDir, "source.dcm")
+	if err := os.WriteFile(source, testDICOMSlice(true, "1.2.3", "0\\0\\0", "1", "0", 16, []uint16{1, 2, 3, 4, 5, 6}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := ReadImage(source, ImageTypeDICOM, nil)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	if value, _ := img.GetMetaData("0020|000e"); value != "1.2.3" {
+		t.Errorf("expected series instance UID 1.2.3, got %q", value)
+	}
+	if value, _ := img.GetMetaData("0028|0030"); value != "0.5\\0.75" {
+		t.Errorf("expected pixel spacing 0.5\\0.75, got %q", value)
+	}
+
+	img.SetMetaData("0010|0010", "Doe^Jane")
+	img.SetMetaData("0010|0020", "from metadata")
+	img.SetMetaData("Comment", "not a tag")
+	img.SetMetaData("0028|1050", "40")
+	directory := filepath.Join(tempDir, "series")
+	if err := WriteDICOMSeries(img, directory, map[DICOMTag]DICOMAttribute{dicomTagPatientID: {Value: "explicit"}}); err != nil {
+		t.Fatalf("failed to write series: %v", err)
+	}
+	tags, err := ReadDICOMTags(filepath.Join(directory, "IM00001.dcm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags[dicomTagPatientName].Value != "Doe^Jane" || tags[dicomTagPatientID].Value != "explicit" {
+		t.Errorf("unexpected patient attributes: %q %q", tags[dicomTagPatientName], tags[dicomTagPatientID])
+	}
+	if tags[0x00281050] != (DICOMAttribute{"DS", "40"}) || tags[dicomTagPixelSpacing] != (DICOMAttribute{"DS", "0.5\\0.75"}) {
+		t.Errorf("unexpected pixel attributes: %v %v", tags[0x00281050], tags[dicomTagPixelSpacing])
+	}
+	if tags[dicomTagSeriesInstanceUID].Value == "1.2.3" {
+		t.Errorf("expected a new series instance UID")
+	}
+}
@@ -0,0 +1,385 @@
+package imagetk
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// FFT computes the discrete Fourier transform of a scalar image along all of
+// its axes.
+//
+// Returns:
+//   - *Image: A Complex64 image for Float32 and Complex64 images and a Complex128 image otherwise, with the geometry of the image
+//   - error: Error if the image has several components
+//
+// Any size is supported: lengths with small prime factors use a mixed-radix
+// transform and other lengths the Bluestein algorithm. Real images transform
+// two lines at once along the first axis. Element k of each axis is the
+// frequency k/(n*spacing) for k below n/2 and (k-n)/(n*spacing) above; use
+// FFTShift to move the zero frequency to the centre.
+func FFT(image *Image) (*Image, error) {
+	if err := requireScalarImage(image); err != nil {
+		return nil, err
+	}
+	size := intSize(image.size)
+	var spectrum []complex128
+	if isComplexPixelType(image.pixelType) {
+		spectrum = complexValues(image)
+		fftND(spectrum, size, 0, false)
+	} else {
+		spectrum = realFFTND(imageValues(image), size)
+	}
+	return newComplexImageFromValues(image, complexPixelType(image.pixelType), spectrum)
+}
+
+// InverseFFT computes the inverse discrete Fourier transform of a scalar
+// image along all of its axes, scaled so that it undoes FFT.
+//
+// Returns:
+//   - *Image: A Complex64 image for Float32 and Complex64 images and a Complex128 image otherwise, with the geometry of the image
+//   - error: Error if the image has several components
+//
+// Use Real to keep the real part of the result of filtering a real image.
+func InverseFFT(image *Image) (*Image, error) {
+	if err := requireScalarImage(image); err != nil {
+		return nil, err
+	}
+	values := complexValues(image)
+	fftND(values, intSize(image.size), 0, true)
+	return newComplexImageFromValues(image, complexPixelType(image.pixelType), values)
+}
+
+// FFTShift moves the zero frequency of a Fourier transform from the first
+// voxel to the centre, at index n/2 along each axis, by shifting the image
+// circularly. It works on images of any pixel type and components.
+//
+// Returns:
+//   - *Image: The shifted image, with the geometry of the image
+//   - error: Error if the image cannot be created
+func FFTShift(image *Image) (*Image, error) {
+	shift := make([]int, image.dimension)
+	for k, n := range image.size {
+		shift[k] = int(n) / 2
+	}
+	return circularShift(image, shift)
+}
+
+// InverseFFTShift undoes FFTShift, moving the zero frequency from the centre
+// back to the first voxel. For odd sizes it differs from FFTShift.
+//
+// Returns:
+//   - *Image: The shifted image, with the geometry of the image
+//   - error: Error if the image cannot be created
+func InverseFFTShift(image *Image) (*Image, error) {
+	shift := make([]int, image.dimension)
+	for k, n := range image.size {
+		shift[k] = (int(n) + 1) / 2
+	}
+	return circularShift(image, shift)
+}
+
+// circularShift moves the pixel at index i to index (i+shift) mod size.
+func circularShift(image *Image, shift []int) (*Image, error) {
+	out, err := newImageLike(image, image.pixelType, image.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+	width := image.bytesPerPixel * image.GetNumberOfComponentsPerPixel()
+	total := int(image.NumPixels())
+	parallelFor(total, func(start, end int) {
+		for i := start; i < end; i++ {
+			target, stride, rest := 0, 1, i
+			for k, n := range image.size {
+				target += (rest%int(n) + shift[k]) % int(n) * stride
+				rest /= int(n)
+				stride *= int(n)
+			}
+			copy(out.pixels[target*width:(target+1)*width], image.pixels[i*width:(i+1)*width])
+		}
+	})
+	return out, nil
+}
+
+// complexPixelType returns the complex pixel type that holds values of the
+// given pixel type without losing precision beyond that of Float32 values.
+func complexPixelType(pixelType int) int {
+	if pixelType == PixelTypeFloat32 || pixelType == PixelTypeComplex64 {
+		return PixelTypeComplex64
+	}
+	return PixelTypeComplex128
+}
+
+// intSize returns the size of an image as ints.
+func intSize(size []uint32) []int {
+	result := make([]int, len(size))
+	for k, n := range size {
+		result[k] = int(n)
+	}
+	return result
+}
+
+// complexValues returns the values of a scalar image as complex128.
+func complexValues(image *Image) []complex128 {
+	values := make([]complex128, image.NumPixels())
+	parallelFor(len(values), func(start, end int) {
+		for i := start; i < end; i++ {
+			values[i] = image.getLinearPixelAsComplex128(i)
+		}
+	})
+	return values
+}
+
+// newComplexImageFromValues returns a scalar image with the geometry and
+// metadata of like, the given complex pixel type and the given values.
+func newComplexImageFromValues(like *Image, pixelType int, values []complex128) (*Image, error) {
+	out, err := newImageLike(like, pixelType, 1)
+	if err != nil {
+		return nil, err
+	}
+	parallelFor(len(values), func(start, end int) {
+		for i := start; i < end; i++ {
+			out.setLinearComplexPixel(i, values[i])
+		}
+	})
+	return out, nil
+}
+
+// fftPlan holds the factors and twiddle factors of a transform of length n.
+// Lengths whose prime factors are all small use a recursive mixed-radix
+// transform; other lengths use the Bluestein algorithm, which computes the
+// transform as a convolution of power of two length.
+type fftPlan struct {
+	n        int
+	factors  []int
+	twiddles []complex128
+	// chirp, chirpSpectrum and convolution are only set for Bluestein plans.
+	chirp         []complex128
+	chirpSpectrum []complex128
+	convolution   *fftPlan
+}
+
+// maximumRadix is the largest prime factor that the mixed-radix transform
+// handles directly. Its butterflies cost radix² operations.
+const maximumRadix = 13
+
+// newFFTPlan returns the plan of a forward or inverse transform of length n.
+func newFFTPlan(n int, inverse bool) *fftPlan {
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	plan := &fftPlan{n: n}
+	rest := n
+	for _, radix := range []int{4, 2, 3, 5} {
+		for rest%radix == 0 && rest > 1 {
+			plan.factors = append(plan.factors, radix)
+			rest /= radix
+		}
+	}
+	for radix := 7; radix*radix <= rest; radix += 2 {
+		for rest%radix == 0 {
+			plan.factors = append(plan.factors, radix)
+			rest /= radix
+		}
+	}
+	if rest > 1 {
+		plan.factors = append(plan.factors, rest)
+	}
+
+	if n <= maximumRadix || plan.factors[len(plan.factors)-1] <= maximumRadix {
+		plan.twiddles = make([]complex128, n)
+		for k := range plan.twiddles {
+			plan.twiddles[k] = cmplx.Rect(1, sign*2*math.Pi*float64(k)/float64(n))
+		}
+		return plan
+	}
+
+	// Bluestein: with jk = (j² + k² - (k-j)²)/2, the transform is the chirp
+	// times the convolution of the chirped input with the conjugate chirp.
+	// k² is reduced modulo 2n to keep the angles accurate.
+	plan.factors = nil
+	m := nextPowerOfTwo(2*n - 1)
+	plan.convolution = newFFTPlan(m, false)
+	plan.chirp = make([]complex128, n)
+	for k := range plan.chirp {
+		square := int64(k) * int64(k) % int64(2*n)
+		plan.chirp[k] = cmplx.Rect(1, sign*math.Pi*float64(square)/float64(n))
+	}
+	plan.chirpSpectrum = make([]complex128, m)
+	plan.chirpSpectrum[0] = cmplx.Conj(plan.chirp[0])
+	for k := 1; k < n; k++ {
+		plan.chirpSpectrum[k] = cmplx.Conj(plan.chirp[k])
+		plan.chirpSpectrum[m-k] = cmplx.Conj(plan.chirp[k])
+	}
+	plan.convolution.transform(plan.chirpSpectrum, plan.convolution.newScratch())
+	return plan
+}
+
+// newScratch returns the working memory that transform needs.
+func (p *fftPlan) newScratch() []complex128 {
+	if p.convolution != nil {
+		return make([]complex128, len(p.chirpSpectrum)+len(p.convolution.newScratch()))
+	}
+	return make([]complex128, p.n+maximumRadix)
+}
+
+// transform replaces data, of length p.n, by its unscaled transform.
+func (p *fftPlan) transform(data, scratch []complex128) {
+	if p.n <= 1 {
+		return
+	}
+	if p.convolution != nil {
+		m := len(p.chirpSpectrum)
+		work := scratch[:m]
+		for k := range work {
+			work[k] = 0
+		}
+		for k, value := range data {
+			work[k] = value * p.chirp[k]
+		}
+		p.convolution.transform(work, scratch[m:])
+		for k := range work {
+			work[k] *= p.chirpSpectrum[k]
+		}
+		// The inverse transform is the forward transform of the conjugate.
+		for k := range work {
+			work[k] = cmplx.Conj(work[k])
+		}
+		p.convolution.transform(work, scratch[m:])
+		scale := 1 / float64(m)
+		for k := range data {
+			data[k] = cmplx.Conj(work[k]) * complex(scale, 0) * p.chirp[k]
+		}
+		return
+	}
+	out := scratch[:p.n]
+	p.mixedRadix(out, data, 0, 1, p.factors, scratch[p.n:])
+	copy(data, out)
+}
+
+// mixedRadix writes to out the transform of the len(out) values of in that
+// start at offset and are stride apart, by splitting it into factors[0]
+// transforms of the interleaved subsequences.
+func (p *fftPlan) mixedRadix(out, in []complex128, offset, stride int, factors []int, butterfly []complex128) {
+	radix := factors[0]
+	m := len(out) / radix
+	if m == 1 {
+		for j := range out {
+			out[j] = in[offset+j*stride]
+		}
+	} else {
+		for j := 0; j < radix; j++ {
+			p.mixedRadix(out[j*m:(j+1)*m], in, offset+j*stride, stride*radix, factors[1:], butterfly)
+		}
+	}
+
+	// out[k+q*m] is the sum over j of W^(j*k) * W_radix^(j*q) * out[k+j*m],
+	// where W is the root of unity of the length radix*m = n/stride.
+	for k := 0; k < m; k++ {
+		for j := 0; j < radix; j++ {
+			butterfly[j] = out[k+j*m] * p.twiddles[j*k*stride%p.n]
+		}
+		switch radix {
+		case 2:
+			out[k], out[k+m] = butterfly[0]+butterfly[1], butterfly[0]-butterfly[1]
+		case 4:
+			// Multiplying by W_4 = ∓i swaps and negates parts.
+			a, b := butterfly[0]+butterfly[2], butterfly[0]-butterfly[2]
+			c, d := butterfly[1]+butterfly[3], butterfly[1]-butterfly[3]
+			d = d * p.twiddles[p.n/4]
+			out[k], out[k+m], out[k+2*m], out[k+3*m] = a+c, b+d, a-c, b-d
+		default:
+			for q := 0; q < radix; q++ {
+				sum := butterfly[0]
+				for j := 1; j < radix; j++ {
+					sum += butterfly[j] * p.twiddles[j*q*m*stride%p.n]
+				}
+				out[k+q*m] = sum
+			}
+		}
+	}
+}
+
+// nextPowerOfTwo returns the smallest power of two that is at least n.
+func nextPowerOfTwo(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+// fftND transforms an N-D array of the given size, with the first axis
+// varying fastest, in place along every axis from firstAxis on. The inverse
+// transform is scaled by the number of elements of those axes.
+func fftND(data []complex128, size []int, firstAxis int, inverse bool) {
+	stride := 1
+	for _, n := range size[:firstAxis] {
+		stride *= n
+	}
+	count := 1
+	for _, n := range size[firstAxis:] {
+		if n > 1 {
+			plan := newFFTPlan(n, inverse)
+			numLines := len(data) / n
+			parallelForCost(numLines, n, func(startLine, endLine int) {
+				line := make([]complex128, n)
+				scratch := plan.newScratch()
+				for l := startLine; l < endLine; l++ {
+					start := (l/stride)*stride*n + l%stride
+					for i := range line {
+						line[i] = data[start+i*stride]
+					}
+					plan.transform(line, scratch)
+					for i, value := range line {
+						data[start+i*stride] = value
+					}
+				}
+			})
+		}
+		stride *= n
+		count *= n
+	}
+	if inverse {
+		scale := complex(1/float64(count), 0)
+		for i := range data {
+			data[i] *= scale
+		}
+	}
+}
+
+// realFFTND returns the forward transform of real values of the given size.
+// Along the first axis, two real lines a and b are transformed at once as
+// a + ib and separated using the conjugate symmetry of real transforms.
+func realFFTND(values []float64, size []int) []complex128 {
+	n := size[0]
+	spectrum := make([]complex128, len(values))
+	numLines := len(values) / n
+	plan := newFFTPlan(n, false)
+	parallelForCost((numLines+1)/2, 2*n, func(startPair, endPair int) {
+		line := make([]complex128, n)
+		scratch := plan.newScratch()
+		for pair := startPair; pair < endPair; pair++ {
+			a, b := values[2*pair*n:(2*pair+1)*n], []float64(nil)
+			if 2*pair+1 < numLines {
+				b = values[(2*pair+1)*n : (2*pair+2)*n]
+			}
+			for i := range line {
+				line[i] = complex(a[i], 0)
+				if b != nil {
+					line[i] = complex(a[i], b[i])
+				}
+			}
+			plan.transform(line, scratch)
+			for k, z := range line {
+				mirror := cmplx.Conj(line[(n-k)%n])
+				spectrum[2*pair*n+k] = (z + mirror) / 2
+				if b != nil {
+					spectrum[(2*pair+1)*n+k] = (z - mirror) / 2i
+				}
+			}
+		}
+	})
+	fftND(spectrum, size, 1, false)
+	return spectrum
+}
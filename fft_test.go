@@ -0,0 +1,178 @@
+package imagetk
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+// referenceDFT computes the N-D discrete Fourier transform by its definition.
+func referenceDFT(values []complex128, size []int) []complex128 {
+	result := make([]complex128, len(values))
+	for k := range result {
+		for j, value := range values {
+			phase, restK, restJ := 0.0, k, j
+			for _, n := range size {
+				phase += float64((restK%n)*(restJ%n)) / float64(n)
+				restK /= n
+				restJ /= n
+			}
+			result[k] += value * cmplx.Rect(1, -2*math.Pi*phase)
+		}
+	}
+	return result
+}
+
+func TestFFT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name    string
+		size    []uint32
+		complex bool
+	}{
+		{"powers of two", []uint32{8, 4}, false},
+		{"mixed radix", []uint32{6, 15}, false},
+		{"odd number of lines", []uint32{12, 5}, false},
+		{"Bluestein", []uint32{17, 3}, false},
+		{"complex", []uint32{10, 7}, true},
+		{"volume", []uint32{4, 3, 19}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pixelType := PixelTypeFloat64
+			if tt.complex {
+				pixelType = PixelTypeComplex128
+			}
+			img, err := NewImage(tt.size, pixelType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values := make([]complex128, img.NumPixels())
+			for i := range values {
+				values[i] = complex(rng.Float64()-0.5, 0)
+				if tt.complex {
+					values[i] += complex(0, rng.Float64()-0.5)
+				}
+				img.setLinearComplexPixel(i, values[i])
+			}
+
+			spectrum, err := FFT(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spectrum.GetPixelType() != PixelTypeComplex128 {
+				t.Fatalf("expected a Complex128 image, got pixel type %d", spectrum.GetPixelType())
+			}
+			want := referenceDFT(values, intSize(tt.size))
+			for i := range want {
+				if got := spectrum.getLinearPixelAsComplex128(i); cmplx.Abs(got-want[i]) > 1e-9 {
+					t.Fatalf("frequency %d: expected %v, got %v", i, want[i], got)
+				}
+			}
+
+			restored, err := InverseFFT(spectrum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range values {
+				if got := restored.getLinearPixelAsComplex128(i); cmplx.Abs(got-values[i]) > 1e-12 {
+					t.Fatalf("value %d: expected %v after the inverse transform, got %v", i, values[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestFFTLengths(t *testing.T) {
+	// Round trips through radices 2 to 13, a square of a large prime and large primes.
+	for _, n := range []int{1, 2, 9, 13, 64, 97, 289, 360, 1001, 1031} {
+		rng := rand.New(rand.NewSource(int64(n)))
+		values := make([]complex128, n)
+		for i := range values {
+			values[i] = complex(rng.Float64(), rng.Float64())
+		}
+		data := append([]complex128(nil), values...)
+		fftND(data, []int{n}, 0, false)
+		// Parseval's theorem checks the forward transform of long lines.
+		energy, spectrumEnergy := 0.0, 0.0
+		for i := range values {
+			energy += real(values[i] * cmplx.Conj(values[i]))
+			spectrumEnergy += real(data[i] * cmplx.Conj(data[i]))
+		}
+		if !almostEqual(spectrumEnergy/float64(n), energy, 1e-9*energy) {
+			t.Errorf("length %d: expected energy %v, got %v", n, energy, spectrumEnergy/float64(n))
+		}
+		fftND(data, []int{n}, 0, true)
+		for i := range values {
+			if cmplx.Abs(data[i]-values[i]) > 1e-10 {
+				t.Fatalf("length %d: value %d: expected %v, got %v", n, i, values[i], data[i])
+			}
+		}
+	}
+}
+
+func TestFFTPixelTypes(t *testing.T) {
+	img, err := NewImage([]uint32{4, 4}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 16; i++ {
+		img.setLinearPixelFromFloat64(i, 1)
+	}
+	spectrum, err := FFT(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spectrum.GetPixelType() != PixelTypeComplex64 {
+		t.Fatalf("expected a Complex64 image, got pixel type %d", spectrum.GetPixelType())
+	}
+	// A constant image has all of its energy at the zero frequency.
+	if got := spectrum.getLinearPixelAsComplex128(0); got != 16 {
+		t.Errorf("expected 16 at the zero frequency, got %v", got)
+	}
+	if got := spectrum.getLinearPixelAsComplex128(5); got != 0 {
+		t.Errorf("expected 0 at other frequencies, got %v", got)
+	}
+
+	vector, err := NewVectorImage([]uint32{4, 4}, PixelTypeFloat32, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FFT(vector); err == nil {
+		t.Errorf("expected error for a vector image")
+	}
+	if _, err := InverseFFT(vector); err == nil {
+		t.Errorf("expected error for a vector image")
+	}
+}
+
+func TestFFTShift(t *testing.T) {
+	img, err := NewImage([]uint32{5, 4}, PixelTypeInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		img.setLinearPixelFromFloat64(i, float64(i))
+	}
+	shifted, err := FFTShift(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The zero frequency moves to index (5/2, 4/2).
+	if got, _ := shifted.GetPixelAsInt16([]uint32{2, 2}); got != 0 {
+		t.Errorf("expected the first value at the centre, got %v", got)
+	}
+	if got, _ := shifted.GetPixelAsInt16([]uint32{0, 0}); got != 13 {
+		t.Errorf("expected value 13 at the first index, got %v", got)
+	}
+	restored, err := InverseFFTShift(shifted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if got := restored.getLinearPixelAsFloat64(i); got != float64(i) {
+			t.Fatalf("value %d: expected the inverse shift to restore the image, got %v", i, got)
+		}
+	}
+}
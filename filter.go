@@ -0,0 +1,158 @@
+package imagetk
+
+import (
+	"fmt"
+)
+
+// Boundary conditions that neighbourhood filters use for voxels outside the image.
+const (
+	// BoundaryReplicate repeats the edge voxel (zero flux Neumann): a a | a b c d | d d.
+	BoundaryReplicate = iota
+	// BoundaryZero treats voxels outside the image as 0.
+	BoundaryZero
+	// BoundaryConstant treats voxels outside the image as a given constant.
+	BoundaryConstant
+	// BoundaryMirror reflects the image about its edge voxels: c b | a b c d | c b.
+	BoundaryMirror
+	// BoundaryPeriodic wraps the image around: c d | a b c d | a b.
+	BoundaryPeriodic
+)
+
+// checkBoundary returns an error for unknown boundary conditions.
+func checkBoundary(boundary int) error {
+	if boundary < BoundaryReplicate || boundary > BoundaryPeriodic {
+		return fmt.Errorf("unsupported boundary condition: %d", boundary)
+	}
+	return nil
+}
+
+// boundaryIndex maps index i of a line of n voxels into [0, n) according to
+// the boundary condition. ok is false for indices outside the line with
+// BoundaryZero and BoundaryConstant.
+func boundaryIndex(i, n, boundary int) (index int, ok bool) {
+	if i >= 0 && i < n {
+		return i, true
+	}
+	switch boundary {
+	case BoundaryReplicate:
+		return min(max(i, 0), n-1), true
+	case BoundaryMirror:
+		if n == 1 {
+			return 0, true
+		}
+		period := 2 * (n - 1)
+		i %= period
+		if i < 0 {
+			i += period
+		}
+		if i >= n {
+			i = period - i
+		}
+		return i, true
+	case BoundaryPeriodic:
+		i %= n
+		if i < 0 {
+			i += n
+		}
+		return i, true
+	default:
+		return 0, false
+	}
+}
+
+// extendLine copies line into padded, which holds len(line)+2*pad values,
+// filling pad values on each side according to the boundary condition.
+func extendLine(padded, line []float64, pad, boundary int, constant float64) {
+	n := len(line)
+	for i := range padded {
+		if index, ok := boundaryIndex(i-pad, n, boundary); ok {
+			padded[i] = line[index]
+		} else if boundary == BoundaryConstant {
+			padded[i] = constant
+		} else {
+			padded[i] = 0
+		}
+	}
+}
+
+// imageValues returns the values of a real image as float64, with the
+// components of each pixel next to each other.
+func imageValues(image *Image) []float64 {
+	values := make([]float64, len(image.pixels)/image.bytesPerPixel)
+	parallelFor(len(values), func(start, end int) {
+		for i := start; i < end; i++ {
+			values[i] = image.getLinearPixelAsFloat64(i)
+		}
+	})
+	return values
+}
+
+// newImageFromValues returns an image with the geometry and metadata of like
+// and the given pixel type, components and values. Values are rounded and
+// clamped to the range of integer pixel types.
+func newImageFromValues(like *Image, pixelType, components int, values []float64) (*Image, error) {
+	out, err := newImageLike(like, pixelType, components)
+	if err != nil {
+		return nil, err
+	}
+	if pixelType == PixelTypeFloat64 {
+		setPixelsOf(out, values)
+		return out, nil
+	}
+	_, _, integer := integerPixelTypeRange(pixelType)
+	parallelFor(len(values), func(start, end int) {
+		for i := start; i < end; i++ {
+			if integer {
+				out.setLinearPixelSaturated(i, values[i])
+			} else {
+				out.setLinearPixelFromFloat64(i, values[i])
+			}
+		}
+	})
+	return out, nil
+}
+
+// filterLines calls fn for every line of values along an axis of an image of
+// the given size and components, in parallel. fn receives a copy of the line
+// and the buffer for the result, both of length size[axis]; the result is
+// stored back into values.
+func filterLines(values []float64, size []uint32, components, axis int, fn func(line, result []float64)) {
+	n := int(size[axis])
+	stride := components
+	for _, s := range size[:axis] {
+		stride *= int(s)
+	}
+	numLines := len(values) / n
+	parallelForCost(numLines, n, func(startLine, endLine int) {
+		line := make([]float64, n)
+		result := make([]float64, n)
+		for l := startLine; l < endLine; l++ {
+			// Lines start at every offset below the stride of the axis, in
+			// every block of stride*n values.
+			start := (l/stride)*stride*n + l%stride
+			for i := range line {
+				line[i] = values[start+i*stride]
+			}
+			fn(line, result)
+			for i, value := range result {
+				values[start+i*stride] = value
+			}
+		}
+	})
+}
+
+// perAxis expands values given once or once per axis to one value per axis.
+func perAxis[T any](values []T, dimension int, name string) ([]T, error) {
+	switch len(values) {
+	case dimension:
+		return values, nil
+	case 1:
+		expanded := make([]T, dimension)
+		for i := range expanded {
+			expanded[i] = values[0]
+		}
+		return expanded, nil
+	default:
+		return nil, fmt.Errorf("expected 1 or %d %s values, got %d", dimension, name, len(values))
+	}
+}
@@ -0,0 +1,336 @@
+package imagetk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// sniffSize is the number of leading bytes passed to format sniffers.
+const sniffSize = 1024
+
+// ImageFormat describes an image file format for RegisterFormat.
+type ImageFormat struct {
+	// Name identifies the format in error messages, e.g. "NIfTI".
+	Name string
+	// Extensions lists the filename extensions of the format including the
+	// leading dot, e.g. ".nii" and ".nii.gz". Matching ignores case.
+	Extensions []string
+	// Sniff reports whether the leading bytes of a file belong to the format.
+	// Gzip-compressed files are decompressed before sniffing. May be nil.
+	Sniff func(header []byte) bool
+	// Directory reports whether the format reads an image from a directory,
+	// such as a DICOM series.
+	Directory bool
+	// Read reads an image from a file. May be nil for write-only formats.
+	Read func(filename string) (*Image, error)
+	// Write writes an image to a file, compressing the pixel data if
+	// compressed is true and the format supports it. May be nil for read-only formats.
+	Write func(img *Image, filename string, compressed bool) error
+	// MultiComponent reports whether Write supports images with more than one
+	// component per pixel.
+	MultiComponent bool
+	// NDimensional reports whether Write supports images with more than three
+	// dimensions.
+	NDimensional bool
+}
+
+var (
+	imageFormatsMutex sync.RWMutex
+	// imageFormats is indexed by image type.
+	imageFormats = []ImageFormat{
+		ImageTypeRaw: {
+			Name: "raw",
+			Write: func(img *Image, filename string, compressed bool) error {
+				return img.saveImageTypeRaw(filename)
+			},
+			MultiComponent: true,
+			NDimensional:   true,
+		},
+		ImageTypeMHD: {
+			Name:           "MetaImage",
+			Extensions:     []string{".mhd", ".mha"},
+			Sniff:          isMHDHeader,
+			Read:           readImageTypeMHD,
+			Write:          (*Image).saveImageTypeMHD,
+			MultiComponent: true,
+			NDimensional:   true,
+		},
+		ImageTypeNIfTI: {
+			Name:       "NIfTI",
+			Extensions: []string{".nii", ".nii.gz", ".hdr", ".hdr.gz"},
+			Sniff:      isNIfTIHeader,
+			Read:       readImageTypeNIfTI,
+			Write: func(img *Image, filename string, compressed bool) error {
+				return img.saveImageTypeNIfTI(filename)
+			},
+			MultiComponent: true,
+			NDimensional:   true,
+		},
+		ImageTypeNRRD: {
+			Name:       "NRRD",
+			Extensions: []string{".nrrd", ".nhdr"},
+			Sniff:      hasPrefix("NRRD000"),
+			Read:       readImageTypeNRRD,
+			Write:      (*Image).saveImageTypeNRRD,
+		},
+		ImageTypeDICOM: {
+			Name:       "DICOM",
+			Extensions: []string{".dcm", ".dicom"},
+			Sniff: func(header []byte) bool {
+				return len(header) >= 132 && string(header[128:132]) == "DICM"
+			},
+			Directory: true,
+			Read:      readImageTypeDICOM,
+			Write: func(img *Image, filename string, compressed bool) error {
+				return img.saveImageTypeDICOM(filename, nil)
+			},
+		},
+		ImageTypeTIFF: {
+			Name:       "TIFF",
+			Extensions: []string{".tif", ".tiff", ".btf"},
+			Sniff:      hasPrefix("II*\x00", "MM\x00*", "II+\x00", "MM\x00+"),
+			Read:       readImageTypeTIFF,
+			Write:      (*Image).saveImageTypeTIFF,
+		},
+		ImageTypePNG: {
+			Name:       "PNG",
+			Extensions: []string{".png"},
+			Sniff:      hasPrefix("\x89PNG\r\n\x1a\n"),
+			Read:       readImageTypeBitmap,
+			Write: func(img *Image, filename string, compressed bool) error {
+				return img.saveImageTypePNG(filename)
+			},
+		},
+		ImageTypeJPEG: {
+			Name:       "JPEG",
+			Extensions: []string{".jpg", ".jpeg"},
+			Sniff:      hasPrefix("\xff\xd8\xff"),
+			Read:       readImageTypeBitmap,
+		},
+		ImageTypeBMP: {
+			Name:       "BMP",
+			Extensions: []string{".bmp"},
+			Sniff:      hasPrefix("BM"),
+			Read:       readImageTypeBitmap,
+		},
+		ImageTypeGIF: {
+			Name:       "GIF",
+			Extensions: []string{".gif"},
+			Sniff:      hasPrefix("GIF87a", "GIF89a"),
+			Read:       readImageTypeBitmap,
+		},
+		ImageTypeVTK: {
+			Name:       "VTK",
+			Extensions: []string{".vtk", ".vti"},
+			Sniff: func(header []byte) bool {
+				return bytes.HasPrefix(header, []byte("# vtk DataFile")) || bytes.Contains(header, []byte("<VTKFile"))
+			},
+			Read:  readImageTypeVTK,
+			Write: (*Image).saveImageTypeVTK,
+		},
+	}
+)
+
+// RegisterFormat adds an image file format, making it available to ReadImage,
+// ReadImageAuto, WriteImage and Save.
+//
+// Parameters:
+//   - format: The format description, with a unique name and a reader, a writer or both
+//
+// Returns:
+//   - int: The image type to pass to ReadImage, WriteImage and Save
+//   - error: Error if the format is invalid or its name is already registered
+//
+// ReadImageAuto tries the sniffers of all formats in registration order before
+// falling back to the extensions, so built-in formats take precedence.
+func RegisterFormat(format ImageFormat) (int, error) {
+	if format.Name == "" {
+		return 0, fmt.Errorf("format name must not be empty")
+	}
+	if format.Read == nil && format.Write == nil {
+		return 0, fmt.Errorf("format %s has neither a reader nor a writer", format.Name)
+	}
+	for _, extension := range format.Extensions {
+		if !strings.HasPrefix(extension, ".") {
+			return 0, fmt.Errorf("format extension must start with a dot: %s", extension)
+		}
+	}
+
+	imageFormatsMutex.Lock()
+	defer imageFormatsMutex.Unlock()
+	for _, registered := range imageFormats {
+		if strings.EqualFold(registered.Name, format.Name) {
+			return 0, fmt.Errorf("format %s is already registered", format.Name)
+		}
+	}
+	format.Extensions = append([]string(nil), format.Extensions...)
+	imageFormats = append(imageFormats, format)
+	return len(imageFormats) - 1, nil
+}
+
+// getImageFormat returns the format registered for an image type.
+func getImageFormat(imageType int) (ImageFormat, error) {
+	imageFormatsMutex.RLock()
+	defer imageFormatsMutex.RUnlock()
+	if imageType < 0 || imageType >= len(imageFormats) {
+		return ImageFormat{}, fmt.Errorf("unknown image type")
+	}
+	return imageFormats[imageType], nil
+}
+
+// ReadImageAuto reads an image, detecting the file format from its leading
+// bytes or, failing that, from the filename extension.
+//
+// Parameters:
+//   - filename: Path to the image file, or to a directory holding a DICOM series
+//
+// Returns:
+//   - *Image: The loaded image object
+//   - error: Error if the format is not recognized or reading fails
+//
+// Raw files cannot be detected; use ReadRawImage to read them.
+func ReadImageAuto(filename string) (*Image, error) {
+	imageType, err := DetectImageType(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ReadImage(filename, imageType, nil)
+}
+
+// DetectImageType returns the image type of a file from its leading bytes or,
+// failing that, from the filename extension.
+//
+// Parameters:
+//   - filename: Path to the image file, or to a directory holding a DICOM series
+//
+// Returns:
+//   - int: The detected image type
+//   - error: Error if the file cannot be opened or the format is not recognized
+func DetectImageType(filename string) (int, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open image file: %v", err)
+	}
+
+	imageFormatsMutex.RLock()
+	defer imageFormatsMutex.RUnlock()
+	if info.IsDir() {
+		for imageType, format := range imageFormats {
+			if format.Directory && format.Read != nil {
+				return imageType, nil
+			}
+		}
+		return 0, fmt.Errorf("no image format reads directories")
+	}
+
+	header, err := readSniffHeader(filename)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read image file: %v", err)
+	}
+	for imageType, format := range imageFormats {
+		if format.Read != nil && format.Sniff != nil && format.Sniff(header) {
+			return imageType, nil
+		}
+	}
+
+	lower := strings.ToLower(filename)
+	bestType, bestLength := -1, 0
+	for imageType, format := range imageFormats {
+		for _, extension := range format.Extensions {
+			if format.Read != nil && len(extension) > bestLength && strings.HasSuffix(lower, strings.ToLower(extension)) {
+				bestType, bestLength = imageType, len(extension)
+			}
+		}
+	}
+	if bestType < 0 {
+		return 0, fmt.Errorf("unrecognized image format: %s", filename)
+	}
+	return bestType, nil
+}
+
+// readSniffHeader returns up to sniffSize leading bytes of a file,
+// decompressed if the file is gzip-compressed.
+func readSniffHeader(filename string) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+	if n < 2 || header[0] != 0x1f || header[1] != 0x8b {
+		return header, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return header, nil
+	}
+	defer reader.Close()
+	decompressed := make([]byte, sniffSize)
+	n, err = io.ReadFull(reader, decompressed)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return header, nil
+	}
+	return decompressed[:n], nil
+}
+
+// hasPrefix returns a sniffer matching any of the given prefixes.
+func hasPrefix(prefixes ...string) func([]byte) bool {
+	return func(header []byte) bool {
+		for _, prefix := range prefixes {
+			if bytes.HasPrefix(header, []byte(prefix)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isMHDHeader reports whether the header starts with a MetaImage key.
+func isMHDHeader(header []byte) bool {
+	header = bytes.TrimLeft(header, " \t\r\n")
+	for _, key := range []string{"ObjectType", "NDims"} {
+		if bytes.HasPrefix(header, []byte(key)) {
+			rest := bytes.TrimLeft(header[len(key):], " \t")
+			return bytes.HasPrefix(rest, []byte("="))
+		}
+	}
+	return false
+}
+
+// isNIfTIHeader reports whether the header is a NIfTI-1 or NIfTI-2 header in
+// either byte order.
+func isNIfTIHeader(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header) {
+		case niftiHeaderSize1:
+			if len(header) >= niftiHeaderSize1 {
+				magic := string(header[344:348])
+				return magic == "n+1\x00" || magic == "ni1\x00"
+			}
+		case niftiHeaderSize2:
+			if len(header) >= 8 {
+				magic := string(header[4:8])
+				return magic == "n+2\x00" || magic == "ni2\x00"
+			}
+		}
+	}
+	return false
+}
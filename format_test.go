@@ -0,0 +1,173 @@
+package imagetk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadImageAuto(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newNIfTITestImage(t)
+	slice, err := NewImage([]uint32{4, 3}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(slice.NumPixels()); i++ {
+		slice.setLinearPixelFromFloat64(i, float64(i*20))
+	}
+
+	tests := []struct {
+		name       string
+		img        *Image
+		filename   string
+		imageType  int
+		compressed bool
+		// renamed is the filename the file is moved to before reading, to
+		// check that detection does not rely on the extension.
+		renamed string
+	}{
+		{name: "mha", img: img, filename: "test.mha", imageType: ImageTypeMHD, renamed: "mha_data"},
+		{name: "mhd", img: img, filename: "test.mhd", imageType: ImageTypeMHD},
+		{name: "nii", img: img, filename: "test.nii", imageType: ImageTypeNIfTI, renamed: "nii_data"},
+		{name: "nii.gz", img: img, filename: "test.nii.gz", imageType: ImageTypeNIfTI, renamed: "niigz_data"},
+		{name: "hdr", img: img, filename: "pair.hdr", imageType: ImageTypeNIfTI},
+		{name: "nrrd", img: img, filename: "test.nrrd", imageType: ImageTypeNRRD, compressed: true, renamed: "nrrd_data"},
+		{name: "dicom", img: img, filename: "series", imageType: ImageTypeDICOM},
+		{name: "tiff", img: slice, filename: "test.tif", imageType: ImageTypeTIFF, renamed: "tiff_data"},
+		{name: "png", img: slice, filename: "test.png", imageType: ImageTypePNG, renamed: "png_data"},
+		{name: "vtk", img: slice, filename: "test.vtk", imageType: ImageTypeVTK, renamed: "vtk_data"},
+		{name: "vti", img: img, filename: "test.vti", imageType: ImageTypeVTK, renamed: "vti_data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := tt.img.save(filename, tt.imageType, tt.compressed); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			if tt.renamed != "" {
+				renamed := filepath.Join(tempDir, tt.renamed)
+				if err := os.Rename(filename, renamed); err != nil {
+					t.Fatal(err)
+				}
+				filename = renamed
+			}
+			imageType, err := DetectImageType(filename)
+			if err != nil {
+				t.Fatalf("failed to detect image type: %v", err)
+			}
+			if imageType != tt.imageType {
+				t.Errorf("expected image type %d, got %d", tt.imageType, imageType)
+			}
+			readImg, err := ReadImageAuto(filename)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if readImg.GetPixelType() != tt.img.GetPixelType() || !bytes.Equal(readImg.pixels, tt.img.pixels) {
+				t.Errorf("pixel data mismatch")
+			}
+		})
+	}
+
+	// Files without a recognizable header fall back to the extension.
+	unknown := filepath.Join(tempDir, "unknown.dat")
+	if err := os.WriteFile(unknown, []byte("no magic here"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadImageAuto(unknown); err == nil {
+		t.Errorf("expected error for unrecognized file")
+	}
+	jpeg := filepath.Join(tempDir, "broken.JPG")
+	if err := os.WriteFile(jpeg, []byte("no magic here"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if imageType, err := DetectImageType(jpeg); err != nil || imageType != ImageTypeJPEG {
+		t.Errorf("expected JPEG from extension, got %d: %v", imageType, err)
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A toy format holding a magic string followed by 8-bit pixels of a 2D image
+	// with a single row.
+	format := ImageFormat{
+		Name:       "TestRow",
+		Extensions: []string{".row"},
+		Sniff:      hasPrefix("ROW1"),
+		Read: func(filename string) (*Image, error) {
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			img, err := NewImage([]uint32{uint32(len(data) - 4), 1}, PixelTypeUInt8)
+			if err != nil {
+				return nil, err
+			}
+			copy(img.pixels, data[4:])
+			return img, nil
+		},
+		Write: func(img *Image, filename string, compressed bool) error {
+			return os.WriteFile(filename, append([]byte("ROW1"), img.pixels...), 0644)
+		},
+	}
+	imageType, err := RegisterFormat(format)
+	if err != nil {
+		t.Fatalf("failed to register format: %v", err)
+	}
+	if imageType <= ImageTypeVTK {
+		t.Errorf("expected a new image type, got %d", imageType)
+	}
+
+	img, err := NewImage([]uint32{5, 1}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(img.pixels, []byte{1, 2, 3, 4, 5})
+	filename := filepath.Join(tempDir, "data")
+	if err := WriteImage(img, filename, imageType); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	readImg, err := ReadImageAuto(filename)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	if !bytes.Equal(readImg.pixels, img.pixels) {
+		t.Errorf("pixel data mismatch")
+	}
+
+	invalid := []struct {
+		name   string
+		format ImageFormat
+	}{
+		{"duplicate", format},
+		{"builtin name", ImageFormat{Name: "nifti", Read: format.Read}},
+		{"empty name", ImageFormat{Read: format.Read}},
+		{"no reader or writer", ImageFormat{Name: "Empty"}},
+		{"extension without dot", ImageFormat{Name: "NoDot", Extensions: []string{"row"}, Read: format.Read}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := RegisterFormat(tt.format); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+
+	if err := WriteImage(img, filepath.Join(tempDir, "test.jpg"), ImageTypeJPEG); err == nil {
+		t.Errorf("expected error writing read-only format")
+	}
+	if _, err := ReadImage(filename, -1, nil); err == nil {
+		t.Errorf("expected error for unknown image type")
+	}
+}
@@ -0,0 +1,167 @@
+package imagetk
+
+import (
+	"fmt"
+	"math"
+)
+
+// Transfer function shapes of LowPassFilter, HighPassFilter and BandPassFilter.
+const (
+	// FrequencyIdeal passes frequencies up to the cutoff and blocks the rest.
+	FrequencyIdeal = iota
+	// FrequencyButterworth passes 1/(1+(f/cutoff)^(2*order)) of frequency f.
+	FrequencyButterworth
+	// FrequencyGaussian passes exp(-f²/(2*cutoff²)) of frequency f.
+	FrequencyGaussian
+)
+
+// FrequencyFilterOptions configures LowPassFilter, HighPassFilter and BandPassFilter.
+type FrequencyFilterOptions struct {
+	// Shape is the transfer function; the zero value is FrequencyIdeal.
+	Shape int
+	// Cutoff is the cutoff frequency in cycles per physical unit, such as
+	// cycles/mm, and the lower cutoff of band-pass filters.
+	Cutoff float64
+	// HighCutoff is the upper cutoff frequency of band-pass filters.
+	HighCutoff float64
+	// Order is the order of Butterworth filters. Zero selects 2.
+	Order int
+}
+
+// LowPassFilter keeps the low spatial frequencies of a scalar image.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The shape and cutoff frequency of the filter
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point or complex type
+//   - error: Error if the options are invalid or the image has several components
+//
+// The filter multiplies the Fourier transform of the image by a transfer
+// function of the length of the frequency vector, in cycles per physical unit
+// along each axis, so the image is treated as periodic.
+func LowPassFilter(image *Image, options FrequencyFilterOptions) (*Image, error) {
+	lowPass, err := lowPassTransfer(options, options.Cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return frequencyFilter(image, lowPass)
+}
+
+// HighPassFilter keeps the high spatial frequencies of a scalar image, with
+// the transfer function 1 minus that of LowPassFilter.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The shape and cutoff frequency of the filter
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point or complex type
+//   - error: Error if the options are invalid or the image has several components
+func HighPassFilter(image *Image, options FrequencyFilterOptions) (*Image, error) {
+	lowPass, err := lowPassTransfer(options, options.Cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return frequencyFilter(image, func(f float64) float64 { return 1 - lowPass(f) })
+}
+
+// BandPassFilter keeps the spatial frequencies of a scalar image between
+// Cutoff and HighCutoff, with the product of the transfer functions of a
+// high-pass filter at Cutoff and a low-pass filter at HighCutoff.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The shape and cutoff frequencies of the filter
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point or complex type
+//   - error: Error if the options are invalid or the image has several components
+func BandPassFilter(image *Image, options FrequencyFilterOptions) (*Image, error) {
+	if !(options.HighCutoff > options.Cutoff) {
+		return nil, fmt.Errorf("high cutoff %g must be above the cutoff %g", options.HighCutoff, options.Cutoff)
+	}
+	low, err := lowPassTransfer(options, options.Cutoff)
+	if err != nil {
+		return nil, err
+	}
+	high, err := lowPassTransfer(options, options.HighCutoff)
+	if err != nil {
+		return nil, err
+	}
+	return frequencyFilter(image, func(f float64) float64 { return (1 - low(f)) * high(f) })
+}
+
+// lowPassTransfer returns the low-pass transfer function of the given shape
+// and cutoff frequency.
+func lowPassTransfer(options FrequencyFilterOptions, cutoff float64) (func(f float64) float64, error) {
+	if !(cutoff > 0) || math.IsInf(cutoff, 0) {
+		return nil, fmt.Errorf("invalid cutoff frequency: %g", cutoff)
+	}
+	switch options.Shape {
+	case FrequencyIdeal:
+		return func(f float64) float64 {
+			if f <= cutoff {
+				return 1
+			}
+			return 0
+		}, nil
+	case FrequencyButterworth:
+		order := options.Order
+		if order == 0 {
+			order = 2
+		}
+		if order < 0 {
+			return nil, fmt.Errorf("invalid Butterworth order: %d", options.Order)
+		}
+		return func(f float64) float64 { return 1 / (1 + math.Pow(f/cutoff, float64(2*order))) }, nil
+	case FrequencyGaussian:
+		return func(f float64) float64 { return math.Exp(-f * f / (2 * cutoff * cutoff)) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported frequency filter shape: %d", options.Shape)
+	}
+}
+
+// frequencyFilter multiplies the Fourier transform of a scalar image by a
+// transfer function of the frequency in cycles per physical unit. Real
+// images keep the real part of the result.
+func frequencyFilter(image *Image, transfer func(f float64) float64) (*Image, error) {
+	if err := requireScalarImage(image); err != nil {
+		return nil, err
+	}
+	size := intSize(image.size)
+	var spectrum []complex128
+	if isComplexPixelType(image.pixelType) {
+		spectrum = complexValues(image)
+		fftND(spectrum, size, 0, false)
+	} else {
+		spectrum = realFFTND(imageValues(image), size)
+	}
+
+	parallelFor(len(spectrum), func(start, end int) {
+		for i := start; i < end; i++ {
+			squared, rest := 0.0, i
+			for k, n := range size {
+				index := rest % n
+				rest /= n
+				if index > n/2 {
+					index -= n
+				}
+				frequency := float64(index) / (float64(n) * image.spacing[k])
+				squared += frequency * frequency
+			}
+			spectrum[i] *= complex(transfer(math.Sqrt(squared)), 0)
+		}
+	})
+	fftND(spectrum, size, 0, true)
+
+	if isComplexPixelType(image.pixelType) {
+		return newComplexImageFromValues(image, image.pixelType, spectrum)
+	}
+	values := make([]float64, len(spectrum))
+	for i, value := range spectrum {
+		values[i] = real(value)
+	}
+	return newImageFromValues(image, floatPixelType(image.pixelType), 1, values)
+}
@@ -0,0 +1,92 @@
+package imagetk
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFrequencyFilters(t *testing.T) {
+	// 3 plus a cosine of 0.5 cycles/mm along x, with 0.5 mm voxels.
+	img := newFunctionTestImage(t, []uint32{32, 16}, []float64{0.5, 1}, func(p []float64) float64 {
+		return 3 + math.Cos(2*math.Pi*0.5*p[0])
+	})
+	wave := func(x int) float64 { return math.Cos(2 * math.Pi * 0.5 * float64(x) * 0.5) }
+
+	tests := []struct {
+		name   string
+		filter func(*Image, FrequencyFilterOptions) (*Image, error)
+		opts   FrequencyFilterOptions
+		want   func(x int) float64
+	}{
+		{"ideal low-pass", LowPassFilter, FrequencyFilterOptions{Cutoff: 0.25}, func(int) float64 { return 3 }},
+		{"ideal high-pass", HighPassFilter, FrequencyFilterOptions{Cutoff: 0.25}, wave},
+		{"ideal band-pass", BandPassFilter, FrequencyFilterOptions{Cutoff: 0.25, HighCutoff: 0.75}, wave},
+		{"ideal band-stop of the wave", BandPassFilter, FrequencyFilterOptions{Cutoff: 0.6, HighCutoff: 0.9}, func(int) float64 { return 0 }},
+		{"butterworth low-pass", LowPassFilter, FrequencyFilterOptions{Shape: FrequencyButterworth, Cutoff: 0.25},
+			func(x int) float64 { return 3 + wave(x)/17 }},
+		{"butterworth order 1 high-pass", HighPassFilter, FrequencyFilterOptions{Shape: FrequencyButterworth, Cutoff: 0.25, Order: 1},
+			func(x int) float64 { return wave(x) * 4 / 5 }},
+		{"gaussian low-pass", LowPassFilter, FrequencyFilterOptions{Shape: FrequencyGaussian, Cutoff: 0.25},
+			func(x int) float64 { return 3 + wave(x)*math.Exp(-2) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.filter(img, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.GetPixelType() != PixelTypeFloat64 {
+				t.Fatalf("expected a Float64 image, got pixel type %d", out.GetPixelType())
+			}
+			for _, index := range [][2]int{{0, 0}, {1, 3}, {2, 7}, {7, 15}} {
+				got, _ := out.GetPixelAsFloat64([]uint32{uint32(index[0]), uint32(index[1])})
+				if want := tt.want(index[0]); !almostEqual(got, want, 1e-9) {
+					t.Errorf("at %v: expected %v, got %v", index, want, got)
+				}
+			}
+		})
+	}
+
+	spectrum, err := FFT(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered, err := LowPassFilter(spectrum, FrequencyFilterOptions{Cutoff: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filtered.GetPixelType() != PixelTypeComplex128 {
+		t.Errorf("expected a complex image for complex input, got pixel type %d", filtered.GetPixelType())
+	}
+}
+
+func TestFrequencyFilterErrors(t *testing.T) {
+	img, err := NewImage([]uint32{8, 8}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, options := range []FrequencyFilterOptions{
+		{},
+		{Cutoff: -1},
+		{Cutoff: math.Inf(1)},
+		{Cutoff: 1, Shape: 5},
+		{Cutoff: 1, Shape: FrequencyButterworth, Order: -2},
+	} {
+		if _, err := LowPassFilter(img, options); err == nil {
+			t.Errorf("expected error for options %+v", options)
+		}
+		if _, err := HighPassFilter(img, options); err == nil {
+			t.Errorf("expected error for options %+v", options)
+		}
+	}
+	if _, err := BandPassFilter(img, FrequencyFilterOptions{Cutoff: 1, HighCutoff: 0.5}); err == nil {
+		t.Errorf("expected error for a high cutoff below the cutoff")
+	}
+	vector, err := NewVectorImage([]uint32{8, 8}, PixelTypeUInt8, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LowPassFilter(vector, FrequencyFilterOptions{Cutoff: 1}); err == nil {
+		t.Errorf("expected error for a vector image")
+	}
+}
@@ -0,0 +1,287 @@
+package imagetk
+
+import (
+	"fmt"
+	"math"
+)
+
+// GaussianOptions configures DiscreteGaussian and RecursiveGaussian.
+type GaussianOptions struct {
+	// Sigma is the standard deviation of the Gaussian in physical units, either
+	// one value for all axes or one value per axis. Axes with a zero sigma and
+	// derivative order are left unchanged.
+	Sigma []float64
+	// Order is the derivative order along each axis, 0, 1 or 2, either one
+	// value for all axes or one value per axis. nil smooths without derivatives.
+	Order []int
+	// Boundary is the boundary condition; the zero value is BoundaryReplicate.
+	Boundary int
+	// Constant is the value outside the image for BoundaryConstant.
+	Constant float64
+	// MaximumError is the largest part of the discrete Gaussian kernel that may
+	// be cut off at its ends. Zero selects 0.01.
+	MaximumError float64
+}
+
+// DiscreteGaussian smooths an image, or computes its Gaussian derivatives, by
+// separable convolution with the discrete Gaussian kernel of Lindeberg.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The sigma in physical units, derivative orders, boundary condition and kernel accuracy
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options are invalid or the image is complex
+//
+// Sigma is divided by the spacing of each axis, and derivatives are taken with
+// respect to physical distance along the image axes. The components of
+// multi-component images are filtered separately. Lines along each axis are
+// filtered in parallel.
+func DiscreteGaussian(image *Image, options GaussianOptions) (*Image, error) {
+	return gaussianFilter(image, options, false)
+}
+
+// RecursiveGaussian smooths an image, or computes its Gaussian derivatives,
+// with the third order recursive filter of Young and van Vliet, whose cost
+// does not depend on sigma.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The sigma in physical units, derivative orders and boundary condition
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options are invalid or the image is complex
+//
+// Derivatives are central differences of the smoothed lines. The recursive
+// filter is only accurate from a sigma of half a voxel, so axes with a smaller
+// sigma use the discrete Gaussian kernel instead. Each line is extended by
+// about four sigma according to the boundary condition before filtering.
+func RecursiveGaussian(image *Image, options GaussianOptions) (*Image, error) {
+	return gaussianFilter(image, options, true)
+}
+
+// gaussianFilter filters image along each axis with a discrete or recursive Gaussian.
+func gaussianFilter(image *Image, options GaussianOptions, recursive bool) (*Image, error) {
+	values, err := gaussianValues(image, options, recursive)
+	if err != nil {
+		return nil, err
+	}
+	return newImageFromValues(image, floatPixelType(image.pixelType), image.GetNumberOfComponentsPerPixel(), values)
+}
+
+// gaussianValues returns the values of image filtered along each axis with a
+// discrete or recursive Gaussian, laid out like imageValues.
+func gaussianValues(image *Image, options GaussianOptions, recursive bool) ([]float64, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	if err := checkBoundary(options.Boundary); err != nil {
+		return nil, err
+	}
+	dimension := int(image.dimension)
+	sigma, err := perAxis(options.Sigma, dimension, "sigma")
+	if err != nil {
+		return nil, err
+	}
+	order := make([]int, dimension)
+	if options.Order != nil {
+		if order, err = perAxis(options.Order, dimension, "derivative order"); err != nil {
+			return nil, err
+		}
+	}
+	maximumError := options.MaximumError
+	if maximumError == 0 {
+		maximumError = 0.01
+	}
+	if !(maximumError > 0 && maximumError < 1) {
+		return nil, fmt.Errorf("invalid maximum kernel error: %g", maximumError)
+	}
+	for axis := range sigma {
+		if !(sigma[axis] >= 0) || math.IsInf(sigma[axis], 0) {
+			return nil, fmt.Errorf("invalid sigma: %g", sigma[axis])
+		}
+		if order[axis] < 0 || order[axis] > 2 {
+			return nil, fmt.Errorf("unsupported derivative order: %d", order[axis])
+		}
+	}
+
+	values := imageValues(image)
+	components := image.GetNumberOfComponentsPerPixel()
+	for axis := range sigma {
+		if sigma[axis] == 0 && order[axis] == 0 {
+			continue
+		}
+		spacing := image.spacing[axis]
+		sigmaIndex := sigma[axis] / spacing
+		scale := math.Pow(spacing, -float64(order[axis]))
+		if recursive && sigmaIndex >= 0.5 {
+			coefficients := youngVanVlietCoefficients(sigmaIndex)
+			pad := int(math.Ceil(4*sigmaIndex)) + 3
+			filterLines(values, image.size, components, axis, func(line, result []float64) {
+				recursiveGaussianLine(line, result, coefficients, pad, order[axis], scale, options.Boundary, options.Constant)
+			})
+			continue
+		}
+		kernel := derivativeKernel(discreteGaussianKernel(sigmaIndex, maximumError), order[axis])
+		for i := range kernel {
+			kernel[i] *= scale
+		}
+		filterLines(values, image.size, components, axis, func(line, result []float64) {
+			correlateLine(line, result, kernel, options.Boundary, options.Constant)
+		})
+	}
+	return values, nil
+}
+
+// discreteGaussianKernel returns the discrete Gaussian kernel e^-t I_n(t) with
+// variance t = sigma², where sigma is in voxels and I_n is the modified Bessel
+// function of the first kind. The kernel is cut off where less than
+// maximumError of it remains at its ends, and normalised to sum to 1. Element
+// r of the returned 2r+1 weights is the centre.
+func discreteGaussianKernel(sigma, maximumError float64) []float64 {
+	if sigma == 0 {
+		return []float64{1}
+	}
+	t := sigma * sigma
+	limit := int(math.Ceil(6*sigma)) + 2
+
+	// Miller's algorithm: recur I_{n-1} = I_{n+1} + (2n/t) I_n downwards from
+	// well beyond the limit, then normalise, since e^-t ∑ I_n(t) = 1.
+	terms := make([]float64, limit+1)
+	start := limit + 10 + int(math.Sqrt(40*float64(limit)))
+	above, current := 0.0, 1e-30
+	for n := start; n > 0; n-- {
+		below := above + 2*float64(n)/t*current
+		above, current = current, below
+		if n-1 <= limit {
+			terms[n-1] = current
+		}
+		if current > 1e200 {
+			above *= 1e-200
+			current *= 1e-200
+			for k := n - 1; k <= limit; k++ {
+				terms[k] *= 1e-200
+			}
+		}
+	}
+	total := terms[0]
+	for _, term := range terms[1:] {
+		total += 2 * term
+	}
+
+	radius, kept := 0, terms[0]/total
+	for radius < limit && 1-kept > maximumError {
+		radius++
+		kept += 2 * terms[radius] / total
+	}
+	kernel := make([]float64, 2*radius+1)
+	for k := 0; k <= radius; k++ {
+		kernel[radius+k] = terms[k] / total / kept
+		kernel[radius-k] = kernel[radius+k]
+	}
+	return kernel
+}
+
+// derivativeKernel combines a smoothing kernel with the central difference
+// of the given order, growing it by one weight on each side per order.
+func derivativeKernel(kernel []float64, order int) []float64 {
+	var difference []float64
+	switch order {
+	case 0:
+		return kernel
+	case 1:
+		difference = []float64{-0.5, 0, 0.5}
+	default:
+		difference = []float64{1, -2, 1}
+	}
+	combined := make([]float64, len(kernel)+2)
+	for j, d := range difference {
+		for k, w := range kernel {
+			combined[j+k] += d * w
+		}
+	}
+	return combined
+}
+
+// correlateLine sets result[i] to the sum of kernel[r+k] * line[i+k] for
+// offsets k from -r to r, extending the line by the boundary condition.
+func correlateLine(line, result, kernel []float64, boundary int, constant float64) {
+	radius := len(kernel) / 2
+	padded := make([]float64, len(line)+2*radius)
+	extendLine(padded, line, radius, boundary, constant)
+	for i := range result {
+		sum := 0.0
+		for k, w := range kernel {
+			sum += w * padded[i+k]
+		}
+		result[i] = sum
+	}
+}
+
+// youngVanVlietCoefficients returns the normalised feedback coefficients
+// b1/b0, b2/b0, b3/b0 and the gain B of the recursive Gaussian for a sigma
+// of at least 0.5 voxels. Rather than the approximate relation between q and
+// sigma of the original paper, q is chosen so that the impulse response of
+// the causal and anti-causal passes has a variance of exactly sigma².
+func youngVanVlietCoefficients(sigma float64) [4]float64 {
+	coefficients := func(q float64) [4]float64 {
+		q2, q3 := q*q, q*q*q
+		b0 := 1.57825 + 2.44413*q + 1.4281*q2 + 0.422205*q3
+		b1 := (2.44413*q + 2.85619*q2 + 1.26661*q3) / b0
+		b2 := -(1.4281*q2 + 1.26661*q3) / b0
+		b3 := 0.422205 * q3 / b0
+		return [4]float64{b1, b2, b3, 1 - (b1 + b2 + b3)}
+	}
+	// The causal pass has mean delay ∑k·bk/B and variance ∑k²·bk/B + mean².
+	variance := func(c [4]float64) float64 {
+		mean := (c[0] + 2*c[1] + 3*c[2]) / c[3]
+		return 2 * ((c[0]+4*c[1]+9*c[2])/c[3] + mean*mean)
+	}
+	low, high := 0.0, 2*sigma+10
+	for i := 0; i < 100; i++ {
+		if q := (low + high) / 2; variance(coefficients(q)) < sigma*sigma {
+			low = q
+		} else {
+			high = q
+		}
+	}
+	return coefficients((low + high) / 2)
+}
+
+// recursiveGaussianLine smooths a line with a causal and an anti-causal pass
+// of the recursive Gaussian, after extending it by pad values on each side,
+// and takes central differences for derivatives.
+func recursiveGaussianLine(line, result []float64, c [4]float64, pad, order int, scale float64, boundary int, constant float64) {
+	b1, b2, b3, gain := c[0], c[1], c[2], c[3]
+	padded := make([]float64, len(line)+2*pad)
+	extendLine(padded, line, pad, boundary, constant)
+
+	// Start each pass in the steady state of a constant signal.
+	w1, w2, w3 := padded[0], padded[0], padded[0]
+	for i, x := range padded {
+		w := gain*x + b1*w1 + b2*w2 + b3*w3
+		padded[i] = w
+		w1, w2, w3 = w, w1, w2
+	}
+	last := padded[len(padded)-1]
+	w1, w2, w3 = last, last, last
+	for i := len(padded) - 1; i >= 0; i-- {
+		w := gain*padded[i] + b1*w1 + b2*w2 + b3*w3
+		padded[i] = w
+		w1, w2, w3 = w, w1, w2
+	}
+
+	for i := range result {
+		p := pad + i
+		switch order {
+		case 0:
+			result[i] = padded[p]
+		case 1:
+			result[i] = (padded[p+1] - padded[p-1]) / 2 * scale
+		default:
+			result[i] = (padded[p+1] - 2*padded[p] + padded[p-1]) * scale
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package imagetk
+
+import (
+	"math"
+	"testing"
+)
+
+// newImpulseTestImage returns a Float64 image that is 1 at index and 0 elsewhere.
+func newImpulseTestImage(t *testing.T, size, index []uint32) *Image {
+	t.Helper()
+	img, err := NewImage(size, PixelTypeFloat64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := img.SetPixel(index, 1.0); err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// impulseMoments returns the sum of the values along the first axis of row y
+// and their variance in voxels around x.
+func impulseMoments(img *Image, y uint32, x float64) (float64, float64) {
+	width := img.GetSize()[0]
+	sum, variance := 0.0, 0.0
+	for i := uint32(0); i < width; i++ {
+		value := img.getLinearPixelAsFloat64(int(y*width + i))
+		sum += value
+		variance += value * (float64(i) - x) * (float64(i) - x)
+	}
+	return sum, variance / sum
+}
+
+func TestGaussianImpulseResponse(t *testing.T) {
+	img := newImpulseTestImage(t, []uint32{101, 3}, []uint32{50, 1})
+	img.SetSpacing([]float64{0.5, 1})
+
+	for _, tt := range []struct {
+		name      string
+		filter    func(*Image, GaussianOptions) (*Image, error)
+		tolerance float64
+	}{
+		{"discrete", DiscreteGaussian, 0.01},
+		{"recursive", RecursiveGaussian, 0.05},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Sigma 2 mm is 4 voxels along x; y is not smoothed.
+			out, err := tt.filter(img, GaussianOptions{Sigma: []float64{2, 0}, MaximumError: 1e-6})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum, variance := impulseMoments(out, 1, 50)
+			if !almostEqual(sum, 1, 1e-6) {
+				t.Errorf("expected the kernel to sum to 1, got %v", sum)
+			}
+			if math.Abs(variance-16) > 16*tt.tolerance {
+				t.Errorf("expected a variance of 16 voxels², got %v", variance)
+			}
+			if rowSum, _ := impulseMoments(out, 0, 50); rowSum != 0 {
+				t.Errorf("expected no smoothing across rows, got %v", rowSum)
+			}
+			left, _ := out.GetPixelAsFloat64([]uint32{46, 1})
+			right, _ := out.GetPixelAsFloat64([]uint32{54, 1})
+			if !almostEqual(left, right, 1e-9) {
+				t.Errorf("expected a symmetric response, got %v and %v", left, right)
+			}
+		})
+	}
+}
+
+func TestGaussianDerivatives(t *testing.T) {
+	// f(x, y) = 3x² - 2y in physical units.
+	img, err := NewImage([]uint32{40, 30}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.SetSpacing([]float64{0.25, 0.5})
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			px, py := float64(x)*0.25, float64(y)*0.5
+			img.setLinearPixelFromFloat64(y*40+x, 3*px*px-2*py)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		order []int
+		want  func(px, py float64) float64
+	}{
+		{"smoothing", []int{0, 0}, func(px, py float64) float64 { return 3*px*px - 2*py + 3*1 }},
+		{"first derivative along x", []int{1, 0}, func(px, py float64) float64 { return 6 * px }},
+		{"first derivative along y", []int{0, 1}, func(px, py float64) float64 { return -2 }},
+		{"second derivative along x", []int{2, 0}, func(px, py float64) float64 { return 6 }},
+	}
+	for _, filter := range []struct {
+		name string
+		fn   func(*Image, GaussianOptions) (*Image, error)
+	}{
+		{"discrete", DiscreteGaussian},
+		{"recursive", RecursiveGaussian},
+	} {
+		for _, tt := range tests {
+			t.Run(filter.name+" "+tt.name, func(t *testing.T) {
+				out, err := filter.fn(img, GaussianOptions{Sigma: []float64{1}, Order: tt.order, MaximumError: 1e-6})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if out.GetPixelType() != PixelTypeFloat32 {
+					t.Fatalf("expected a Float32 image, got pixel type %d", out.GetPixelType())
+				}
+				// Away from the edges, where the replicated boundary bends the ramp.
+				for _, index := range [][2]int{{20, 15}, {18, 12}, {24, 17}} {
+					px, py := float64(index[0])*0.25, float64(index[1])*0.5
+					got := out.getLinearPixelAsFloat64(index[1]*40 + index[0])
+					if want := tt.want(px, py); math.Abs(got-want) > 0.05*math.Max(1, math.Abs(want)) {
+						t.Errorf("at %v: expected %v, got %v", index, want, got)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestGaussianBoundaries(t *testing.T) {
+	// An impulse next to the edge, so that mirroring reflects part of it back.
+	img := newImpulseTestImage(t, []uint32{20, 2}, []uint32{1, 0})
+	tests := []struct {
+		boundary int
+		constant float64
+		wantSum  func(sum float64) bool
+	}{
+		{BoundaryReplicate, 0, func(sum float64) bool { return sum > 0.8 && sum < 0.9 }},
+		{BoundaryZero, 0, func(sum float64) bool { return sum > 0.8 && sum < 0.9 }},
+		{BoundaryConstant, 1, func(sum float64) bool { return sum > 1.9 && sum < 2 }},
+		{BoundaryMirror, 0, func(sum float64) bool { return sum > 1.15 && sum < 1.25 }},
+		{BoundaryPeriodic, 0, func(sum float64) bool { return almostEqual(sum, 1, 1e-6) }},
+	}
+	for _, tt := range tests {
+		for _, filter := range []func(*Image, GaussianOptions) (*Image, error){DiscreteGaussian, RecursiveGaussian} {
+			out, err := filter(img, GaussianOptions{Sigma: []float64{1.5, 0}, Boundary: tt.boundary, Constant: tt.constant})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sum, _ := impulseMoments(out, 0, 0); !tt.wantSum(sum) {
+				t.Errorf("boundary %d: unexpected sum %v", tt.boundary, sum)
+			}
+		}
+	}
+
+	periodic, err := RecursiveGaussian(img, GaussianOptions{Sigma: []float64{1.5, 0}, Boundary: BoundaryPeriodic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two voxels on either side of the impulse, one of them across the edge.
+	first, _ := periodic.GetPixelAsFloat64([]uint32{3, 0})
+	last, _ := periodic.GetPixelAsFloat64([]uint32{19, 0})
+	if !almostEqual(first, last, 1e-6) {
+		t.Errorf("expected the periodic response to wrap around, got %v and %v", first, last)
+	}
+}
+
+func TestGaussianVolume(t *testing.T) {
+	volume, err := NewVectorImage([]uint32{24, 20, 16}, PixelTypeUInt8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume.SetSpacing([]float64{1, 1, 2})
+	for i := range volume.pixels {
+		volume.pixels[i] = uint8(100 + 50*(i%2))
+	}
+	for _, filter := range []func(*Image, GaussianOptions) (*Image, error){DiscreteGaussian, RecursiveGaussian} {
+		out, err := filter(volume, GaussianOptions{Sigma: []float64{2, 1, 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.GetPixelType() != PixelTypeFloat64 || out.GetNumberOfComponentsPerPixel() != 2 {
+			t.Fatalf("expected a Float64 image with 2 components")
+		}
+		for i := 0; i < len(out.pixels)/8; i++ {
+			if want := float64(100 + 50*(i%2)); !almostEqual(out.getLinearPixelAsFloat64(i), want, 1e-9) {
+				t.Fatalf("value %d: expected constant components to stay %v, got %v", i, want, out.getLinearPixelAsFloat64(i))
+			}
+		}
+	}
+}
+
+func TestGaussianErrors(t *testing.T) {
+	img, err := NewImage([]uint32{8, 8, 8}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, options := range []GaussianOptions{
+		{},
+		{Sigma: []float64{1, 1}},
+		{Sigma: []float64{-1}},
+		{Sigma: []float64{math.NaN()}},
+		{Sigma: []float64{1}, Order: []int{3}},
+		{Sigma: []float64{1}, Order: []int{1, 0}},
+		{Sigma: []float64{1}, Boundary: 9},
+		{Sigma: []float64{1}, MaximumError: 2},
+	} {
+		if _, err := DiscreteGaussian(img, options); err == nil {
+			t.Errorf("expected error for options %+v", options)
+		}
+		if _, err := RecursiveGaussian(img, options); err == nil {
+			t.Errorf("expected error for options %+v", options)
+		}
+	}
+	if _, err := DiscreteGaussian(newComplexTestImage(t), GaussianOptions{Sigma: []float64{1}}); err == nil {
+		t.Errorf("expected error for a complex image")
+	}
+}
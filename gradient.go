@@ -0,0 +1,313 @@
+package imagetk
+
+import (
+	"fmt"
+	"math"
+)
+
+// Derivative operators for Gradient, GradientMagnitude and Laplacian. The
+// Sobel, Prewitt and Scharr operators smooth across each axis with their
+// weights in every other direction, in 2D and 3D alike, and are normalised so
+// that a linear ramp has the same derivative as with central differences.
+const (
+	// GradientCentralDifference takes central differences along each axis.
+	GradientCentralDifference = iota
+	// GradientSobel smooths across each axis with the weights 1 2 1.
+	GradientSobel
+	// GradientPrewitt smooths across each axis with the weights 1 1 1.
+	GradientPrewitt
+	// GradientScharr smooths across each axis with the weights 3 10 3.
+	GradientScharr
+)
+
+// GradientOptions configures Gradient, GradientImages, GradientMagnitude and Laplacian.
+type GradientOptions struct {
+	// Operator is the derivative operator; the zero value is GradientCentralDifference.
+	Operator int
+	// Boundary is the boundary condition; the zero value is BoundaryReplicate.
+	Boundary int
+	// Constant is the value outside the image for BoundaryConstant.
+	Constant float64
+	// UseImageAxes keeps the derivatives along the image axes instead of
+	// rotating the gradient into physical space with the image direction.
+	UseImageAxes bool
+}
+
+// Gradient computes the gradient of a scalar image in physical units.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The derivative operator, boundary condition and axes of the gradient
+//
+// Returns:
+//   - *Image: A vector image with one component per dimension, Float64 for integer images or of the same floating point type
+//   - error: Error if the options are invalid, or the image is complex or has several components
+//
+// Derivatives are divided by the spacing of each axis. Unless UseImageAxes is
+// set, component j of the gradient is along physical axis j, so the gradient
+// of an oblique image points the same way in the world as that of an axis
+// aligned one.
+func Gradient(image *Image, options GradientOptions) (*Image, error) {
+	derivatives, err := gradientValues(image, options)
+	if err != nil {
+		return nil, err
+	}
+	n := len(derivatives)
+	values := make([]float64, n*len(derivatives[0]))
+	parallelFor(len(derivatives[0]), func(start, end int) {
+		for i := start; i < end; i++ {
+			for j, derivative := range derivatives {
+				values[i*n+j] = derivative[i]
+			}
+		}
+	})
+	return newImageFromValues(image, floatPixelType(image.pixelType), n, values)
+}
+
+// GradientImages computes the gradient of a scalar image in physical units as
+// one scalar image per axis.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The derivative operator, boundary condition and axes of the gradient
+//
+// Returns:
+//   - []*Image: The components of the gradient, as computed by Gradient
+//   - error: Error if the options are invalid, or the image is complex or has several components
+func GradientImages(image *Image, options GradientOptions) ([]*Image, error) {
+	derivatives, err := gradientValues(image, options)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]*Image, len(derivatives))
+	for j, derivative := range derivatives {
+		if images[j], err = newImageFromValues(image, floatPixelType(image.pixelType), 1, derivative); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// GradientMagnitude computes the length of the gradient of a scalar image in
+// physical units.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The derivative operator and boundary condition
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options are invalid, or the image is complex or has several components
+func GradientMagnitude(image *Image, options GradientOptions) (*Image, error) {
+	derivatives, err := gradientValues(image, options)
+	if err != nil {
+		return nil, err
+	}
+	return newImageFromValues(image, floatPixelType(image.pixelType), 1, sumOfSquaresRoot(derivatives))
+}
+
+// GradientMagnitudeRecursiveGaussian computes the length of the gradient of a
+// scalar image smoothed by a recursive Gaussian.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The sigma in physical units and boundary condition; Order must be nil
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options are invalid, or the image is complex or has several components
+//
+// Each component of the gradient is a first order Gaussian derivative as
+// computed by RecursiveGaussian.
+func GradientMagnitudeRecursiveGaussian(image *Image, options GaussianOptions) (*Image, error) {
+	if err := requireScalarImage(image); err != nil {
+		return nil, err
+	}
+	derivatives, err := gaussianDerivatives(image, options, 1)
+	if err != nil {
+		return nil, err
+	}
+	return newImageFromValues(image, floatPixelType(image.pixelType), 1, sumOfSquaresRoot(derivatives))
+}
+
+// Laplacian computes the sum of the second derivatives of an image along
+// each axis in physical units.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The derivative operator and boundary condition
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options are invalid or the image is complex
+//
+// The second derivatives are the differences 1 -2 1 along each axis, smoothed
+// across it by the Sobel, Prewitt or Scharr weights if selected. The
+// Laplacian does not depend on the direction, so UseImageAxes has no effect.
+// The components of multi-component images are filtered separately.
+func Laplacian(image *Image, options GradientOptions) (*Image, error) {
+	derivatives, err := axisDerivatives(image, options, 2)
+	if err != nil {
+		return nil, err
+	}
+	return newImageFromValues(image, floatPixelType(image.pixelType), image.GetNumberOfComponentsPerPixel(), sumValues(derivatives))
+}
+
+// LaplacianOfGaussian computes the sum of the second order recursive Gaussian
+// derivatives of an image along each axis.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The sigma in physical units and boundary condition; Order must be nil
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options are invalid or the image is complex
+//
+// Blobs brighter than their surroundings give negative responses. The
+// components of multi-component images are filtered separately.
+func LaplacianOfGaussian(image *Image, options GaussianOptions) (*Image, error) {
+	derivatives, err := gaussianDerivatives(image, options, 2)
+	if err != nil {
+		return nil, err
+	}
+	return newImageFromValues(image, floatPixelType(image.pixelType), image.GetNumberOfComponentsPerPixel(), sumValues(derivatives))
+}
+
+// requireScalarImage returns an error for multi-component images.
+func requireScalarImage(image *Image) error {
+	if components := image.GetNumberOfComponentsPerPixel(); components != 1 {
+		return fmt.Errorf("a scalar image is required, got %d components", components)
+	}
+	return nil
+}
+
+// gradientValues returns the first derivatives of a scalar image along each
+// axis, rotated into physical space unless options.UseImageAxes is set.
+func gradientValues(image *Image, options GradientOptions) ([][]float64, error) {
+	if err := requireScalarImage(image); err != nil {
+		return nil, err
+	}
+	derivatives, err := axisDerivatives(image, options, 1)
+	if err != nil {
+		return nil, err
+	}
+	if options.UseImageAxes {
+		return derivatives, nil
+	}
+
+	// Axis k points along row k of the direction matrix, so the physical
+	// gradient is the sum of the axis derivatives times their directions.
+	n := len(derivatives)
+	direction := image.GetDirectionMatrix()
+	parallelFor(len(derivatives[0]), func(start, end int) {
+		g := make([]float64, n)
+		for i := start; i < end; i++ {
+			for k, derivative := range derivatives {
+				g[k] = derivative[i]
+			}
+			for j, derivative := range derivatives {
+				sum := 0.0
+				for k := range g {
+					sum += g[k] * direction[k*n+j]
+				}
+				derivative[i] = sum
+			}
+		}
+	})
+	return derivatives, nil
+}
+
+// axisDerivatives returns the derivatives of the given order, 1 or 2, of an
+// image along each of its axes, divided by the spacing.
+func axisDerivatives(image *Image, options GradientOptions, order int) ([][]float64, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	if err := checkBoundary(options.Boundary); err != nil {
+		return nil, err
+	}
+	var smoothing []float64
+	switch options.Operator {
+	case GradientCentralDifference:
+	case GradientSobel:
+		smoothing = []float64{0.25, 0.5, 0.25}
+	case GradientPrewitt:
+		smoothing = []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}
+	case GradientScharr:
+		smoothing = []float64{3.0 / 16, 10.0 / 16, 3.0 / 16}
+	default:
+		return nil, fmt.Errorf("unsupported gradient operator: %d", options.Operator)
+	}
+
+	values := imageValues(image)
+	components := image.GetNumberOfComponentsPerPixel()
+	derivatives := make([][]float64, image.dimension)
+	for axis := range derivatives {
+		spacing := image.spacing[axis]
+		difference := []float64{-0.5 / spacing, 0, 0.5 / spacing}
+		if order == 2 {
+			difference = []float64{1 / (spacing * spacing), -2 / (spacing * spacing), 1 / (spacing * spacing)}
+		}
+		derivative := append([]float64(nil), values...)
+		for other := range derivatives {
+			kernel := smoothing
+			if other == axis {
+				kernel = difference
+			} else if kernel == nil {
+				continue
+			}
+			filterLines(derivative, image.size, components, other, func(line, result []float64) {
+				correlateLine(line, result, kernel, options.Boundary, options.Constant)
+			})
+		}
+		derivatives[axis] = derivative
+	}
+	return derivatives, nil
+}
+
+// gaussianDerivatives returns the recursive Gaussian derivatives of the given
+// order along each axis of an image.
+func gaussianDerivatives(image *Image, options GaussianOptions, order int) ([][]float64, error) {
+	if options.Order != nil {
+		return nil, fmt.Errorf("derivative orders are set by the filter, got %v", options.Order)
+	}
+	derivatives := make([][]float64, image.dimension)
+	for axis := range derivatives {
+		options.Order = make([]int, image.dimension)
+		options.Order[axis] = order
+		derivative, err := gaussianValues(image, options, true)
+		if err != nil {
+			return nil, err
+		}
+		derivatives[axis] = derivative
+	}
+	return derivatives, nil
+}
+
+// sumValues adds the other equally long slices to the first and returns it.
+func sumValues(values [][]float64) []float64 {
+	sum := values[0]
+	for _, v := range values[1:] {
+		for i := range sum {
+			sum[i] += v[i]
+		}
+	}
+	return sum
+}
+
+// sumOfSquaresRoot returns the element-wise length of the vectors whose
+// components are given by equally long slices.
+func sumOfSquaresRoot(values [][]float64) []float64 {
+	length := make([]float64, len(values[0]))
+	parallelFor(len(length), func(start, end int) {
+		for i := start; i < end; i++ {
+			sum := 0.0
+			for _, v := range values {
+				sum += v[i] * v[i]
+			}
+			length[i] = math.Sqrt(sum)
+		}
+	})
+	return length
+}
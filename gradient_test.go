@@ -0,0 +1,233 @@
+package imagetk
+
+import (
+	"math"
+	"testing"
+)
+
+// newFunctionTestImage returns a Float64 image of the given size and spacing
+// whose values are fn of the physical position of each voxel.
+func newFunctionTestImage(t *testing.T, size []uint32, spacing []float64, fn func(p []float64) float64) *Image {
+	t.Helper()
+	img, err := NewImage(size, PixelTypeFloat64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := img.SetSpacing(spacing); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(img.NumPixels()); i++ {
+		index, err := img.GetIndexFromLinearIndex(uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := make([]float64, len(index))
+		for k := range index {
+			p[k] = float64(index[k]) * spacing[k]
+		}
+		img.setLinearPixelFromFloat64(i, fn(p))
+	}
+	return img
+}
+
+func TestGradient(t *testing.T) {
+	ramp := newFunctionTestImage(t, []uint32{12, 10}, []float64{0.5, 2}, func(p []float64) float64 {
+		return 2*p[0] + 3*p[1]
+	})
+	interior := []uint32{5, 4}
+
+	for _, operator := range []int{GradientCentralDifference, GradientSobel, GradientPrewitt, GradientScharr} {
+		gradient, err := Gradient(ramp, GradientOptions{Operator: operator})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gradient.GetNumberOfComponentsPerPixel() != 2 || gradient.GetPixelType() != PixelTypeFloat64 {
+			t.Fatalf("operator %d: expected a Float64 image with 2 components", operator)
+		}
+		value, err := gradient.GetPixel(interior)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := value.([]float64); !almostEqual(g[0], 2, 1e-9) || !almostEqual(g[1], 3, 1e-9) {
+			t.Errorf("operator %d: expected gradient [2 3], got %v", operator, g)
+		}
+
+		images, err := GradientImages(ramp, GradientOptions{Operator: operator})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for axis, want := range []float64{2, 3} {
+			if got, _ := images[axis].GetPixelAsFloat64(interior); !almostEqual(got, want, 1e-9) {
+				t.Errorf("operator %d: expected %v along axis %d, got %v", operator, want, axis, got)
+			}
+		}
+
+		magnitude, err := GradientMagnitude(ramp, GradientOptions{Operator: operator})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := magnitude.GetPixelAsFloat64(interior); !almostEqual(got, math.Sqrt(13), 1e-9) {
+			t.Errorf("operator %d: expected magnitude %v, got %v", operator, math.Sqrt(13), got)
+		}
+	}
+
+	// The replicated boundary halves the central difference at the edge.
+	gradient, err := GradientImages(ramp, GradientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := gradient[0].GetPixelAsFloat64([]uint32{0, 4}); !almostEqual(got, 1, 1e-9) {
+		t.Errorf("expected 1 at the edge, got %v", got)
+	}
+}
+
+func TestGradientDirection(t *testing.T) {
+	// Axis 0 points along physical y and axis 1 along -x, and the values are
+	// 2x + 3y at the physical position of each voxel.
+	img, err := NewImage([]uint32{8, 8}, PixelTypeInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.SetSpacing([]float64{0.5, 2})
+	if err := img.SetDirectionMatrix([]float64{0, 1, -1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	for j := 0; j < 8; j++ {
+		for i := 0; i < 8; i++ {
+			x, y := -float64(j)*2, float64(i)*0.5
+			img.setLinearPixelFromFloat64(j*8+i, 2*x+3*y)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		options GradientOptions
+		want    []float64
+	}{
+		{"physical axes", GradientOptions{}, []float64{2, 3}},
+		{"image axes", GradientOptions{UseImageAxes: true}, []float64{3, -2}},
+		{"sobel physical axes", GradientOptions{Operator: GradientSobel}, []float64{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gradient, err := Gradient(img, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := gradient.GetPixel([]uint32{4, 4})
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := value.([]float64)
+			for j := range tt.want {
+				if !almostEqual(g[j], tt.want[j], 1e-9) {
+					t.Fatalf("expected gradient %v, got %v", tt.want, g)
+				}
+			}
+			if got := gradient.GetDirectionMatrix(); got[1] != 1 || got[2] != -1 {
+				t.Errorf("expected the direction to be kept, got %v", got)
+			}
+		})
+	}
+}
+
+func TestGradientVolume(t *testing.T) {
+	volume := newFunctionTestImage(t, []uint32{9, 8, 7}, []float64{1, 0.5, 2}, func(p []float64) float64 {
+		return p[0] - 2*p[1] + 4*p[2]
+	})
+	for _, operator := range []int{GradientCentralDifference, GradientSobel, GradientPrewitt, GradientScharr} {
+		gradient, err := Gradient(volume, GradientOptions{Operator: operator})
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := gradient.GetPixel([]uint32{4, 4, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := value.([]float64)
+		for j, want := range []float64{1, -2, 4} {
+			if !almostEqual(g[j], want, 1e-9) {
+				t.Errorf("operator %d: expected gradient [1 -2 4], got %v", operator, g)
+				break
+			}
+		}
+	}
+}
+
+func TestLaplacian(t *testing.T) {
+	// The Laplacian of x² + 2y² is 6 everywhere.
+	img := newFunctionTestImage(t, []uint32{48, 40}, []float64{0.25, 0.5}, func(p []float64) float64 {
+		return p[0]*p[0] + 2*p[1]*p[1]
+	})
+	for _, operator := range []int{GradientCentralDifference, GradientSobel, GradientPrewitt, GradientScharr} {
+		laplacian, err := Laplacian(img, GradientOptions{Operator: operator})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := laplacian.GetPixelAsFloat64([]uint32{20, 20}); !almostEqual(got, 6, 1e-9) {
+			t.Errorf("operator %d: expected 6, got %v", operator, got)
+		}
+	}
+
+	log, err := LaplacianOfGaussian(img, GaussianOptions{Sigma: []float64{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := log.GetPixelAsFloat64([]uint32{24, 20}); math.Abs(got-6) > 0.1 {
+		t.Errorf("expected a Laplacian of Gaussian of 6, got %v", got)
+	}
+
+	// A bright blob gives a negative response at its centre.
+	blob := newImpulseTestImage(t, []uint32{21, 21}, []uint32{10, 10})
+	log, err = LaplacianOfGaussian(blob, GaussianOptions{Sigma: []float64{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := log.GetPixelAsFloat64([]uint32{10, 10}); got >= 0 {
+		t.Errorf("expected a negative response at the blob, got %v", got)
+	}
+}
+
+func TestGradientMagnitudeRecursiveGaussian(t *testing.T) {
+	ramp := newFunctionTestImage(t, []uint32{40, 40}, []float64{0.5, 0.5}, func(p []float64) float64 {
+		return 3*p[0] - 4*p[1]
+	})
+	magnitude, err := GradientMagnitudeRecursiveGaussian(ramp, GaussianOptions{Sigma: []float64{1.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := magnitude.GetPixelAsFloat64([]uint32{20, 20}); !almostEqual(got, 5, 1e-3) {
+		t.Errorf("expected magnitude 5, got %v", got)
+	}
+}
+
+func TestGradientErrors(t *testing.T) {
+	img, err := NewImage([]uint32{8, 8}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, options := range []GradientOptions{{Operator: 7}, {Boundary: -1}} {
+		if _, err := Gradient(img, options); err == nil {
+			t.Errorf("expected error for options %+v", options)
+		}
+		if _, err := Laplacian(img, options); err == nil {
+			t.Errorf("expected error for options %+v", options)
+		}
+	}
+	vector, err := NewVectorImage([]uint32{8, 8}, PixelTypeFloat32, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GradientMagnitude(vector, GradientOptions{}); err == nil {
+		t.Errorf("expected error for a vector image")
+	}
+	if _, err := GradientMagnitudeRecursiveGaussian(vector, GaussianOptions{Sigma: []float64{1}}); err == nil {
+		t.Errorf("expected error for a vector image")
+	}
+	if _, err := LaplacianOfGaussian(img, GaussianOptions{Sigma: []float64{1}, Order: []int{1}}); err == nil {
+		t.Errorf("expected error for derivative orders")
+	}
+	if _, err := Gradient(newComplexTestImage(t), GradientOptions{}); err == nil {
+		t.Errorf("expected error for a complex image")
+	}
+}
@@ -4,9 +4,12 @@ package imagetk
 import (
 	"encoding/binary"
 	"fmt"
+	"maps"
 	"math"
 	"reflect"
 	"runtime"
+	"slices"
+	"sort"
 	"sync"
 )
 
@@ -33,6 +36,10 @@ const (
 	PixelTypeFloat32
 	// PixelTypeFloat64 is a 64-bit floating point pixel type.
 	PixelTypeFloat64
+	// PixelTypeComplex64 is a complex pixel type with 32-bit floating point parts.
+	PixelTypeComplex64
+	// PixelTypeComplex128 is a complex pixel type with 64-bit floating point parts.
+	PixelTypeComplex128
 )
 
 // Image represents an image with various properties such as pixels, pixel type,
@@ -46,6 +53,9 @@ const (
 //   - spacing: A slice of float64 representing the spacing between pixels in each dimension.
 //   - origin: A slice of float64 representing the origin of the image.
 //   - direction: An array of 9 float64 values representing the direction cosines of the image.
+//   - components: The number of components of each pixel, stored next to each other.
+//   - mapping: The memory-mapped file region backing pixels, if any, released by Close.
+//   - metadata: Key/value pairs read from or written to file headers.
 type Image struct {
 	pixels        []byte
 	pixelType     int
@@ -55,6 +65,11 @@ type Image struct {
 	spacing       []float64
 	origin        []float64
 	direction     [9]float64
+	directionND   []float64 // the full NxN matrix of images with more than 3 dimensions
+	components    int
+	mapping       []byte
+	metadata      map[string]string
+	metadataVRs   map[string]string // the DICOM VRs of metadata read from DICOM files
 }
 
 // NewImage creates a new Image with the specified size and pixel type.
@@ -73,24 +88,58 @@ type Image struct {
 //   - PixelTypeInt64
 //   - PixelTypeFloat32
 //   - PixelTypeFloat64
+//   - PixelTypeComplex64
+//   - PixelTypeComplex128
 //
 // Returns:
 //   - *Image: A pointer to the created Image.
 //   - error: An error if the image creation fails.
 func NewImage(size []uint32, pixelType int) (*Image, error) {
-	if len(size) < 2 || len(size) > 3 {
+	img, err := newImageHeader(size, pixelType)
+	if err != nil {
+		return nil, err
+	}
+	img.pixels = make([]byte, img.pixelDataSize())
+	return img, nil
+}
+
+// NewVectorImage creates a new Image whose pixels have several components of
+// the specified pixel type, such as RGB colors or displacement vectors.
+//
+// Parameters:
+//   - size: A slice of uint32 representing the size of the image in each dimension.
+//   - pixelType: An integer representing the type of each component.
+//   - components: The number of components of each pixel.
+//
+// Returns:
+//   - *Image: A pointer to the created Image.
+//   - error: An error if the image creation fails.
+func NewVectorImage(size []uint32, pixelType int, components int) (*Image, error) {
+	if components < 1 {
+		return nil, fmt.Errorf("invalid number of components: %d", components)
+	}
+	img, err := newImageHeader(size, pixelType)
+	if err != nil {
+		return nil, err
+	}
+	img.components = components
+	img.pixels = make([]byte, img.pixelDataSize())
+	return img, nil
+}
+
+// newImageHeader creates an Image like NewImage without allocating the pixel
+// data, for readers that fill in pixels themselves.
+func newImageHeader(size []uint32, pixelType int) (*Image, error) {
+	if len(size) < 2 {
 		return nil, fmt.Errorf("invalid size length: %d", len(size))
 	}
 
-	numPixels := 1
 	for _, s := range size {
 		if s == 0 {
 			return nil, fmt.Errorf("invalid size: %d", s)
 		}
-		numPixels *= int(s)
 	}
 
-	var pixels []byte
 	var bytesPerPixel int
 	switch pixelType {
 	case PixelTypeUInt8, PixelTypeInt8:
@@ -99,14 +148,14 @@ func NewImage(size []uint32, pixelType int) (*Image, error) {
 		bytesPerPixel = 2
 	case PixelTypeUInt32, PixelTypeInt32, PixelTypeFloat32:
 		bytesPerPixel = 4
-	case PixelTypeUInt64, PixelTypeInt64, PixelTypeFloat64:
+	case PixelTypeUInt64, PixelTypeInt64, PixelTypeFloat64, PixelTypeComplex64:
 		bytesPerPixel = 8
+	case PixelTypeComplex128:
+		bytesPerPixel = 16
 	default:
 		return nil, fmt.Errorf("unsupported pixel type: %d", pixelType)
 	}
 
-	pixels = make([]byte, numPixels*bytesPerPixel)
-
 	spacing := make([]float64, len(size))
 	origin := make([]float64, len(size))
 	for i := 0; i < len(size); i++ {
@@ -117,7 +166,6 @@ func NewImage(size []uint32, pixelType int) (*Image, error) {
 	direction := [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
 
 	return &Image{
-		pixels:        pixels,
 		pixelType:     pixelType,
 		bytesPerPixel: bytesPerPixel,
 		dimension:     uint32(len(size)),
@@ -125,6 +173,7 @@ func NewImage(size []uint32, pixelType int) (*Image, error) {
 		spacing:       spacing,
 		origin:        origin,
 		direction:     direction,
+		components:    1,
 	}, nil
 }
 
@@ -149,6 +198,8 @@ func NewImage(size []uint32, pixelType int) (*Image, error) {
 //   - int64
 //   - float32
 //   - float64
+//   - complex64
+//   - complex128
 //
 // If the pixel type is not supported, the function returns an error.
 func GetImageFromArray(data any) (*Image, error) {
@@ -173,7 +224,7 @@ func GetImageFromArray(data any) (*Image, error) {
 		size[i] = _size[len(_size)-1-i]
 	}
 
-	if len(size) < 2 || len(size) > 3 {
+	if len(size) < 2 {
 		return nil, fmt.Errorf("invalid dimension: %d", len(size))
 	}
 
@@ -200,6 +251,10 @@ func GetImageFromArray(data any) (*Image, error) {
 		pixelType = PixelTypeFloat32
 	case reflect.Float64:
 		pixelType = PixelTypeFloat64
+	case reflect.Complex64:
+		pixelType = PixelTypeComplex64
+	case reflect.Complex128:
+		pixelType = PixelTypeComplex128
 	default:
 		return nil, fmt.Errorf("unsupported pixel type: %s", value.Kind().String())
 	}
@@ -218,6 +273,9 @@ func GetImageFromArray(data any) (*Image, error) {
 }
 
 func GetArrayFromImage(img *Image) (any, error) {
+	if img.GetNumberOfComponentsPerPixel() > 1 {
+		return nil, fmt.Errorf("multi-component images cannot be converted to an array; use ExtractComponent")
+	}
 	numGoroutines := uint64(runtime.NumCPU())
 	chunkSize := uint64(img.NumPixels()) / numGoroutines
 	if chunkSize*numGoroutines < uint64(img.NumPixels()) {
@@ -250,7 +308,7 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	case PixelTypeInt8:
 		data := make([]int8, img.NumPixels())
@@ -277,7 +335,7 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	case PixelTypeUInt16:
 		data := make([]uint16, img.NumPixels())
@@ -304,7 +362,7 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	case PixelTypeInt16:
 		data := make([]int16, img.NumPixels())
@@ -331,7 +389,7 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	case PixelTypeUInt32:
 		data := make([]uint32, img.NumPixels())
@@ -358,7 +416,7 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	case PixelTypeInt32:
 		data := make([]int32, img.NumPixels())
@@ -385,7 +443,7 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	case PixelTypeUInt64:
 		data := make([]uint64, img.NumPixels())
@@ -412,7 +470,7 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	case PixelTypeInt64:
 		data := make([]int64, img.NumPixels())
@@ -439,7 +497,7 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	case PixelTypeFloat32:
 		data := make([]float32, img.NumPixels())
@@ -466,7 +524,7 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	case PixelTypeFloat64:
 		data := make([]float64, img.NumPixels())
@@ -493,7 +551,61 @@ func GetArrayFromImage(img *Image) (any, error) {
 			}(start, end)
 		}
 		wg.Wait()
-		shapedData := reshape(data, img.size)
+		shapedData := reshape(data, arrayShape(img.size))
+		return shapedData, nil
+	case PixelTypeComplex64:
+		data := make([]complex64, img.NumPixels())
+		for chunk := uint64(0); chunk < numGoroutines; chunk++ {
+			start := chunk * chunkSize
+			end := start + chunkSize
+			if end > img.NumPixels() {
+				end = img.NumPixels()
+			}
+			wg.Add(1)
+			go func(start, end uint64) {
+				defer wg.Done()
+				for i := start; i < end; i++ {
+					index, err := img.GetIndexFromLinearIndex(i)
+					if err != nil {
+						return
+					}
+					value, err := img.GetPixel(index)
+					if err != nil {
+						return
+					}
+					data[i] = value.(complex64)
+				}
+			}(start, end)
+		}
+		wg.Wait()
+		shapedData := reshape(data, arrayShape(img.size))
+		return shapedData, nil
+	case PixelTypeComplex128:
+		data := make([]complex128, img.NumPixels())
+		for chunk := uint64(0); chunk < numGoroutines; chunk++ {
+			start := chunk * chunkSize
+			end := start + chunkSize
+			if end > img.NumPixels() {
+				end = img.NumPixels()
+			}
+			wg.Add(1)
+			go func(start, end uint64) {
+				defer wg.Done()
+				for i := start; i < end; i++ {
+					index, err := img.GetIndexFromLinearIndex(i)
+					if err != nil {
+						return
+					}
+					value, err := img.GetPixel(index)
+					if err != nil {
+						return
+					}
+					data[i] = value.(complex128)
+				}
+			}(start, end)
+		}
+		wg.Wait()
+		shapedData := reshape(data, arrayShape(img.size))
 		return shapedData, nil
 	default:
 		return nil, fmt.Errorf("unsupported pixel type: %d", img.pixelType)
@@ -515,6 +627,8 @@ func GetArrayFromImage(img *Image) (any, error) {
 //   - PixelTypeInt64
 //   - PixelTypeFloat32
 //   - PixelTypeFloat64
+//   - PixelTypeComplex64
+//   - PixelTypeComplex128
 func (img *Image) GetPixelType() int {
 	return img.pixelType
 }
@@ -544,17 +658,154 @@ func (img *Image) GetOrigin() []float64 {
 	return img.origin
 }
 
-// GetDirection returns the direction matrix of the image.
+// GetDirection returns the direction matrix of the first three axes of the
+// image. Use GetDirectionMatrix for images with more than three dimensions.
 func (img *Image) GetDirection() [9]float64 {
 	return img.direction
 }
 
+// GetDirectionMatrix returns the direction matrix of the image as an NxN
+// matrix for an N-dimensional image, where entry k*N+j is component j of the
+// direction of axis k.
+//
+// Returns:
+//   - []float64: A copy of the direction matrix
+func (img *Image) GetDirectionMatrix() []float64 {
+	n := int(img.dimension)
+	matrix := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for j := 0; j < n; j++ {
+			matrix[k*n+j] = img.directionAt(k, j)
+		}
+	}
+	return matrix
+}
+
+// SetDirectionMatrix sets the direction matrix of the image from an NxN
+// matrix laid out like the result of GetDirectionMatrix.
+//
+// Parameters:
+//   - matrix: The direction matrix with one row per axis
+//
+// Returns:
+//   - error: Error if the matrix does not have N*N entries
+func (img *Image) SetDirectionMatrix(matrix []float64) error {
+	n := int(img.dimension)
+	if len(matrix) != n*n {
+		return fmt.Errorf("invalid direction matrix length %d for dimension %d", len(matrix), n)
+	}
+	for k := 0; k < min(n, 3); k++ {
+		for j := 0; j < min(n, 3); j++ {
+			img.direction[k*3+j] = matrix[k*n+j]
+		}
+	}
+	img.directionND = nil
+	if n > 3 {
+		img.directionND = slices.Clone(matrix)
+	}
+	return nil
+}
+
+// directionAt returns component j of the direction of axis k. The first three
+// axes are described by direction; further axes are stored in directionND and
+// default to the identity.
+func (img *Image) directionAt(k, j int) float64 {
+	switch {
+	case k < 3 && j < 3:
+		return img.direction[k*3+j]
+	case img.directionND != nil:
+		return img.directionND[k*int(img.dimension)+j]
+	case k == j:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// copyGeometry copies the spacing, origin and direction of src, which must have
+// the same dimension as the image.
+func (img *Image) copyGeometry(src *Image) {
+	copy(img.spacing, src.spacing)
+	copy(img.origin, src.origin)
+	img.direction = src.direction
+	img.directionND = slices.Clone(src.directionND)
+}
+
+// GetNumberOfComponentsPerPixel returns the number of components of each pixel,
+// 1 for scalar images.
+func (img *Image) GetNumberOfComponentsPerPixel() int {
+	if img.components < 1 {
+		return 1
+	}
+	return img.components
+}
+
+// pixelDataSize returns the size of the pixel data in bytes.
+func (img *Image) pixelDataSize() int {
+	return int(img.NumPixels()) * img.GetNumberOfComponentsPerPixel() * img.bytesPerPixel
+}
+
+// GetMetaData returns the metadata value stored under a key.
+//
+// Parameters:
+//   - key: The metadata key
+//
+// Returns:
+//   - string: The value, or an empty string if the key is not set
+//   - bool: Whether the key is set
+//
+// Readers store header fields the image does not otherwise describe, such as
+// MHD keys, NRRD key/value pairs, the NIfTI descrip, aux_file and intent_name
+// fields, and DICOM attributes under keys of the form "0010|0010".
+func (img *Image) GetMetaData(key string) (string, bool) {
+	value, ok := img.metadata[key]
+	return value, ok
+}
+
+// SetMetaData stores a metadata value under a key, replacing any previous value.
+//
+// Parameters:
+//   - key: The metadata key
+//   - value: The value to store
+func (img *Image) SetMetaData(key, value string) {
+	if img.metadata == nil {
+		img.metadata = make(map[string]string)
+	}
+	img.metadata[key] = value
+}
+
+// DeleteMetaData removes the metadata value stored under a key, if any.
+//
+// Parameters:
+//   - key: The metadata key
+func (img *Image) DeleteMetaData(key string) {
+	delete(img.metadata, key)
+	delete(img.metadataVRs, key)
+}
+
+// MetaDataKeys returns the metadata keys of the image in sorted order.
+func (img *Image) MetaDataKeys() []string {
+	keys := make([]string, 0, len(img.metadata))
+	for key := range img.metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// copyMetaData replaces the metadata of the image with a copy of the metadata of src.
+func (img *Image) copyMetaData(src *Image) {
+	img.metadata = maps.Clone(src.metadata)
+	img.metadataVRs = maps.Clone(src.metadataVRs)
+}
+
 // GetPixel returns the pixel value at the given index.
 // Parameters:
 //   - index: A slice of uint32 representing the index of the pixel.
 //
 // Returns:
-//   - any: The pixel value as the type of the image.
+//   - any: The pixel value as the type of the image, or a slice of the
+//     components of the pixel, e.g. []uint8, for multi-component images.
 //   - error: An error if the index is out of range.
 func (img *Image) GetPixel(index []uint32) (any, error) {
 	if len(index) != int(img.dimension) {
@@ -567,6 +818,9 @@ func (img *Image) GetPixel(index []uint32) (any, error) {
 		}
 		idx = idx*img.size[i] + index[i]
 	}
+	if img.GetNumberOfComponentsPerPixel() > 1 {
+		return img.getVectorPixel(int(idx)), nil
+	}
 	switch img.pixelType {
 	case PixelTypeUInt8:
 		value := uint8(img.pixels[idx])
@@ -598,6 +852,8 @@ func (img *Image) GetPixel(index []uint32) (any, error) {
 	case PixelTypeFloat64:
 		value := math.Float64frombits(binary.LittleEndian.Uint64(img.pixels[idx*8 : idx*8+8]))
 		return value, nil
+	case PixelTypeComplex64, PixelTypeComplex128:
+		return img.getLinearComplexPixel(int(idx)), nil
 	default:
 		return nil, fmt.Errorf("unsupported pixel type: %d", img.pixelType)
 	}
@@ -848,6 +1104,8 @@ func (img *Image) GetPixelAsFloat64(index []uint32) (float64, error) {
 //   - PixelTypeInt64
 //   - PixelTypeFloat32
 //   - PixelTypeFloat64
+//   - PixelTypeComplex64
+//   - PixelTypeComplex128
 //
 // Returns:
 //   - *Image: A pointer to the created Image.
@@ -864,18 +1122,26 @@ func (img *Image) AsType(pixelType int) (*Image, error) {
 		return nil, err
 	}
 
-	for i := 0; i < len(img.size); i++ {
-		newImg.spacing[i] = img.spacing[i]
-		newImg.origin[i] = img.origin[i]
-	}
-
-	newImg.direction = img.direction
+	newImg.copyGeometry(img)
+	newImg.components = img.GetNumberOfComponentsPerPixel()
+	newImg.copyMetaData(img)
 
-	numPixels := 1
+	// Each component is converted on its own.
+	numPixels := newImg.components
 	for _, s := range img.size {
 		numPixels *= int(s)
 	}
 
+	// Complex values convert to real types by dropping the imaginary part and
+	// real values convert to complex types with a zero imaginary part.
+	if isComplexPixelType(pixelType) || isComplexPixelType(img.pixelType) {
+		newImg.pixels = make([]byte, numPixels*newImg.bytesPerPixel)
+		for i := 0; i < numPixels; i++ {
+			newImg.setLinearComplexPixel(i, img.getLinearPixelAsComplex128(i))
+		}
+		return newImg, nil
+	}
+
 	numGoroutines := runtime.NumCPU()
 	chunkSize := numPixels / numGoroutines
 	if chunkSize*numGoroutines < numPixels {
@@ -1212,10 +1478,30 @@ func (img *Image) SetOrigin(origin []float64) error {
 	return nil
 }
 
+// SetDirection sets the direction matrix of the first three axes of the
+// image. Images with more than three dimensions keep the directions of their
+// further axes; use SetDirectionMatrix to set those.
 func (img *Image) SetDirection(direction [9]float64) {
 	img.direction = direction
+	if img.directionND == nil {
+		return
+	}
+	n := int(img.dimension)
+	for k := 0; k < 3; k++ {
+		for j := 0; j < 3; j++ {
+			img.directionND[k*n+j] = direction[k*3+j]
+		}
+	}
 }
 
+// SetPixel sets the pixel value at the given index.
+// Parameters:
+//   - index: A slice of uint32 representing the index of the pixel.
+//   - value: The pixel value, or a slice holding all components of the pixel
+//     for multi-component images.
+//
+// Returns:
+//   - error: An error if the index is out of range or the value does not fit the pixel.
 func (img *Image) SetPixel(index []uint32, value any) error {
 	if len(index) != int(img.dimension) {
 		return fmt.Errorf("invalid index length: %d", len(index))
@@ -1227,6 +1513,9 @@ func (img *Image) SetPixel(index []uint32, value any) error {
 		}
 		idx = idx*img.size[i] + index[i]
 	}
+	if img.GetNumberOfComponentsPerPixel() > 1 {
+		return img.setVectorPixel(int(idx), value)
+	}
 	bytesPerPixel := uint32(img.bytesPerPixel)
 
 	valueBytes, err := getValueAsBytes(value)
@@ -1243,7 +1532,7 @@ func (img *Image) SetPixels(pixels any) error {
 	if err != nil {
 		return err
 	}
-	numPixels := 1
+	numPixels := img.GetNumberOfComponentsPerPixel()
 	for _, s := range img.size {
 		numPixels *= int(s)
 	}
@@ -1263,7 +1552,7 @@ func (img *Image) SetSize(size []uint32) error {
 		totalSize *= s
 	}
 
-	numPixels := len(img.pixels) / img.bytesPerPixel
+	numPixels := len(img.pixels) / img.bytesPerPixel / img.GetNumberOfComponentsPerPixel()
 
 	if uint32(numPixels) != totalSize {
 		return fmt.Errorf("invalid number of pixels, expected %d, got %d", totalSize, numPixels)
@@ -1273,7 +1562,8 @@ func (img *Image) SetSize(size []uint32) error {
 	return nil
 }
 
-// GetIndexFromLinearIndex converts a linear index to multi-dimensional indices
+// GetIndexFromLinearIndex converts a linear index to multi-dimensional indices,
+// with the first index varying fastest like the pixel data.
 func (img *Image) GetIndexFromLinearIndex(linearIdx uint64) ([]uint32, error) {
 	if linearIdx >= img.NumPixels() {
 		return nil, fmt.Errorf("linear index out of range: %d", linearIdx)
@@ -1281,23 +1571,9 @@ func (img *Image) GetIndexFromLinearIndex(linearIdx uint64) ([]uint32, error) {
 
 	indices := make([]uint32, img.dimension)
 	remaining := linearIdx
-
-	// Working backwards through dimensions
 	for i := 0; i < int(img.dimension); i++ {
-		// Calculate the size of the sub-array for the current dimension
-		subArraySize := uint64(1)
-		for j := 0; j < i; j++ {
-			subArraySize *= uint64(img.size[j])
-		}
-
-		// Calculate the index for this dimension
-		indices[i] = uint32((remaining / subArraySize) % uint64(img.size[i]))
-		remaining = remaining % subArraySize
-	}
-
-	// Reverse the indices array since the original indexing was in reverse order
-	for i := 0; i < len(indices)/2; i++ {
-		indices[i], indices[len(indices)-1-i] = indices[len(indices)-1-i], indices[i]
+		indices[i] = uint32(remaining % uint64(img.size[i]))
+		remaining /= uint64(img.size[i])
 	}
 
 	return indices, nil
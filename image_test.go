@@ -1,9 +1,31 @@
 package imagetk
 
 import (
+	"reflect"
 	"testing"
 )
 
+// newTestImage returns an image of the given size, pixel type and number of
+// components, with anisotropic spacing, an offset origin and a rotation of 90
+// degrees around z, so that tests catch geometry that is dropped or swapped.
+// Each value of the pixel array is set to value(i); a nil value leaves zeros.
+func newTestImage(t *testing.T, size []uint32, pixelType, components int, value func(i int) float64) *Image {
+	t.Helper()
+	img, err := NewVectorImage(size, pixelType, components)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	if value != nil {
+		for i := 0; i < int(img.NumPixels())*components; i++ {
+			img.setLinearPixelFromFloat64(i, value(i))
+		}
+	}
+	img.SetSpacing([]float64{0.5, 0.75, 2.5})
+	img.SetOrigin([]float64{-10, 20.5, 3})
+	img.SetDirection([9]float64{0, 1, 0, -1, 0, 0, 0, 0, 1})
+	return img
+}
+
 func TestImageCreation(t *testing.T) {
 	// Create a new image
 	img, err := NewImage([]uint32{10, 11, 12}, PixelTypeFloat32)
@@ -372,3 +394,79 @@ func TestAsType(t *testing.T) {
 		}
 	}
 }
+
+func TestGetArrayFromImage(t *testing.T) {
+	tests := []any{
+		[][]int16{{1, 2, 3}, {4, 5, 6}},
+		[][][]float64{{{1, 2}, {3, 4}, {5, 6}}, {{7, 8}, {9, 10}, {11, 12}}},
+	}
+	for _, data := range tests {
+		img, err := GetImageFromArray(data)
+		if err != nil {
+			t.Fatalf("Error creating image: %v", err)
+		}
+		array, err := GetArrayFromImage(img)
+		if err != nil {
+			t.Fatalf("Error getting array: %v", err)
+		}
+		if !reflect.DeepEqual(array, data) {
+			t.Errorf("Expected %v, got %v", data, array)
+		}
+	}
+
+	img, err := NewImage([]uint32{3, 2, 4}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := img.GetIndexFromLinearIndex(3*2*2 + 3 + 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(index, []uint32{2, 1, 2}) {
+		t.Errorf("Expected index [2 1 2], got %v", index)
+	}
+}
+
+func TestMetaData(t *testing.T) {
+	img, err := NewImage([]uint32{4, 4}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.GetMetaData("Modality"); ok || len(img.MetaDataKeys()) != 0 {
+		t.Fatalf("expected no metadata")
+	}
+	img.SetMetaData("Modality", "CT")
+	img.SetMetaData("Comment", "first")
+	img.SetMetaData("Comment", "second")
+	if value, ok := img.GetMetaData("Comment"); !ok || value != "second" {
+		t.Errorf("expected Comment=second, got %q %v", value, ok)
+	}
+	if keys := img.MetaDataKeys(); len(keys) != 2 || keys[0] != "Comment" || keys[1] != "Modality" {
+		t.Errorf("expected sorted keys [Comment Modality], got %v", keys)
+	}
+
+	converted, err := img.AsType(PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resampled, err := img.Resample(NearestInterpolator{
+		Size:      []uint32{2, 2},
+		Spacing:   []float64{2, 2},
+		Origin:    []float64{0, 0},
+		Direction: [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, derived := range map[string]*Image{"AsType": converted, "Resample": resampled} {
+		if value, _ := derived.GetMetaData("Modality"); value != "CT" {
+			t.Errorf("%s: expected Modality=CT, got %q", name, value)
+		}
+		// Derived images hold their own copy.
+		derived.SetMetaData("Modality", "MR")
+	}
+	img.DeleteMetaData("Comment")
+	if value, _ := img.GetMetaData("Modality"); value != "CT" || len(img.MetaDataKeys()) != 1 {
+		t.Errorf("expected only Modality=CT, got %v", img.MetaDataKeys())
+	}
+}
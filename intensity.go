@@ -0,0 +1,295 @@
+package imagetk
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// CastWrap converts values like a Go conversion: integers wrap around and
+	// floating point values are truncated towards zero.
+	CastWrap = iota
+	// CastSaturate rounds floating point values to the nearest integer and
+	// clamps values to the range of the new pixel type. NaN becomes 0.
+	CastSaturate
+)
+
+// AsTypeWithMode converts the image to the specified pixel type like AsType,
+// using the given cast mode for values that the new pixel type cannot hold.
+//
+// Parameters:
+//   - pixelType: An integer representing the type of pixels.
+//   - mode: CastWrap or CastSaturate.
+//
+// Returns:
+//   - *Image: A pointer to the converted Image.
+//   - error: An error if the mode or pixel type is not supported.
+//
+// Saturating a Float32 CT image to PixelTypeUInt8, for example, maps values
+// below 0 to 0 and values above 255 to 255 instead of wrapping them around.
+// Complex values lose their imaginary part as in AsType.
+func (img *Image) AsTypeWithMode(pixelType, mode int) (*Image, error) {
+	switch mode {
+	case CastWrap:
+		return img.AsType(pixelType)
+	case CastSaturate:
+	default:
+		return nil, fmt.Errorf("unsupported cast mode: %d", mode)
+	}
+	if img.pixelType == pixelType || pixelType == PixelTypeFloat64 || isComplexPixelType(pixelType) {
+		return img.AsType(pixelType)
+	}
+	newImg, err := newImageLike(img, pixelType, img.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+
+	lowest, highest, isInteger := integerPixelTypeRange(pixelType)
+	_, sourceHighest, sourceIsInteger := integerPixelTypeRange(img.pixelType)
+	parallelFor(len(newImg.pixels)/newImg.bytesPerPixel, func(start, end int) {
+		for i := start; i < end; i++ {
+			switch {
+			case !isInteger:
+				newImg.setLinearPixelSaturated(i, img.getLinearPixelAsFloat64(i))
+			case sourceIsInteger && isSignedPixelType(img.pixelType):
+				value := int64(img.getLinearIntegerPixel(i))
+				value = max(value, lowest)
+				if value > 0 && uint64(value) > highest {
+					value = int64(highest)
+				}
+				newImg.setLinearIntegerPixel(i, uint64(value))
+			case sourceIsInteger && sourceHighest > highest:
+				newImg.setLinearIntegerPixel(i, min(img.getLinearIntegerPixel(i), highest))
+			case sourceIsInteger:
+				newImg.setLinearIntegerPixel(i, img.getLinearIntegerPixel(i))
+			default:
+				newImg.setLinearIntegerPixel(i, saturatedIntegerBits(img.getLinearPixelAsFloat64(i), lowest, highest))
+			}
+		}
+	})
+	return newImg, nil
+}
+
+// RescaleIntensity linearly maps the intensity range of an image to
+// [outMin, outMax]. The output keeps the pixel type of the image, with values
+// rounded and clamped for integer pixel types.
+//
+// Parameters:
+//   - image: The input image
+//   - outMin: The value of the smallest intensity in the output
+//   - outMax: The value of the largest intensity in the output
+//
+// Returns:
+//   - *Image: The rescaled image, with the geometry and metadata of the input
+//   - error: Error if outMin > outMax or the image is complex
+//
+// All components share one intensity range. Images of a single intensity
+// become outMin everywhere.
+func RescaleIntensity(image *Image, outMin, outMax float64) (*Image, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	if outMin > outMax {
+		return nil, fmt.Errorf("invalid output range: [%g, %g]", outMin, outMax)
+	}
+	inMin, inMax := image.intensityRange()
+	scale := 0.0
+	if inMax > inMin {
+		scale = (outMax - outMin) / (inMax - inMin)
+	}
+	return mapIntensities(image, image.pixelType, func(v float64) float64 {
+		return outMin + (v-inMin)*scale
+	})
+}
+
+// IntensityWindowing linearly maps intensities in [windowMin, windowMax] to
+// [outMin, outMax], and intensities outside the window to outMin or outMax,
+// e.g. to display a CT image with a soft tissue window. The output keeps the
+// pixel type of the image, with values rounded and clamped for integer pixel types.
+//
+// Parameters:
+//   - image: The input image
+//   - windowMin: The lower bound of the window
+//   - windowMax: The upper bound of the window
+//   - outMin: The output value for windowMin and below
+//   - outMax: The output value for windowMax and above
+//
+// Returns:
+//   - *Image: The windowed image, with the geometry and metadata of the input
+//   - error: Error if windowMin >= windowMax or the image is complex
+func IntensityWindowing(image *Image, windowMin, windowMax, outMin, outMax float64) (*Image, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	if windowMin >= windowMax {
+		return nil, fmt.Errorf("invalid window: [%g, %g]", windowMin, windowMax)
+	}
+	scale := (outMax - outMin) / (windowMax - windowMin)
+	return mapIntensities(image, image.pixelType, func(v float64) float64 {
+		switch {
+		case v <= windowMin:
+			return outMin
+		case v >= windowMax:
+			return outMax
+		default:
+			return outMin + (v-windowMin)*scale
+		}
+	})
+}
+
+// Clamp limits the intensities of an image to [lower, upper]. Values inside
+// the range are kept exactly and the pixel type is unchanged.
+//
+// Parameters:
+//   - image: The input image
+//   - lower: The smallest output value
+//   - upper: The largest output value
+//
+// Returns:
+//   - *Image: The clamped image, with the geometry and metadata of the input
+//   - error: Error if lower > upper or the image is complex
+func Clamp(image *Image, lower, upper float64) (*Image, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	if lower > upper {
+		return nil, fmt.Errorf("invalid clamp range: [%g, %g]", lower, upper)
+	}
+	out, err := newImageLike(image, image.pixelType, image.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+	copy(out.pixels, image.pixels)
+	parallelFor(len(out.pixels)/out.bytesPerPixel, func(start, end int) {
+		for i := start; i < end; i++ {
+			if v := image.getLinearPixelAsFloat64(i); v < lower {
+				out.setLinearPixelSaturated(i, lower)
+			} else if v > upper {
+				out.setLinearPixelSaturated(i, upper)
+			}
+		}
+	})
+	return out, nil
+}
+
+// Normalize shifts and scales the intensities of an image to zero mean and
+// unit variance.
+//
+// Parameters:
+//   - image: The input image
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the image is complex
+//
+// The population standard deviation over all components is used. Images of a
+// single intensity become 0 everywhere.
+func Normalize(image *Image) (*Image, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	meanValue := image.ExactMean()
+	std, _ := image.Std().(float64)
+	if std == 0 {
+		std = 1
+	}
+	return mapIntensities(image, floatPixelType(image.pixelType), func(v float64) float64 {
+		return (v - meanValue) / std
+	})
+}
+
+// ShiftScale returns (v + shift) * scale for every intensity v. The output
+// keeps the pixel type of the image, with values rounded and clamped for
+// integer pixel types.
+//
+// Parameters:
+//   - image: The input image
+//   - shift: The value added to every intensity
+//   - scale: The factor applied after the shift
+//
+// Returns:
+//   - *Image: The result, with the geometry and metadata of the input
+//   - error: Error if the image is complex
+func ShiftScale(image *Image, shift, scale float64) (*Image, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	return mapIntensities(image, image.pixelType, func(v float64) float64 {
+		return (v + shift) * scale
+	})
+}
+
+// mapIntensities returns an image of the given pixel type holding fn(v) for
+// every value v of image, saturated to the pixel type.
+func mapIntensities(image *Image, pixelType int, fn func(float64) float64) (*Image, error) {
+	out, err := newImageLike(image, pixelType, image.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+	parallelFor(len(out.pixels)/out.bytesPerPixel, func(start, end int) {
+		for i := start; i < end; i++ {
+			out.setLinearPixelSaturated(i, fn(image.getLinearPixelAsFloat64(i)))
+		}
+	})
+	return out, nil
+}
+
+// intensityRange returns the smallest and largest values of the image,
+// ignoring NaN. Images without values other than NaN give 0, 0.
+func (img *Image) intensityRange() (float64, float64) {
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for i := 0; i < len(img.pixels)/img.bytesPerPixel; i++ {
+		v := img.getLinearPixelAsFloat64(i)
+		if math.IsNaN(v) {
+			continue
+		}
+		lowest = min(lowest, v)
+		highest = max(highest, v)
+	}
+	if lowest > highest {
+		return 0, 0
+	}
+	return lowest, highest
+}
+
+// requireRealImage returns an error for complex images, which have no
+// ordered intensities.
+func requireRealImage(image *Image) error {
+	if isComplexPixelType(image.pixelType) {
+		return fmt.Errorf("complex images are not supported, got pixel type %d", image.pixelType)
+	}
+	return nil
+}
+
+// setLinearPixelSaturated stores value at the given linear index, rounded to
+// the nearest integer and clamped to the range of integer pixel types, or
+// clamped to the finite range of Float32.
+func (img *Image) setLinearPixelSaturated(i int, value float64) {
+	if lowest, highest, ok := integerPixelTypeRange(img.pixelType); ok {
+		img.setLinearIntegerPixel(i, saturatedIntegerBits(value, lowest, highest))
+		return
+	}
+	if img.pixelType == PixelTypeFloat32 && !math.IsInf(value, 0) {
+		value = max(min(value, math.MaxFloat32), -math.MaxFloat32)
+	}
+	img.setLinearPixelFromFloat64(i, value)
+}
+
+// saturatedIntegerBits rounds value to the nearest integer in [lowest, highest]
+// and returns it as the bits of an int64, or of a uint64 above math.MaxInt64.
+// NaN gives 0.
+func saturatedIntegerBits(value float64, lowest int64, highest uint64) uint64 {
+	value = math.Round(value)
+	switch {
+	case math.IsNaN(value):
+		return 0
+	case value <= float64(lowest):
+		return uint64(lowest)
+	case value >= float64(highest):
+		return highest
+	case value < 0:
+		return uint64(int64(value))
+	default:
+		return uint64(value)
+	}
+}
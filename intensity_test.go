@@ -0,0 +1,162 @@
+package imagetk
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAsTypeWithMode(t *testing.T) {
+	ct, err := GetImageFromArray([][]float32{{-1000, -0.6, 0.4}, {127.5, 254.6, 3000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	int16Img, err := GetImageFromArray([][]int16{{-300, -1, 0}, {127, 200, 32767}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uint64Img, err := GetImageFromArray([][]uint64{{0, 1}, {math.MaxInt64 + 1, math.MaxUint64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	float64Img, err := GetImageFromArray([][]float64{{-1e300, math.NaN()}, {math.Inf(1), 1.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		img       *Image
+		pixelType int
+		want      []float64
+	}{
+		{"float to uint8", ct, PixelTypeUInt8, []float64{0, 0, 0, 128, 255, 255}},
+		{"float to int8", ct, PixelTypeInt8, []float64{-128, -1, 0, 127, 127, 127}},
+		{"int16 to uint8", int16Img, PixelTypeUInt8, []float64{0, 0, 0, 127, 200, 255}},
+		{"int16 to int8", int16Img, PixelTypeInt8, []float64{-128, -1, 0, 127, 127, 127}},
+		{"int16 to uint64", int16Img, PixelTypeUInt64, []float64{0, 0, 0, 127, 200, 32767}},
+		{"uint64 to int16", uint64Img, PixelTypeInt16, []float64{0, 1, 32767, 32767}},
+		{"float64 to float32", float64Img, PixelTypeFloat32, []float64{-math.MaxFloat32, math.NaN(), math.Inf(1), 1.5}},
+		{"float64 to int32", float64Img, PixelTypeInt32, []float64{math.MinInt32, 0, math.MaxInt32, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.img.AsTypeWithMode(tt.pixelType, CastSaturate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.GetPixelType() != tt.pixelType {
+				t.Fatalf("expected pixel type %d, got %d", tt.pixelType, out.GetPixelType())
+			}
+			for i, want := range tt.want {
+				got := out.getLinearPixelAsFloat64(i)
+				if got != want && !(math.IsNaN(got) && math.IsNaN(want)) {
+					t.Errorf("pixel %d: expected %v, got %v", i, want, got)
+				}
+			}
+		})
+	}
+
+	out, err := uint64Img.AsTypeWithMode(PixelTypeInt64, CastSaturate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := out.GetPixel([]uint32{1, 1}); value != int64(math.MaxInt64) {
+		t.Errorf("expected %d, got %v", int64(math.MaxInt64), value)
+	}
+	wrapped, err := int16Img.AsTypeWithMode(PixelTypeUInt8, CastWrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := wrapped.GetPixel([]uint32{1, 1}); value != uint8(200) {
+		t.Errorf("expected 200, got %v", value)
+	}
+	if value, _ := wrapped.GetPixel([]uint32{0, 0}); value != uint8(212) {
+		t.Errorf("expected -300 to wrap to 212, got %v", value)
+	}
+	if _, err := ct.AsTypeWithMode(PixelTypeUInt8, 7); err == nil {
+		t.Errorf("expected error for an unknown cast mode")
+	}
+}
+
+func TestIntensityFilters(t *testing.T) {
+	ct, err := GetImageFromArray([][]int16{{-1000, -160, 40}, {240, 1000, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct.SetSpacing([]float64{0.5, 0.5})
+	ct.SetMetaData("Modality", "CT")
+
+	tests := []struct {
+		name      string
+		fn        func() (*Image, error)
+		pixelType int
+		want      []float64
+	}{
+		{"rescale", func() (*Image, error) { return RescaleIntensity(ct, 0, 100) }, PixelTypeInt16, []float64{0, 42, 52, 62, 100, 50}},
+		{"window", func() (*Image, error) { return IntensityWindowing(ct, -160, 240, 0, 200) }, PixelTypeInt16, []float64{0, 0, 100, 200, 200, 80}},
+		{"clamp", func() (*Image, error) { return Clamp(ct, -100, 100) }, PixelTypeInt16, []float64{-100, -100, 40, 100, 100, 0}},
+		{"shift scale", func() (*Image, error) { return ShiftScale(ct, 1000, 0.01) }, PixelTypeInt16, []float64{0, 8, 10, 12, 20, 10}},
+		{"shift scale saturates", func() (*Image, error) { return ShiftScale(ct, 0, 100) }, PixelTypeInt16, []float64{-32768, -16000, 4000, 24000, 32767, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.fn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.GetPixelType() != tt.pixelType {
+				t.Fatalf("expected pixel type %d, got %d", tt.pixelType, out.GetPixelType())
+			}
+			if !reflect.DeepEqual(out.GetSpacing(), ct.GetSpacing()) {
+				t.Errorf("expected spacing %v, got %v", ct.GetSpacing(), out.GetSpacing())
+			}
+			if modality, _ := out.GetMetaData("Modality"); modality != "CT" {
+				t.Errorf("expected metadata to be kept, got %q", modality)
+			}
+			for i, want := range tt.want {
+				if got := out.getLinearPixelAsFloat64(i); got != want {
+					t.Errorf("pixel %d: expected %v, got %v", i, want, got)
+				}
+			}
+		})
+	}
+
+	normalized, err := Normalize(ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normalized.GetPixelType() != PixelTypeFloat64 {
+		t.Fatalf("expected a Float64 image, got pixel type %d", normalized.GetPixelType())
+	}
+	if mean := normalized.ExactMean(); !almostEqual(mean, 0, 1e-12) {
+		t.Errorf("expected zero mean, got %v", mean)
+	}
+	if std := normalized.Std().(float64); !almostEqual(std, 1, 1e-12) {
+		t.Errorf("expected unit standard deviation, got %v", std)
+	}
+
+	constant, err := NewImage([]uint32{2, 2}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := RescaleIntensity(constant, 5, 10); err != nil || out.getLinearPixelAsFloat64(3) != 5 {
+		t.Errorf("expected a constant image to rescale to the output minimum")
+	}
+	if out, err := Normalize(constant); err != nil || out.GetPixelType() != PixelTypeFloat32 || out.getLinearPixelAsFloat64(0) != 0 {
+		t.Errorf("expected a constant Float32 image to normalize to 0")
+	}
+
+	if _, err := RescaleIntensity(ct, 10, 0); err == nil {
+		t.Errorf("expected error for an inverted output range")
+	}
+	if _, err := IntensityWindowing(ct, 40, 40, 0, 255); err == nil {
+		t.Errorf("expected error for an empty window")
+	}
+	if _, err := Clamp(ct, 1, 0); err == nil {
+		t.Errorf("expected error for an inverted clamp range")
+	}
+	if _, err := ShiftScale(newComplexTestImage(t), 0, 1); err == nil {
+		t.Errorf("expected error for a complex image")
+	}
+}
@@ -2,7 +2,6 @@ package imagetk
 
 import (
 	"fmt"
-	"runtime"
 	"sync"
 )
 
@@ -36,6 +35,15 @@ const (
 //   - *Image: The resampled image
 //   - error: Error if resampling fails
 func (img *Image) Resample(interpolator any) (*Image, error) {
+	if img.GetNumberOfComponentsPerPixel() > 1 {
+		return nil, fmt.Errorf("resampling multi-component images is not supported; resample each component")
+	}
+	if isComplexPixelType(img.pixelType) {
+		return nil, fmt.Errorf("resampling complex images is not supported; resample the real and imaginary parts")
+	}
+	if img.dimension > 3 {
+		return nil, fmt.Errorf("resampling %dD images is not supported; resample each volume", img.dimension)
+	}
 	switch interpolator := interpolator.(type) {
 	case LinearInterpolator:
 		return linearResample(img, interpolator)
@@ -52,6 +60,7 @@ func linearResample(img *Image, interpolator LinearInterpolator) (*Image, error)
 	if err != nil {
 		return nil, err
 	}
+	newImg.copyMetaData(img)
 
 	// Copy the origin, spacing and direction with default values if not specified
 	if interpolator.Origin != nil {
@@ -76,71 +85,13 @@ func linearResample(img *Image, interpolator LinearInterpolator) (*Image, error)
 		return nil, fmt.Errorf("size is not specified")
 	}
 
-	numPixels := 1
-	for i := 0; i < len(interpolator.Size); i++ {
-		numPixels *= int(interpolator.Size[i])
-	}
-
-	strides := make([]int, len(interpolator.Size))
-	strides[len(interpolator.Size)-1] = 1
-	for i := len(interpolator.Size) - 2; i >= 0; i-- {
-		strides[i] = strides[i+1] * int(interpolator.Size[i+1])
-	}
-
-	numGoroutines := uint32(runtime.NumCPU())
-	chunkSize := (uint32(numPixels) + numGoroutines - 1) / numGoroutines
-
-	wg := sync.WaitGroup{}
-	for chunk := uint32(0); chunk < numGoroutines; chunk++ {
-		start := chunk * chunkSize
-		end := start + chunkSize
-		if end > uint32(numPixels) {
-			end = uint32(numPixels)
-		}
-		wg.Add(1)
-		go func(start, end uint32) {
-			defer wg.Done()
-			for i := start; i < end; i++ {
-				physicalPoint := make([]float64, len(interpolator.Size))
-				idx := i
-				indices := make([]float64, len(interpolator.Size))
-				for j := 0; j < len(interpolator.Size); j++ {
-					indices[j] = float64(idx / uint32(strides[j]))
-					idx %= uint32(strides[j])
-				}
-
-				// Apply direction matrix correctly
-				for j := 0; j < len(interpolator.Size); j++ { // physical dimensions
-					for k := 0; k < len(interpolator.Size); k++ { // image dimensions
-						physicalPoint[j] += interpolator.Direction[j*3+k] * indices[k]
-					}
-					physicalPoint[j] = physicalPoint[j]*interpolator.Spacing[j] + interpolator.Origin[j]
-				}
-
-				value, err := img.GetPixelFromPoint(physicalPoint, interpolator.FillType)
-				if err != nil {
-					return
-				}
-
-				pixelValue, err := getValueAsPixelType(value, newImg.pixelType)
-				if err != nil {
-					return
-				}
-				index := make([]uint32, len(interpolator.Size))
-				idx = i
-				for j := 0; j < len(interpolator.Size); j++ {
-					index[j] = uint32(idx / uint32(strides[j]))
-					idx %= uint32(strides[j])
-				}
-				err = newImg.SetPixel(index, pixelValue)
-				if err != nil {
-					return
-				}
-			}
-		}(start, end)
+	err = resamplePixels(img, newImg, interpolator.Size, interpolator.Spacing, interpolator.Origin, interpolator.Direction,
+		func(physicalPoint []float64, valueAt func(i int) float64) (float64, error) {
+			return img.interpolateAt(physicalPoint, interpolator.FillType, valueAt)
+		})
+	if err != nil {
+		return nil, err
 	}
-	wg.Wait()
-
 	return newImg, nil
 }
 
@@ -150,6 +101,7 @@ func nearestResample(img *Image, interpolator NearestInterpolator) (*Image, erro
 	if err != nil {
 		return nil, err
 	}
+	newImg.copyMetaData(img)
 
 	// Copy the origin, spacing and direction with default values if not specified
 	if interpolator.Origin != nil {
@@ -174,82 +126,98 @@ func nearestResample(img *Image, interpolator NearestInterpolator) (*Image, erro
 		return nil, fmt.Errorf("size is not specified")
 	}
 
-	numPixels := 1
-	for i := 0; i < len(interpolator.Size); i++ {
-		numPixels *= int(interpolator.Size[i])
+	err = resamplePixels(img, newImg, interpolator.Size, interpolator.Spacing, interpolator.Origin, interpolator.Direction,
+		func(physicalPoint []float64, valueAt func(i int) float64) (float64, error) {
+			// Transform the physical point back to input image space
+			inputPoint := make([]float64, len(physicalPoint))
+			for j := range physicalPoint {
+				// Convert physical point to input image space using correct transformation
+				// Subtract 0.5 because pixel coordinates are at center of pixel
+				inputPoint[j] = ((physicalPoint[j] - img.origin[j]) / img.spacing[j]) - 0.5
+				// Round to nearest integer for nearest neighbor
+				inputPoint[j] = float64(int(inputPoint[j]+0.5)) + 0.5
+			}
+			return img.interpolateAt(inputPoint, FillTypeNearest, valueAt)
+		})
+	if err != nil {
+		return nil, err
 	}
+	return newImg, nil
+}
 
-	strides := make([]int, len(interpolator.Size))
-	strides[len(interpolator.Size)-1] = 1
-	for i := len(interpolator.Size) - 2; i >= 0; i-- {
-		strides[i] = strides[i+1] * int(interpolator.Size[i+1])
+// resamplePixels sets every pixel of newImg to the value that sample returns
+// at its physical point, given by the size, spacing, origin and direction of
+// the output grid. sample reads the pixels of img with valueAt.
+func resamplePixels(img, newImg *Image, size []uint32, spacing, origin []float64, direction [9]float64,
+	sample func(physicalPoint []float64, valueAt func(i int) float64) (float64, error)) error {
+	switch img.pixelType {
+	case PixelTypeUInt8:
+		return resampleInto(pixelsOf[uint8](img), newImg, size, spacing, origin, direction, sample)
+	case PixelTypeInt8:
+		return resampleInto(pixelsOf[int8](img), newImg, size, spacing, origin, direction, sample)
+	case PixelTypeUInt16:
+		return resampleInto(pixelsOf[uint16](img), newImg, size, spacing, origin, direction, sample)
+	case PixelTypeInt16:
+		return resampleInto(pixelsOf[int16](img), newImg, size, spacing, origin, direction, sample)
+	case PixelTypeUInt32:
+		return resampleInto(pixelsOf[uint32](img), newImg, size, spacing, origin, direction, sample)
+	case PixelTypeInt32:
+		return resampleInto(pixelsOf[int32](img), newImg, size, spacing, origin, direction, sample)
+	case PixelTypeUInt64:
+		return resampleInto(pixelsOf[uint64](img), newImg, size, spacing, origin, direction, sample)
+	case PixelTypeInt64:
+		return resampleInto(pixelsOf[int64](img), newImg, size, spacing, origin, direction, sample)
+	case PixelTypeFloat32:
+		return resampleInto(pixelsOf[float32](img), newImg, size, spacing, origin, direction, sample)
+	case PixelTypeFloat64:
+		return resampleInto(pixelsOf[float64](img), newImg, size, spacing, origin, direction, sample)
+	default:
+		return fmt.Errorf("unsupported pixel type for resampling: %d", img.pixelType)
 	}
+}
 
-	numGoroutines := uint32(runtime.NumCPU())
-	chunkSize := (uint32(numPixels) + numGoroutines - 1) / numGoroutines
-
-	wg := sync.WaitGroup{}
-	for chunk := uint32(0); chunk < numGoroutines; chunk++ {
-		start := chunk * chunkSize
-		end := start + chunkSize
-		if end > uint32(numPixels) {
-			end = uint32(numPixels)
-		}
-		wg.Add(1)
-		go func(start, end uint32) {
-			defer wg.Done()
-			for i := start; i < end; i++ {
-				physicalPoint := make([]float64, len(interpolator.Size))
-				idx := i
-				indices := make([]float64, len(interpolator.Size))
-				for j := 0; j < len(interpolator.Size); j++ {
-					indices[j] = float64(idx / uint32(strides[j]))
-					idx %= uint32(strides[j])
-				}
-
-				// Apply direction matrix correctly
-				for j := 0; j < len(interpolator.Size); j++ { // physical dimensions
-					for k := 0; k < len(interpolator.Size); k++ { // image dimensions
-						physicalPoint[j] += interpolator.Direction[j*3+k] * indices[k]
-					}
-					physicalPoint[j] = physicalPoint[j]*interpolator.Spacing[j] + interpolator.Origin[j]
-				}
-
-				// Transform the physical point back to input image space
-				inputPoint := make([]float64, len(interpolator.Size))
-				for j := range physicalPoint {
-					// Convert physical point to input image space using correct transformation
-					// Subtract 0.5 because pixel coordinates are at center of pixel
-					inputPoint[j] = ((physicalPoint[j] - img.origin[j]) / img.spacing[j]) - 0.5
-					// Round to nearest integer for nearest neighbor
-					inputPoint[j] = float64(int(inputPoint[j]+0.5)) + 0.5
-				}
-
-				value, err := img.GetPixelFromPoint(inputPoint, FillTypeNearest)
-				if err != nil {
-					return
-				}
-
-				pixelValue, err := getValueAsPixelType(value, newImg.pixelType)
-				if err != nil {
-					return
-				}
+// resampleInto is resamplePixels for pixels of type T, the pixel type of img and newImg.
+func resampleInto[T Number](pixels []T, newImg *Image, size []uint32, spacing, origin []float64, direction [9]float64,
+	sample func(physicalPoint []float64, valueAt func(i int) float64) (float64, error)) error {
+	out := make([]T, newImg.NumPixels())
+	valueAt := func(i int) float64 { return float64(pixels[i]) }
+
+	var mutex sync.Mutex
+	var firstErr error
+	parallelFor(len(out), func(start, end int) {
+		indices := make([]float64, len(size))
+		physicalPoint := make([]float64, len(size))
+		for i := start; i < end; i++ {
+			rest := i
+			for k, n := range size {
+				indices[k] = float64(rest % int(n))
+				rest /= int(n)
+			}
 
-				index := make([]uint32, len(interpolator.Size))
-				idx = i
-				for j := 0; j < len(interpolator.Size); j++ {
-					index[j] = uint32(idx / uint32(strides[j]))
-					idx %= uint32(strides[j])
+			// Apply direction matrix correctly
+			for j := range physicalPoint { // physical dimensions
+				physicalPoint[j] = 0
+				for k := range indices { // image dimensions
+					physicalPoint[j] += direction[j*3+k] * indices[k]
 				}
+				physicalPoint[j] = physicalPoint[j]*spacing[j] + origin[j]
+			}
 
-				err = newImg.SetPixel(index, pixelValue)
-				if err != nil {
-					return
+			value, err := sample(physicalPoint, valueAt)
+			if err != nil {
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = err
 				}
+				mutex.Unlock()
+				return
 			}
-		}(start, end)
+			out[i] = T(value)
+		}
+	})
+	if firstErr != nil {
+		return firstErr
 	}
-	wg.Wait()
-
-	return newImg, nil
+	setPixelsOf(newImg, out)
+	return nil
 }
@@ -2,8 +2,12 @@ package imagetk
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -13,103 +17,298 @@ import (
 const (
 	ImageTypeRaw = iota
 	ImageTypeMHD
+	ImageTypeNIfTI
+	ImageTypeNRRD
+	ImageTypeDICOM
+	ImageTypeTIFF
+	ImageTypePNG
+	ImageTypeJPEG
+	ImageTypeBMP
+	ImageTypeGIF
+	ImageTypeVTK
 )
 
 // ReadImage reads an image from a file and returns an Image object.
-// The function supports reading both raw binary files and MetaImage (MHD) files.
+// The function supports reading raw binary files, MetaImage (MHD) files, NIfTI-1/NIfTI-2 files, NRRD files,
+// DICOM files, TIFF files, PNG, JPEG, BMP and GIF pictures and VTK image files.
 //
 // Parameters:
 //   - filename: Path to the image file to read
 //   - imageType: Type of image file format
-//   - pixelType: Pointer to pixel data type for raw files (can be nil for MHD files)
+//   - pixelType: Pointer to pixel data type for raw files (can be nil for other formats)
 //
 // Returns:
 //   - *Image: The loaded image object
 //   - error: Error if reading fails
 //
-// For raw files, the pixelType parameter must be specified to correctly interpret the binary data.
-// For MHD files, the pixel type is determined from the header information.
+// Raw files have no header, so the pixelType parameter must be specified and the image is read
+// as a 3D volume with equal x and y sizes, the number of slices following from the file size.
+// Use ReadRawImage to read raw files with a known geometry.
+// For MHD, NIfTI, NRRD, DICOM, TIFF and VTK files, the pixel type is determined from the header information.
+// PNG, JPEG, BMP and GIF pictures are read as 2D grayscale images, UInt16 for 16-bit files and UInt8
+// otherwise; use ReadImageChannels to read the color channels separately.
+// For DICOM, filename may be a single file or a directory holding exactly one series; use
+// ReadDICOMSeries to select a series from a directory holding several.
+// Formats added with RegisterFormat are read with their registered reader; use
+// ReadImageAuto to detect the format from the file.
+// VTK files ending with .vti are read as XML ImageData, others as legacy STRUCTURED_POINTS.
 func ReadImage(filename string, imageType int, pixelType *int) (*Image, error) {
-	switch imageType {
-	case ImageTypeRaw:
+	if imageType == ImageTypeRaw {
+		if pixelType == nil {
+			return nil, fmt.Errorf("pixel type must be specified for raw files")
+		}
 		return readImageTypeRaw(filename, *pixelType)
-	case ImageTypeMHD:
-		return readImageTypeMHD(filename)
-	default:
-		return nil, fmt.Errorf("unknown image type")
 	}
+	format, err := getImageFormat(imageType)
+	if err != nil {
+		return nil, err
+	}
+	if format.Read == nil {
+		return nil, fmt.Errorf("reading %s files is not supported", format.Name)
+	}
+	return format.Read(filename)
+}
+
+// readFileMaybeGzip reads the whole file, transparently decompressing it if it starts with the gzip magic bytes.
+func readFileMaybeGzip(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// writeFileMaybeGzip writes data to the file, gzip-compressing it if the filename ends with ".gz".
+func writeFileMaybeGzip(filename string, data []byte) error {
+	if !strings.HasSuffix(strings.ToLower(filename), ".gz") {
+		return os.WriteFile(filename, data, 0666)
+	}
+	outputFile, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+	writer := gzip.NewWriter(outputFile)
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	return writer.Close()
 }
 
+// readImageTypeRaw reads a raw file as a volume with equal x and y sizes, the
+// closest to a cube that the number of pixels allows.
 func readImageTypeRaw(filename string, pixelType int) (*Image, error) {
-	// Open the file
-	file, err := os.Open(filename)
+	bytesPerPixel, err := getBytesPerPixel(pixelType)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	fileInfo, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	xy := max(uint32(math.Round(math.Cbrt(float64(fileInfo.Size()/int64(bytesPerPixel))))), 1)
+	img, err := ReadRawImage(filename, RawReadOptions{Size: []uint32{xy, xy}, Dimension: 3, PixelType: pixelType})
+	if err != nil {
+		return nil, fmt.Errorf("%v; use ReadRawImage with the size of the file", err)
+	}
+	return img, nil
+}
+
+// RawReadOptions describes the layout of a headerless raw image file.
+//
+// Fields:
+//   - Size: The size of the image in each dimension. If it holds one entry less than
+//     Dimension, the size of the last dimension is derived from the file size.
+//   - Spacing: The spacing between pixels in each dimension (defaults to 1).
+//   - Origin: The physical coordinate of the first pixel (defaults to 0).
+//   - Direction: The direction cosines of the image (defaults to identity).
+//   - DirectionMatrix: The NxN direction matrix laid out like GetDirectionMatrix, for images
+//     with more than 3 dimensions; set either Direction or DirectionMatrix.
+//   - PixelType: The type of the stored pixels.
+//   - ByteOrder: The byte order of the stored pixels (defaults to little endian).
+//   - HeaderOffset: The number of bytes to skip before the pixel data, or -1 if the
+//     pixel data is at the end of the file.
+//   - Dimension: The number of dimensions of the image (defaults to the length of Size).
+type RawReadOptions struct {
+	Size            []uint32
+	Spacing         []float64
+	Origin          []float64
+	Direction       [9]float64
+	DirectionMatrix []float64
+	PixelType       int
+	ByteOrder       binary.ByteOrder
+	HeaderOffset    int64
+	Dimension       uint32
+}
 
-	// Get file size
-	fileInfo, err := file.Stat()
+// ReadRawImage reads a headerless raw image file with the layout described by options.
+//
+// Parameters:
+//   - filename: Path to the raw file to read
+//   - options: The size, geometry, pixel type and byte layout of the file
+//
+// Returns:
+//   - *Image: The loaded image object
+//   - error: Error if the options are invalid, reading fails or the file size disagrees with the options
+func ReadRawImage(filename string, options RawReadOptions) (*Image, error) {
+	layout, err := getRawLayout(filename, options)
+	if err != nil {
+		return nil, err
+	}
+	return layout.read()
+}
+
+// getRawLayout checks the options against the file size and describes where the
+// pixel data of a raw file is stored.
+func getRawLayout(filename string, options RawReadOptions) (*imageFileLayout, error) {
+	bytesPerPixel, err := getBytesPerPixel(options.PixelType)
+	if err != nil {
+		return nil, err
+	}
+
+	dimension := options.Dimension
+	if dimension == 0 {
+		dimension = uint32(len(options.Size))
+	}
+	if dimension < 2 {
+		return nil, fmt.Errorf("invalid dimension: %d", dimension)
+	}
+	if len(options.Size) != int(dimension) && len(options.Size) != int(dimension)-1 {
+		return nil, fmt.Errorf("invalid size length %d for dimension %d", len(options.Size), dimension)
+	}
+	if options.Spacing != nil && len(options.Spacing) != int(dimension) {
+		return nil, fmt.Errorf("invalid spacing length: %d", len(options.Spacing))
+	}
+	if options.Origin != nil && len(options.Origin) != int(dimension) {
+		return nil, fmt.Errorf("invalid origin length: %d", len(options.Origin))
+	}
+
+	fileInfo, err := os.Stat(filename)
 	if err != nil {
 		return nil, err
 	}
 	fileSize := fileInfo.Size()
 
-	// Determine pixel type based on file size and dimensions
-	var bytesPerPixel int
-	switch pixelType {
-	case PixelTypeUInt8, PixelTypeInt8:
-		bytesPerPixel = 1
-	case PixelTypeUInt16, PixelTypeInt16:
-		bytesPerPixel = 2
-	case PixelTypeUInt32, PixelTypeInt32, PixelTypeFloat32:
-		bytesPerPixel = 4
-	case PixelTypeUInt64, PixelTypeInt64, PixelTypeFloat64:
-		bytesPerPixel = 8
-	}
-
-	totalPixels := fileSize / int64(bytesPerPixel)
-
-	// Create a new image
-	img := &Image{}
-
-	// This is a placeholder - you should modify these values based on your needs
-	img.dimension = 3
-	img.size = make([]uint32, img.dimension)
-	xy := uint32(math.Round(math.Pow(float64(totalPixels), 1.0/float64(img.dimension))))
-	z := uint32(totalPixels / int64(xy*xy))
-	img.size = []uint32{xy, xy, z}
-	img.bytesPerPixel = bytesPerPixel
-	img.pixelType = pixelType
-
-	img.spacing = []float64{1.0, 1.0, 1.0}
-	img.origin = []float64{0.0, 0.0, 0.0}
-	img.direction = [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
-
-	// Read the pixel data
-	img.pixels = make([]byte, fileSize)
-	if _, err := file.Read(img.pixels); err != nil {
+	size := make([]uint32, dimension)
+	copy(size, options.Size)
+	sliceBytes := int64(bytesPerPixel)
+	for _, s := range options.Size {
+		if s == 0 {
+			return nil, fmt.Errorf("invalid size: %v", options.Size)
+		}
+		sliceBytes *= int64(s)
+	}
+	if len(options.Size) < int(dimension) {
+		if options.HeaderOffset < 0 {
+			return nil, fmt.Errorf("size of the last dimension cannot be derived when the header offset is -1")
+		}
+		dataSize := fileSize - options.HeaderOffset
+		if dataSize <= 0 || dataSize%sliceBytes != 0 {
+			return nil, fmt.Errorf("file size %d is not a multiple of %d bytes per slice after a %d byte header", fileSize, sliceBytes, options.HeaderOffset)
+		}
+		size[dimension-1] = uint32(dataSize / sliceBytes)
+	}
+
+	img, err := newImageHeader(size, options.PixelType)
+	if err != nil {
 		return nil, err
 	}
+	if options.Spacing != nil {
+		if err := img.SetSpacing(append([]float64(nil), options.Spacing...)); err != nil {
+			return nil, err
+		}
+	}
+	if options.Origin != nil {
+		if err := img.SetOrigin(append([]float64(nil), options.Origin...)); err != nil {
+			return nil, err
+		}
+	}
+	if options.Direction != [9]float64{} {
+		if options.DirectionMatrix != nil {
+			return nil, fmt.Errorf("set either Direction or DirectionMatrix, not both")
+		}
+		img.SetDirection(options.Direction)
+	}
+	if options.DirectionMatrix != nil {
+		if err := img.SetDirectionMatrix(options.DirectionMatrix); err != nil {
+			return nil, err
+		}
+	}
 
-	return img, nil
+	numBytes := int64(img.NumPixels()) * int64(bytesPerPixel)
+	offset := options.HeaderOffset
+	if offset == -1 {
+		offset = fileSize - numBytes
+	}
+	if offset < 0 || fileSize-offset != numBytes {
+		return nil, fmt.Errorf("file size %d does not match the expected %d bytes of pixel data after a %d byte header", fileSize, numBytes, options.HeaderOffset)
+	}
+
+	byteOrder := options.ByteOrder
+	if byteOrder == nil {
+		byteOrder = binary.LittleEndian
+	}
+	return &imageFileLayout{header: img, filename: filename, offset: offset, byteOrder: byteOrder}, nil
 }
 
-func readImageTypeMHD(filename string) (*Image, error) {
-	headerFile, err := os.Open(filename)
+// mhdReservedKeys are the MetaImage keys describing the image layout and
+// geometry, which are not kept as metadata.
+var mhdReservedKeys = map[string]bool{
+	"ObjectType": true, "NDims": true, "BinaryData": true, "BinaryDataByteOrderMSB": true,
+	"ElementByteOrderMSB": true, "CompressedData": true, "CompressedDataSize": true,
+	"TransformMatrix": true, "Rotation": true, "Orientation": true, "Offset": true,
+	"Position": true, "Origin": true, "CenterOfRotation": true, "AnatomicalOrientation": true,
+	"ElementSpacing": true, "ElementSize": true, "DimSize": true, "ElementType": true,
+	"ElementNumberOfChannels": true, "HeaderSize": true, "ElementDataFile": true,
+	"ElementComplex": true,
+}
+
+// mhdHeader holds a parsed MetaImage header.
+type mhdHeader struct {
+	img                *Image // geometry and pixel type, without pixel data
+	local              bool   // the pixel data follows the header in the same file
+	dataOffset         int    // offset of local pixel data in the header file
+	dataFiles          []string
+	compressed         bool
+	compressedDataSize int
+	byteOrderMSB       bool
+	headerSize         int
+}
+
+// readMHDHeader parses a MetaImage header, resolving the data file names
+// relative to the directory of the header file.
+func readMHDHeader(filename string) (*mhdHeader, error) {
+	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open MHD file: %v", err)
 	}
-	defer headerFile.Close()
+	defer file.Close()
 
-	img := &Image{}
+	hdr := &mhdHeader{compressedDataSize: -1}
+	img := &Image{direction: [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}}
+	hdr.img = img
 	var rawFilename string
 	var elementType string
-
-	scanner := bufio.NewScanner(headerFile)
+	var transform []float64
+	var complexElements bool
+
+	// ElementDataFile is always the last field of the header. With LOCAL the
+	// pixel data starts right after it, with LIST the file names follow it.
+	offset := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Split(scanLinesWithOffset(&offset))
+header:
 	for scanner.Scan() {
 		line := scanner.Text()
-		parts := strings.Split(line, "=")
+		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
 			continue
 		}
@@ -128,14 +327,15 @@ func readImageTypeMHD(filename string) (*Image, error) {
 				fmt.Sscanf(numbers[i], "%d", &img.size[i])
 			}
 
-		case "TransformMatrix":
-			img.direction = [9]float64{}
-			numbers := strings.Fields(value)
-			for i := 0; i < len(numbers) && i < 9; i++ {
-				fmt.Sscanf(numbers[i], "%f", &img.direction[i])
+		case "TransformMatrix", "Rotation", "Orientation":
+			transform = nil
+			for _, number := range strings.Fields(value) {
+				var v float64
+				fmt.Sscanf(number, "%f", &v)
+				transform = append(transform, v)
 			}
 
-		case "Offset":
+		case "Offset", "Position", "Origin":
 			img.origin = make([]float64, img.dimension)
 			numbers := strings.Fields(value)
 			for i := 0; i < len(numbers) && i < int(img.dimension); i++ {
@@ -152,8 +352,32 @@ func readImageTypeMHD(filename string) (*Image, error) {
 		case "ElementType":
 			elementType = value
 
+		case "ElementNumberOfChannels":
+			fmt.Sscanf(value, "%d", &img.components)
+
+		case "ElementComplex":
+			complexElements = strings.EqualFold(value, "True")
+
+		case "CompressedData":
+			hdr.compressed = strings.EqualFold(value, "True")
+
+		case "CompressedDataSize":
+			fmt.Sscanf(value, "%d", &hdr.compressedDataSize)
+
+		case "ElementByteOrderMSB", "BinaryDataByteOrderMSB":
+			hdr.byteOrderMSB = strings.EqualFold(value, "True")
+
+		case "HeaderSize":
+			fmt.Sscanf(value, "%d", &hdr.headerSize)
+
 		case "ElementDataFile":
 			rawFilename = value
+			break header
+
+		default:
+			if !mhdReservedKeys[key] {
+				img.SetMetaData(key, value)
+			}
 		}
 	}
 
@@ -161,43 +385,199 @@ func readImageTypeMHD(filename string) (*Image, error) {
 		return nil, fmt.Errorf("error reading MHD file: %v", err)
 	}
 
+	if img.dimension < 2 || len(img.size) != int(img.dimension) {
+		return nil, fmt.Errorf("invalid MHD dimension: %d", img.dimension)
+	}
+	if img.spacing == nil {
+		img.spacing = make([]float64, img.dimension)
+		for i := range img.spacing {
+			img.spacing[i] = 1
+		}
+	}
+	if img.origin == nil {
+		img.origin = make([]float64, img.dimension)
+	}
+	// TransformMatrix holds NDims*NDims values, one row per image axis; older
+	// files written by this package always hold a 3x3 matrix.
+	n := int(img.dimension)
+	switch len(transform) {
+	case 9:
+		copy(img.direction[:], transform)
+	case n * n:
+		img.SetDirectionMatrix(transform)
+	}
+
 	// Set pixel type based on ElementType
+	img.pixelType, err = getPixelTypeFromMETType(elementType)
+	if err != nil {
+		return nil, err
+	}
+	if img.components < 1 {
+		img.components = 1
+	}
+	// MetaImage has no complex element types; complex pixels are stored as
+	// pairs of real and imaginary channels.
+	if complexElements {
+		switch {
+		case img.components%2 != 0:
+			return nil, fmt.Errorf("invalid MHD complex data: %d channels", img.components)
+		case img.pixelType == PixelTypeFloat32:
+			img.pixelType = PixelTypeComplex64
+		case img.pixelType == PixelTypeFloat64:
+			img.pixelType = PixelTypeComplex128
+		default:
+			return nil, fmt.Errorf("invalid MHD complex data: %s", elementType)
+		}
+		img.components /= 2
+	}
+	img.bytesPerPixel, _ = getBytesPerPixel(img.pixelType)
+
+	// Collect the data files, if any.
+	fields := strings.Fields(rawFilename)
+	switch {
+	case rawFilename == "LOCAL":
+		hdr.local = true
+		hdr.dataOffset = offset
+	case len(fields) > 0 && fields[0] == "LIST":
+		for scanner.Scan() {
+			if name := strings.TrimSpace(scanner.Text()); name != "" {
+				hdr.dataFiles = append(hdr.dataFiles, name)
+			}
+		}
+	case len(fields) >= 4:
+		var minIndex, maxIndex, step int
+		fmt.Sscanf(fields[1], "%d", &minIndex)
+		fmt.Sscanf(fields[2], "%d", &maxIndex)
+		fmt.Sscanf(fields[3], "%d", &step)
+		if step == 0 {
+			return nil, fmt.Errorf("invalid MHD data file pattern: %s", rawFilename)
+		}
+		for i := minIndex; (step > 0 && i <= maxIndex) || (step < 0 && i >= maxIndex); i += step {
+			hdr.dataFiles = append(hdr.dataFiles, fmt.Sprintf(fields[0], i))
+		}
+	default:
+		hdr.dataFiles = []string{rawFilename}
+	}
+	for i, dataFile := range hdr.dataFiles {
+		if !filepath.IsAbs(dataFile) {
+			hdr.dataFiles[i] = filepath.Join(filepath.Dir(filename), dataFile)
+		}
+	}
+	return hdr, nil
+}
+
+func readImageTypeMHD(filename string) (*Image, error) {
+	hdr, err := readMHDHeader(filename)
+	if err != nil {
+		return nil, err
+	}
+	img := hdr.img
+	numBytes := img.pixelDataSize()
+
+	var data []byte
+	if hdr.local {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open MHD file: %v", err)
+		}
+		data, err = decodeMHDData(content[hdr.dataOffset:], hdr.compressed, hdr.compressedDataSize, 0, numBytes)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, dataFile := range hdr.dataFiles {
+			fileData, err := os.ReadFile(dataFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read raw data: %v", err)
+			}
+			// CompressedDataSize and a HeaderSize of -1 refer to the whole data
+			// and only make sense for a single data file.
+			if len(hdr.dataFiles) == 1 {
+				fileData, err = decodeMHDData(fileData, hdr.compressed, hdr.compressedDataSize, hdr.headerSize, numBytes)
+			} else {
+				fileData, err = decodeMHDData(fileData, hdr.compressed, -1, hdr.headerSize, -1)
+			}
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, fileData...)
+		}
+	}
+
+	if len(data) < numBytes {
+		return nil, fmt.Errorf("failed to read raw data: expected %d bytes, got %d", numBytes, len(data))
+	}
+	img.pixels = data[:numBytes:numBytes]
+	if hdr.byteOrderMSB {
+		img.swapPixelBytes(img.pixels)
+	}
+
+	return img, nil
+}
+
+// scanLinesWithOffset returns a bufio.SplitFunc that splits lines like
+// bufio.ScanLines and keeps *offset at the position following the last line.
+func scanLinesWithOffset(offset *int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		*offset += advance
+		return advance, token, err
+	}
+}
+
+// decodeMHDData strips the header of a MetaImage data block and decompresses it
+// if needed. A headerSize of -1 means the pixel data is at the end of the block.
+func decodeMHDData(data []byte, compressed bool, compressedDataSize, headerSize, expectedSize int) ([]byte, error) {
+	if compressed {
+		if compressedDataSize > 0 && compressedDataSize < len(data) {
+			data = data[:compressedDataSize]
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress raw data: %v", err)
+		}
+		defer reader.Close()
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress raw data: %v", err)
+		}
+		return data, nil
+	}
+
+	if headerSize == -1 && expectedSize >= 0 {
+		headerSize = len(data) - expectedSize
+	}
+	if headerSize < 0 || headerSize > len(data) {
+		return nil, fmt.Errorf("invalid MHD header size: %d", headerSize)
+	}
+	return data[headerSize:], nil
+}
+
+func getPixelTypeFromMETType(elementType string) (int, error) {
 	switch elementType {
 	case "MET_UCHAR":
-		img.pixelType = PixelTypeUInt8
+		return PixelTypeUInt8, nil
 	case "MET_CHAR":
-		img.pixelType = PixelTypeInt8
+		return PixelTypeInt8, nil
 	case "MET_USHORT":
-		img.pixelType = PixelTypeUInt16
+		return PixelTypeUInt16, nil
 	case "MET_SHORT":
-		img.pixelType = PixelTypeInt16
+		return PixelTypeInt16, nil
 	case "MET_UINT":
-		img.pixelType = PixelTypeUInt32
+		return PixelTypeUInt32, nil
 	case "MET_INT":
-		img.pixelType = PixelTypeInt32
-	case "MET_ULONG":
-		img.pixelType = PixelTypeUInt64
-	case "MET_LONG":
-		img.pixelType = PixelTypeInt64
+		return PixelTypeInt32, nil
+	case "MET_ULONG", "MET_ULONG_LONG":
+		return PixelTypeUInt64, nil
+	case "MET_LONG", "MET_LONG_LONG":
+		return PixelTypeInt64, nil
 	case "MET_FLOAT":
-		img.pixelType = PixelTypeFloat32
+		return PixelTypeFloat32, nil
 	case "MET_DOUBLE":
-		img.pixelType = PixelTypeFloat64
+		return PixelTypeFloat64, nil
 	default:
-		return nil, fmt.Errorf("unsupported element type: %s", elementType)
+		return PixelTypeUnknown, fmt.Errorf("unsupported element type: %s", elementType)
 	}
-
-	// Read the raw data file
-	rawPath := filepath.Join(filepath.Dir(filename), rawFilename)
-	rawImg, err := readImageTypeRaw(rawPath, img.pixelType)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read raw data: %v", err)
-	}
-
-	// Copy pixel data from raw image
-	img.pixels = rawImg.pixels
-
-	return img, nil
 }
 
 // WriteImage saves an image to a file.
@@ -213,6 +593,20 @@ func WriteImage(img *Image, filename string, imageType int) error {
 	return img.Save(filename, imageType)
 }
 
+// WriteImageCompressed saves an image to a file, compressing the pixel data if
+// the file format supports it.
+//
+// Parameters:
+//   - img: The image object to save
+//   - filename: Path to the file where the image will be saved
+//   - imageType: Type of image file format
+//
+// Returns:
+//   - error: Error if saving fails
+func WriteImageCompressed(img *Image, filename string, imageType int) error {
+	return img.SaveCompressed(filename, imageType)
+}
+
 // Save saves the image to a file based on the specified image type.
 //
 // Parameters:
@@ -221,15 +615,54 @@ func WriteImage(img *Image, filename string, imageType int) error {
 //
 // Returns:
 //   - error: Error if saving fails
+//
+// MHD files ending with .mha are written as a single file with the pixel data
+// embedded after the header. DICOM images are written as a series into the
+// directory named by filename; use WriteDICOMSeries to include attributes.
+// TIFF files are written as OME-TIFF with one page per slice, carrying the
+// spacing but not the origin or direction. PNG files keep UInt8 and UInt16
+// values and map other pixel types from their full range to 8 bits; use
+// WritePNG to choose the intensity window. VTK files ending with .vti are
+// written as XML ImageData with appended raw data, others as binary legacy
+// files without the direction; use WriteVTK to choose the encoding.
+// Metadata is written as MHD header keys and NRRD key/value pairs, to the NIfTI
+// descrip, aux_file and intent_name fields, and as DICOM attributes for keys of
+// the form "0010|0010"; other formats do not keep it.
 func (img *Image) Save(filename string, imageType int) error {
-	switch imageType {
-	case ImageTypeRaw:
-		return img.saveImageTypeRaw(filename)
-	case ImageTypeMHD:
-		return img.saveImageTypeMHD(filename)
-	default:
-		return fmt.Errorf("unknown image type")
+	return img.save(filename, imageType, false)
+}
+
+// SaveCompressed saves the image to a file based on the specified image type,
+// compressing the pixel data if the file format supports it. MHD files are
+// written with zlib-compressed data, NRRD files with gzip encoding, TIFF files
+// with Deflate compression and .vti files with zlib-compressed blocks; NIfTI
+// files are compressed when the filename ends with .gz.
+//
+// Parameters:
+//   - filename: Path to the file where the image will be saved
+//   - imageType: Type of image file format
+//
+// Returns:
+//   - error: Error if saving fails
+func (img *Image) SaveCompressed(filename string, imageType int) error {
+	return img.save(filename, imageType, true)
+}
+
+func (img *Image) save(filename string, imageType int, compressed bool) error {
+	format, err := getImageFormat(imageType)
+	if err != nil {
+		return err
+	}
+	if format.Write == nil {
+		return fmt.Errorf("writing %s files is not supported", format.Name)
+	}
+	if img.GetNumberOfComponentsPerPixel() > 1 && !format.MultiComponent {
+		return fmt.Errorf("writing multi-component images to %s files is not supported", format.Name)
 	}
+	if img.dimension > 3 && !format.NDimensional {
+		return fmt.Errorf("writing %dD images to %s files is not supported", img.dimension, format.Name)
+	}
+	return format.Write(img, filename, compressed)
 }
 
 func (img *Image) saveImageTypeRaw(filename string) error {
@@ -242,11 +675,37 @@ func (img *Image) saveImageTypeRaw(filename string) error {
 	return nil
 }
 
-func (img *Image) saveImageTypeMHD(filename string) error {
-	// Save the raw data file
-	rawFilename := filename[:len(filename)-4] + ".raw"
-	if err := img.saveImageTypeRaw(rawFilename); err != nil {
-		return fmt.Errorf("failed to save raw data: %v", err)
+func (img *Image) saveImageTypeMHD(filename string, compressed bool) error {
+	elementType, err := getMETTypeFromPixelType(img.pixelType)
+	if err != nil {
+		return err
+	}
+
+	data := img.pixels
+	if compressed {
+		buffer := new(bytes.Buffer)
+		writer := zlib.NewWriter(buffer)
+		if _, err := writer.Write(img.pixels); err != nil {
+			return fmt.Errorf("failed to compress raw data: %v", err)
+		}
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("failed to compress raw data: %v", err)
+		}
+		data = buffer.Bytes()
+	}
+
+	// .mha files embed the pixel data after the header, .mhd files reference a
+	// separate data file.
+	local := strings.HasSuffix(strings.ToLower(filename), ".mha")
+	rawFilename := ""
+	if !local {
+		rawFilename = filename[:len(filename)-4] + ".raw"
+		if compressed {
+			rawFilename = filename[:len(filename)-4] + ".zraw"
+		}
+		if err := os.WriteFile(rawFilename, data, 0666); err != nil {
+			return fmt.Errorf("failed to save raw data: %v", err)
+		}
 	}
 
 	// Create and write the MHD header file
@@ -257,65 +716,98 @@ func (img *Image) saveImageTypeMHD(filename string) error {
 	defer headerFile.Close()
 
 	// Write header information
-	fmt.Fprintf(headerFile, "ObjectType = Image\n")
-	fmt.Fprintf(headerFile, "BinaryData = True\n")
-	fmt.Fprintf(headerFile, "NDims = %d\n", img.dimension)
-	fmt.Fprintf(headerFile, "DimSize = %d", img.size[0])
-	for i := 1; i < int(img.dimension); i++ {
-		fmt.Fprintf(headerFile, " %d", img.size[i])
-	}
-	fmt.Fprintf(headerFile, "\n")
-	fmt.Fprintf(headerFile, "TransformMatrix = ")
-	for i := 0; i < 9; i++ {
-		fmt.Fprintf(headerFile, "%f ", img.direction[i])
-	}
-	fmt.Fprintf(headerFile, "\n")
-	fmt.Fprintf(headerFile, "Offset = ")
+	header := bufio.NewWriter(headerFile)
+	fmt.Fprintf(header, "ObjectType = Image\n")
+	fmt.Fprintf(header, "NDims = %d\n", img.dimension)
+	fmt.Fprintf(header, "BinaryData = True\n")
+	fmt.Fprintf(header, "BinaryDataByteOrderMSB = False\n")
+	if compressed {
+		fmt.Fprintf(header, "CompressedData = True\n")
+		fmt.Fprintf(header, "CompressedDataSize = %d\n", len(data))
+	} else {
+		fmt.Fprintf(header, "CompressedData = False\n")
+	}
+	fmt.Fprintf(header, "TransformMatrix =")
+	for k := 0; k < int(img.dimension); k++ {
+		for j := 0; j < int(img.dimension); j++ {
+			fmt.Fprintf(header, " %g", img.directionAt(k, j))
+		}
+	}
+	fmt.Fprintf(header, "\n")
+	fmt.Fprintf(header, "Offset =")
+	for i := 0; i < int(img.dimension); i++ {
+		fmt.Fprintf(header, " %g", img.origin[i])
+	}
+	fmt.Fprintf(header, "\n")
+	fmt.Fprintf(header, "ElementSpacing =")
 	for i := 0; i < int(img.dimension); i++ {
-		fmt.Fprintf(headerFile, "%f ", img.origin[i])
+		fmt.Fprintf(header, " %g", img.spacing[i])
+	}
+	fmt.Fprintf(header, "\n")
+	fmt.Fprintf(header, "DimSize =")
+	for i := 0; i < int(img.dimension); i++ {
+		fmt.Fprintf(header, " %d", img.size[i])
+	}
+	fmt.Fprintf(header, "\n")
+	channels := img.GetNumberOfComponentsPerPixel()
+	if isComplexPixelType(img.pixelType) {
+		channels *= 2
+		// ElementComplex is our own key. ITK writes complex images as 2 channels
+		// without it and relies on the pixel type the caller asks for, so ITK
+		// reads these files as 2-channel real images, and ITK files are read
+		// here as 2-component real images.
+		fmt.Fprintf(header, "ElementComplex = True\n")
+	}
+	if channels > 1 {
+		fmt.Fprintf(header, "ElementNumberOfChannels = %d\n", channels)
+	}
+	fmt.Fprintf(header, "ElementType = %s\n", elementType)
+	// Metadata goes before ElementDataFile, which must be the last key.
+	for _, key := range img.MetaDataKeys() {
+		value := img.metadata[key]
+		if mhdReservedKeys[key] || strings.TrimSpace(key) != key || key == "" ||
+			strings.ContainsAny(key, "=\r\n") || strings.ContainsAny(value, "\r\n") {
+			continue
+		}
+		fmt.Fprintf(header, "%s = %s\n", key, value)
 	}
-	fmt.Fprintf(headerFile, "\n")
 
-	// Map pixel type to MHD ElementType
-	elementType := ""
-	switch img.pixelType {
+	// Reference the raw data file
+	if local {
+		fmt.Fprintf(header, "ElementDataFile = LOCAL\n")
+		if _, err := header.Write(data); err != nil {
+			return fmt.Errorf("failed to write MHD data: %v", err)
+		}
+	} else {
+		fmt.Fprintf(header, "ElementDataFile = %s\n", filepath.Base(rawFilename))
+	}
+
+	return header.Flush()
+}
+
+func getMETTypeFromPixelType(pixelType int) (string, error) {
+	switch pixelType {
 	case PixelTypeUInt8:
-		elementType = "MET_UCHAR"
+		return "MET_UCHAR", nil
 	case PixelTypeInt8:
-		elementType = "MET_CHAR"
+		return "MET_CHAR", nil
 	case PixelTypeUInt16:
-		elementType = "MET_USHORT"
+		return "MET_USHORT", nil
 	case PixelTypeInt16:
-		elementType = "MET_SHORT"
+		return "MET_SHORT", nil
 	case PixelTypeUInt32:
-		elementType = "MET_UINT"
+		return "MET_UINT", nil
 	case PixelTypeInt32:
-		elementType = "MET_INT"
+		return "MET_INT", nil
 	case PixelTypeUInt64:
-		elementType = "MET_ULONG"
+		return "MET_ULONG", nil
 	case PixelTypeInt64:
-		elementType = "MET_LONG"
-	case PixelTypeFloat32:
-		elementType = "MET_FLOAT"
-	case PixelTypeFloat64:
-		elementType = "MET_DOUBLE"
+		return "MET_LONG", nil
+	case PixelTypeFloat32, PixelTypeComplex64:
+		return "MET_FLOAT", nil
+	case PixelTypeFloat64, PixelTypeComplex128:
+		return "MET_DOUBLE", nil
 	default:
-		return fmt.Errorf("unsupported pixel type for MHD format")
+		return "", fmt.Errorf("unsupported pixel type for MHD format")
 	}
-	fmt.Fprintf(headerFile, "ElementType = %s\n", elementType)
-
-	// Write additional metadata
-	fmt.Fprintf(headerFile, "ElementByteOrderMSB = False\n")
-	fmt.Fprintf(headerFile, "CompressedData = False\n")
-	fmt.Fprintf(headerFile, "ElementSpacing = %f", img.spacing[0])
-	for i := 1; i < int(img.dimension); i++ {
-		fmt.Fprintf(headerFile, " %f", img.spacing[i])
-	}
-	fmt.Fprintf(headerFile, "\n")
-
-	// Reference the raw data file
-	rawFilenameBase := rawFilename[len(filepath.Dir(rawFilename))+1:]
-	fmt.Fprintf(headerFile, "ElementDataFile = %s\n", rawFilenameBase)
-
-	return nil
 }
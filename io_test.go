@@ -1,8 +1,11 @@
 package imagetk
 
 import (
+	"bytes"
+	"encoding/binary"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -71,6 +74,10 @@ func TestReadImage(t *testing.T) {
 				t.Errorf("expected error %v, got %v", tt.expect, err)
 			}
 			if tt.imageType == ImageTypeRaw {
+				// The 100 pixels are read as a 5x5x4 volume.
+				if !reflect.DeepEqual(img.GetSize(), []uint32{5, 5, 4}) {
+					t.Errorf("expected size [5 5 4], got %v", img.GetSize())
+				}
 				err = img.SetSize([]uint32{10, 10})
 				if err != nil {
 					t.Fatalf("failed to set size: %v", err)
@@ -86,3 +93,289 @@ func TestReadImage(t *testing.T) {
 		})
 	}
 }
+
+func TestMetaImageRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_mha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newNIfTITestImage(t)
+	tests := []struct {
+		name       string
+		filename   string
+		compressed bool
+	}{
+		{name: "mhd", filename: "test.mhd"},
+		{name: "mha", filename: "test.mha"},
+		{name: "compressed mhd", filename: "testz.mhd", compressed: true},
+		{name: "compressed mha", filename: "testz.mha", compressed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			write := WriteImage
+			if tt.compressed {
+				write = WriteImageCompressed
+			}
+			if err := write(img, filename, ImageTypeMHD); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			readImg, err := ReadImage(filename, ImageTypeMHD, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if !reflect.DeepEqual(readImg.GetSize(), img.GetSize()) ||
+				!reflect.DeepEqual(readImg.GetSpacing(), img.GetSpacing()) ||
+				!reflect.DeepEqual(readImg.GetOrigin(), img.GetOrigin()) ||
+				readImg.GetDirection() != img.GetDirection() {
+				t.Errorf("geometry mismatch: got size %v spacing %v origin %v direction %v",
+					readImg.GetSize(), readImg.GetSpacing(), readImg.GetOrigin(), readImg.GetDirection())
+			}
+			if !bytes.Equal(readImg.pixels, img.pixels) {
+				t.Errorf("pixel data mismatch")
+			}
+		})
+	}
+}
+
+func TestReadMetaImageVariants(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_mha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	values := []uint16{1, 2, 300, 400, 5, 6, 7, 8}
+	bigEndian := new(bytes.Buffer)
+	binary.Write(bigEndian, binary.BigEndian, values)
+	littleEndian := new(bytes.Buffer)
+	binary.Write(littleEndian, binary.LittleEndian, values)
+	os.WriteFile(filepath.Join(tempDir, "header.raw"), append([]byte("skipme"), bigEndian.Bytes()...), 0666)
+	os.WriteFile(filepath.Join(tempDir, "slice1.raw"), littleEndian.Bytes()[:8], 0666)
+	os.WriteFile(filepath.Join(tempDir, "slice2.raw"), littleEndian.Bytes()[8:], 0666)
+
+	header := "ObjectType = Image\nNDims = 3\nDimSize = 2 2 2\nElementType = MET_USHORT\n"
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "big endian with header size", header: header + "ElementByteOrderMSB = True\nHeaderSize = 6\nElementDataFile = header.raw\n"},
+		{name: "header size at end", header: header + "ElementByteOrderMSB = True\nHeaderSize = -1\nElementDataFile = header.raw\n"},
+		{name: "list", header: header + "ElementDataFile = LIST 2D\nslice1.raw\nslice2.raw\n"},
+		{name: "pattern", header: header + "ElementDataFile = slice%d.raw 1 2 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, "test.mhd")
+			if err := os.WriteFile(filename, []byte(tt.header), 0666); err != nil {
+				t.Fatal(err)
+			}
+			img, err := ReadImage(filename, ImageTypeMHD, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			for i, v := range values {
+				if img.getLinearPixelAsFloat64(i) != float64(v) {
+					t.Errorf("pixel %d: expected %v, got %v", i, v, img.getLinearPixelAsFloat64(i))
+				}
+			}
+		})
+	}
+}
+
+func TestReadMetaImage2DTransformMatrix(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_mha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	header := "ObjectType = Image\nNDims = 2\nTransformMatrix = 0 1 -1 0\nDimSize = 2 1\n" +
+		"ElementType = MET_UCHAR\nElementDataFile = LOCAL\n"
+	filename := filepath.Join(tempDir, "test.mha")
+	if err := os.WriteFile(filename, append([]byte(header), 3, 4), 0666); err != nil {
+		t.Fatal(err)
+	}
+	img, err := ReadImage(filename, ImageTypeMHD, nil)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	expected := [9]float64{0, 1, 0, -1, 0, 0, 0, 0, 1}
+	if img.GetDirection() != expected {
+		t.Errorf("expected direction %v, got %v", expected, img.GetDirection())
+	}
+	if img.pixels[0] != 3 || img.pixels[1] != 4 {
+		t.Errorf("expected pixels [3 4], got %v", img.pixels)
+	}
+}
+
+func TestReadRawImage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	values := []int16{1, -2, 3, -4, 5, -6, 7, -8, 9, -10, 11, -12}
+	littleEndian := new(bytes.Buffer)
+	binary.Write(littleEndian, binary.LittleEndian, values)
+	bigEndian := new(bytes.Buffer)
+	binary.Write(bigEndian, binary.BigEndian, values)
+	os.WriteFile(filepath.Join(tempDir, "le.raw"), littleEndian.Bytes(), 0666)
+	os.WriteFile(filepath.Join(tempDir, "be.raw"), append([]byte{0xff, 0xff, 0xff, 0xff}, bigEndian.Bytes()...), 0666)
+
+	tests := []struct {
+		name      string
+		filename  string
+		options   RawReadOptions
+		expectErr bool
+	}{
+		{name: "little endian", filename: "le.raw", options: RawReadOptions{Size: []uint32{3, 2, 2}, PixelType: PixelTypeInt16}},
+		{name: "big endian with header", filename: "be.raw", options: RawReadOptions{Size: []uint32{3, 2, 2}, PixelType: PixelTypeInt16, ByteOrder: binary.BigEndian, HeaderOffset: 4}},
+		{name: "header at end", filename: "be.raw", options: RawReadOptions{Size: []uint32{3, 2, 2}, PixelType: PixelTypeInt16, ByteOrder: binary.BigEndian, HeaderOffset: -1}},
+		{name: "derived last size", filename: "le.raw", options: RawReadOptions{Size: []uint32{3, 2}, Dimension: 3, PixelType: PixelTypeInt16}},
+		{name: "size mismatch", filename: "le.raw", options: RawReadOptions{Size: []uint32{3, 3, 2}, PixelType: PixelTypeInt16}, expectErr: true},
+		{name: "unknown pixel type", filename: "le.raw", options: RawReadOptions{Size: []uint32{3, 2, 2}}, expectErr: true},
+		{name: "invalid spacing", filename: "le.raw", options: RawReadOptions{Size: []uint32{3, 2, 2}, PixelType: PixelTypeInt16, Spacing: []float64{1, 1}}, expectErr: true},
+		{name: "invalid origin", filename: "le.raw", options: RawReadOptions{Size: []uint32{3, 2, 2}, PixelType: PixelTypeInt16, Origin: []float64{0}}, expectErr: true},
+		{name: "invalid direction matrix", filename: "le.raw", options: RawReadOptions{Size: []uint32{3, 2, 2}, PixelType: PixelTypeInt16, DirectionMatrix: make([]float64, 4)}, expectErr: true},
+		{name: "direction and matrix", filename: "le.raw", options: RawReadOptions{Size: []uint32{3, 2, 2}, PixelType: PixelTypeInt16, Direction: [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}, DirectionMatrix: make([]float64, 9)}, expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := ReadRawImage(filepath.Join(tempDir, tt.filename), tt.options)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectErr, err)
+			}
+			if tt.expectErr {
+				return
+			}
+			if !reflect.DeepEqual(img.GetSize(), []uint32{3, 2, 2}) {
+				t.Errorf("expected size [3 2 2], got %v", img.GetSize())
+			}
+			for i, v := range values {
+				if img.getLinearPixelAsFloat64(i) != float64(v) {
+					t.Errorf("pixel %d: expected %v, got %v", i, v, img.getLinearPixelAsFloat64(i))
+				}
+			}
+		})
+	}
+
+	// Images with more than 3 dimensions take an NxN direction matrix.
+	matrix := []float64{
+		1, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 0, 1,
+		0, 0, 1, 0,
+	}
+	img4D, err := ReadRawImage(filepath.Join(tempDir, "le.raw"), RawReadOptions{Size: []uint32{3, 2, 2, 1}, PixelType: PixelTypeInt16, DirectionMatrix: matrix})
+	if err != nil {
+		t.Fatalf("failed to read 4D raw image: %v", err)
+	}
+	if !reflect.DeepEqual(img4D.GetDirectionMatrix(), matrix) {
+		t.Errorf("expected direction matrix %v, got %v", matrix, img4D.GetDirectionMatrix())
+	}
+
+	// ReadImage guesses a volume with equal x and y sizes.
+	pixelType := PixelTypeInt16
+	img, err := ReadImage(filepath.Join(tempDir, "le.raw"), ImageTypeRaw, &pixelType)
+	if err != nil {
+		t.Fatalf("failed to read raw image: %v", err)
+	}
+	if !reflect.DeepEqual(img.GetSize(), []uint32{2, 2, 3}) {
+		t.Errorf("expected size [2 2 3], got %v", img.GetSize())
+	}
+	if _, err := ReadImage(filepath.Join(tempDir, "le.raw"), ImageTypeRaw, nil); err == nil {
+		t.Errorf("expected error for a raw image without pixel type")
+	}
+	pixelType = PixelTypeInt32
+	if _, err := ReadImage(filepath.Join(tempDir, "le.raw"), ImageTypeRaw, &pixelType); err == nil {
+		t.Errorf("expected error for a raw image without square slices")
+	}
+}
+
+func TestMetaDataRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	metadata := map[string]string{
+		"descrip":   "T1 weighted",
+		"0010|0010": "Doe^Jane",
+		"Modality":  "MR",
+	}
+	tests := []struct {
+		filename  string
+		imageType int
+		expected  map[string]string
+	}{
+		{"test.mhd", ImageTypeMHD, metadata},
+		{"test.mha", ImageTypeMHD, metadata},
+		{"test.nrrd", ImageTypeNRRD, metadata},
+		{"test.nhdr", ImageTypeNRRD, metadata},
+		// NIfTI headers only hold the descrip, aux_file and intent_name fields.
+		{"test.nii", ImageTypeNIfTI, map[string]string{"descrip": "T1 weighted"}},
+		{"test.nii.gz", ImageTypeNIfTI, map[string]string{"descrip": "T1 weighted"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			img := newNIfTITestImage(t)
+			for key, value := range metadata {
+				img.SetMetaData(key, value)
+			}
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := WriteImage(img, filename, tt.imageType); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			readImg, err := ReadImage(filename, tt.imageType, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if len(readImg.MetaDataKeys()) != len(tt.expected) {
+				t.Errorf("expected metadata keys %v, got %v", tt.expected, readImg.MetaDataKeys())
+			}
+			for key, value := range tt.expected {
+				if readValue, _ := readImg.GetMetaData(key); readValue != value {
+					t.Errorf("%s: expected %q, got %q", key, value, readValue)
+				}
+			}
+		})
+	}
+
+	// Keys the MHD format cannot hold are skipped, and layout keys are not metadata.
+	img := newNIfTITestImage(t)
+	img.SetMetaData("Bad=Key", "value")
+	img.SetMetaData("Multi", "two\nlines")
+	img.SetMetaData("DimSize", "1 1 1")
+	filename := filepath.Join(tempDir, "skipped.mhd")
+	if err := WriteImage(img, filename, ImageTypeMHD); err != nil {
+		t.Fatal(err)
+	}
+	readImg, err := ReadImage(filename, ImageTypeMHD, nil)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	if keys := readImg.MetaDataKeys(); len(keys) != 0 || readImg.GetSize()[0] != 4 {
+		t.Errorf("expected no metadata and size 4, got %v and %v", keys, readImg.GetSize())
+	}
+
+	// NRRD key/value pairs escape line breaks and backslashes.
+	img.SetMetaData("Path", "C:\\data")
+	filename = filepath.Join(tempDir, "escaped.nrrd")
+	if err := WriteImage(img, filename, ImageTypeNRRD); err != nil {
+		t.Fatal(err)
+	}
+	readImg, err = ReadImage(filename, ImageTypeNRRD, nil)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	for _, key := range []string{"Multi", "Path", "Bad=Key"} {
+		if value, _ := readImg.GetMetaData(key); value != img.metadata[key] {
+			t.Errorf("%s: expected %q, got %q", key, img.metadata[key], value)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package imagetk
+
+import "os"
+
+// mapFile reads length bytes of the file starting at offset, as memory mapping
+// is not supported on this platform.
+func mapFile(file *os.File, offset int64, length int) ([]byte, []byte, error) {
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, offset); err != nil {
+		return nil, nil, err
+	}
+	return nil, data, nil
+}
+
+// unmapFile does nothing, as mapFile returns no mapping on this platform.
+func unmapFile(mapping []byte) error {
+	return nil
+}
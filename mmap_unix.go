@@ -0,0 +1,25 @@
+//go:build unix
+
+package imagetk
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps length bytes of the file starting at offset into private,
+// copy-on-write memory. It returns the whole mapping, which starts at a page
+// boundary, and the requested bytes within it.
+func mapFile(file *os.File, offset int64, length int) ([]byte, []byte, error) {
+	pageOffset := offset % int64(os.Getpagesize())
+	mapping, err := syscall.Mmap(int(file.Fd()), offset-pageOffset, int(pageOffset)+length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mapping, mapping[pageOffset : int(pageOffset)+length : int(pageOffset)+length], nil
+}
+
+// unmapFile releases a mapping returned by mapFile.
+func unmapFile(mapping []byte) error {
+	return syscall.Munmap(mapping)
+}
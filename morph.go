@@ -1,8 +1,8 @@
 package imagetk
 
 import (
-	"runtime"
-	"sync"
+	"fmt"
+	"slices"
 )
 
 const (
@@ -10,41 +10,37 @@ const (
 	MORPH_CLOSE
 )
 
-// BinaryDilate dilates the binary image.
+// BinaryDilate dilates the binary image, whose voxels above zero are foreground.
 // Parameters:
 //   - image: The image to dilate.
 //   - kernelSize: The size of the kernel to use for the dilation.
 //
 // Returns:
-//   - *Image: The resulting image after dilation.
+//   - *Image: The resulting Int8 image of 0 and 1 after dilation.
 //   - error: An error if the operation fails.
 func BinaryDilate(image *Image, kernelSize int) (*Image, error) {
 	switch image.GetDimension() {
-	case 2:
-		return binaryDilate2D(image, kernelSize)
-	case 3:
-		return binaryDilate3D(image, kernelSize)
+	case 2, 3:
+		return binaryMorphology(image, kernelSize, false)
 	default:
-		return nil, nil
+		return nil, fmt.Errorf("unsupported dimension: %d", image.GetDimension())
 	}
 }
 
-// BinaryErode erodes the binary image.
+// BinaryErode erodes the binary image, whose voxels above zero are foreground.
 // Parameters:
 //   - image: The image to erode.
 //   - kernelSize: The size of the kernel to use for the erosion.
 //
 // Returns:
-//   - *Image: The resulting image after erosion.
+//   - *Image: The resulting Int8 image of 0 and 1 after erosion.
 //   - error: An error if the operation fails.
 func BinaryErode(image *Image, kernelSize int) (*Image, error) {
 	switch image.GetDimension() {
-	case 2:
-		return binaryErode2D(image, kernelSize)
-	case 3:
-		return binaryErode3D(image, kernelSize)
+	case 2, 3:
+		return binaryMorphology(image, kernelSize, true)
 	default:
-		return nil, nil
+		return nil, fmt.Errorf("unsupported dimension: %d", image.GetDimension())
 	}
 }
 
@@ -92,274 +88,111 @@ func Morphology(image *Image, operation, kernelSize, iterations int) (*Image, er
 	return output, nil
 }
 
-func binaryDilate3D(image *Image, kernelSize int) (*Image, error) {
-	size := image.GetSize()
-	int8Array := make([][][]int8, size[2])
-	expandedArray := make([][][]int8, size[2])
-	for z := uint32(0); z < size[2]; z++ {
-		int8Array[z] = make([][]int8, size[1])
-		expandedArray[z] = make([][]int8, size[1])
-		for y := uint32(0); y < size[1]; y++ {
-			int8Array[z][y] = make([]int8, size[0])
-			expandedArray[z][y] = make([]int8, size[0])
-			for x := uint32(0); x < size[0]; x++ {
-				val, err := image.GetPixelAsInt8([]uint32{x, y, z})
-				if err != nil {
-					return nil, err
-				}
-				if val > 0 {
-					int8Array[z][y][x] = 1
-				} else {
-					int8Array[z][y][x] = 0
-				}
-			}
-		}
+// binaryMorphology dilates or erodes a 2D or 3D binary image with a cubic
+// kernel. A voxel of the dilated image is 1 if any voxel of the kernel around
+// it is foreground; a voxel of the eroded image is 1 if all voxels of the
+// kernel around it lie inside the image and are foreground.
+func binaryMorphology(image *Image, kernelSize int, erode bool) (*Image, error) {
+	mask, err := binaryForeground(image)
+	if err != nil {
+		return nil, err
 	}
-
-	numGoroutines := uint32(runtime.NumCPU())
-	chunkSize := size[2] / numGoroutines
-	if chunkSize*numGoroutines < size[2] {
-		chunkSize += 1
+	size := [3]int{int(image.size[0]), int(image.size[1]), 1}
+	if image.dimension == 3 {
+		size[2] = int(image.size[2])
 	}
-	wg := sync.WaitGroup{}
-	for chunk := uint32(0); chunk < numGoroutines; chunk++ {
-		start := chunk * chunkSize
-		end := start + chunkSize
-		if end > size[2] {
-			end = size[2]
-		}
-		wg.Add(1)
-		go func(start, end uint32) {
-			defer wg.Done()
-			for z := start; z < end; z++ {
-				for y := uint32(0); y < size[1]; y++ {
-					for x := uint32(0); x < size[0]; x++ {
-						// Check if the current pixel is set to 1
-						if int8Array[z][y][x] == 1 {
-							// Expand around the pixel, respecting boundaries
-							for i := -kernelSize / 2; i <= kernelSize/2; i++ {
-								for j := -kernelSize / 2; j <= kernelSize/2; j++ {
-									for k := -kernelSize / 2; k <= kernelSize/2; k++ {
-										newZ := int(z) + i
-										newY := int(y) + j
-										newX := int(x) + k
-
-										// Ensure the new coordinates are within bounds
-										if newZ >= 0 && newZ < int(size[2]) && newY >= 0 && newY < int(size[1]) && newX >= 0 && newX < int(size[0]) {
-											expandedArray[newZ][newY][newX] = 1
-										}
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-		}(start, end)
+	half := [3]int{kernelSize / 2, kernelSize / 2, 0}
+	if image.dimension == 3 {
+		half[2] = kernelSize / 2
 	}
-	wg.Wait()
 
-	newImage, err := GetImageFromArray(expandedArray)
+	newImage, err := NewImage(slices.Clone(image.size), PixelTypeInt8)
 	if err != nil {
 		return nil, err
 	}
-
-	newImage.SetOrigin(image.GetOrigin())
-	newImage.SetSpacing(image.GetSpacing())
-	newImage.SetDirection(image.GetDirection())
-	return newImage, nil
-}
-
-func binaryDilate2D(image *Image, kernelSize int) (*Image, error) {
-	size := image.GetSize()
-	int8Array := make([][]int8, size[1])
-	expandedArray := make([][]int8, size[1])
-	for y := uint32(0); y < size[1]; y++ {
-		int8Array[y] = make([]int8, size[0])
-		expandedArray[y] = make([]int8, size[0])
-		for x := uint32(0); x < size[0]; x++ {
-			val, err := image.GetPixelAsInt8([]uint32{x, y})
-			if err != nil {
-				return nil, err
-			}
-			if val > 0 {
-				int8Array[y][x] = 1
-			} else {
-				int8Array[y][x] = 0
-			}
-		}
-	}
-	for y := uint32(0); y < size[1]; y++ {
-		for x := uint32(0); x < size[0]; x++ {
-			// Check if the current pixel is set to 1
-			if int8Array[y][x] == 1 {
-				// Expand around the pixel, respecting boundaries
-				for j := -kernelSize / 2; j <= kernelSize/2; j++ {
-					for k := -kernelSize / 2; k <= kernelSize/2; k++ {
-						newY := int(y) + j
-						newX := int(x) + k
-
-						// Ensure the new coordinates are within bounds
-						if newY >= 0 && newY < int(size[1]) && newX >= 0 && newX < int(size[0]) {
-							expandedArray[newY][newX] = 1
-						}
-					}
-				}
-			}
-		}
-	}
-
-	newImage, err := GetImageFromArray(expandedArray)
+	newImage.copyGeometry(image)
+	newImage.copyMetaData(image)
+	view, err := NewView[int8](newImage)
 	if err != nil {
 		return nil, err
 	}
+	out := view.Pixels()
 
-	newImage.SetOrigin(image.GetOrigin())
-	newImage.SetSpacing(image.GetSpacing())
-	newImage.SetDirection(image.GetDirection())
+	cost := (2*half[0] + 1) * (2*half[1] + 1) * (2*half[2] + 1)
+	parallelForCost(len(out), max(cost, 1), func(start, end int) {
+		for i := start; i < end; i++ {
+			if erode && mask[i] == 0 {
+				continue
+			}
+			x, y, z := i%size[0], i/size[0]%size[1], i/(size[0]*size[1])
+			out[i] = binaryKernelValue(mask, size, half, x, y, z, erode)
+		}
+	})
 	return newImage, nil
 }
 
-func binaryErode3D(image *Image, kernelSize int) (*Image, error) {
-	size := image.GetSize()
-	int8Array := make([][][]int8, size[2])
-	erodedArray := make([][][]int8, size[2])
-
-	// Initialize arrays and copy input
-	for z := uint32(0); z < size[2]; z++ {
-		int8Array[z] = make([][]int8, size[1])
-		erodedArray[z] = make([][]int8, size[1])
-		for y := uint32(0); y < size[1]; y++ {
-			int8Array[z][y] = make([]int8, size[0])
-			erodedArray[z][y] = make([]int8, size[0])
-			for x := uint32(0); x < size[0]; x++ {
-				val, err := image.GetPixelAsInt8([]uint32{x, y, z})
-				if err != nil {
-					return nil, err
+// binaryKernelValue returns 1 if any (dilation) or all (erosion) voxels of the
+// kernel around (x, y, z) are foreground, and 0 otherwise.
+func binaryKernelValue(mask []int8, size, half [3]int, x, y, z int, erode bool) int8 {
+	for dz := -half[2]; dz <= half[2]; dz++ {
+		for dy := -half[1]; dy <= half[1]; dy++ {
+			for dx := -half[0]; dx <= half[0]; dx++ {
+				newX, newY, newZ := x+dx, y+dy, z+dz
+				inside := newX >= 0 && newX < size[0] && newY >= 0 && newY < size[1] && newZ >= 0 && newZ < size[2]
+				foreground := inside && mask[(newZ*size[1]+newY)*size[0]+newX] == 1
+				if erode && !foreground {
+					return 0
 				}
-				if val > 0 {
-					int8Array[z][y][x] = 1
-					erodedArray[z][y][x] = 1
+				if !erode && foreground {
+					return 1
 				}
 			}
 		}
 	}
-
-	halfKernel := kernelSize / 2
-
-	numGoroutines := uint32(runtime.NumCPU())
-	chunkSize := size[2] / numGoroutines
-	if chunkSize*numGoroutines < size[2] {
-		chunkSize += 1
-	}
-	wg := sync.WaitGroup{}
-	for chunk := uint32(0); chunk < numGoroutines; chunk++ {
-		start := chunk * chunkSize
-		end := start + chunkSize
-		if end > size[2] {
-			end = size[2]
-		}
-		wg.Add(1)
-		go func(start, end uint32) {
-			defer wg.Done()
-			for z := start; z < end; z++ {
-				for y := uint32(0); y < size[1]; y++ {
-					for x := uint32(0); x < size[0]; x++ {
-						// Only process pixels that are 1 in the input
-						if int8Array[z][y][x] == 1 {
-							// Check all pixels in the kernel neighborhood
-							for dz := -halfKernel; dz <= halfKernel; dz++ {
-								for dy := -halfKernel; dy <= halfKernel; dy++ {
-									for dx := -halfKernel; dx <= halfKernel; dx++ {
-										newZ := int(z) + dz
-										newY := int(y) + dy
-										newX := int(x) + dx
-
-										// If any neighbor is outside bounds or 0, erode the current pixel
-										if newZ < 0 || newZ >= int(size[2]) ||
-											newY < 0 || newY >= int(size[1]) ||
-											newX < 0 || newX >= int(size[0]) ||
-											int8Array[newZ][newY][newX] == 0 {
-											erodedArray[z][y][x] = 0
-											goto nextPixel // Break out of all loops
-										}
-									}
-								}
-							}
-						}
-					nextPixel:
-					}
-				}
-			}
-		}(start, end)
+	if erode {
+		return 1
 	}
-	wg.Wait()
+	return 0
+}
 
-	newImage, err := GetImageFromArray(erodedArray)
-	if err != nil {
+// binaryForeground returns 1 for the voxels of a scalar image above zero and 0
+// for the others.
+func binaryForeground(image *Image) ([]int8, error) {
+	if err := requireScalarImage(image); err != nil {
 		return nil, err
 	}
-
-	newImage.SetOrigin(image.GetOrigin())
-	newImage.SetSpacing(image.GetSpacing())
-	newImage.SetDirection(image.GetDirection())
-	return newImage, nil
-}
-
-func binaryErode2D(image *Image, kernelSize int) (*Image, error) {
-	size := image.GetSize()
-	int8Array := make([][]int8, size[1])
-	erodedArray := make([][]int8, size[1])
-
-	// Initialize arrays and copy input
-	for y := uint32(0); y < size[1]; y++ {
-		int8Array[y] = make([]int8, size[0])
-		erodedArray[y] = make([]int8, size[0])
-		for x := uint32(0); x < size[0]; x++ {
-			val, err := image.GetPixelAsInt8([]uint32{x, y})
-			if err != nil {
-				return nil, err
-			}
-			if val > 0 {
-				int8Array[y][x] = 1
-				erodedArray[y][x] = 1
-			}
-		}
+	switch image.pixelType {
+	case PixelTypeUInt8:
+		return foregroundOf(pixelsOf[uint8](image)), nil
+	case PixelTypeInt8:
+		return foregroundOf(pixelsOf[int8](image)), nil
+	case PixelTypeUInt16:
+		return foregroundOf(pixelsOf[uint16](image)), nil
+	case PixelTypeInt16:
+		return foregroundOf(pixelsOf[int16](image)), nil
+	case PixelTypeUInt32:
+		return foregroundOf(pixelsOf[uint32](image)), nil
+	case PixelTypeInt32:
+		return foregroundOf(pixelsOf[int32](image)), nil
+	case PixelTypeUInt64:
+		return foregroundOf(pixelsOf[uint64](image)), nil
+	case PixelTypeInt64:
+		return foregroundOf(pixelsOf[int64](image)), nil
+	case PixelTypeFloat32:
+		return foregroundOf(pixelsOf[float32](image)), nil
+	case PixelTypeFloat64:
+		return foregroundOf(pixelsOf[float64](image)), nil
+	default:
+		return nil, fmt.Errorf("unsupported pixel type for binary morphology: %d", image.pixelType)
 	}
+}
 
-	halfKernel := kernelSize / 2
-
-	for y := uint32(0); y < size[1]; y++ {
-		for x := uint32(0); x < size[0]; x++ {
-			// Only process pixels that are 1 in the input
-			if int8Array[y][x] == 1 {
-				// Check all pixels in the kernel neighborhood
-				for dy := -halfKernel; dy <= halfKernel; dy++ {
-					for dx := -halfKernel; dx <= halfKernel; dx++ {
-						newY := int(y) + dy
-						newX := int(x) + dx
-
-						// If any neighbor is outside bounds or 0, erode the current pixel
-						if newY < 0 || newY >= int(size[1]) ||
-							newX < 0 || newX >= int(size[0]) ||
-							int8Array[newY][newX] == 0 {
-							erodedArray[y][x] = 0
-							goto nextPixel
-						}
-					}
-				}
-			}
-		nextPixel:
+func foregroundOf[T Number](pixels []T) []int8 {
+	mask := make([]int8, len(pixels))
+	for i, value := range pixels {
+		if value > 0 {
+			mask[i] = 1
 		}
 	}
-
-	newImage, err := GetImageFromArray(erodedArray)
-	if err != nil {
-		return nil, err
-	}
-
-	newImage.SetOrigin(image.GetOrigin())
-	newImage.SetSpacing(image.GetSpacing())
-	newImage.SetDirection(image.GetDirection())
-	return newImage, nil
+	return mask
 }
@@ -1,6 +1,7 @@
 package imagetk
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -358,3 +359,44 @@ func TestMorphologyOpen3D(t *testing.T) {
 		}
 	}
 }
+
+func TestBinaryDilatePixelTypes(t *testing.T) {
+	// Voxels above zero are foreground whatever the pixel type.
+	for _, pixelType := range []int{PixelTypeUInt8, PixelTypeUInt16, PixelTypeFloat32} {
+		img, err := NewImage([]uint32{5, 4}, pixelType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img.setLinearPixelFromFloat64(0, 200)
+		img.setLinearPixelFromFloat64(19, 0.5)
+		dilated, err := BinaryDilate(img, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dilated.GetPixelType() != PixelTypeInt8 {
+			t.Fatalf("expected an Int8 image, got pixel type %d", dilated.GetPixelType())
+		}
+		want := []int8{
+			1, 1, 0, 0, 0,
+			1, 1, 0, 0, 0,
+			0, 0, 0, 1, 1,
+			0, 0, 0, 1, 1,
+		}
+		if pixelType != PixelTypeFloat32 {
+			// 0.5 is stored as 0 in integer images.
+			want = []int8{
+				1, 1, 0, 0, 0,
+				1, 1, 0, 0, 0,
+				0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0,
+			}
+		}
+		if got := pixelsOf[int8](dilated); !slices.Equal(got, want) {
+			t.Errorf("pixel type %d: expected %v, got %v", pixelType, want, got)
+		}
+	}
+
+	if _, err := BinaryErode(newComplexTestImage(t), 3); err == nil {
+		t.Errorf("expected error for a complex image")
+	}
+}
@@ -0,0 +1,804 @@
+package imagetk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	niftiHeaderSize1 = 348
+	niftiHeaderSize2 = 540
+)
+
+// NIfTI datatype codes.
+const (
+	niftiTypeUInt8   = 2
+	niftiTypeInt16   = 4
+	niftiTypeInt32   = 8
+	niftiTypeFloat32 = 16
+	niftiTypeFloat64 = 64
+	niftiTypeInt8    = 256
+	niftiTypeUInt16  = 512
+	niftiTypeUInt32  = 768
+	niftiTypeInt64   = 1024
+	niftiTypeUInt64  = 1280
+	niftiTypeRGB24   = 128
+	niftiTypeRGBA32  = 2304
+
+	niftiTypeComplex64  = 32
+	niftiTypeComplex128 = 1792
+)
+
+// niftiIntentVector is the intent code of images with a vector of values per
+// voxel, stored along the fifth dimension.
+const niftiIntentVector = 1007
+
+// NIfTI xform codes and units.
+const (
+	niftiXformScannerAnat = 1
+	niftiUnitsMeter       = 1
+	niftiUnitsMM          = 2
+	niftiUnitsMicron      = 3
+	niftiUnitsSec         = 8
+)
+
+// niftiHeader holds the fields of a NIfTI-1 or NIfTI-2 header that are needed
+// to build an Image, widened to the NIfTI-2 field types.
+type niftiHeader struct {
+	version    int
+	magic      string
+	dim        [8]int64
+	datatype   int
+	bitpix     int
+	pixdim     [8]float64
+	voxOffset  int64
+	sclSlope   float64
+	sclInter   float64
+	toffset    float64
+	xyztUnits  int
+	intentCode int
+	descrip    string
+	auxFile    string
+	intentName string
+	qformCode  int
+	sformCode  int
+	quatern    [3]float64
+	qoffset    [3]float64
+	srow       [3][4]float64
+}
+
+// isPair reports whether the header describes a .hdr/.img file pair.
+func (hdr *niftiHeader) isPair() bool {
+	return hdr.magic == "ni1" || hdr.magic == "ni2"
+}
+
+// hasVectorDim reports whether the voxel values are stored along the fifth
+// dimension, one volume per component.
+func (hdr *niftiHeader) hasVectorDim() bool {
+	return hdr.dim[0] >= 5 && hdr.dim[5] > 1
+}
+
+func readImageTypeNIfTI(filename string) (*Image, error) {
+	data, err := readFileMaybeGzip(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NIfTI file: %v", err)
+	}
+
+	hdr, byteOrder, err := parseNIfTIHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := newImageFromNIfTIHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	if hdr.isPair() {
+		data, err = readFileMaybeGzip(niftiPairDataFilename(filename))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read NIfTI data file: %v", err)
+		}
+	}
+
+	numBytes := int64(img.pixelDataSize())
+	if hdr.voxOffset < 0 || int64(len(data)) < hdr.voxOffset+numBytes {
+		return nil, fmt.Errorf("NIfTI data is truncated: expected %d bytes at offset %d, got %d", numBytes, hdr.voxOffset, len(data))
+	}
+	img.pixels = make([]byte, numBytes)
+	copy(img.pixels, data[hdr.voxOffset:hdr.voxOffset+numBytes])
+	if byteOrder == binary.BigEndian {
+		img.swapPixelBytes(img.pixels)
+	}
+	if hdr.hasVectorDim() {
+		img.pixels = interleaveComponents(img.pixels, img.components, img.bytesPerPixel)
+	}
+
+	return applyNIfTIScaling(img, hdr.sclSlope, hdr.sclInter)
+}
+
+// getNIfTILayout describes where the pixel data of an uncompressed NIfTI file
+// is stored, reading only the header.
+func getNIfTILayout(filename string) (*imageFileLayout, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NIfTI file: %v", err)
+	}
+	defer file.Close()
+	data := make([]byte, niftiHeaderSize2)
+	n, err := io.ReadFull(file, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read NIfTI file: %v", err)
+	}
+	data = data[:n]
+	if n >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		return nil, fmt.Errorf("compressed NIfTI files cannot be read in part")
+	}
+
+	hdr, byteOrder, err := parseNIfTIHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.hasVectorDim() {
+		return nil, fmt.Errorf("NIfTI images with vector components cannot be read in part")
+	}
+	img, err := newImageFromNIfTIHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	dataFilename := filename
+	if hdr.isPair() {
+		dataFilename = niftiPairDataFilename(filename)
+		if strings.HasSuffix(strings.ToLower(dataFilename), ".gz") {
+			return nil, fmt.Errorf("compressed NIfTI files cannot be read in part")
+		}
+	}
+	return &imageFileLayout{header: img, filename: dataFilename, offset: hdr.voxOffset, byteOrder: byteOrder, slope: hdr.sclSlope, inter: hdr.sclInter}, nil
+}
+
+// niftiPairDataFilename returns the .img filename belonging to a .hdr header file.
+func niftiPairDataFilename(filename string) string {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".hdr.gz"):
+		return filename[:len(filename)-7] + ".img.gz"
+	case strings.HasSuffix(lower, ".hdr"):
+		return filename[:len(filename)-4] + ".img"
+	default:
+		return filename
+	}
+}
+
+// parseNIfTIHeader decodes a NIfTI-1 or NIfTI-2 header and detects its byte order.
+func parseNIfTIHeader(data []byte) (*niftiHeader, binary.ByteOrder, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("NIfTI header is truncated")
+	}
+
+	var byteOrder binary.ByteOrder
+	var version int
+	switch {
+	case binary.LittleEndian.Uint32(data) == niftiHeaderSize1:
+		byteOrder, version = binary.LittleEndian, 1
+	case binary.BigEndian.Uint32(data) == niftiHeaderSize1:
+		byteOrder, version = binary.BigEndian, 1
+	case binary.LittleEndian.Uint32(data) == niftiHeaderSize2:
+		byteOrder, version = binary.LittleEndian, 2
+	case binary.BigEndian.Uint32(data) == niftiHeaderSize2:
+		byteOrder, version = binary.BigEndian, 2
+	default:
+		return nil, nil, fmt.Errorf("not a NIfTI file: invalid sizeof_hdr")
+	}
+
+	if version == 1 {
+		if len(data) < niftiHeaderSize1 {
+			return nil, nil, fmt.Errorf("NIfTI header is truncated")
+		}
+		return parseNIfTI1Header(data, byteOrder), byteOrder, nil
+	}
+	if len(data) < niftiHeaderSize2 {
+		return nil, nil, fmt.Errorf("NIfTI header is truncated")
+	}
+	return parseNIfTI2Header(data, byteOrder), byteOrder, nil
+}
+
+func parseNIfTI1Header(data []byte, bo binary.ByteOrder) *niftiHeader {
+	f32 := func(offset int) float64 {
+		return float64(math.Float32frombits(bo.Uint32(data[offset:])))
+	}
+	i16 := func(offset int) int {
+		return int(int16(bo.Uint16(data[offset:])))
+	}
+
+	hdr := &niftiHeader{version: 1}
+	for i := 0; i < 8; i++ {
+		hdr.dim[i] = int64(i16(40 + i*2))
+		hdr.pixdim[i] = f32(76 + i*4)
+	}
+	hdr.intentCode = i16(68)
+	hdr.datatype = i16(70)
+	hdr.bitpix = i16(72)
+	hdr.voxOffset = int64(f32(108))
+	hdr.sclSlope = f32(112)
+	hdr.sclInter = f32(116)
+	hdr.toffset = f32(136)
+	hdr.xyztUnits = int(data[123])
+	hdr.descrip = cString(data[148:228])
+	hdr.auxFile = cString(data[228:252])
+	hdr.intentName = cString(data[328:344])
+	hdr.qformCode = i16(252)
+	hdr.sformCode = i16(254)
+	for i := 0; i < 3; i++ {
+		hdr.quatern[i] = f32(256 + i*4)
+		hdr.qoffset[i] = f32(268 + i*4)
+		for j := 0; j < 4; j++ {
+			hdr.srow[i][j] = f32(280 + i*16 + j*4)
+		}
+	}
+	hdr.magic = cString(data[344:348])
+	return hdr
+}
+
+func parseNIfTI2Header(data []byte, bo binary.ByteOrder) *niftiHeader {
+	f64 := func(offset int) float64 {
+		return math.Float64frombits(bo.Uint64(data[offset:]))
+	}
+	i32 := func(offset int) int {
+		return int(int32(bo.Uint32(data[offset:])))
+	}
+
+	hdr := &niftiHeader{version: 2}
+	hdr.magic = cString(data[4:12])
+	hdr.datatype = int(int16(bo.Uint16(data[12:])))
+	hdr.bitpix = int(int16(bo.Uint16(data[14:])))
+	for i := 0; i < 8; i++ {
+		hdr.dim[i] = int64(bo.Uint64(data[16+i*8:]))
+		hdr.pixdim[i] = f64(104 + i*8)
+	}
+	hdr.voxOffset = int64(bo.Uint64(data[168:]))
+	hdr.sclSlope = f64(176)
+	hdr.sclInter = f64(184)
+	hdr.toffset = f64(216)
+	hdr.descrip = cString(data[240:320])
+	hdr.auxFile = cString(data[320:344])
+	hdr.intentName = cString(data[508:524])
+	hdr.qformCode = i32(344)
+	hdr.sformCode = i32(348)
+	for i := 0; i < 3; i++ {
+		hdr.quatern[i] = f64(352 + i*8)
+		hdr.qoffset[i] = f64(376 + i*8)
+		for j := 0; j < 4; j++ {
+			hdr.srow[i][j] = f64(400 + i*32 + j*8)
+		}
+	}
+	hdr.xyztUnits = i32(500)
+	hdr.intentCode = i32(504)
+	return hdr
+}
+
+// cString returns the contents of a fixed-size, NUL-padded character field.
+func cString(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// newImageFromNIfTIHeader creates an Image without pixel data with the size,
+// pixel type and geometry described by the header. The geometry is converted from the RAS
+// convention used by NIfTI to the LPS convention used by MetaImage and ITK.
+func newImageFromNIfTIHeader(hdr *niftiHeader) (*Image, error) {
+	// RGB voxels are stored as interleaved bytes, other multi-component voxels
+	// along the fifth dimension.
+	datatype, components := hdr.datatype, 1
+	switch datatype {
+	case niftiTypeRGB24:
+		datatype, components = niftiTypeUInt8, 3
+	case niftiTypeRGBA32:
+		datatype, components = niftiTypeUInt8, 4
+	}
+	pixelType, err := getPixelTypeFromNIfTIDatatype(datatype)
+	if err != nil {
+		return nil, err
+	}
+
+	ndim := int(hdr.dim[0])
+	if ndim < 1 || ndim > 7 {
+		return nil, fmt.Errorf("invalid NIfTI dimension: %d", ndim)
+	}
+	for i := 5; i <= ndim; i++ {
+		if i == 5 && components == 1 && hdr.dim[5] > 1 {
+			components = int(hdr.dim[5])
+			continue
+		}
+		if hdr.dim[i] > 1 {
+			return nil, fmt.Errorf("unsupported NIfTI dimension: %d", ndim)
+		}
+	}
+	// The fourth dimension is usually time; single volumes are read as 3D.
+	if ndim > 4 {
+		ndim = 4
+	}
+	if ndim == 4 && hdr.dim[4] <= 1 {
+		ndim = 3
+	}
+	if ndim < 2 {
+		ndim = 2
+	}
+
+	size := make([]uint32, ndim)
+	for i := 0; i < ndim; i++ {
+		if hdr.dim[i+1] < 1 {
+			size[i] = 1
+			continue
+		}
+		size[i] = uint32(hdr.dim[i+1])
+	}
+	img, err := newImageHeader(size, pixelType)
+	if err != nil {
+		return nil, err
+	}
+	img.components = components
+
+	unitScale := 1.0
+	switch hdr.xyztUnits & 0x07 {
+	case niftiUnitsMeter:
+		unitScale = 1000
+	case niftiUnitsMicron:
+		unitScale = 0.001
+	}
+
+	// Build the 3x3 matrix whose columns are the axis directions scaled by the
+	// spacing, plus the origin, all in RAS.
+	var matrix [3][3]float64
+	var origin [3]float64
+	switch {
+	case hdr.sformCode > 0:
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				matrix[j][k] = hdr.srow[j][k]
+			}
+			origin[j] = hdr.srow[j][3]
+		}
+	case hdr.qformCode > 0:
+		rotation := quaternionToRotation(hdr.quatern[0], hdr.quatern[1], hdr.quatern[2])
+		qfac := hdr.pixdim[0]
+		if qfac == 0 {
+			qfac = 1
+		}
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				spacing := hdr.pixdim[k+1]
+				if spacing <= 0 {
+					spacing = 1
+				}
+				if k == 2 {
+					spacing *= qfac
+				}
+				matrix[j][k] = rotation[j][k] * spacing
+			}
+			origin[j] = hdr.qoffset[j]
+		}
+	default:
+		for k := 0; k < 3; k++ {
+			spacing := hdr.pixdim[k+1]
+			if spacing <= 0 {
+				spacing = 1
+			}
+			matrix[k][k] = spacing
+		}
+	}
+
+	direction := [9]float64{}
+	spacing := [3]float64{}
+	for k := 0; k < 3; k++ {
+		norm := math.Sqrt(matrix[0][k]*matrix[0][k] + matrix[1][k]*matrix[1][k] + matrix[2][k]*matrix[2][k])
+		if norm == 0 {
+			norm = 1
+			matrix[k][k] = 1
+		}
+		spacing[k] = norm * unitScale
+		for j := 0; j < 3; j++ {
+			value := matrix[j][k] / norm
+			if j < 2 {
+				value = -value
+			}
+			direction[k*3+j] = value
+		}
+	}
+	origin[0], origin[1] = -origin[0], -origin[1]
+
+	for i := 0; i < min(ndim, 3); i++ {
+		img.spacing[i] = spacing[i]
+		img.origin[i] = origin[i] * unitScale
+	}
+	if ndim == 4 {
+		if hdr.pixdim[4] > 0 {
+			img.spacing[3] = hdr.pixdim[4]
+		}
+		img.origin[3] = hdr.toffset
+	}
+	img.direction = direction
+
+	for key, value := range map[string]string{"descrip": hdr.descrip, "aux_file": hdr.auxFile, "intent_name": hdr.intentName} {
+		if value != "" {
+			img.SetMetaData(key, value)
+		}
+	}
+	if hdr.hasVectorDim() && hdr.intentCode != 0 {
+		img.SetMetaData("intent_code", strconv.Itoa(hdr.intentCode))
+	}
+	return img, nil
+}
+
+// quaternionToRotation returns the rotation matrix of the unit quaternion
+// (a, b, c, d), where a is derived from b, c and d.
+func quaternionToRotation(b, c, d float64) [3][3]float64 {
+	a := 1.0 - (b*b + c*c + d*d)
+	if a < 1e-7 {
+		norm := 1.0 / math.Sqrt(b*b+c*c+d*d)
+		b, c, d = b*norm, c*norm, d*norm
+		a = 0
+	} else {
+		a = math.Sqrt(a)
+	}
+	return [3][3]float64{
+		{a*a + b*b - c*c - d*d, 2 * (b*c - a*d), 2 * (b*d + a*c)},
+		{2 * (b*c + a*d), a*a + c*c - b*b - d*d, 2 * (c*d - a*b)},
+		{2 * (b*d - a*c), 2 * (c*d + a*b), a*a + d*d - c*c - b*b},
+	}
+}
+
+// rotationToQuaternion returns the quaternion parameters (b, c, d) and qfac of a
+// rotation matrix whose columns are unit vectors.
+func rotationToQuaternion(r [3][3]float64) (float64, float64, float64, float64) {
+	qfac := 1.0
+	det := r[0][0]*(r[1][1]*r[2][2]-r[1][2]*r[2][1]) -
+		r[0][1]*(r[1][0]*r[2][2]-r[1][2]*r[2][0]) +
+		r[0][2]*(r[1][0]*r[2][1]-r[1][1]*r[2][0])
+	if det < 0 {
+		qfac = -1
+		r[0][2], r[1][2], r[2][2] = -r[0][2], -r[1][2], -r[2][2]
+	}
+
+	var a, b, c, d float64
+	a = r[0][0] + r[1][1] + r[2][2] + 1
+	if a > 0.5 {
+		a = 0.5 * math.Sqrt(a)
+		b = 0.25 * (r[2][1] - r[1][2]) / a
+		c = 0.25 * (r[0][2] - r[2][0]) / a
+		d = 0.25 * (r[1][0] - r[0][1]) / a
+	} else {
+		xd := 1.0 + r[0][0] - (r[1][1] + r[2][2])
+		yd := 1.0 + r[1][1] - (r[0][0] + r[2][2])
+		zd := 1.0 + r[2][2] - (r[0][0] + r[1][1])
+		if xd > 1 {
+			b = 0.5 * math.Sqrt(xd)
+			c = 0.25 * (r[0][1] + r[1][0]) / b
+			d = 0.25 * (r[0][2] + r[2][0]) / b
+			a = 0.25 * (r[2][1] - r[1][2]) / b
+		} else if yd > 1 {
+			c = 0.5 * math.Sqrt(yd)
+			b = 0.25 * (r[0][1] + r[1][0]) / c
+			d = 0.25 * (r[1][2] + r[2][1]) / c
+			a = 0.25 * (r[0][2] - r[2][0]) / c
+		} else {
+			d = 0.5 * math.Sqrt(zd)
+			b = 0.25 * (r[0][2] + r[2][0]) / d
+			c = 0.25 * (r[1][2] + r[2][1]) / d
+			a = 0.25 * (r[1][0] - r[0][1]) / d
+		}
+		if a < 0 {
+			b, c, d = -b, -c, -d
+		}
+	}
+	return b, c, d, qfac
+}
+
+// applyNIfTIScaling converts the image to a floating point type and applies
+// value = slope*stored + inter when the header requests a non-identity scaling.
+// Complex images are returned unscaled.
+func applyNIfTIScaling(img *Image, slope, inter float64) (*Image, error) {
+	if !isNIfTIScaled(slope, inter) || isComplexPixelType(img.pixelType) {
+		return img, nil
+	}
+
+	pixelType := PixelTypeFloat32
+	switch img.pixelType {
+	case PixelTypeUInt32, PixelTypeInt32, PixelTypeUInt64, PixelTypeInt64, PixelTypeFloat64:
+		pixelType = PixelTypeFloat64
+	}
+	scaled, err := img.AsType(pixelType)
+	if err != nil {
+		return nil, err
+	}
+	if scaled == img {
+		scaled.pixels = append([]byte(nil), img.pixels...)
+	}
+	numValues := len(scaled.pixels) / scaled.bytesPerPixel
+	for i := 0; i < numValues; i++ {
+		scaled.setLinearPixelFromFloat64(i, scaled.getLinearPixelAsFloat64(i)*slope+inter)
+	}
+	return scaled, nil
+}
+
+// isNIfTIScaled reports whether scl_slope and scl_inter change the stored values.
+func isNIfTIScaled(slope, inter float64) bool {
+	return !(slope == 0 || math.IsNaN(slope) || math.IsNaN(inter) || (slope == 1 && inter == 0))
+}
+
+func getPixelTypeFromNIfTIDatatype(datatype int) (int, error) {
+	switch datatype {
+	case niftiTypeUInt8:
+		return PixelTypeUInt8, nil
+	case niftiTypeInt8:
+		return PixelTypeInt8, nil
+	case niftiTypeUInt16:
+		return PixelTypeUInt16, nil
+	case niftiTypeInt16:
+		return PixelTypeInt16, nil
+	case niftiTypeUInt32:
+		return PixelTypeUInt32, nil
+	case niftiTypeInt32:
+		return PixelTypeInt32, nil
+	case niftiTypeUInt64:
+		return PixelTypeUInt64, nil
+	case niftiTypeInt64:
+		return PixelTypeInt64, nil
+	case niftiTypeFloat32:
+		return PixelTypeFloat32, nil
+	case niftiTypeFloat64:
+		return PixelTypeFloat64, nil
+	case niftiTypeComplex64:
+		return PixelTypeComplex64, nil
+	case niftiTypeComplex128:
+		return PixelTypeComplex128, nil
+	default:
+		return PixelTypeUnknown, fmt.Errorf("unsupported NIfTI datatype: %d", datatype)
+	}
+}
+
+func getNIfTIDatatypeFromPixelType(pixelType int) (int, error) {
+	switch pixelType {
+	case PixelTypeUInt8:
+		return niftiTypeUInt8, nil
+	case PixelTypeInt8:
+		return niftiTypeInt8, nil
+	case PixelTypeUInt16:
+		return niftiTypeUInt16, nil
+	case PixelTypeInt16:
+		return niftiTypeInt16, nil
+	case PixelTypeUInt32:
+		return niftiTypeUInt32, nil
+	case PixelTypeInt32:
+		return niftiTypeInt32, nil
+	case PixelTypeUInt64:
+		return niftiTypeUInt64, nil
+	case PixelTypeInt64:
+		return niftiTypeInt64, nil
+	case PixelTypeFloat32:
+		return niftiTypeFloat32, nil
+	case PixelTypeFloat64:
+		return niftiTypeFloat64, nil
+	case PixelTypeComplex64:
+		return niftiTypeComplex64, nil
+	case PixelTypeComplex128:
+		return niftiTypeComplex128, nil
+	default:
+		return 0, fmt.Errorf("unsupported pixel type for NIfTI format")
+	}
+}
+
+// saveImageTypeNIfTI writes the image as a single-file NIfTI (.nii or .nii.gz) or,
+// if the filename ends with .hdr, as a .hdr/.img pair. A NIfTI-2 header is used
+// when the image size does not fit the 16-bit dimensions of NIfTI-1.
+func (img *Image) saveImageTypeNIfTI(filename string) error {
+	if img.dimension > 4 {
+		return fmt.Errorf("NIfTI files hold at most 4 dimensions, got %d", img.dimension)
+	}
+	version := 1
+	for _, s := range img.size {
+		if s > math.MaxInt16 {
+			version = 2
+		}
+	}
+	if img.GetNumberOfComponentsPerPixel() > math.MaxInt16 {
+		version = 2
+	}
+	return img.writeNIfTI(filename, version)
+}
+
+func (img *Image) writeNIfTI(filename string, version int) error {
+	lower := strings.ToLower(filename)
+	pair := strings.HasSuffix(lower, ".hdr") || strings.HasSuffix(lower, ".hdr.gz")
+
+	header, err := img.encodeNIfTIHeader(version, pair)
+	if err != nil {
+		return err
+	}
+	// Multi-component images are stored one volume per component.
+	pixels := img.pixels
+	if components := img.GetNumberOfComponentsPerPixel(); components > 1 {
+		pixels = planarizeComponents(img.pixels, components, img.bytesPerPixel)
+	}
+
+	if pair {
+		if err := writeFileMaybeGzip(filename, header); err != nil {
+			return fmt.Errorf("failed to write NIfTI header: %v", err)
+		}
+		if err := writeFileMaybeGzip(niftiPairDataFilename(filename), pixels); err != nil {
+			return fmt.Errorf("failed to write NIfTI data: %v", err)
+		}
+		return nil
+	}
+
+	// Single files carry a 4-byte extension flag between the header and the data.
+	data := make([]byte, 0, len(header)+4+len(pixels))
+	data = append(data, header...)
+	data = append(data, 0, 0, 0, 0)
+	data = append(data, pixels...)
+	if err := writeFileMaybeGzip(filename, data); err != nil {
+		return fmt.Errorf("failed to write NIfTI file: %v", err)
+	}
+	return nil
+}
+
+// encodeNIfTIHeader builds a little-endian NIfTI-1 or NIfTI-2 header for the image.
+// Both the qform and the sform are written, converted from LPS to RAS.
+func (img *Image) encodeNIfTIHeader(version int, pair bool) ([]byte, error) {
+	datatype, err := getNIfTIDatatypeFromPixelType(img.pixelType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Columns of the rotation are the unit axis directions in RAS.
+	var rotation [3][3]float64
+	var spacing [3]float64
+	var origin [3]float64
+	for k := 0; k < 3; k++ {
+		spacing[k] = 1
+		if k < int(img.dimension) {
+			spacing[k] = img.spacing[k]
+			origin[k] = img.origin[k]
+		}
+		for j := 0; j < 3; j++ {
+			value := img.direction[k*3+j]
+			if j < 2 {
+				value = -value
+			}
+			rotation[j][k] = value
+		}
+	}
+	origin[0], origin[1] = -origin[0], -origin[1]
+	b, c, d, qfac := rotationToQuaternion(rotation)
+
+	dim := [8]int64{int64(img.dimension), 1, 1, 1, 1, 1, 1, 1}
+	pixdim := [8]float64{qfac, 1, 1, 1, 1, 1, 1, 1}
+	for i := 0; i < int(img.dimension); i++ {
+		dim[i+1] = int64(img.size[i])
+		pixdim[i+1] = img.spacing[i]
+	}
+	toffset := 0.0
+	if img.dimension > 3 {
+		toffset = img.origin[3]
+	}
+	intentCode := 0
+	if components := img.GetNumberOfComponentsPerPixel(); components > 1 {
+		dim[0], dim[5] = 5, int64(components)
+		intentCode = niftiIntentVector
+		if value, ok := img.GetMetaData("intent_code"); ok {
+			if code, err := strconv.Atoi(value); err == nil && code > 0 {
+				intentCode = code
+			}
+		}
+	}
+	var srow [3][4]float64
+	for j := 0; j < 3; j++ {
+		for k := 0; k < 3; k++ {
+			srow[j][k] = rotation[j][k] * spacing[k]
+		}
+		srow[j][3] = origin[j]
+	}
+
+	bo := binary.LittleEndian
+	if version == 2 {
+		header := make([]byte, niftiHeaderSize2)
+		put64 := func(offset int, value float64) {
+			bo.PutUint64(header[offset:], math.Float64bits(value))
+		}
+		bo.PutUint32(header[0:], niftiHeaderSize2)
+		magic := "n+2\x00\r\n\x1a\n"
+		voxOffset := int64(niftiHeaderSize2 + 4)
+		if pair {
+			magic = "ni2\x00\r\n\x1a\n"
+			voxOffset = 0
+		}
+		copy(header[4:12], magic)
+		bo.PutUint16(header[12:], uint16(datatype))
+		bo.PutUint16(header[14:], uint16(img.bytesPerPixel*8))
+		for i := 0; i < 8; i++ {
+			bo.PutUint64(header[16+i*8:], uint64(dim[i]))
+			put64(104+i*8, pixdim[i])
+		}
+		bo.PutUint64(header[168:], uint64(voxOffset))
+		put64(176, 1)
+		put64(184, 0)
+		put64(216, toffset)
+		bo.PutUint32(header[344:], niftiXformScannerAnat)
+		bo.PutUint32(header[348:], niftiXformScannerAnat)
+		put64(352, b)
+		put64(360, c)
+		put64(368, d)
+		for j := 0; j < 3; j++ {
+			put64(376+j*8, origin[j])
+			for k := 0; k < 4; k++ {
+				put64(400+j*32+k*8, srow[j][k])
+			}
+		}
+		bo.PutUint32(header[500:], niftiUnitsMM|niftiUnitsSec)
+		bo.PutUint32(header[504:], uint32(intentCode))
+		img.putNIfTIStrings(header[240:320], header[320:344], header[508:524])
+		return header, nil
+	}
+
+	for i := 1; i < len(dim); i++ {
+		if dim[i] > math.MaxInt16 {
+			return nil, fmt.Errorf("image size %d exceeds the NIfTI-1 limit", dim[i])
+		}
+	}
+	header := make([]byte, niftiHeaderSize1)
+	put32 := func(offset int, value float64) {
+		bo.PutUint32(header[offset:], math.Float32bits(float32(value)))
+	}
+	bo.PutUint32(header[0:], niftiHeaderSize1)
+	for i := 0; i < 8; i++ {
+		bo.PutUint16(header[40+i*2:], uint16(dim[i]))
+		put32(76+i*4, pixdim[i])
+	}
+	bo.PutUint16(header[68:], uint16(intentCode))
+	bo.PutUint16(header[70:], uint16(datatype))
+	bo.PutUint16(header[72:], uint16(img.bytesPerPixel*8))
+	if pair {
+		put32(108, 0)
+	} else {
+		put32(108, niftiHeaderSize1+4)
+	}
+	put32(112, 1)
+	put32(116, 0)
+	put32(136, toffset)
+	header[123] = niftiUnitsMM | niftiUnitsSec
+	bo.PutUint16(header[252:], niftiXformScannerAnat)
+	bo.PutUint16(header[254:], niftiXformScannerAnat)
+	put32(256, b)
+	put32(260, c)
+	put32(264, d)
+	for j := 0; j < 3; j++ {
+		put32(268+j*4, origin[j])
+		for k := 0; k < 4; k++ {
+			put32(280+j*16+k*4, srow[j][k])
+		}
+	}
+	if pair {
+		copy(header[344:348], "ni1\x00")
+	} else {
+		copy(header[344:348], "n+1\x00")
+	}
+	img.putNIfTIStrings(header[148:228], header[228:252], header[328:344])
+	return header, nil
+}
+
+// putNIfTIStrings copies the descrip, aux_file and intent_name metadata into
+// their header fields, truncated to leave room for the terminating NUL.
+func (img *Image) putNIfTIStrings(descrip, auxFile, intentName []byte) {
+	for key, field := range map[string][]byte{"descrip": descrip, "aux_file": auxFile, "intent_name": intentName} {
+		if value, ok := img.GetMetaData(key); ok {
+			copy(field[:len(field)-1], value)
+		}
+	}
+}
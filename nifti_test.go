@@ -0,0 +1,122 @@
+package imagetk
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newNIfTITestImage(t *testing.T) *Image {
+	return newTestImage(t, []uint32{4, 3, 2}, PixelTypeInt16, 1, func(i int) float64 { return float64(i - 5) })
+}
+
+func TestNIfTIRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_nifti")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newNIfTITestImage(t)
+	tests := []struct {
+		name     string
+		filename string
+		version  int
+	}{
+		{name: "nii", filename: "test.nii", version: 1},
+		{name: "nii.gz", filename: "test.nii.gz", version: 1},
+		{name: "hdr/img pair", filename: "test.hdr", version: 1},
+		{name: "nifti-2", filename: "test2.nii", version: 2},
+		{name: "nifti-2 gz", filename: "test2.nii.gz", version: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := img.writeNIfTI(filename, tt.version); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			readImg, err := ReadImage(filename, ImageTypeNIfTI, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if readImg.GetPixelType() != PixelTypeInt16 {
+				t.Errorf("expected pixel type %d, got %d", PixelTypeInt16, readImg.GetPixelType())
+			}
+			for i, s := range img.GetSize() {
+				if readImg.GetSize()[i] != s {
+					t.Errorf("expected size %v, got %v", img.GetSize(), readImg.GetSize())
+				}
+				if !almostEqual(readImg.GetSpacing()[i], img.GetSpacing()[i], 1e-5) {
+					t.Errorf("expected spacing %v, got %v", img.GetSpacing(), readImg.GetSpacing())
+				}
+				if !almostEqual(readImg.GetOrigin()[i], img.GetOrigin()[i], 1e-5) {
+					t.Errorf("expected origin %v, got %v", img.GetOrigin(), readImg.GetOrigin())
+				}
+			}
+			for i, d := range img.GetDirection() {
+				if !almostEqual(readImg.GetDirection()[i], d, 1e-5) {
+					t.Errorf("expected direction %v, got %v", img.GetDirection(), readImg.GetDirection())
+					break
+				}
+			}
+			for i := 0; i < int(img.NumPixels()); i++ {
+				if readImg.getLinearPixelAsFloat64(i) != img.getLinearPixelAsFloat64(i) {
+					t.Fatalf("pixel %d: expected %v, got %v", i, img.getLinearPixelAsFloat64(i), readImg.getLinearPixelAsFloat64(i))
+				}
+			}
+		})
+	}
+}
+
+func TestNIfTIScaling(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_nifti")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newNIfTITestImage(t)
+	header, err := img.encodeNIfTIHeader(1, false)
+	if err != nil {
+		t.Fatalf("failed to encode header: %v", err)
+	}
+	// scl_slope = 2, scl_inter = -1
+	header[112], header[113], header[114], header[115] = 0x00, 0x00, 0x00, 0x40
+	header[116], header[117], header[118], header[119] = 0x00, 0x00, 0x80, 0xbf
+	data := append(append(header, 0, 0, 0, 0), img.pixels...)
+	filename := filepath.Join(tempDir, "scaled.nii")
+	if err := os.WriteFile(filename, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	readImg, err := ReadImage(filename, ImageTypeNIfTI, nil)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	if readImg.GetPixelType() != PixelTypeFloat32 {
+		t.Errorf("expected pixel type %d, got %d", PixelTypeFloat32, readImg.GetPixelType())
+	}
+	for i := 0; i < int(img.NumPixels()); i++ {
+		expected := img.getLinearPixelAsFloat64(i)*2 - 1
+		if math.Abs(readImg.getLinearPixelAsFloat64(i)-expected) > 1e-6 {
+			t.Fatalf("pixel %d: expected %v, got %v", i, expected, readImg.getLinearPixelAsFloat64(i))
+		}
+	}
+}
+
+func TestNIfTIInvalidFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_nifti")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	filename := filepath.Join(tempDir, "invalid.nii")
+	if err := os.WriteFile(filename, []byte("not a nifti file"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadImage(filename, ImageTypeNIfTI, nil); err == nil {
+		t.Errorf("expected error when reading an invalid NIfTI file")
+	}
+}
@@ -0,0 +1,477 @@
+package imagetk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// nrrdHeader holds the fields of a NRRD header, keyed by lower-case field name,
+// and the offset of the attached data within the header file.
+type nrrdHeader struct {
+	fields     map[string]string
+	keyValues  map[string]string
+	dataOffset int
+}
+
+func readImageTypeNRRD(filename string) (*Image, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open NRRD file: %v", err)
+	}
+
+	hdr, err := parseNRRDHeader(content)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := newImageFromNRRDHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range hdr.keyValues {
+		img.SetMetaData(key, value)
+	}
+
+	// Attached data follows the blank line that ends the header; detached data
+	// lives in the file named by the "data file" field.
+	data := content[hdr.dataOffset:]
+	if dataFile, ok := hdr.fields["data file"]; ok {
+		if dataFile == "LIST" || len(strings.Fields(dataFile)) > 1 {
+			return nil, fmt.Errorf("unsupported NRRD data file specification: %s", dataFile)
+		}
+		if !filepath.IsAbs(dataFile) {
+			dataFile = filepath.Join(filepath.Dir(filename), dataFile)
+		}
+		data, err = os.ReadFile(dataFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read NRRD data file: %v", err)
+		}
+	}
+
+	if err := decodeNRRDData(img, hdr, data); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// parseNRRDHeader reads the magic line and the "field: value" lines of a NRRD header.
+func parseNRRDHeader(content []byte) (*nrrdHeader, error) {
+	if !bytes.HasPrefix(content, []byte("NRRD000")) {
+		return nil, fmt.Errorf("not a NRRD file: invalid magic")
+	}
+
+	hdr := &nrrdHeader{fields: make(map[string]string), keyValues: make(map[string]string), dataOffset: len(content)}
+	offset := 0
+	first := true
+	for offset < len(content) {
+		end := bytes.IndexByte(content[offset:], '\n')
+		var line string
+		if end < 0 {
+			line = string(content[offset:])
+			offset = len(content)
+		} else {
+			line = string(content[offset : offset+end])
+			offset += end + 1
+		}
+		line = strings.TrimRight(line, "\r")
+
+		if first {
+			first = false
+			continue
+		}
+		if line == "" {
+			hdr.dataOffset = offset
+			break
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		// The first colon ends the key; a key/value pair has "=" right after it,
+		// while field values may themselves contain ":=".
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid NRRD header line: %s", line)
+		}
+		if keyValue, isKeyValue := strings.CutPrefix(value, "="); isKeyValue {
+			hdr.keyValues[unescapeNRRDKeyValue(key)] = unescapeNRRDKeyValue(keyValue)
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "datafile" {
+			key = "data file"
+		}
+		hdr.fields[key] = strings.TrimSpace(value)
+	}
+	return hdr, nil
+}
+
+// escapeNRRDKeyValue escapes backslashes and line breaks in a key or value of
+// a NRRD key/value pair.
+func escapeNRRDKeyValue(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r").Replace(s)
+}
+
+// unescapeNRRDKeyValue reverses escapeNRRDKeyValue.
+func unescapeNRRDKeyValue(s string) string {
+	return strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r").Replace(s)
+}
+
+// newImageFromNRRDHeader allocates an empty Image with the size, pixel type and
+// geometry described by the header. Geometry in RAS or LAS space is converted to LPS.
+func newImageFromNRRDHeader(hdr *nrrdHeader) (*Image, error) {
+	pixelType, err := getPixelTypeFromNRRDType(hdr.fields["type"])
+	if err != nil {
+		return nil, err
+	}
+
+	dimension, err := strconv.Atoi(hdr.fields["dimension"])
+	if err != nil || dimension > 3 {
+		return nil, fmt.Errorf("invalid NRRD dimension: %s", hdr.fields["dimension"])
+	}
+	sizes := strings.Fields(hdr.fields["sizes"])
+	if len(sizes) != dimension {
+		return nil, fmt.Errorf("NRRD sizes do not match dimension %d", dimension)
+	}
+	size := make([]uint32, dimension)
+	for i, s := range sizes {
+		value, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NRRD size: %s", s)
+		}
+		size[i] = uint32(value)
+	}
+
+	img, err := NewImage(size, pixelType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sign flips that take a vector from the header space to LPS.
+	flip := [3]float64{1, 1, 1}
+	switch strings.ToLower(hdr.fields["space"]) {
+	case "right-anterior-superior", "ras":
+		flip = [3]float64{-1, -1, 1}
+	case "left-anterior-superior", "las":
+		flip = [3]float64{1, -1, 1}
+	case "right-posterior-superior", "rps":
+		flip = [3]float64{-1, 1, 1}
+	}
+
+	if value, ok := hdr.fields["space directions"]; ok {
+		vectors, err := parseNRRDVectors(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) != dimension {
+			return nil, fmt.Errorf("NRRD space directions do not match dimension %d", dimension)
+		}
+		direction := [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+		for k, vector := range vectors {
+			if vector == nil {
+				return nil, fmt.Errorf("unsupported NRRD axis without space direction")
+			}
+			norm := 0.0
+			for _, v := range vector {
+				norm += v * v
+			}
+			norm = math.Sqrt(norm)
+			if norm == 0 {
+				return nil, fmt.Errorf("invalid NRRD space direction: %v", vector)
+			}
+			img.spacing[k] = norm
+			for j := 0; j < len(vector) && j < 3; j++ {
+				direction[k*3+j] = vector[j] / norm * flip[j]
+			}
+			for j := len(vector); j < 3; j++ {
+				direction[k*3+j] = 0
+			}
+		}
+		img.direction = direction
+	} else if value, ok := hdr.fields["spacings"]; ok {
+		for i, s := range strings.Fields(value) {
+			if i >= dimension {
+				break
+			}
+			spacing, err := strconv.ParseFloat(s, 64)
+			if err == nil && !math.IsNaN(spacing) && spacing > 0 {
+				img.spacing[i] = spacing
+			}
+		}
+	}
+
+	if value, ok := hdr.fields["space origin"]; ok {
+		vectors, err := parseNRRDVectors(value)
+		if err != nil || len(vectors) != 1 || vectors[0] == nil {
+			return nil, fmt.Errorf("invalid NRRD space origin: %s", value)
+		}
+		for j := 0; j < len(vectors[0]) && j < dimension; j++ {
+			img.origin[j] = vectors[0][j] * flip[j]
+		}
+	}
+
+	return img, nil
+}
+
+// parseNRRDVectors parses a list of vectors such as "(1,0,0) (0,1,0) none".
+// Axes given as "none" are returned as nil vectors.
+func parseNRRDVectors(value string) ([][]float64, error) {
+	var vectors [][]float64
+	rest := strings.TrimSpace(value)
+	for rest != "" {
+		if strings.HasPrefix(rest, "none") {
+			vectors = append(vectors, nil)
+			rest = strings.TrimSpace(rest[4:])
+			continue
+		}
+		if rest[0] != '(' {
+			return nil, fmt.Errorf("invalid NRRD vector: %s", value)
+		}
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid NRRD vector: %s", value)
+		}
+		var vector []float64
+		for _, s := range strings.Split(rest[1:end], ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid NRRD vector: %s", value)
+			}
+			vector = append(vector, v)
+		}
+		vectors = append(vectors, vector)
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	return vectors, nil
+}
+
+// decodeNRRDData fills the image pixels from the raw, compressed or ASCII payload.
+func decodeNRRDData(img *Image, hdr *nrrdHeader, data []byte) error {
+	lineSkip, _ := strconv.Atoi(hdr.fields["line skip"])
+	for i := 0; i < lineSkip; i++ {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			return fmt.Errorf("NRRD line skip exceeds data length")
+		}
+		data = data[end+1:]
+	}
+
+	var err error
+	encoding := strings.ToLower(hdr.fields["encoding"])
+	switch encoding {
+	case "raw":
+	case "gzip", "gz":
+		var reader *gzip.Reader
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to decompress NRRD data: %v", err)
+		}
+		data, err = io.ReadAll(reader)
+	case "bzip2", "bz2":
+		data, err = io.ReadAll(bzip2.NewReader(bytes.NewReader(data)))
+	case "ascii", "text", "txt":
+		return decodeNRRDASCIIData(img, data)
+	default:
+		return fmt.Errorf("unsupported NRRD encoding: %s", hdr.fields["encoding"])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decompress NRRD data: %v", err)
+	}
+
+	numBytes := int(img.NumPixels()) * img.bytesPerPixel
+	byteSkip, _ := strconv.Atoi(hdr.fields["byte skip"])
+	if byteSkip == -1 {
+		byteSkip = len(data) - numBytes
+	}
+	if byteSkip < 0 || len(data) < byteSkip+numBytes {
+		return fmt.Errorf("NRRD data is truncated: expected %d bytes, got %d", numBytes, len(data)-byteSkip)
+	}
+	img.pixels = make([]byte, numBytes)
+	copy(img.pixels, data[byteSkip:byteSkip+numBytes])
+	if strings.ToLower(hdr.fields["endian"]) == "big" {
+		img.swapPixelBytes(img.pixels)
+	}
+	return nil
+}
+
+func decodeNRRDASCIIData(img *Image, data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Split(bufio.ScanWords)
+	numPixels := int(img.NumPixels())
+	i := 0
+	for i < numPixels && scanner.Scan() {
+		value, err := strconv.ParseFloat(strings.Trim(scanner.Text(), ","), 64)
+		if err != nil {
+			return fmt.Errorf("invalid NRRD ASCII value: %s", scanner.Text())
+		}
+		img.setLinearPixelFromFloat64(i, value)
+		i++
+	}
+	if i != numPixels {
+		return fmt.Errorf("NRRD data is truncated: expected %d values, got %d", numPixels, i)
+	}
+	return nil
+}
+
+func getPixelTypeFromNRRDType(value string) (int, error) {
+	switch strings.ToLower(value) {
+	case "uchar", "unsigned char", "uint8", "uint8_t":
+		return PixelTypeUInt8, nil
+	case "signed char", "int8", "int8_t":
+		return PixelTypeInt8, nil
+	case "ushort", "unsigned short", "unsigned short int", "uint16", "uint16_t":
+		return PixelTypeUInt16, nil
+	case "short", "short int", "signed short", "signed short int", "int16", "int16_t":
+		return PixelTypeInt16, nil
+	case "uint", "unsigned int", "uint32", "uint32_t":
+		return PixelTypeUInt32, nil
+	case "int", "signed int", "int32", "int32_t":
+		return PixelTypeInt32, nil
+	case "ulonglong", "unsigned long long", "unsigned long long int", "uint64", "uint64_t":
+		return PixelTypeUInt64, nil
+	case "longlong", "long long", "long long int", "signed long long", "signed long long int", "int64", "int64_t":
+		return PixelTypeInt64, nil
+	case "float":
+		return PixelTypeFloat32, nil
+	case "double":
+		return PixelTypeFloat64, nil
+	default:
+		return PixelTypeUnknown, fmt.Errorf("unsupported NRRD type: %s", value)
+	}
+}
+
+func getNRRDTypeFromPixelType(pixelType int) (string, error) {
+	switch pixelType {
+	case PixelTypeUInt8:
+		return "uint8", nil
+	case PixelTypeInt8:
+		return "int8", nil
+	case PixelTypeUInt16:
+		return "uint16", nil
+	case PixelTypeInt16:
+		return "int16", nil
+	case PixelTypeUInt32:
+		return "uint32", nil
+	case PixelTypeInt32:
+		return "int32", nil
+	case PixelTypeUInt64:
+		return "uint64", nil
+	case PixelTypeInt64:
+		return "int64", nil
+	case PixelTypeFloat32:
+		return "float", nil
+	case PixelTypeFloat64:
+		return "double", nil
+	default:
+		return "", fmt.Errorf("unsupported pixel type for NRRD format")
+	}
+}
+
+// saveImageTypeNRRD writes the image as a NRRD file in LPS space. Files ending
+// with .nhdr get a detached header next to a .raw (or .raw.gz) data file; other
+// files are written with the data attached.
+func (img *Image) saveImageTypeNRRD(filename string, compressed bool) error {
+	typeName, err := getNRRDTypeFromPixelType(img.pixelType)
+	if err != nil {
+		return err
+	}
+
+	data := img.pixels
+	encoding := "raw"
+	if compressed {
+		buffer := new(bytes.Buffer)
+		writer := gzip.NewWriter(buffer)
+		if _, err := writer.Write(img.pixels); err != nil {
+			return fmt.Errorf("failed to compress NRRD data: %v", err)
+		}
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("failed to compress NRRD data: %v", err)
+		}
+		data = buffer.Bytes()
+		encoding = "gzip"
+	}
+
+	var header strings.Builder
+	fmt.Fprintf(&header, "NRRD0004\n")
+	fmt.Fprintf(&header, "# Complete NRRD file format specification at:\n")
+	fmt.Fprintf(&header, "# http://teem.sourceforge.net/nrrd/format.html\n")
+	fmt.Fprintf(&header, "type: %s\n", typeName)
+	fmt.Fprintf(&header, "dimension: %d\n", img.dimension)
+	if img.dimension == 3 {
+		fmt.Fprintf(&header, "space: left-posterior-superior\n")
+	} else {
+		fmt.Fprintf(&header, "space dimension: %d\n", img.dimension)
+	}
+	fmt.Fprintf(&header, "sizes:")
+	for i := 0; i < int(img.dimension); i++ {
+		fmt.Fprintf(&header, " %d", img.size[i])
+	}
+	fmt.Fprintf(&header, "\n")
+	fmt.Fprintf(&header, "space directions:")
+	for k := 0; k < int(img.dimension); k++ {
+		components := make([]string, img.dimension)
+		for j := 0; j < int(img.dimension); j++ {
+			components[j] = strconv.FormatFloat(img.direction[k*3+j]*img.spacing[k], 'g', -1, 64)
+		}
+		fmt.Fprintf(&header, " (%s)", strings.Join(components, ","))
+	}
+	fmt.Fprintf(&header, "\n")
+	fmt.Fprintf(&header, "kinds:%s\n", strings.Repeat(" domain", int(img.dimension)))
+	fmt.Fprintf(&header, "endian: little\n")
+
+	lower := strings.ToLower(filename)
+	detached := strings.HasSuffix(lower, ".nhdr")
+	dataFilename := ""
+	if detached {
+		dataFilename = filename[:len(filename)-5] + ".raw"
+		if compressed {
+			dataFilename += ".gz"
+		}
+	}
+	fmt.Fprintf(&header, "encoding: %s\n", encoding)
+
+	origin := make([]string, img.dimension)
+	for j := 0; j < int(img.dimension); j++ {
+		origin[j] = strconv.FormatFloat(img.origin[j], 'g', -1, 64)
+	}
+	fmt.Fprintf(&header, "space origin: (%s)\n", strings.Join(origin, ","))
+	for _, key := range img.MetaDataKeys() {
+		if key != "" && !strings.Contains(key, ":=") {
+			fmt.Fprintf(&header, "%s:=%s\n", escapeNRRDKeyValue(key), escapeNRRDKeyValue(img.metadata[key]))
+		}
+	}
+
+	if detached {
+		fmt.Fprintf(&header, "data file: %s\n", filepath.Base(dataFilename))
+		fmt.Fprintf(&header, "\n")
+		if err := os.WriteFile(filename, []byte(header.String()), 0666); err != nil {
+			return fmt.Errorf("failed to create NRRD file: %v", err)
+		}
+		if err := os.WriteFile(dataFilename, data, 0666); err != nil {
+			return fmt.Errorf("failed to save raw data: %v", err)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(&header, "\n")
+	outputFile, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create NRRD file: %v", err)
+	}
+	defer outputFile.Close()
+	if _, err := outputFile.WriteString(header.String()); err != nil {
+		return fmt.Errorf("failed to write NRRD header: %v", err)
+	}
+	if _, err := outputFile.Write(data); err != nil {
+		return fmt.Errorf("failed to write NRRD data: %v", err)
+	}
+	return nil
+}
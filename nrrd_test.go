@@ -0,0 +1,135 @@
+package imagetk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNRRDRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_nrrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newNIfTITestImage(t)
+	tests := []struct {
+		name       string
+		filename   string
+		compressed bool
+	}{
+		{name: "attached", filename: "test.nrrd"},
+		{name: "detached", filename: "test.nhdr"},
+		{name: "attached gzip", filename: "testgz.nrrd", compressed: true},
+		{name: "detached gzip", filename: "testgz.nhdr", compressed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			write := WriteImage
+			if tt.compressed {
+				write = WriteImageCompressed
+			}
+			if err := write(img, filename, ImageTypeNRRD); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			readImg, err := ReadImage(filename, ImageTypeNRRD, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			for i := range img.GetSize() {
+				if readImg.GetSize()[i] != img.GetSize()[i] ||
+					!almostEqual(readImg.GetSpacing()[i], img.GetSpacing()[i], 1e-9) ||
+					!almostEqual(readImg.GetOrigin()[i], img.GetOrigin()[i], 1e-9) {
+					t.Fatalf("geometry mismatch: got size %v spacing %v origin %v", readImg.GetSize(), readImg.GetSpacing(), readImg.GetOrigin())
+				}
+			}
+			if readImg.GetDirection() != img.GetDirection() {
+				t.Errorf("expected direction %v, got %v", img.GetDirection(), readImg.GetDirection())
+			}
+			if !bytes.Equal(readImg.pixels, img.pixels) {
+				t.Errorf("pixel data mismatch")
+			}
+		})
+	}
+}
+
+func TestNRRDReadEncodings(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_nrrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	values := []int16{1, -2, 300, -400, 5, 6}
+	bigEndian := new(bytes.Buffer)
+	binary.Write(bigEndian, binary.BigEndian, values)
+	compressed := new(bytes.Buffer)
+	writer := gzip.NewWriter(compressed)
+	binary.Write(writer, binary.LittleEndian, values)
+	writer.Close()
+
+	header := "NRRD0004\ntype: short\ndimension: 2\nspace: right-anterior-superior\nsizes: 3 2\n" +
+		"space directions: (2,0,0) (0,3,0)\nspace origin: (10,20,30)\n"
+	tests := []struct {
+		name    string
+		content []byte
+		data    []byte
+	}{
+		{name: "gzip", content: append([]byte(header+"encoding: gzip\nendian: little\n\n"), compressed.Bytes()...)},
+		{name: "big endian", content: append([]byte(header+"encoding: raw\nendian: big\n\n"), bigEndian.Bytes()...)},
+		{name: "ascii", content: []byte(header + "encoding: ascii\n\n1 -2 300\n-400 5 6\n")},
+		{name: "detached", content: []byte(header + "encoding: raw\nendian: big\nbyte skip: 4\ndata file: data.raw\n\n"), data: append([]byte{0, 0, 0, 0}, bigEndian.Bytes()...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, "test.nrrd")
+			if err := os.WriteFile(filename, tt.content, 0666); err != nil {
+				t.Fatal(err)
+			}
+			if tt.data != nil {
+				if err := os.WriteFile(filepath.Join(tempDir, "data.raw"), tt.data, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			img, err := ReadImage(filename, ImageTypeNRRD, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			for i, v := range values {
+				if img.getLinearPixelAsFloat64(i) != float64(v) {
+					t.Errorf("pixel %d: expected %v, got %v", i, v, img.getLinearPixelAsFloat64(i))
+				}
+			}
+			if img.GetSpacing()[0] != 2 || img.GetSpacing()[1] != 3 {
+				t.Errorf("expected spacing [2 3], got %v", img.GetSpacing())
+			}
+			if img.GetOrigin()[0] != -10 || img.GetOrigin()[1] != -20 {
+				t.Errorf("expected origin [-10 -20], got %v", img.GetOrigin())
+			}
+			if img.GetDirection()[0] != -1 || img.GetDirection()[4] != -1 {
+				t.Errorf("expected flipped direction, got %v", img.GetDirection())
+			}
+		})
+	}
+}
+
+func TestParseNRRDHeader(t *testing.T) {
+	hdr, err := parseNRRDHeader([]byte("NRRD0004\ncontent: a:=b\nmodality:=CT:=x\n# comment: c:=d\nDataFile: data.raw\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.fields["content"] != "a:=b" || hdr.fields["data file"] != "data.raw" {
+		t.Errorf("unexpected fields: %v", hdr.fields)
+	}
+	if len(hdr.keyValues) != 1 || hdr.keyValues["modality"] != "CT:=x" {
+		t.Errorf("unexpected key/value pairs: %v", hdr.keyValues)
+	}
+	if _, err := parseNRRDHeader([]byte("NRRD0004\nno separator\n\n")); err == nil {
+		t.Errorf("expected error for a line without a separator")
+	}
+}
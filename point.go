@@ -1,7 +1,6 @@
 package imagetk
 
 import (
-	"encoding/binary"
 	"fmt"
 	"math"
 )
@@ -141,6 +140,21 @@ func solveLinearSystem(A [][]float64, b []float64) ([]float64, error) {
 //   - float64: The interpolated pixel value.
 //   - error: An error if the operation fails.
 func (img *Image) GetPixelFromPoint(point []float64, fillType int) (float64, error) {
+	if img.GetNumberOfComponentsPerPixel() > 1 {
+		return 0.0, fmt.Errorf("multi-component images cannot be interpolated")
+	}
+	if isComplexPixelType(img.pixelType) {
+		return 0.0, fmt.Errorf("complex images cannot be interpolated")
+	}
+	if img.dimension > 3 {
+		return 0.0, fmt.Errorf("%dD images cannot be interpolated", img.dimension)
+	}
+	return img.interpolateAt(point, fillType, img.getLinearPixelAsFloat64)
+}
+
+// interpolateAt returns the linearly interpolated value at a physical point of
+// a scalar 2D or 3D image, reading the pixel at a linear index with valueAt.
+func (img *Image) interpolateAt(point []float64, fillType int, valueAt func(i int) float64) (float64, error) {
 	// Step 1: Compute y = x - o
 	p := make([]float64, img.dimension)
 	for i := 0; i < int(img.dimension); i++ {
@@ -243,44 +257,7 @@ func (img *Image) GetPixelFromPoint(point []float64, fillType int) (float64, err
 			linearIndex += indices[2] * int(img.size[0]*img.size[1])
 		}
 
-		// Retrieve the pixel value
-		var pixelValue float64
-		switch img.pixelType {
-		case PixelTypeUInt8:
-			value := img.pixels[linearIndex]
-			pixelValue = float64(uint8(value))
-		case PixelTypeInt8:
-			value := img.pixels[linearIndex]
-			pixelValue = float64(int8(value))
-		case PixelTypeUInt16:
-			value := binary.LittleEndian.Uint16(img.pixels[linearIndex*2 : linearIndex*2+2])
-			pixelValue = float64(uint16(value))
-		case PixelTypeInt16:
-			value := binary.LittleEndian.Uint16(img.pixels[linearIndex*2 : linearIndex*2+2])
-			pixelValue = float64(int16(value))
-		case PixelTypeUInt32:
-			value := binary.LittleEndian.Uint32(img.pixels[linearIndex*4 : linearIndex*4+4])
-			pixelValue = float64(uint32(value))
-		case PixelTypeInt32:
-			value := binary.LittleEndian.Uint32(img.pixels[linearIndex*4 : linearIndex*4+4])
-			pixelValue = float64(int32(value))
-		case PixelTypeUInt64:
-			value := binary.LittleEndian.Uint64(img.pixels[linearIndex*8 : linearIndex*8+8])
-			pixelValue = float64(uint64(value))
-		case PixelTypeInt64:
-			value := binary.LittleEndian.Uint64(img.pixels[linearIndex*8 : linearIndex*8+8])
-			pixelValue = float64(int64(value))
-		case PixelTypeFloat32:
-			value := math.Float32frombits(binary.LittleEndian.Uint32(img.pixels[linearIndex*4 : linearIndex*4+4]))
-			pixelValue = float64(value)
-		case PixelTypeFloat64:
-			value := math.Float64frombits(binary.LittleEndian.Uint64(img.pixels[linearIndex*8 : linearIndex*8+8]))
-			pixelValue = value
-		default:
-			return 0.0, fmt.Errorf("unsupported pixel type")
-		}
-
-		interpolatedValue += pixelValue * weight
+		interpolatedValue += valueAt(linearIndex) * weight
 	}
 
 	return interpolatedValue, nil
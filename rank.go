@@ -0,0 +1,419 @@
+package imagetk
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// NeighborhoodOptions configures MeanFilter, VarianceFilter, MinimumFilter,
+// MaximumFilter, MedianFilter and RankFilter.
+type NeighborhoodOptions struct {
+	// Radius is the radius of the box neighbourhood in voxels, either one value
+	// for all axes or one value per axis. The neighbourhood spans 2*radius+1
+	// voxels along each axis.
+	Radius []int
+	// Boundary is the boundary condition; the zero value is BoundaryReplicate.
+	Boundary int
+	// Constant is the value outside the image for BoundaryConstant.
+	Constant float64
+}
+
+// maximumHistogramLevels is the largest number of distinct values for which
+// RankFilter keeps a sliding histogram. Images with more distinct values sort
+// each neighbourhood instead.
+const maximumHistogramLevels = 1 << 20
+
+// MeanFilter replaces each voxel by the mean of its box neighbourhood.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The radius per axis and boundary condition
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options are invalid or the image is complex
+//
+// The box is averaged one axis at a time with running sums, so the cost does
+// not depend on the radius. The components of multi-component images are
+// filtered separately.
+func MeanFilter(image *Image, options NeighborhoodOptions) (*Image, error) {
+	values, radius, err := neighborhoodValues(image, options)
+	if err != nil {
+		return nil, err
+	}
+	boxMean(values, image, radius, options.Boundary, options.Constant)
+	return newImageFromValues(image, floatPixelType(image.pixelType), image.GetNumberOfComponentsPerPixel(), values)
+}
+
+// VarianceFilter replaces each voxel by the variance of the values in its box
+// neighbourhood, dividing by the number of voxels.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The radius per axis and boundary condition
+//
+// Returns:
+//   - *Image: A Float64 image for integer images, or an image of the same floating point type
+//   - error: Error if the options are invalid or the image is complex
+//
+// The variance is the box mean of the squares minus the square of the box
+// mean, computed with running sums around the mean of the image to limit
+// rounding errors.
+func VarianceFilter(image *Image, options NeighborhoodOptions) (*Image, error) {
+	values, radius, err := neighborhoodValues(image, options)
+	if err != nil {
+		return nil, err
+	}
+	shift, count := 0.0, 0
+	for _, v := range values {
+		if isFinite(v) {
+			shift += v
+			count++
+		}
+	}
+	if count > 0 {
+		shift /= float64(count)
+	}
+	squares := make([]float64, len(values))
+	for i := range values {
+		values[i] -= shift
+		squares[i] = values[i] * values[i]
+	}
+	// Voxels outside the image are shifted as well, so zero becomes a constant.
+	boundary, constant := options.Boundary, boundaryFill(options.Boundary, options.Constant)-shift
+	if boundary == BoundaryZero {
+		boundary = BoundaryConstant
+	}
+	boxMean(values, image, radius, boundary, constant)
+	boxMean(squares, image, radius, boundary, constant*constant)
+	for i, mean := range values {
+		values[i] = max(squares[i]-mean*mean, 0)
+	}
+	return newImageFromValues(image, floatPixelType(image.pixelType), image.GetNumberOfComponentsPerPixel(), values)
+}
+
+// MinimumFilter replaces each voxel by the smallest value in its box
+// neighbourhood, which is grey-scale erosion with a box.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The radius per axis and boundary condition
+//
+// Returns:
+//   - *Image: An image of the same pixel type
+//   - error: Error if the options are invalid or the image is complex
+//
+// The box is filtered one axis at a time with a monotonic queue, so the cost
+// does not depend on the radius.
+func MinimumFilter(image *Image, options NeighborhoodOptions) (*Image, error) {
+	return extremumFilter(image, options, func(a, b float64) bool { return a <= b })
+}
+
+// MaximumFilter replaces each voxel by the largest value in its box
+// neighbourhood, which is grey-scale dilation with a box.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The radius per axis and boundary condition
+//
+// Returns:
+//   - *Image: An image of the same pixel type
+//   - error: Error if the options are invalid or the image is complex
+//
+// The box is filtered one axis at a time with a monotonic queue, so the cost
+// does not depend on the radius.
+func MaximumFilter(image *Image, options NeighborhoodOptions) (*Image, error) {
+	return extremumFilter(image, options, func(a, b float64) bool { return a >= b })
+}
+
+// MedianFilter replaces each voxel by the median of its box neighbourhood,
+// which removes isolated outliers such as salt-and-pepper noise.
+//
+// Parameters:
+//   - image: The input image
+//   - options: The radius per axis and boundary condition
+//
+// Returns:
+//   - *Image: An image of the same pixel type
+//   - error: Error if the options are invalid or the image is complex
+func MedianFilter(image *Image, options NeighborhoodOptions) (*Image, error) {
+	return RankFilter(image, 0.5, options)
+}
+
+// RankFilter replaces each voxel by the value of the given rank among the
+// sorted values of its box neighbourhood.
+//
+// Parameters:
+//   - image: The input image
+//   - rank: The rank from 0 (the minimum) through 0.5 (the median) to 1 (the maximum)
+//   - options: The radius per axis and boundary condition
+//
+// Returns:
+//   - *Image: An image of the same pixel type
+//   - error: Error if the rank or options are invalid or the image is complex
+//
+// The box of n voxels, always an odd number, is sorted and the value at index
+// round(rank*(n-1)) is kept. A histogram of the box slides along the first
+// axis, adding and removing one face of the box per voxel, so the cost grows
+// with the face rather than the volume of the box. Images with more than
+// about a million distinct values sort each box instead. NaN sorts below all
+// other values. Results of integer images are rounded and clamped, which only
+// matters for a Constant outside the pixel type. The components of
+// multi-component images are filtered separately, and lines of the image are
+// filtered in parallel.
+func RankFilter(image *Image, rank float64, options NeighborhoodOptions) (*Image, error) {
+	if !(rank >= 0 && rank <= 1) {
+		return nil, fmt.Errorf("rank must be between 0 and 1, got %g", rank)
+	}
+	values, radius, err := neighborhoodValues(image, options)
+	if err != nil {
+		return nil, err
+	}
+	levels := slices.Clone(values)
+	if options.Boundary == BoundaryZero || options.Boundary == BoundaryConstant {
+		levels = append(levels, boundaryFill(options.Boundary, options.Constant))
+	}
+	slices.SortFunc(levels, cmp.Compare[float64])
+	levels = slices.CompactFunc(levels, func(a, b float64) bool { return cmp.Compare(a, b) == 0 })
+
+	result := rankValues(values, levels, image.size, image.GetNumberOfComponentsPerPixel(), radius, rank, options, len(levels) <= maximumHistogramLevels)
+	return newImageFromValues(image, image.pixelType, image.GetNumberOfComponentsPerPixel(), result)
+}
+
+// neighborhoodValues validates the options of a neighbourhood filter and
+// returns the values of the image and the radius per axis.
+func neighborhoodValues(image *Image, options NeighborhoodOptions) ([]float64, []int, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, nil, err
+	}
+	if err := checkBoundary(options.Boundary); err != nil {
+		return nil, nil, err
+	}
+	radius, err := perAxis(options.Radius, int(image.dimension), "radius")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range radius {
+		if r < 0 {
+			return nil, nil, fmt.Errorf("invalid radius: %d", r)
+		}
+	}
+	return imageValues(image), radius, nil
+}
+
+// boundaryFill returns the value of voxels outside the image for BoundaryZero
+// and BoundaryConstant.
+func boundaryFill(boundary int, constant float64) float64 {
+	if boundary == BoundaryConstant {
+		return constant
+	}
+	return 0
+}
+
+// boxMean replaces values by their mean over a box of the given radius, one
+// axis at a time, with a running sum along each line.
+func boxMean(values []float64, image *Image, radius []int, boundary int, constant float64) {
+	for axis, r := range radius {
+		if r == 0 {
+			continue
+		}
+		width := float64(2*r + 1)
+		filterLines(values, image.size, image.GetNumberOfComponentsPerPixel(), axis, func(line, result []float64) {
+			padded := make([]float64, len(line)+2*r)
+			extendLine(padded, line, r, boundary, constant)
+			sum := 0.0
+			for _, v := range padded[:2*r] {
+				sum += v
+			}
+			for i := range result {
+				sum += padded[i+2*r]
+				result[i] = sum / width
+				sum -= padded[i]
+			}
+		})
+	}
+}
+
+// extremumFilter filters an image along each axis with the running minimum
+// or maximum of a box, where keeps(a, b) reports whether a replaces b as the
+// extremum. A queue holds the indices of the values that can still become
+// the extremum of a later window, in order of decreasing priority.
+func extremumFilter(image *Image, options NeighborhoodOptions, keeps func(a, b float64) bool) (*Image, error) {
+	values, radius, err := neighborhoodValues(image, options)
+	if err != nil {
+		return nil, err
+	}
+	for axis, r := range radius {
+		if r == 0 {
+			continue
+		}
+		filterLines(values, image.size, image.GetNumberOfComponentsPerPixel(), axis, func(line, result []float64) {
+			padded := make([]float64, len(line)+2*r)
+			extendLine(padded, line, r, options.Boundary, options.Constant)
+			queue := make([]int, 0, 2*r+1)
+			for i, v := range padded {
+				for len(queue) > 0 && keeps(v, padded[queue[len(queue)-1]]) {
+					queue = queue[:len(queue)-1]
+				}
+				queue = append(queue, i)
+				if queue[0] <= i-2*r-1 {
+					queue = queue[1:]
+				}
+				if i >= 2*r {
+					result[i-2*r] = padded[queue[0]]
+				}
+			}
+		})
+	}
+	return newImageFromValues(image, image.pixelType, image.GetNumberOfComponentsPerPixel(), values)
+}
+
+// rankValues returns the value of the given rank in the box around each
+// voxel. levels holds the sorted distinct values of the image and the value
+// outside it. With histogram set, a count of the levels in the box slides
+// along the first axis; otherwise each box is sorted.
+func rankValues(values, levels []float64, size []uint32, components int, radius []int, rank float64, options NeighborhoodOptions, histogram bool) []float64 {
+	ranks := make([]int32, len(values))
+	parallelFor(len(values), func(start, end int) {
+		for i := start; i < end; i++ {
+			index, _ := slices.BinarySearchFunc(levels, values[i], cmp.Compare[float64])
+			ranks[i] = int32(index)
+		}
+	})
+	fillRank, _ := slices.BinarySearchFunc(levels, boundaryFill(options.Boundary, options.Constant), cmp.Compare[float64])
+
+	n := int(size[0])
+	boxSize, faceSize := 2*radius[0]+1, 1
+	for _, r := range radius[1:] {
+		faceSize *= 2*r + 1
+	}
+	boxSize *= faceSize
+	k := int(math.Round(rank * float64(boxSize-1)))
+
+	// columns maps the indices along the first axis that the boxes of a row
+	// cover into the image, or to -1 outside it.
+	columns := make([]int, n+2*radius[0])
+	for i := range columns {
+		if index, ok := boundaryIndex(i-radius[0], n, options.Boundary); ok {
+			columns[i] = index
+		} else {
+			columns[i] = -1
+		}
+	}
+
+	result := make([]float64, len(values))
+	numRows := len(values) / n / components
+	parallelForCost(numRows*components, n*faceSize, func(startTask, endTask int) {
+		faces := make([]int, faceSize)
+		var counts fenwickTree
+		var box []int32
+		if histogram {
+			counts = make(fenwickTree, len(levels)+1)
+		} else {
+			box = make([]int32, 0, boxSize)
+		}
+		// rankAt returns the rank of the value at column i of face f.
+		rankAt := func(f, i, c int) int32 {
+			if faces[f] < 0 || columns[i] < 0 {
+				return int32(fillRank)
+			}
+			return ranks[(faces[f]+columns[i])*components+c]
+		}
+
+		for task := startTask; task < endTask; task++ {
+			row, c := task/components, task%components
+			rowFaces(faces, row, size, radius, options.Boundary)
+			if !histogram {
+				for x := 0; x < n; x++ {
+					box = box[:0]
+					for f := range faces {
+						for i := x; i <= x+2*radius[0]; i++ {
+							box = append(box, rankAt(f, i, c))
+						}
+					}
+					slices.Sort(box)
+					result[(row*n+x)*components+c] = levels[box[k]]
+				}
+				continue
+			}
+
+			for i := 0; i < 2*radius[0]+1; i++ {
+				for f := range faces {
+					counts.add(int(rankAt(f, i, c)), 1)
+				}
+			}
+			for x := 0; x < n; x++ {
+				result[(row*n+x)*components+c] = levels[counts.find(k)]
+				// Slide the box: column x leaves it and column x+2r+1 enters.
+				last := x == n-1
+				for f := range faces {
+					counts.add(int(rankAt(f, x, c)), -1)
+					if !last {
+						counts.add(int(rankAt(f, x+2*radius[0]+1, c)), 1)
+					}
+				}
+			}
+			// Empty the histogram for the next row.
+			for i := n; i < n+2*radius[0]; i++ {
+				for f := range faces {
+					counts.add(int(rankAt(f, i, c)), -1)
+				}
+			}
+		}
+	})
+	return result
+}
+
+// rowFaces sets faces to the linear voxel index of the start of each row that
+// the boxes around the given row cover, or to -1 for rows outside the image.
+// The row index counts the rows along the first axis.
+func rowFaces(faces []int, row int, size []uint32, radius []int, boundary int) {
+	faces[0] = 0
+	count, stride := 1, int(size[0])
+	for axis := 1; axis < len(size); axis++ {
+		n := int(size[axis])
+		coordinate := row % n
+		row /= n
+		width := 2*radius[axis] + 1
+		// Each existing face is repeated for every offset along this axis.
+		for f := count - 1; f >= 0; f-- {
+			base := faces[f]
+			for offset := width - 1; offset >= 0; offset-- {
+				index, ok := boundaryIndex(coordinate+offset-radius[axis], n, boundary)
+				if base < 0 || !ok {
+					faces[f*width+offset] = -1
+				} else {
+					faces[f*width+offset] = base + index*stride
+				}
+			}
+		}
+		count *= width
+		stride *= n
+	}
+}
+
+// fenwickTree counts values by level and finds the level of a given rank in
+// logarithmic time. Element 0 is unused.
+type fenwickTree []int32
+
+// add adds delta to the count of level i.
+func (t fenwickTree) add(i int, delta int32) {
+	for i++; i < len(t); i += i & -i {
+		t[i] += delta
+	}
+}
+
+// find returns the level of the value at index k of the sorted values.
+func (t fenwickTree) find(k int) int {
+	position, remaining := 0, int32(k)
+	for step := 1 << (bits.Len(uint(len(t)-1)) - 1); step > 0; step >>= 1 {
+		if next := position + step; next < len(t) && t[next] <= remaining {
+			position = next
+			remaining -= t[next]
+		}
+	}
+	return position
+}
@@ -0,0 +1,185 @@
+package imagetk
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// referenceNeighborhood returns the values of the box around voxel (x, y) of
+// a scalar 2D image, with the boundary condition of the options.
+func referenceNeighborhood(img *Image, x, y int, radius []int, options NeighborhoodOptions) []float64 {
+	n0, n1 := int(img.size[0]), int(img.size[1])
+	var box []float64
+	for j := y - radius[1]; j <= y+radius[1]; j++ {
+		for i := x - radius[0]; i <= x+radius[0]; i++ {
+			bi, okI := boundaryIndex(i, n0, options.Boundary)
+			bj, okJ := boundaryIndex(j, n1, options.Boundary)
+			if okI && okJ {
+				box = append(box, img.getLinearPixelAsFloat64(bj*n0+bi))
+			} else {
+				box = append(box, boundaryFill(options.Boundary, options.Constant))
+			}
+		}
+	}
+	return box
+}
+
+func TestNeighborhoodFiltersMatchReference(t *testing.T) {
+	img := newRandomTestImage(t, []uint32{15, 11}, 1, 7)
+	// Few distinct values, so that ranks have ties.
+	quantized, err := img.AsType(PixelTypeInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	radius := []int{2, 1}
+
+	filters := []struct {
+		name      string
+		filter    func(*Image, NeighborhoodOptions) (*Image, error)
+		reference func(box []float64) float64
+	}{
+		{"mean", MeanFilter, func(box []float64) float64 {
+			sum := 0.0
+			for _, v := range box {
+				sum += v
+			}
+			return sum / float64(len(box))
+		}},
+		{"variance", VarianceFilter, func(box []float64) float64 {
+			mean, squares := 0.0, 0.0
+			for _, v := range box {
+				mean += v
+				squares += v * v
+			}
+			mean /= float64(len(box))
+			return squares/float64(len(box)) - mean*mean
+		}},
+		{"minimum", MinimumFilter, func(box []float64) float64 { return slices.Min(box) }},
+		{"maximum", MaximumFilter, func(box []float64) float64 { return slices.Max(box) }},
+		{"median", MedianFilter, func(box []float64) float64 {
+			slices.Sort(box)
+			return box[len(box)/2]
+		}},
+		{"rank 0.25", func(img *Image, options NeighborhoodOptions) (*Image, error) {
+			return RankFilter(img, 0.25, options)
+		}, func(box []float64) float64 {
+			slices.Sort(box)
+			return box[int(math.Round(0.25*float64(len(box)-1)))]
+		}},
+	}
+	for _, source := range []*Image{img, quantized} {
+		for _, tt := range filters {
+			for boundary := BoundaryReplicate; boundary <= BoundaryPeriodic; boundary++ {
+				options := NeighborhoodOptions{Radius: radius, Boundary: boundary, Constant: 1.5}
+				out, err := tt.filter(source, options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for y := 0; y < 11; y++ {
+					for x := 0; x < 15; x++ {
+						want := tt.reference(referenceNeighborhood(source, x, y, radius, options))
+						if out.GetPixelType() == PixelTypeInt8 {
+							want = math.Round(want)
+						}
+						if got := out.getLinearPixelAsFloat64(y*15 + x); !almostEqual(got, want, 1e-9) {
+							t.Fatalf("%s, pixel type %d, boundary %d: at (%d, %d) expected %v, got %v",
+								tt.name, source.GetPixelType(), boundary, x, y, want, got)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRankFilterSortedNeighborhoods(t *testing.T) {
+	// Images with many distinct values sort each box instead of keeping a
+	// histogram; both must agree.
+	volume := newRandomTestImage(t, []uint32{9, 7, 6}, 2, 8)
+	values := imageValues(volume)
+	levels := slices.Clone(values)
+	slices.Sort(levels)
+	options := NeighborhoodOptions{Boundary: BoundaryMirror}
+	radius := []int{1, 2, 1}
+	for _, rank := range []float64{0, 0.3, 0.5, 1} {
+		histogram := rankValues(values, levels, volume.size, 2, radius, rank, options, true)
+		sorted := rankValues(values, levels, volume.size, 2, radius, rank, options, false)
+		if !slices.Equal(histogram, sorted) {
+			t.Errorf("rank %v: expected both methods to agree", rank)
+		}
+	}
+
+	minimum, err := RankFilter(volume, 0, NeighborhoodOptions{Radius: radius, Boundary: BoundaryMirror})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eroded, err := MinimumFilter(volume, NeighborhoodOptions{Radius: radius, Boundary: BoundaryMirror})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(imageValues(minimum), imageValues(eroded)) {
+		t.Errorf("expected rank 0 to match the minimum filter")
+	}
+}
+
+func TestMedianFilterSaltAndPepper(t *testing.T) {
+	img, err := NewImage([]uint32{16, 16, 4}, PixelTypeUInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(img.NumPixels()); i++ {
+		img.setLinearPixelFromFloat64(i, 1000)
+	}
+	for _, i := range []int{17, 100, 301, 555, 1000} {
+		img.setLinearPixelFromFloat64(i, float64(65535*(i%2)))
+	}
+	out, err := MedianFilter(img, NeighborhoodOptions{Radius: []int{1, 1, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.GetPixelType() != PixelTypeUInt16 {
+		t.Fatalf("expected a UInt16 image, got pixel type %d", out.GetPixelType())
+	}
+	for i := 0; i < int(out.NumPixels()); i++ {
+		if got := out.getLinearPixelAsFloat64(i); got != 1000 {
+			t.Fatalf("pixel %d: expected the outliers to be removed, got %v", i, got)
+		}
+	}
+
+	mean, err := MeanFilter(img, NeighborhoodOptions{Radius: []int{0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mean.GetPixelType() != PixelTypeFloat64 || mean.getLinearPixelAsFloat64(17) != 65535 {
+		t.Errorf("expected a radius of 0 to keep the values as Float64")
+	}
+}
+
+func TestNeighborhoodFilterErrors(t *testing.T) {
+	img, err := NewImage([]uint32{8, 8}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, options := range []NeighborhoodOptions{
+		{},
+		{Radius: []int{1, 1, 1}},
+		{Radius: []int{-1}},
+		{Radius: []int{1}, Boundary: 6},
+	} {
+		if _, err := MeanFilter(img, options); err == nil {
+			t.Errorf("expected error for options %+v", options)
+		}
+		if _, err := MedianFilter(img, options); err == nil {
+			t.Errorf("expected error for options %+v", options)
+		}
+	}
+	for _, rank := range []float64{-0.1, 1.5, math.NaN()} {
+		if _, err := RankFilter(img, rank, NeighborhoodOptions{Radius: []int{1}}); err == nil {
+			t.Errorf("expected error for rank %v", rank)
+		}
+	}
+	if _, err := VarianceFilter(newComplexTestImage(t), NeighborhoodOptions{Radius: []int{1}}); err == nil {
+		t.Errorf("expected error for a complex image")
+	}
+}
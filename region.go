@@ -0,0 +1,321 @@
+package imagetk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// imageFileLayout describes uncompressed pixel data stored in a file, so that
+// it can be read in part or mapped into memory.
+type imageFileLayout struct {
+	header    *Image // geometry and pixel type, without pixel data
+	filename  string // the file holding the pixel data
+	offset    int64  // the position of the first pixel in the file
+	byteOrder binary.ByteOrder
+	// slope and inter give the NIfTI intensity scaling; a zero slope means none.
+	slope float64
+	inter float64
+}
+
+// getImageFileLayout returns the layout of the pixel data of an MHD or NIfTI file.
+func getImageFileLayout(filename string, imageType int) (*imageFileLayout, error) {
+	switch imageType {
+	case ImageTypeMHD:
+		return getMHDLayout(filename)
+	case ImageTypeNIfTI:
+		return getNIfTILayout(filename)
+	case ImageTypeRaw:
+		return nil, fmt.Errorf("raw files need a layout; use ReadRawImageRegion or ReadRawImageMapped")
+	default:
+		return nil, fmt.Errorf("region and mapped reading only support raw, MHD and NIfTI files")
+	}
+}
+
+func getMHDLayout(filename string) (*imageFileLayout, error) {
+	hdr, err := readMHDHeader(filename)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.compressed {
+		return nil, fmt.Errorf("compressed MHD files cannot be read in part")
+	}
+	byteOrder := binary.ByteOrder(binary.LittleEndian)
+	if hdr.byteOrderMSB {
+		byteOrder = binary.BigEndian
+	}
+	if hdr.local {
+		return &imageFileLayout{header: hdr.img, filename: filename, offset: int64(hdr.dataOffset), byteOrder: byteOrder}, nil
+	}
+	if len(hdr.dataFiles) != 1 {
+		return nil, fmt.Errorf("MHD files with %d data files cannot be read in part", len(hdr.dataFiles))
+	}
+
+	offset := int64(hdr.headerSize)
+	if offset == -1 {
+		fileInfo, err := os.Stat(hdr.dataFiles[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read raw data: %v", err)
+		}
+		offset = fileInfo.Size() - int64(hdr.img.pixelDataSize())
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid MHD header size: %d", hdr.headerSize)
+	}
+	return &imageFileLayout{header: hdr.img, filename: hdr.dataFiles[0], offset: offset, byteOrder: byteOrder}, nil
+}
+
+// ReadImageRegion reads a rectangular part of an MHD or NIfTI image, reading
+// only the pixel data inside the region from the file.
+//
+// Parameters:
+//   - filename: Path to the image file to read
+//   - imageType: ImageTypeMHD or ImageTypeNIfTI
+//   - start: The index of the first pixel of the region
+//   - size: The size of the region in each dimension
+//
+// Returns:
+//   - *Image: The region, with the spacing and direction of the file and the origin
+//     moved to the first pixel of the region
+//   - error: Error if the file is compressed, the region lies outside the image or reading fails
+//
+// Use ReadRawImageRegion for raw files.
+func ReadImageRegion(filename string, imageType int, start, size []uint32) (*Image, error) {
+	layout, err := getImageFileLayout(filename, imageType)
+	if err != nil {
+		return nil, err
+	}
+	return layout.readRegion(start, size)
+}
+
+// ReadRawImageRegion reads a rectangular part of a headerless raw image file
+// with the layout described by options.
+//
+// Parameters:
+//   - filename: Path to the raw file to read
+//   - options: The size, geometry, pixel type and byte layout of the file
+//   - start: The index of the first pixel of the region
+//   - size: The size of the region in each dimension
+//
+// Returns:
+//   - *Image: The region, with the origin moved to its first pixel
+//   - error: Error if the options are invalid, the region lies outside the image or reading fails
+func ReadRawImageRegion(filename string, options RawReadOptions, start, size []uint32) (*Image, error) {
+	layout, err := getRawLayout(filename, options)
+	if err != nil {
+		return nil, err
+	}
+	return layout.readRegion(start, size)
+}
+
+// ReadImageMapped maps the pixel data of an MHD or NIfTI file into memory
+// instead of reading it, so that only the parts of the image that are accessed
+// are loaded. The image must be released with Close.
+//
+// Parameters:
+//   - filename: Path to the image file to read
+//   - imageType: ImageTypeMHD or ImageTypeNIfTI
+//
+// Returns:
+//   - *Image: The image backed by the file
+//   - error: Error if the pixel data cannot be used in place or mapping fails
+//
+// The pixel data must be uncompressed, little endian and unscaled. Changes to
+// the pixels are private to the process and are not written to the file. On
+// platforms without memory mapping the pixel data is read into memory.
+func ReadImageMapped(filename string, imageType int) (*Image, error) {
+	layout, err := getImageFileLayout(filename, imageType)
+	if err != nil {
+		return nil, err
+	}
+	return layout.mapImage()
+}
+
+// ReadRawImageMapped maps the pixel data of a headerless raw image file with
+// the layout described by options into memory. The image must be released with
+// Close. See ReadImageMapped for the requirements on the pixel data.
+//
+// Parameters:
+//   - filename: Path to the raw file to read
+//   - options: The size, geometry, pixel type and byte layout of the file
+//
+// Returns:
+//   - *Image: The image backed by the file
+//   - error: Error if the options are invalid or mapping fails
+func ReadRawImageMapped(filename string, options RawReadOptions) (*Image, error) {
+	layout, err := getRawLayout(filename, options)
+	if err != nil {
+		return nil, err
+	}
+	return layout.mapImage()
+}
+
+// Close releases the memory-mapped file backing an image read with
+// ReadImageMapped or ReadRawImageMapped. The image, and any image sharing its
+// pixels, must not be used after Close. Close does nothing for other images.
+//
+// Returns:
+//   - error: Error if unmapping fails
+func (img *Image) Close() error {
+	if img.mapping == nil {
+		return nil
+	}
+	err := unmapFile(img.mapping)
+	img.mapping = nil
+	img.pixels = nil
+	if err != nil {
+		return fmt.Errorf("failed to unmap image: %v", err)
+	}
+	return nil
+}
+
+// newImage returns an image with the geometry of the layout and the given pixels.
+func (layout *imageFileLayout) newImage(pixels []byte) *Image {
+	header := layout.header
+	img := *header
+	img.size = append([]uint32(nil), header.size...)
+	img.spacing = append([]float64(nil), header.spacing...)
+	img.origin = append([]float64(nil), header.origin...)
+	img.directionND = slices.Clone(header.directionND)
+	img.copyMetaData(header)
+	img.pixels = pixels
+	return &img
+}
+
+// numBytes returns the size of the pixel data in bytes.
+func (layout *imageFileLayout) numBytes() int64 {
+	return int64(layout.header.pixelDataSize())
+}
+
+// open opens the data file and checks that it holds all the pixel data.
+func (layout *imageFileLayout) open() (*os.File, error) {
+	file, err := os.Open(layout.filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image data: %v", err)
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if layout.offset < 0 || fileInfo.Size() < layout.offset+layout.numBytes() {
+		file.Close()
+		return nil, fmt.Errorf("image data is truncated: expected %d bytes at offset %d, got %d", layout.numBytes(), layout.offset, fileInfo.Size())
+	}
+	return file, nil
+}
+
+// finish converts pixels read from the file to little endian and applies the
+// intensity scaling.
+func (layout *imageFileLayout) finish(img *Image) (*Image, error) {
+	if layout.byteOrder == binary.BigEndian {
+		img.swapPixelBytes(img.pixels)
+	}
+	return applyNIfTIScaling(img, layout.slope, layout.inter)
+}
+
+// read reads the whole image.
+func (layout *imageFileLayout) read() (*Image, error) {
+	file, err := layout.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img := layout.newImage(make([]byte, layout.numBytes()))
+	if _, err := file.ReadAt(img.pixels, layout.offset); err != nil {
+		return nil, err
+	}
+	return layout.finish(img)
+}
+
+// readRegion reads the pixels of a region, reading runs of pixels that are
+// contiguous in the file with a single call.
+func (layout *imageFileLayout) readRegion(start, size []uint32) (*Image, error) {
+	header := layout.header
+	dimension := int(header.dimension)
+	if len(start) != dimension || len(size) != dimension {
+		return nil, fmt.Errorf("region start and size must have %d entries", dimension)
+	}
+	for i := 0; i < dimension; i++ {
+		if size[i] == 0 || uint64(start[i])+uint64(size[i]) > uint64(header.size[i]) {
+			return nil, fmt.Errorf("region start %v size %v exceeds image size %v", start, size, header.size)
+		}
+	}
+
+	file, err := layout.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, err := newImageHeader(append([]uint32(nil), size...), header.pixelType)
+	if err != nil {
+		return nil, err
+	}
+	img.components = header.GetNumberOfComponentsPerPixel()
+	img.pixels = make([]byte, img.pixelDataSize())
+	img.copyGeometry(header)
+	img.copyMetaData(header)
+	for j := 0; j < dimension; j++ {
+		for k := 0; k < dimension; k++ {
+			img.origin[j] += float64(start[k]) * header.spacing[k] * header.directionAt(k, j)
+		}
+	}
+
+	// A run spans the region along x, and along further axes as long as the
+	// region covers the whole image in the preceding axes.
+	runAxes := 1
+	for runAxes < dimension && size[runAxes-1] == header.size[runAxes-1] {
+		runAxes++
+	}
+	runPixels := uint64(1)
+	for i := 0; i < runAxes; i++ {
+		runPixels *= uint64(size[i])
+	}
+	pixelSize := int64(header.bytesPerPixel) * int64(img.components)
+	runBytes := int64(runPixels) * pixelSize
+
+	index := append([]uint32(nil), start...)
+	for position := int64(0); position < int64(len(img.pixels)); position += runBytes {
+		linear := uint64(0)
+		for i := dimension - 1; i >= 0; i-- {
+			linear = linear*uint64(header.size[i]) + uint64(index[i])
+		}
+		fileOffset := layout.offset + int64(linear)*pixelSize
+		if _, err := file.ReadAt(img.pixels[position:position+runBytes], fileOffset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read image data: %v", err)
+		}
+		for i := runAxes; i < dimension; i++ {
+			index[i]++
+			if index[i] < start[i]+size[i] {
+				break
+			}
+			index[i] = start[i]
+		}
+	}
+	return layout.finish(img)
+}
+
+// mapImage maps the pixel data into memory.
+func (layout *imageFileLayout) mapImage() (*Image, error) {
+	if layout.byteOrder == binary.BigEndian && layout.header.bytesPerPixel > 1 {
+		return nil, fmt.Errorf("big endian pixel data cannot be mapped")
+	}
+	if isNIfTIScaled(layout.slope, layout.inter) {
+		return nil, fmt.Errorf("scaled pixel data cannot be mapped")
+	}
+	file, err := layout.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	mapping, pixels, err := mapFile(file, layout.offset, int(layout.numBytes()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to map image data: %v", err)
+	}
+	img := layout.newImage(pixels)
+	img.mapping = mapping
+	return img, nil
+}
@@ -0,0 +1,209 @@
+package imagetk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newRegionTestImage returns a 7x5x4 Int16 image whose pixels encode their index.
+func newRegionTestImage(t *testing.T) *Image {
+	return newTestImage(t, []uint32{7, 5, 4}, PixelTypeInt16, 1, func(i int) float64 {
+		x, y, z := i%7, i/7%5, i/35
+		return float64(z*100 + y*10 + x - 50)
+	})
+}
+
+func TestReadImageRegion(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newRegionTestImage(t)
+	files := []struct {
+		filename  string
+		imageType int
+	}{
+		{"test.mhd", ImageTypeMHD},
+		{"test.mha", ImageTypeMHD},
+		{"test.nii", ImageTypeNIfTI},
+		{"pair.hdr", ImageTypeNIfTI},
+	}
+	regions := []struct {
+		name        string
+		start, size []uint32
+	}{
+		{"interior", []uint32{2, 1, 1}, []uint32{3, 2, 2}},
+		{"full rows", []uint32{0, 1, 0}, []uint32{7, 3, 4}},
+		{"full slices", []uint32{0, 0, 2}, []uint32{7, 5, 2}},
+		{"single pixel", []uint32{6, 4, 3}, []uint32{1, 1, 1}},
+		{"whole image", []uint32{0, 0, 0}, []uint32{7, 5, 4}},
+	}
+	for _, file := range files {
+		filename := filepath.Join(tempDir, file.filename)
+		if err := WriteImage(img, filename, file.imageType); err != nil {
+			t.Fatalf("failed to write image: %v", err)
+		}
+		for _, tt := range regions {
+			t.Run(file.filename+" "+tt.name, func(t *testing.T) {
+				region, err := ReadImageRegion(filename, file.imageType, tt.start, tt.size)
+				if err != nil {
+					t.Fatalf("failed to read region: %v", err)
+				}
+				checkRegion(t, img, region, tt.start, tt.size)
+			})
+		}
+	}
+
+	if _, err := ReadImageRegion(filepath.Join(tempDir, "test.mhd"), ImageTypeMHD, []uint32{5, 0, 0}, []uint32{3, 1, 1}); err == nil {
+		t.Errorf("expected error for region outside the image")
+	}
+	if _, err := ReadImageRegion(filepath.Join(tempDir, "test.mhd"), ImageTypeMHD, []uint32{0, 0}, []uint32{1, 1}); err == nil {
+		t.Errorf("expected error for region of the wrong dimension")
+	}
+	compressed := filepath.Join(tempDir, "test.nii.gz")
+	if err := WriteImage(img, compressed, ImageTypeNIfTI); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadImageRegion(compressed, ImageTypeNIfTI, []uint32{0, 0, 0}, []uint32{1, 1, 1}); err == nil {
+		t.Errorf("expected error for compressed file")
+	}
+	if _, err := ReadImageRegion(filepath.Join(tempDir, "test.tif"), ImageTypeTIFF, []uint32{0, 0, 0}, []uint32{1, 1, 1}); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
+
+func checkRegion(t *testing.T, img, region *Image, start, size []uint32) {
+	t.Helper()
+	for i := range size {
+		if region.GetSize()[i] != size[i] || region.GetSpacing()[i] != img.GetSpacing()[i] {
+			t.Fatalf("expected size %v spacing %v, got %v and %v", size, img.GetSpacing(), region.GetSize(), region.GetSpacing())
+		}
+	}
+	if region.GetDirection() != img.GetDirection() {
+		t.Errorf("expected direction %v, got %v", img.GetDirection(), region.GetDirection())
+	}
+	// The rotation maps the x axis to y and the y axis to -x.
+	expectedOrigin := []float64{
+		img.GetOrigin()[0] - float64(start[1])*img.GetSpacing()[1],
+		img.GetOrigin()[1] + float64(start[0])*img.GetSpacing()[0],
+		img.GetOrigin()[2] + float64(start[2])*img.GetSpacing()[2],
+	}
+	for i, value := range expectedOrigin {
+		if !almostEqual(region.GetOrigin()[i], value, 1e-9) {
+			t.Errorf("expected origin %v, got %v", expectedOrigin, region.GetOrigin())
+			break
+		}
+	}
+	for z := uint32(0); z < size[2]; z++ {
+		for y := uint32(0); y < size[1]; y++ {
+			for x := uint32(0); x < size[0]; x++ {
+				expected, _ := img.GetPixelAsInt16([]uint32{start[0] + x, start[1] + y, start[2] + z})
+				value, _ := region.GetPixelAsInt16([]uint32{x, y, z})
+				if value != expected {
+					t.Fatalf("pixel (%d, %d, %d): expected %d, got %d", x, y, z, expected, value)
+				}
+			}
+		}
+	}
+}
+
+func TestReadRawImageRegion(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newRegionTestImage(t)
+	data := append([]byte("HEADER"), img.pixels...)
+	swapBytes(data[6:], 2)
+	filename := filepath.Join(tempDir, "test.raw")
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := RawReadOptions{
+		Size:         []uint32{7, 5},
+		Dimension:    3,
+		Spacing:      img.GetSpacing(),
+		Origin:       img.GetOrigin(),
+		Direction:    img.GetDirection(),
+		PixelType:    PixelTypeInt16,
+		ByteOrder:    binary.BigEndian,
+		HeaderOffset: 6,
+	}
+	start, size := []uint32{1, 2, 1}, []uint32{5, 3, 3}
+	region, err := ReadRawImageRegion(filename, options, start, size)
+	if err != nil {
+		t.Fatalf("failed to read region: %v", err)
+	}
+	checkRegion(t, img, region, start, size)
+
+	if _, err := ReadRawImageMapped(filename, options); err == nil {
+		t.Errorf("expected error mapping big endian data")
+	}
+}
+
+func TestReadImageMapped(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newRegionTestImage(t)
+	for _, tt := range []struct {
+		filename  string
+		imageType int
+	}{
+		{"test.mha", ImageTypeMHD},
+		{"test.nii", ImageTypeNIfTI},
+	} {
+		t.Run(tt.filename, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := WriteImage(img, filename, tt.imageType); err != nil {
+				t.Fatal(err)
+			}
+			before, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mapped, err := ReadImageMapped(filename, tt.imageType)
+			if err != nil {
+				t.Fatalf("failed to map image: %v", err)
+			}
+			if !bytes.Equal(mapped.pixels, img.pixels) || mapped.GetDirection() != img.GetDirection() {
+				t.Errorf("mapped image does not match")
+			}
+			if err := mapped.SetPixel([]uint32{0, 0, 0}, int16(1234)); err != nil {
+				t.Fatal(err)
+			}
+			if value, _ := mapped.GetPixelAsInt16([]uint32{0, 0, 0}); value != 1234 {
+				t.Errorf("expected modified pixel 1234, got %d", value)
+			}
+			if err := mapped.Close(); err != nil {
+				t.Fatalf("failed to close image: %v", err)
+			}
+			if err := mapped.Close(); err != nil {
+				t.Errorf("second close failed: %v", err)
+			}
+
+			after, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(before, after) {
+				t.Errorf("changes to the mapped image were written to the file")
+			}
+		})
+	}
+
+	if err := newRegionTestImage(t).Close(); err != nil {
+		t.Errorf("closing an unmapped image failed: %v", err)
+	}
+}
@@ -1,7 +1,6 @@
 package imagetk
 
 import (
-	"encoding/binary"
 	"math"
 	"sort"
 )
@@ -13,93 +12,25 @@ import (
 func (img *Image) Min() any {
 	switch img.pixelType {
 	case PixelTypeUInt8:
-		minValue := uint8(math.MaxUint8)
-		for i := 0; i < len(img.pixels); i++ {
-			if uint8(img.pixels[i]) < minValue {
-				minValue = uint8(img.pixels[i])
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[uint8](img))
 	case PixelTypeInt8:
-		minValue := int8(math.MaxInt8)
-		for i := 0; i < len(img.pixels); i++ {
-			if int8(img.pixels[i]) < minValue {
-				minValue = int8(img.pixels[i])
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[int8](img))
 	case PixelTypeUInt16:
-		minValue := uint16(math.MaxUint16)
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2])
-			if value < minValue {
-				minValue = value
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[uint16](img))
 	case PixelTypeInt16:
-		minValue := int16(math.MaxInt16)
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := int16(binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2]))
-			if value < minValue {
-				minValue = value
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[int16](img))
 	case PixelTypeUInt32:
-		minValue := uint32(math.MaxUint32)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4])
-			if value < minValue {
-				minValue = value
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[uint32](img))
 	case PixelTypeInt32:
-		minValue := int32(math.MaxInt32)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := int32(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			if value < minValue {
-				minValue = value
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[int32](img))
 	case PixelTypeUInt64:
-		minValue := uint64(math.MaxUint64)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8])
-			if value < minValue {
-				minValue = value
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[uint64](img))
 	case PixelTypeInt64:
-		minValue := int64(math.MaxInt64)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := int64(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			if value < minValue {
-				minValue = value
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[int64](img))
 	case PixelTypeFloat32:
-		minValue := float32(math.MaxFloat32)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := math.Float32frombits(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			if value < minValue {
-				minValue = value
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[float32](img))
 	case PixelTypeFloat64:
-		minValue := float64(math.MaxFloat64)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := math.Float64frombits(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			if value < minValue {
-				minValue = value
-			}
-		}
-		return minValue
+		return minOf(pixelsOf[float64](img))
 	default:
 		return nil
 	}
@@ -112,93 +43,25 @@ func (img *Image) Min() any {
 func (img *Image) Max() any {
 	switch img.pixelType {
 	case PixelTypeUInt8:
-		maxValue := uint8(0)
-		for i := 0; i < len(img.pixels); i++ {
-			if uint8(img.pixels[i]) > maxValue {
-				maxValue = uint8(img.pixels[i])
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[uint8](img))
 	case PixelTypeInt8:
-		maxValue := int8(math.MinInt8)
-		for i := 0; i < len(img.pixels); i++ {
-			if int8(img.pixels[i]) > maxValue {
-				maxValue = int8(img.pixels[i])
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[int8](img))
 	case PixelTypeUInt16:
-		maxValue := uint16(0)
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2])
-			if value > maxValue {
-				maxValue = value
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[uint16](img))
 	case PixelTypeInt16:
-		maxValue := int16(math.MinInt16)
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := int16(binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2]))
-			if value > maxValue {
-				maxValue = value
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[int16](img))
 	case PixelTypeUInt32:
-		maxValue := uint32(0)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4])
-			if value > maxValue {
-				maxValue = value
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[uint32](img))
 	case PixelTypeInt32:
-		maxValue := int32(math.MinInt32)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := int32(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			if value > maxValue {
-				maxValue = value
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[int32](img))
 	case PixelTypeUInt64:
-		maxValue := uint64(0)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8])
-			if value > maxValue {
-				maxValue = value
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[uint64](img))
 	case PixelTypeInt64:
-		maxValue := int64(math.MinInt64)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := int64(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			if value > maxValue {
-				maxValue = value
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[int64](img))
 	case PixelTypeFloat32:
-		maxValue := float32(-math.MaxFloat32)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := math.Float32frombits(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			if value > maxValue {
-				maxValue = value
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[float32](img))
 	case PixelTypeFloat64:
-		maxValue := float64(-math.MaxFloat64)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := math.Float64frombits(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			if value > maxValue {
-				maxValue = value
-			}
-		}
-		return maxValue
+		return maxOf(pixelsOf[float64](img))
 	default:
 		return nil
 	}
@@ -211,73 +74,25 @@ func (img *Image) Max() any {
 func (img *Image) Sum() any {
 	switch img.pixelType {
 	case PixelTypeUInt8:
-		sumValue := uint64(0)
-		for i := 0; i < len(img.pixels); i++ {
-			sumValue += uint64(uint8(img.pixels[i]))
-		}
-		return sumValue
+		return sumOf[uint8, uint64](pixelsOf[uint8](img))
 	case PixelTypeInt8:
-		sumValue := int64(0)
-		for i := 0; i < len(img.pixels); i++ {
-			sumValue += int64(int8(img.pixels[i]))
-		}
-		return sumValue
+		return sumOf[int8, int64](pixelsOf[int8](img))
 	case PixelTypeUInt16:
-		sumValue := uint64(0)
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2])
-			sumValue += uint64(value)
-		}
-		return sumValue
+		return sumOf[uint16, uint64](pixelsOf[uint16](img))
 	case PixelTypeInt16:
-		sumValue := int64(0)
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := int16(binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2]))
-			sumValue += int64(value)
-		}
-		return sumValue
+		return sumOf[int16, int64](pixelsOf[int16](img))
 	case PixelTypeUInt32:
-		sumValue := uint64(0)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4])
-			sumValue += uint64(value)
-		}
-		return sumValue
+		return sumOf[uint32, uint64](pixelsOf[uint32](img))
 	case PixelTypeInt32:
-		sumValue := int64(0)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := int32(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			sumValue += int64(value)
-		}
-		return sumValue
+		return sumOf[int32, int64](pixelsOf[int32](img))
 	case PixelTypeUInt64:
-		sumValue := uint64(0)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8])
-			sumValue += uint64(value)
-		}
-		return sumValue
+		return sumOf[uint64, uint64](pixelsOf[uint64](img))
 	case PixelTypeInt64:
-		sumValue := int64(0)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := int64(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			sumValue += int64(value)
-		}
-		return sumValue
+		return sumOf[int64, int64](pixelsOf[int64](img))
 	case PixelTypeFloat32:
-		sumValue := float64(0)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := math.Float32frombits(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			sumValue += float64(value)
-		}
-		return sumValue
+		return sumOf[float32, float64](pixelsOf[float32](img))
 	case PixelTypeFloat64:
-		sumValue := float64(0)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := math.Float64frombits(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			sumValue += float64(value)
-		}
-		return sumValue
+		return sumOf[float64, float64](pixelsOf[float64](img))
 	default:
 		return nil
 	}
@@ -290,73 +105,25 @@ func (img *Image) Sum() any {
 func (img *Image) Product() any {
 	switch img.pixelType {
 	case PixelTypeUInt8:
-		productValue := uint64(1)
-		for i := 0; i < len(img.pixels); i++ {
-			productValue *= uint64(uint8(img.pixels[i]))
-		}
-		return productValue
+		return productOf[uint8, uint64](pixelsOf[uint8](img))
 	case PixelTypeInt8:
-		productValue := int64(1)
-		for i := 0; i < len(img.pixels); i++ {
-			productValue *= int64(int8(img.pixels[i]))
-		}
-		return productValue
+		return productOf[int8, int64](pixelsOf[int8](img))
 	case PixelTypeUInt16:
-		productValue := uint64(1)
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2])
-			productValue *= uint64(value)
-		}
-		return productValue
+		return productOf[uint16, uint64](pixelsOf[uint16](img))
 	case PixelTypeInt16:
-		productValue := int64(1)
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := int16(binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2]))
-			productValue *= int64(value)
-		}
-		return productValue
+		return productOf[int16, int64](pixelsOf[int16](img))
 	case PixelTypeUInt32:
-		productValue := uint64(1)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4])
-			productValue *= uint64(value)
-		}
-		return productValue
+		return productOf[uint32, uint64](pixelsOf[uint32](img))
 	case PixelTypeInt32:
-		productValue := int64(1)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := int32(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			productValue *= int64(value)
-		}
-		return productValue
+		return productOf[int32, int64](pixelsOf[int32](img))
 	case PixelTypeUInt64:
-		productValue := uint64(1)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8])
-			productValue *= uint64(value)
-		}
-		return productValue
+		return productOf[uint64, uint64](pixelsOf[uint64](img))
 	case PixelTypeInt64:
-		productValue := int64(1)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := int64(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			productValue *= int64(value)
-		}
-		return productValue
+		return productOf[int64, int64](pixelsOf[int64](img))
 	case PixelTypeFloat32:
-		productValue := float64(1)
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := math.Float32frombits(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			productValue *= float64(value)
-		}
-		return productValue
+		return productOf[float32, float64](pixelsOf[float32](img))
 	case PixelTypeFloat64:
-		productValue := float64(1)
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := math.Float64frombits(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			productValue *= float64(value)
-		}
-		return productValue
+		return productOf[float64, float64](pixelsOf[float64](img))
 	default:
 		return nil
 	}
@@ -418,85 +185,27 @@ func (img *Image) Mean() any {
 // Returns:
 //   - float64: The median of the image.
 func (img *Image) Median() float64 {
-	pixelData := make([]byte, len(img.pixels))
-	copy(pixelData, img.pixels)
 	switch img.pixelType {
 	case PixelTypeUInt8:
-		sort.Slice(pixelData, func(i, j int) bool { return uint8(pixelData[i]) < uint8(pixelData[j]) })
-		if len(pixelData)%2 == 0 {
-			return float64(pixelData[len(pixelData)/2-1]+pixelData[len(pixelData)/2]) / 2
-		}
-		return float64(uint8(pixelData[len(pixelData)/2]))
+		return medianOf(pixelsOf[uint8](img))
 	case PixelTypeInt8:
-		sort.Slice(pixelData, func(i, j int) bool { return int8(pixelData[i]) < int8(pixelData[j]) })
-		if len(pixelData)%2 == 0 {
-			return float64(pixelData[len(pixelData)/2-1]+pixelData[len(pixelData)/2]) / 2
-		}
-		return float64(int8(pixelData[len(pixelData)/2]))
+		return medianOf(pixelsOf[int8](img))
 	case PixelTypeUInt16:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return binary.LittleEndian.Uint16(pixelData[i*2:i*2+2]) < binary.LittleEndian.Uint16(pixelData[j*2:j*2+2])
-		})
-		if len(pixelData)%2 == 0 {
-			return float64(binary.LittleEndian.Uint16(pixelData[len(pixelData)/2*2-2:len(pixelData)/2*2])+binary.LittleEndian.Uint16(pixelData[len(pixelData)/2*2:len(pixelData)/2*2+2])) / 2
-		}
-		return float64(binary.LittleEndian.Uint16(pixelData[len(pixelData)/2*2 : len(pixelData)/2*2+2]))
+		return medianOf(pixelsOf[uint16](img))
 	case PixelTypeInt16:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return int16(binary.LittleEndian.Uint16(pixelData[i*2:i*2+2])) < int16(binary.LittleEndian.Uint16(pixelData[j*2:j*2+2]))
-		})
-		if len(pixelData)%2 == 0 {
-			return float64(int16(binary.LittleEndian.Uint16(pixelData[len(pixelData)/2*2-2:len(pixelData)/2*2]))+int16(binary.LittleEndian.Uint16(pixelData[len(pixelData)/2*2:len(pixelData)/2*2+2]))) / 2
-		}
-		return float64(int16(binary.LittleEndian.Uint16(pixelData[len(pixelData)/2*2 : len(pixelData)/2*2+2])))
+		return medianOf(pixelsOf[int16](img))
 	case PixelTypeUInt32:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return binary.LittleEndian.Uint32(pixelData[i*4:i*4+4]) < binary.LittleEndian.Uint32(pixelData[j*4:j*4+4])
-		})
-		if len(pixelData)%2 == 0 {
-			return float64(binary.LittleEndian.Uint32(pixelData[len(pixelData)/2*4-4:len(pixelData)/2*4])+binary.LittleEndian.Uint32(pixelData[len(pixelData)/2*4:len(pixelData)/2*4+4])) / 2
-		}
-		return float64(binary.LittleEndian.Uint32(pixelData[len(pixelData)/2*4 : len(pixelData)/2*4+4]))
+		return medianOf(pixelsOf[uint32](img))
 	case PixelTypeInt32:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return int32(binary.LittleEndian.Uint32(pixelData[i*4:i*4+4])) < int32(binary.LittleEndian.Uint32(pixelData[j*4:j*4+4]))
-		})
-		if len(pixelData)%2 == 0 {
-			return float64(int32(binary.LittleEndian.Uint32(pixelData[len(pixelData)/2*4-4:len(pixelData)/2*4]))+int32(binary.LittleEndian.Uint32(pixelData[len(pixelData)/2*4:len(pixelData)/2*4+4]))) / 2
-		}
-		return float64(int32(binary.LittleEndian.Uint32(pixelData[len(pixelData)/2*4 : len(pixelData)/2*4+4])))
+		return medianOf(pixelsOf[int32](img))
 	case PixelTypeUInt64:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return binary.LittleEndian.Uint64(pixelData[i*8:i*8+8]) < binary.LittleEndian.Uint64(pixelData[j*8:j*8+8])
-		})
-		if len(pixelData)%2 == 0 {
-			return float64(binary.LittleEndian.Uint64(pixelData[len(pixelData)/2*8-8:len(pixelData)/2*8])+binary.LittleEndian.Uint64(pixelData[len(pixelData)/2*8:len(pixelData)/2*8+8])) / 2
-		}
-		return float64(binary.LittleEndian.Uint64(pixelData[len(pixelData)/2*8 : len(pixelData)/2*8+8]))
+		return medianOf(pixelsOf[uint64](img))
 	case PixelTypeInt64:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return int64(binary.LittleEndian.Uint64(pixelData[i*8:i*8+8])) < int64(binary.LittleEndian.Uint64(pixelData[j*8:j*8+8]))
-		})
-		if len(pixelData)%2 == 0 {
-			return float64(int64(binary.LittleEndian.Uint64(pixelData[len(pixelData)/2*8-8:len(pixelData)/2*8]))+int64(binary.LittleEndian.Uint64(pixelData[len(pixelData)/2*8:len(pixelData)/2*8+8]))) / 2
-		}
-		return float64(int64(binary.LittleEndian.Uint64(pixelData[len(pixelData)/2*8 : len(pixelData)/2*8+8])))
+		return medianOf(pixelsOf[int64](img))
 	case PixelTypeFloat32:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return math.Float32frombits(binary.LittleEndian.Uint32(pixelData[i*4:i*4+4])) < math.Float32frombits(binary.LittleEndian.Uint32(pixelData[j*4:j*4+4]))
-		})
-		if len(pixelData)%2 == 0 {
-			return float64(math.Float32frombits(binary.LittleEndian.Uint32(pixelData[len(pixelData)/2*4-4:len(pixelData)/2*4]))+math.Float32frombits(binary.LittleEndian.Uint32(pixelData[len(pixelData)/2*4:len(pixelData)/2*4+4]))) / 2
-		}
-		return float64(math.Float32frombits(binary.LittleEndian.Uint32(pixelData[len(pixelData)/2*4 : len(pixelData)/2*4+4])))
+		return medianOf(pixelsOf[float32](img))
 	case PixelTypeFloat64:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return math.Float64frombits(binary.LittleEndian.Uint64(pixelData[i*8:i*8+8])) < math.Float64frombits(binary.LittleEndian.Uint64(pixelData[j*8:j*8+8]))
-		})
-		if len(pixelData)%2 == 0 {
-			return float64(math.Float64frombits(binary.LittleEndian.Uint64(pixelData[len(pixelData)/2*8-8:len(pixelData)/2*8]))+math.Float64frombits(binary.LittleEndian.Uint64(pixelData[len(pixelData)/2*8:len(pixelData)/2*8+8]))) / 2
-		}
-		return float64(math.Float64frombits(binary.LittleEndian.Uint64(pixelData[len(pixelData)/2*8 : len(pixelData)/2*8+8])))
+		return medianOf(pixelsOf[float64](img))
 	default:
 		return 0
 	}
@@ -507,87 +216,28 @@ func (img *Image) Median() float64 {
 // Returns:
 //   - any: The standard deviation of the image.
 func (img *Image) Std() any {
+	meanValue := img.ExactMean()
 	switch img.pixelType {
 	case PixelTypeUInt8:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels); i++ {
-			value := float64(uint8(img.pixels[i]))
-			sumValue += (value - meanValue) * (value - meanValue)
-		}
-		return math.Sqrt(sumValue / float64(len(img.pixels)))
+		return stdOf(pixelsOf[uint8](img), meanValue)
 	case PixelTypeInt8:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels); i++ {
-			value := float64(int8(img.pixels[i]))
-			sumValue += (value - meanValue) * (value - meanValue)
-		}
-		return math.Sqrt(sumValue / float64(len(img.pixels)))
+		return stdOf(pixelsOf[int8](img), meanValue)
 	case PixelTypeUInt16:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := float64(binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2]))
-			sumValue += (value - meanValue) * (value - meanValue)
-		}
-		return math.Sqrt(float64(sumValue) / float64(len(img.pixels)/2))
+		return stdOf(pixelsOf[uint16](img), meanValue)
 	case PixelTypeInt16:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels)/2; i++ {
-			value := float64(int16(binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2])))
-			sumValue += (value - meanValue) * (value - meanValue)
-		}
-		return math.Sqrt(float64(sumValue) / float64(len(img.pixels)/2))
+		return stdOf(pixelsOf[int16](img), meanValue)
 	case PixelTypeUInt32:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := float64(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			sumValue += (value - meanValue) * (value - meanValue)
-		}
-		return math.Sqrt(sumValue / float64(len(img.pixels)/4))
+		return stdOf(pixelsOf[uint32](img), meanValue)
 	case PixelTypeInt32:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := float64(int32(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4])))
-			sumValue += (value - meanValue) * (value - meanValue)
-		}
-		return math.Sqrt(sumValue / float64(len(img.pixels)/4))
+		return stdOf(pixelsOf[int32](img), meanValue)
 	case PixelTypeUInt64:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := float64(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			sumValue += (value - meanValue) * (value - meanValue)
-		}
-		return math.Sqrt(sumValue / float64(len(img.pixels)/8))
+		return stdOf(pixelsOf[uint64](img), meanValue)
 	case PixelTypeInt64:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := float64(int64(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8])))
-			sumValue += (value - meanValue) * (value - meanValue)
-		}
-		return math.Sqrt(sumValue / float64(len(img.pixels)/8))
+		return stdOf(pixelsOf[int64](img), meanValue)
 	case PixelTypeFloat32:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels)/4; i++ {
-			value := math.Float32frombits(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
-			sumValue += (float64(value) - meanValue) * (float64(value) - meanValue)
-		}
-		return math.Sqrt(sumValue / float64(len(img.pixels)/4))
+		return stdOf(pixelsOf[float32](img), meanValue)
 	case PixelTypeFloat64:
-		meanValue := img.ExactMean()
-		sumValue := 0.0
-		for i := 0; i < len(img.pixels)/8; i++ {
-			value := math.Float64frombits(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
-			sumValue += (value - meanValue) * (value - meanValue)
-		}
-		return math.Sqrt(sumValue / float64(len(img.pixels)/8))
+		return stdOf(pixelsOf[float64](img), meanValue)
 	default:
 		return nil
 	}
@@ -600,215 +250,124 @@ func (img *Image) Std() any {
 // Returns:
 //   - float64: The percentile value.
 func (img *Image) Percentile(p float64) float64 {
-	pixelData := make([]byte, len(img.pixels))
-	copy(pixelData, img.pixels)
 	switch img.pixelType {
 	case PixelTypeUInt8:
-		sort.Slice(pixelData, func(i, j int) bool { return uint8(pixelData[i]) < uint8(pixelData[j]) })
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(uint8(pixelData[index]))
-		}
-		value := float64(uint8(img.pixels[index]))
-		nextValue := float64(uint8(img.pixels[index+1]))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[uint8](img), p)
 	case PixelTypeInt8:
-		sort.Slice(pixelData, func(i, j int) bool { return int8(pixelData[i]) < int8(pixelData[j]) })
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(int8(pixelData[index]))
-		}
-		value := float64(int8(pixelData[index]))
-		nextValue := float64(int8(pixelData[index+1]))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[int8](img), p)
 	case PixelTypeUInt16:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return binary.LittleEndian.Uint16(pixelData[i*2:i*2+2]) < binary.LittleEndian.Uint16(pixelData[j*2:j*2+2])
-		})
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(binary.LittleEndian.Uint16(pixelData[index*2 : index*2+2]))
-		}
-		value := float64(binary.LittleEndian.Uint16(pixelData[index*2 : index*2+2]))
-		nextValue := float64(binary.LittleEndian.Uint16(pixelData[(index+1)*2 : (index+1)*2+2]))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[uint16](img), p)
 	case PixelTypeInt16:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return int16(binary.LittleEndian.Uint16(pixelData[i*2:i*2+2])) < int16(binary.LittleEndian.Uint16(pixelData[j*2:j*2+2]))
-		})
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(int16(binary.LittleEndian.Uint16(pixelData[index*2 : index*2+2])))
-		}
-		value := float64(int16(binary.LittleEndian.Uint16(pixelData[index*2 : index*2+2])))
-		nextValue := float64(int16(binary.LittleEndian.Uint16(pixelData[(index+1)*2 : (index+1)*2+2])))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[int16](img), p)
 	case PixelTypeUInt32:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return binary.LittleEndian.Uint32(pixelData[i*4:i*4+4]) < binary.LittleEndian.Uint32(pixelData[j*4:j*4+4])
-		})
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(binary.LittleEndian.Uint32(pixelData[index*4 : index*4+4]))
-		}
-		value := float64(binary.LittleEndian.Uint32(pixelData[index*4 : index*4+4]))
-		nextValue := float64(binary.LittleEndian.Uint32(pixelData[(index+1)*4 : (index+1)*4+4]))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[uint32](img), p)
 	case PixelTypeInt32:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return int32(binary.LittleEndian.Uint32(pixelData[i*4:i*4+4])) < int32(binary.LittleEndian.Uint32(pixelData[j*4:j*4+4]))
-		})
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(int32(binary.LittleEndian.Uint32(pixelData[index*4 : index*4+4])))
-		}
-		value := float64(int32(binary.LittleEndian.Uint32(pixelData[index*4 : index*4+4])))
-		nextValue := float64(int32(binary.LittleEndian.Uint32(pixelData[(index+1)*4 : (index+1)*4+4])))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[int32](img), p)
 	case PixelTypeUInt64:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return binary.LittleEndian.Uint64(pixelData[i*8:i*8+8]) < binary.LittleEndian.Uint64(pixelData[j*8:j*8+8])
-		})
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(binary.LittleEndian.Uint64(pixelData[index*8 : index*8+8]))
-		}
-		value := float64(binary.LittleEndian.Uint64(pixelData[index*8 : index*8+8]))
-		nextValue := float64(binary.LittleEndian.Uint64(pixelData[(index+1)*8 : (index+1)*8+8]))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[uint64](img), p)
 	case PixelTypeInt64:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return int64(binary.LittleEndian.Uint64(pixelData[i*8:i*8+8])) < int64(binary.LittleEndian.Uint64(pixelData[j*8:j*8+8]))
-		})
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(int64(binary.LittleEndian.Uint64(pixelData[index*8 : index*8+8])))
-		}
-		value := float64(int64(binary.LittleEndian.Uint64(pixelData[index*8 : index*8+8])))
-		nextValue := float64(int64(binary.LittleEndian.Uint64(pixelData[(index+1)*8 : (index+1)*8+8])))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[int64](img), p)
 	case PixelTypeFloat32:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return math.Float32frombits(binary.LittleEndian.Uint32(pixelData[i*4:i*4+4])) < math.Float32frombits(binary.LittleEndian.Uint32(pixelData[j*4:j*4+4]))
-		})
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(math.Float32frombits(binary.LittleEndian.Uint32(pixelData[index*4 : index*4+4])))
-		}
-		value := float64(math.Float32frombits(binary.LittleEndian.Uint32(pixelData[index*4 : index*4+4])))
-		nextValue := float64(math.Float32frombits(binary.LittleEndian.Uint32(pixelData[(index+1)*4 : (index+1)*4+4])))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[float32](img), p)
 	case PixelTypeFloat64:
-		sort.Slice(pixelData, func(i, j int) bool {
-			return math.Float64frombits(binary.LittleEndian.Uint64(pixelData[i*8:i*8+8])) < math.Float64frombits(binary.LittleEndian.Uint64(pixelData[j*8:j*8+8]))
-		})
-		indexFloat := p * float64(len(pixelData)-1)
-		index := int(indexFloat)
-		if indexFloat == float64(index) {
-			return float64(math.Float64frombits(binary.LittleEndian.Uint64(pixelData[index*8 : index*8+8])))
-		}
-		value := float64(math.Float64frombits(binary.LittleEndian.Uint64(pixelData[index*8 : index*8+8])))
-		nextValue := float64(math.Float64frombits(binary.LittleEndian.Uint64(pixelData[(index+2)*8 : (index+1)*8+8])))
-		return value + (indexFloat-float64(index))*(nextValue-value)
+		return percentileOf(pixelsOf[float64](img), p)
 	default:
 		return 0
 	}
 }
 
-// OtsuThreshold returns the threshold value for the Otsu thresholding method.
+// OtsuThreshold returns the threshold value for the Otsu thresholding method,
+// computed from a 256-bin histogram over the intensity range of the image.
 // Returns:
-//   - float64: The threshold value.
+//   - float64: The threshold value, the largest intensity of the background class.
+//
+// Use ComputeThreshold to choose the number of bins, a mask or another method.
 func (img *Image) OtsuThreshold() float64 {
-	var maxVal float64
-	switch img.pixelType {
-	case PixelTypeUInt8:
-		maxVal = float64(img.Max().(uint8))
-	case PixelTypeInt8:
-		maxVal = float64(img.Max().(int8))
-	case PixelTypeUInt16:
-		maxVal = float64(img.Max().(uint16))
-	case PixelTypeInt16:
-		maxVal = float64(img.Max().(int16))
-	case PixelTypeUInt32:
-		maxVal = float64(img.Max().(uint32))
-	case PixelTypeInt32:
-		maxVal = float64(img.Max().(int32))
-	case PixelTypeUInt64:
-		maxVal = float64(img.Max().(uint64))
-	case PixelTypeInt64:
-		maxVal = float64(img.Max().(int64))
-	case PixelTypeFloat32:
-		maxVal = float64(img.Max().(float32))
-	case PixelTypeFloat64:
-		maxVal = float64(img.Max().(float64))
-	default:
+	threshold, err := ComputeThreshold(img, ThresholdOtsu, ThresholdOptions{})
+	if err != nil {
 		return 0
 	}
+	return threshold
+}
 
-	size := img.GetSize()
-	hist := make([]int, 256)
-	switch img.dimension {
-	case 2:
-		for y := 0; y < int(size[1]); y++ {
-			for x := 0; x < int(size[0]); x++ {
-				value, err := img.GetPixelAsFloat64([]uint32{uint32(x), uint32(y)})
-				if err != nil {
-					return 0
-				}
-				hist[int(value/maxVal*255)]++
-			}
+// minOf returns the smallest of the pixels, ignoring NaN values.
+func minOf[T Number](pixels []T) T {
+	minValue := pixels[0]
+	for _, value := range pixels[1:] {
+		if value < minValue || minValue != minValue {
+			minValue = value
 		}
-	case 3:
-		for z := 0; z < int(size[2]); z++ {
-			for y := 0; y < int(size[1]); y++ {
-				for x := 0; x < int(size[0]); x++ {
-					value, err := img.GetPixelAsFloat64([]uint32{uint32(x), uint32(y), uint32(z)})
-					if err != nil {
-						return 0
-					}
-					hist[int(value/maxVal*255)]++
-				}
-			}
+	}
+	return minValue
+}
+
+// maxOf returns the largest of the pixels, ignoring NaN values.
+func maxOf[T Number](pixels []T) T {
+	maxValue := pixels[0]
+	for _, value := range pixels[1:] {
+		if value > maxValue || maxValue != maxValue {
+			maxValue = value
 		}
 	}
+	return maxValue
+}
 
-	total := 1
-	for _, v := range size {
-		total *= int(v)
+// sumOf returns the sum of the pixels accumulated as S.
+func sumOf[T Number, S uint64 | int64 | float64](pixels []T) S {
+	sumValue := S(0)
+	for _, value := range pixels {
+		sumValue += S(value)
 	}
+	return sumValue
+}
 
-	sum := 0
-	for i := 0; i < 256; i++ {
-		sum += hist[i] * i
+// productOf returns the product of the pixels accumulated as S.
+func productOf[T Number, S uint64 | int64 | float64](pixels []T) S {
+	productValue := S(1)
+	for _, value := range pixels {
+		productValue *= S(value)
 	}
+	return productValue
+}
 
-	sumB, wB, wF, varMax, threshold := 0, 0, 0, 0.0, 0
-	for t := 0; t < 256; t++ {
-		wB += hist[t]
-		if wB == 0 {
-			continue
-		}
-		wF = total - wB
-		if wF == 0 {
-			break
-		}
-		sumB += t * hist[t]
-		mB := float64(sumB) / float64(wB)
-		mF := float64(sum-sumB) / float64(wF)
-		varBetween := float64(wB) * float64(wF) * (mB - mF) * (mB - mF)
-		if varBetween > varMax {
-			varMax = varBetween
-			threshold = t
-		}
+// stdOf returns the population standard deviation of the pixels around meanValue.
+func stdOf[T Number](pixels []T, meanValue float64) float64 {
+	sumValue := 0.0
+	for _, value := range pixels {
+		diff := float64(value) - meanValue
+		sumValue += diff * diff
+	}
+	return math.Sqrt(sumValue / float64(len(pixels)))
+}
+
+// sortedCopy returns a sorted copy of the pixels.
+func sortedCopy[T Number](pixels []T) []T {
+	sorted := append([]T(nil), pixels...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// medianOf returns the median of the pixels, averaging the two middle values
+// of an even number of pixels.
+func medianOf[T Number](pixels []T) float64 {
+	sorted := sortedCopy(pixels)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (float64(sorted[middle-1]) + float64(sorted[middle])) / 2
+	}
+	return float64(sorted[middle])
+}
+
+// percentileOf returns the p-th quantile of the pixels, interpolating linearly
+// between neighbouring values.
+func percentileOf[T Number](pixels []T, p float64) float64 {
+	sorted := sortedCopy(pixels)
+	indexFloat := p * float64(len(sorted)-1)
+	index := int(indexFloat)
+	if indexFloat == float64(index) {
+		return float64(sorted[index])
 	}
-	return float64(threshold) / 255.0 * maxVal
+	value := float64(sorted[index])
+	nextValue := float64(sorted[index+1])
+	return value + (indexFloat-float64(index))*(nextValue-value)
 }
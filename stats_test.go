@@ -1,6 +1,7 @@
 package imagetk
 
 import (
+	"fmt"
 	"math"
 	"testing"
 )
@@ -197,7 +198,8 @@ func TestOtsuThreshold(t *testing.T) {
 	}{
 		{name: "otsu threshold of 0", pixelData: [][]float64{{0, 0, 0}, {0, 0, 0}, {1, 1, 1}, {1, 1, 1}}, expect: 0},
 		{name: "otsu threshold of 1", pixelData: [][]float64{{0, 0, 0}, {1, 1, 1}, {2, 2, 2}, {3, 3, 3}}, expect: 1},
-		{name: "otsu threshold of 5.97", pixelData: [][]float64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10, 11, 12}}, expect: 5.976},
+		{name: "otsu threshold of 6", pixelData: [][]float64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10, 11, 12}}, expect: 6},
+		{name: "otsu threshold of negative values", pixelData: [][]float64{{-1000, -1000, -990}, {-995, 40, 60}, {50, 45, 55}, {-1000, 52, 48}}, expect: -990},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -217,3 +219,36 @@ func almostEqual(a, b float64, tolerance float64) bool {
 	diff := math.Abs(a - b)
 	return diff <= tolerance
 }
+
+func TestStatsPixelTypes(t *testing.T) {
+	values := []float64{9, 3, 100, 7, 1, 4}
+	for _, pixelType := range []int{
+		PixelTypeUInt8, PixelTypeInt8, PixelTypeUInt16, PixelTypeInt16, PixelTypeUInt32,
+		PixelTypeInt32, PixelTypeUInt64, PixelTypeInt64, PixelTypeFloat32, PixelTypeFloat64,
+	} {
+		t.Run(fmt.Sprintf("pixel type %d", pixelType), func(t *testing.T) {
+			img, err := NewImage([]uint32{3, 2}, pixelType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, value := range values {
+				img.setLinearPixelFromFloat64(i, value)
+			}
+			if value, _ := getValueAsPixelType(img.Min(), PixelTypeFloat64); value != 1.0 {
+				t.Errorf("expected min 1, got %v", img.Min())
+			}
+			if value, _ := getValueAsPixelType(img.Max(), PixelTypeFloat64); value != 100.0 {
+				t.Errorf("expected max 100, got %v", img.Max())
+			}
+			if value, _ := getValueAsPixelType(img.Sum(), PixelTypeFloat64); value != 124.0 {
+				t.Errorf("expected sum 124, got %v", img.Sum())
+			}
+			if median := img.Median(); median != 5.5 {
+				t.Errorf("expected median 5.5, got %v", median)
+			}
+			if percentile := img.Percentile(0.1); percentile != 2 {
+				t.Errorf("expected 10th percentile 2, got %v", percentile)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package imagetk
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// BinaryThreshold returns a mask that is inside where lower <= v <= upper and
+// outside elsewhere.
+//
+// Parameters:
+//   - image: The input image
+//   - lower: The smallest intensity inside the range
+//   - upper: The largest intensity inside the range
+//   - inside: The mask value for intensities in [lower, upper]
+//   - outside: The mask value for other intensities, including NaN
+//
+// Returns:
+//   - *Image: A UInt8 mask with the geometry and metadata of the input
+//   - error: Error if lower > upper or the image is complex
+func BinaryThreshold(image *Image, lower, upper float64, inside, outside uint8) (*Image, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	if lower > upper {
+		return nil, fmt.Errorf("invalid threshold range: [%g, %g]", lower, upper)
+	}
+	return mapIntensities(image, PixelTypeUInt8, func(v float64) float64 {
+		if v >= lower && v <= upper {
+			return float64(inside)
+		}
+		return float64(outside)
+	})
+}
+
+// OtsuThresholdImage segments an image with the threshold of OtsuThreshold.
+//
+// Parameters:
+//   - image: The input image
+//
+// Returns:
+//   - *Image: A UInt8 mask that is 1 above the threshold and 0 elsewhere
+//   - error: Error if the image is complex
+func OtsuThresholdImage(image *Image) (*Image, error) {
+	return AutoThresholdImage(image, ThresholdOtsu, ThresholdOptions{})
+}
+
+// Threshold classifies intensities by a list of increasing cutoffs into a
+// label map: intensities below thresholds[0] get label 0, intensities in
+// [thresholds[i-1], thresholds[i]) get label i, and intensities at or above
+// the last cutoff get label len(thresholds). MultiOtsuThresholds returns
+// cutoffs of this form.
+//
+// Parameters:
+//   - image: The input image
+//   - thresholds: The cutoffs between the classes, in increasing order
+//
+// Returns:
+//   - *Image: A UInt8 label map, or UInt16 for more than 255 cutoffs, with the geometry and metadata of the input
+//   - error: Error if no cutoffs are given, they are not increasing or the image is complex
+//
+// NaN intensities get label 0.
+func Threshold(image *Image, thresholds []float64) (*Image, error) {
+	if err := requireRealImage(image); err != nil {
+		return nil, err
+	}
+	if len(thresholds) == 0 {
+		return nil, fmt.Errorf("no thresholds given")
+	}
+	if len(thresholds) > math.MaxUint16 {
+		return nil, fmt.Errorf("too many thresholds: %d", len(thresholds))
+	}
+	for i, t := range thresholds {
+		if math.IsNaN(t) || (i > 0 && t <= thresholds[i-1]) {
+			return nil, fmt.Errorf("thresholds must be increasing, got %v", thresholds)
+		}
+	}
+	pixelType := PixelTypeUInt8
+	if len(thresholds) > math.MaxUint8 {
+		pixelType = PixelTypeUInt16
+	}
+	return mapIntensities(image, pixelType, func(v float64) float64 {
+		if math.IsNaN(v) {
+			return 0
+		}
+		// The label is the number of cutoffs at or below v.
+		return float64(sort.Search(len(thresholds), func(i int) bool { return thresholds[i] > v }))
+	})
+}
@@ -0,0 +1,113 @@
+package imagetk
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBinaryThreshold(t *testing.T) {
+	img, err := GetImageFromArray([][]float32{{-5, 0, 2.5}, {10, float32(math.NaN()), 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.SetOrigin([]float64{3, 4})
+
+	tests := []struct {
+		name            string
+		lower, upper    float64
+		inside, outside uint8
+		want            []uint8
+	}{
+		{"range", 0, 7, 1, 0, []uint8{0, 1, 1, 0, 0, 1}},
+		{"inverted values", 0, 7, 0, 255, []uint8{255, 0, 0, 255, 255, 0}},
+		{"single value", 10, 10, 1, 0, []uint8{0, 0, 0, 1, 0, 0}},
+		{"open range", math.Inf(-1), 1, 2, 0, []uint8{2, 2, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mask, err := BinaryThreshold(img, tt.lower, tt.upper, tt.inside, tt.outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mask.GetPixelType() != PixelTypeUInt8 || !reflect.DeepEqual(mask.GetOrigin(), img.GetOrigin()) {
+				t.Fatalf("expected a UInt8 mask with the input geometry")
+			}
+			if !reflect.DeepEqual(mask.pixels, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, mask.pixels)
+			}
+		})
+	}
+
+	if _, err := BinaryThreshold(img, 2, 1, 1, 0); err == nil {
+		t.Errorf("expected error for an inverted range")
+	}
+}
+
+func TestOtsuThresholdImage(t *testing.T) {
+	img, err := NewImage([]uint32{16, 16}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range img.pixels {
+		if i%16 < 8 {
+			img.pixels[i] = uint8(10 + i%3)
+		} else {
+			img.pixels[i] = uint8(251 + i%5)
+		}
+	}
+	mask, err := OtsuThresholdImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range mask.pixels {
+		want := uint8(0)
+		if i%16 >= 8 {
+			want = 1
+		}
+		if value != want {
+			t.Fatalf("pixel %d: expected %d, got %d", i, want, value)
+		}
+	}
+	if _, err := OtsuThresholdImage(newComplexTestImage(t)); err == nil {
+		t.Errorf("expected error for a complex image")
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	img, err := GetImageFromArray([][]int16{{-1000, -100, -50}, {0, 40, 400}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels, err := Threshold(img, []float64{-500, -50, 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint8{0, 1, 2, 2, 2, 3}; !reflect.DeepEqual(labels.pixels, want) {
+		t.Errorf("expected %v, got %v", want, labels.pixels)
+	}
+
+	cutoffs := make([]float64, 300)
+	for i := range cutoffs {
+		cutoffs[i] = float64(i) - 1000
+	}
+	labels, err = Threshold(img, cutoffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels.GetPixelType() != PixelTypeUInt16 {
+		t.Fatalf("expected a UInt16 label map for 300 cutoffs, got pixel type %d", labels.GetPixelType())
+	}
+	if value, _ := labels.GetPixel([]uint32{0, 0}); value != uint16(1) {
+		t.Errorf("expected label 1, got %v", value)
+	}
+	if value, _ := labels.GetPixel([]uint32{2, 1}); value != uint16(300) {
+		t.Errorf("expected label 300, got %v", value)
+	}
+
+	for _, thresholds := range [][]float64{nil, {1, 1}, {2, 1}, {math.NaN()}} {
+		if _, err := Threshold(img, thresholds); err == nil {
+			t.Errorf("expected error for thresholds %v", thresholds)
+		}
+	}
+}
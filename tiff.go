@@ -0,0 +1,859 @@
+package imagetk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	tiffTagNewSubfileType            = 254
+	tiffTagImageWidth                = 256
+	tiffTagImageLength               = 257
+	tiffTagBitsPerSample             = 258
+	tiffTagCompression               = 259
+	tiffTagPhotometricInterpretation = 262
+	tiffTagImageDescription          = 270
+	tiffTagStripOffsets              = 273
+	tiffTagSamplesPerPixel           = 277
+	tiffTagRowsPerStrip              = 278
+	tiffTagStripByteCounts           = 279
+	tiffTagXResolution               = 282
+	tiffTagYResolution               = 283
+	tiffTagPlanarConfiguration       = 284
+	tiffTagResolutionUnit            = 296
+	tiffTagPredictor                 = 317
+	tiffTagTileWidth                 = 322
+	tiffTagTileLength                = 323
+	tiffTagTileOffsets               = 324
+	tiffTagTileByteCounts            = 325
+	tiffTagSampleFormat              = 339
+)
+
+const (
+	tiffCompressionNone         = 1
+	tiffCompressionLZW          = 5
+	tiffCompressionAdobeDeflate = 8
+	tiffCompressionDeflate      = 32946
+)
+
+const (
+	tiffTypeByte     = 1
+	tiffTypeASCII    = 2
+	tiffTypeShort    = 3
+	tiffTypeLong     = 4
+	tiffTypeRational = 5
+	tiffTypeLong8    = 16
+	tiffSampleUInt   = 1
+	tiffSampleInt    = 2
+	tiffSampleIEEE   = 3
+)
+
+// tiffTypeSizes holds the byte size of each TIFF field type.
+var tiffTypeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4, 16: 8, 17: 8, 18: 8,
+}
+
+// tiffEntry is a single IFD entry with its value bytes resolved.
+type tiffEntry struct {
+	fieldType uint16
+	count     uint64
+	value     []byte
+}
+
+// tiffIFD holds the entries of one image file directory.
+type tiffIFD struct {
+	entries map[uint16]tiffEntry
+	order   binary.ByteOrder
+}
+
+func readImageTypeTIFF(filename string) (*Image, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open TIFF file: %v", err)
+	}
+	ifds, order, err := parseTIFF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reduced resolution pages such as thumbnails and pyramid levels are skipped.
+	var pages []*tiffIFD
+	for _, ifd := range ifds {
+		if ifd.getUint(tiffTagNewSubfileType, 0)&1 == 0 {
+			pages = append(pages, ifd)
+		}
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("TIFF file has no images")
+	}
+
+	first := pages[0]
+	width := first.getUint(tiffTagImageWidth, 0)
+	height := first.getUint(tiffTagImageLength, 0)
+	pixelType, err := first.getPixelType()
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range pages[1:] {
+		pagePixelType, err := page.getPixelType()
+		if err != nil {
+			return nil, err
+		}
+		if page.getUint(tiffTagImageWidth, 0) != width || page.getUint(tiffTagImageLength, 0) != height || pagePixelType != pixelType {
+			return nil, fmt.Errorf("TIFF pages have different sizes or pixel types")
+		}
+	}
+	if width == 0 || height == 0 || width > math.MaxUint32 || height > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid TIFF image size: %dx%d", width, height)
+	}
+
+	size := []uint32{uint32(width), uint32(height)}
+	if len(pages) > 1 {
+		size = append(size, uint32(len(pages)))
+	}
+	img, err := NewImage(size, pixelType)
+	if err != nil {
+		return nil, err
+	}
+
+	pageBytes := int(width) * int(height) * img.bytesPerPixel
+	for k, page := range pages {
+		if err := page.decodePage(data, img.pixels[k*pageBytes:(k+1)*pageBytes], img.bytesPerPixel); err != nil {
+			return nil, err
+		}
+	}
+	if order == binary.BigEndian {
+		img.swapPixelBytes(img.pixels)
+	}
+
+	spacing, err := getTIFFSpacing(first, len(size))
+	if err != nil {
+		return nil, err
+	}
+	if err := img.SetSpacing(spacing); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// parseTIFF decodes the header and the chain of IFDs of a classic TIFF or BigTIFF file.
+func parseTIFF(data []byte) ([]*tiffIFD, binary.ByteOrder, error) {
+	if len(data) < 8 {
+		return nil, nil, fmt.Errorf("not a TIFF file")
+	}
+	var order binary.ByteOrder
+	switch string(data[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, nil, fmt.Errorf("not a TIFF file")
+	}
+
+	var offset uint64
+	bigTIFF := false
+	switch order.Uint16(data[2:]) {
+	case 42:
+		offset = uint64(order.Uint32(data[4:]))
+	case 43:
+		if len(data) < 16 || order.Uint16(data[4:]) != 8 {
+			return nil, nil, fmt.Errorf("invalid BigTIFF header")
+		}
+		bigTIFF = true
+		offset = order.Uint64(data[8:])
+	default:
+		return nil, nil, fmt.Errorf("not a TIFF file")
+	}
+
+	var ifds []*tiffIFD
+	visited := make(map[uint64]bool)
+	for offset != 0 {
+		if visited[offset] {
+			return nil, nil, fmt.Errorf("TIFF IFD chain contains a loop")
+		}
+		visited[offset] = true
+		ifd, next, err := parseTIFFIFD(data, offset, order, bigTIFF)
+		if err != nil {
+			return nil, nil, err
+		}
+		ifds = append(ifds, ifd)
+		offset = next
+	}
+	return ifds, order, nil
+}
+
+func parseTIFFIFD(data []byte, offset uint64, order binary.ByteOrder, bigTIFF bool) (*tiffIFD, uint64, error) {
+	countSize, entrySize, valueSize := uint64(2), uint64(12), uint64(4)
+	if bigTIFF {
+		countSize, entrySize, valueSize = 8, 20, 8
+	}
+	if offset+countSize > uint64(len(data)) {
+		return nil, 0, fmt.Errorf("TIFF IFD offset out of range")
+	}
+	var numEntries uint64
+	if bigTIFF {
+		numEntries = order.Uint64(data[offset:])
+	} else {
+		numEntries = uint64(order.Uint16(data[offset:]))
+	}
+	end := offset + countSize + numEntries*entrySize
+	if numEntries > uint64(len(data)) || end+valueSize > uint64(len(data)) {
+		return nil, 0, fmt.Errorf("TIFF IFD is truncated")
+	}
+
+	ifd := &tiffIFD{entries: make(map[uint16]tiffEntry), order: order}
+	for i := uint64(0); i < numEntries; i++ {
+		p := offset + countSize + i*entrySize
+		tag := order.Uint16(data[p:])
+		fieldType := order.Uint16(data[p+2:])
+		var count uint64
+		if bigTIFF {
+			count = order.Uint64(data[p+4:])
+		} else {
+			count = uint64(order.Uint32(data[p+4:]))
+		}
+		typeSize, ok := tiffTypeSizes[fieldType]
+		if !ok {
+			continue
+		}
+		length := count * uint64(typeSize)
+		valueOffset := p + 8
+		if bigTIFF {
+			valueOffset = p + 12
+		}
+		if length > valueSize {
+			if bigTIFF {
+				valueOffset = order.Uint64(data[valueOffset:])
+			} else {
+				valueOffset = uint64(order.Uint32(data[valueOffset:]))
+			}
+		}
+		if count > uint64(len(data)) || valueOffset+length > uint64(len(data)) {
+			return nil, 0, fmt.Errorf("TIFF tag %d value out of range", tag)
+		}
+		ifd.entries[tag] = tiffEntry{fieldType: fieldType, count: count, value: data[valueOffset : valueOffset+length]}
+	}
+
+	var next uint64
+	if bigTIFF {
+		next = order.Uint64(data[end:])
+	} else {
+		next = uint64(order.Uint32(data[end:]))
+	}
+	return ifd, next, nil
+}
+
+// getUints returns the values of an integer field.
+func (ifd *tiffIFD) getUints(tag uint16) ([]uint64, bool) {
+	entry, ok := ifd.entries[tag]
+	if !ok {
+		return nil, false
+	}
+	values := make([]uint64, entry.count)
+	for i := range values {
+		switch entry.fieldType {
+		case tiffTypeByte:
+			values[i] = uint64(entry.value[i])
+		case tiffTypeShort:
+			values[i] = uint64(ifd.order.Uint16(entry.value[i*2:]))
+		case tiffTypeLong, 13:
+			values[i] = uint64(ifd.order.Uint32(entry.value[i*4:]))
+		case tiffTypeLong8, 18:
+			values[i] = ifd.order.Uint64(entry.value[i*8:])
+		default:
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// getUint returns the first value of an integer field, or defaultValue if it is missing.
+func (ifd *tiffIFD) getUint(tag uint16, defaultValue uint64) uint64 {
+	values, ok := ifd.getUints(tag)
+	if !ok || len(values) == 0 {
+		return defaultValue
+	}
+	return values[0]
+}
+
+func (ifd *tiffIFD) getRational(tag uint16) (float64, bool) {
+	entry, ok := ifd.entries[tag]
+	if !ok || entry.fieldType != tiffTypeRational || entry.count == 0 {
+		return 0, false
+	}
+	numerator := ifd.order.Uint32(entry.value)
+	denominator := ifd.order.Uint32(entry.value[4:])
+	if numerator == 0 || denominator == 0 {
+		return 0, false
+	}
+	return float64(numerator) / float64(denominator), true
+}
+
+func (ifd *tiffIFD) getString(tag uint16) string {
+	entry, ok := ifd.entries[tag]
+	if !ok || entry.fieldType != tiffTypeASCII {
+		return ""
+	}
+	return strings.TrimRight(string(entry.value), "\x00")
+}
+
+// getPixelType returns the pixel type of a single sample per pixel page.
+func (ifd *tiffIFD) getPixelType() (int, error) {
+	if samples := ifd.getUint(tiffTagSamplesPerPixel, 1); samples != 1 {
+		return PixelTypeUnknown, fmt.Errorf("unsupported TIFF samples per pixel: %d", samples)
+	}
+	bits := ifd.getUint(tiffTagBitsPerSample, 1)
+	format := ifd.getUint(tiffTagSampleFormat, tiffSampleUInt)
+	switch {
+	case format == tiffSampleUInt && bits == 8:
+		return PixelTypeUInt8, nil
+	case format == tiffSampleInt && bits == 8:
+		return PixelTypeInt8, nil
+	case format == tiffSampleUInt && bits == 16:
+		return PixelTypeUInt16, nil
+	case format == tiffSampleInt && bits == 16:
+		return PixelTypeInt16, nil
+	case format == tiffSampleUInt && bits == 32:
+		return PixelTypeUInt32, nil
+	case format == tiffSampleInt && bits == 32:
+		return PixelTypeInt32, nil
+	case format == tiffSampleUInt && bits == 64:
+		return PixelTypeUInt64, nil
+	case format == tiffSampleInt && bits == 64:
+		return PixelTypeInt64, nil
+	case format == tiffSampleIEEE && bits == 32:
+		return PixelTypeFloat32, nil
+	case format == tiffSampleIEEE && bits == 64:
+		return PixelTypeFloat64, nil
+	default:
+		return PixelTypeUnknown, fmt.Errorf("unsupported TIFF sample format %d with %d bits", format, bits)
+	}
+}
+
+// decodePage decompresses the strips or tiles of a page into dst, which holds
+// the page pixels in file byte order.
+func (ifd *tiffIFD) decodePage(data []byte, dst []byte, bytesPerSample int) error {
+	width := int(ifd.getUint(tiffTagImageWidth, 0))
+	height := int(ifd.getUint(tiffTagImageLength, 0))
+	compression := ifd.getUint(tiffTagCompression, tiffCompressionNone)
+	predictor := ifd.getUint(tiffTagPredictor, 1)
+	if predictor != 1 && predictor != 2 {
+		return fmt.Errorf("unsupported TIFF predictor: %d", predictor)
+	}
+
+	// Strips are handled as tiles spanning the full image width.
+	tileWidth := int(ifd.getUint(tiffTagTileWidth, 0))
+	tileHeight := int(ifd.getUint(tiffTagTileLength, 0))
+	offsets, ok := ifd.getUints(tiffTagTileOffsets)
+	byteCounts, _ := ifd.getUints(tiffTagTileByteCounts)
+	if !ok {
+		tileWidth = width
+		tileHeight = int(ifd.getUint(tiffTagRowsPerStrip, uint64(height)))
+		if tileHeight <= 0 || tileHeight > height {
+			tileHeight = height
+		}
+		offsets, ok = ifd.getUints(tiffTagStripOffsets)
+		byteCounts, _ = ifd.getUints(tiffTagStripByteCounts)
+		if !ok {
+			return fmt.Errorf("TIFF page has no strip or tile offsets")
+		}
+	}
+	if tileWidth <= 0 || tileHeight <= 0 {
+		return fmt.Errorf("invalid TIFF tile size: %dx%d", tileWidth, tileHeight)
+	}
+	tilesAcross := (width + tileWidth - 1) / tileWidth
+	tilesDown := (height + tileHeight - 1) / tileHeight
+	if len(offsets) < tilesAcross*tilesDown || len(byteCounts) < len(offsets) {
+		return fmt.Errorf("TIFF page has %d strips or tiles, expected %d", len(offsets), tilesAcross*tilesDown)
+	}
+
+	tileRowBytes := tileWidth * bytesPerSample
+	rowBytes := width * bytesPerSample
+	for ty := 0; ty < tilesDown; ty++ {
+		for tx := 0; tx < tilesAcross; tx++ {
+			i := ty*tilesAcross + tx
+			if offsets[i]+byteCounts[i] > uint64(len(data)) {
+				return fmt.Errorf("TIFF strip or tile out of range")
+			}
+			rows := min(tileHeight, height-ty*tileHeight)
+			if tileWidth != width {
+				// Tiles are always stored at full size, padded at the image edges.
+				rows = tileHeight
+			}
+			tile, err := decodeTIFFData(data[offsets[i]:offsets[i]+byteCounts[i]], compression, rows*tileRowBytes)
+			if err != nil {
+				return err
+			}
+			if len(tile) < rows*tileRowBytes {
+				return fmt.Errorf("TIFF strip or tile is truncated: expected %d bytes, got %d", rows*tileRowBytes, len(tile))
+			}
+			if predictor == 2 {
+				undoTIFFPredictor(tile[:rows*tileRowBytes], tileRowBytes, bytesPerSample, ifd.order)
+			}
+
+			copyBytes := min(tileRowBytes, rowBytes-tx*tileRowBytes)
+			for y := 0; y < rows && ty*tileHeight+y < height; y++ {
+				start := (ty*tileHeight+y)*rowBytes + tx*tileRowBytes
+				copy(dst[start:start+copyBytes], tile[y*tileRowBytes:])
+			}
+		}
+	}
+	return nil
+}
+
+func decodeTIFFData(data []byte, compression uint64, expectedSize int) ([]byte, error) {
+	switch compression {
+	case tiffCompressionNone:
+		return data, nil
+	case tiffCompressionLZW:
+		return decodeTIFFLZW(data, expectedSize)
+	case tiffCompressionAdobeDeflate, tiffCompressionDeflate:
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress TIFF data: %v", err)
+		}
+		defer reader.Close()
+		decoded, err := io.ReadAll(io.LimitReader(reader, int64(expectedSize)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress TIFF data: %v", err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unsupported TIFF compression: %d", compression)
+	}
+}
+
+// decodeTIFFLZW decodes TIFF LZW data: MSB-first codes of 9 to 12 bits where
+// the code width grows one code early.
+func decodeTIFFLZW(src []byte, expectedSize int) ([]byte, error) {
+	const clearCode, endCode = 256, 257
+	out := make([]byte, 0, expectedSize)
+	table := make([][]byte, 258, 4096)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+
+	width := 9
+	var prev []byte
+	for bitPos := 0; bitPos+width <= len(src)*8 && len(out) < expectedSize; {
+		code := 0
+		for i := 0; i < width; i++ {
+			bit := (src[(bitPos+i)/8] >> (7 - uint((bitPos+i)%8))) & 1
+			code = code<<1 | int(bit)
+		}
+		bitPos += width
+
+		if code == endCode {
+			break
+		}
+		if code == clearCode {
+			table = table[:258]
+			width = 9
+			prev = nil
+			continue
+		}
+
+		var entry []byte
+		switch {
+		case code < len(table) && (code < 256 || code > endCode):
+			entry = table[code]
+		case code == len(table) && prev != nil:
+			entry = append(prev[:len(prev):len(prev)], prev[0])
+		default:
+			return nil, fmt.Errorf("invalid TIFF LZW code: %d", code)
+		}
+		out = append(out, entry...)
+		if prev != nil && len(table) < 4096 {
+			table = append(table, append(prev[:len(prev):len(prev)], entry[0]))
+		}
+		prev = entry
+		if len(table) >= 1<<width-1 && width < 12 {
+			width++
+		}
+	}
+	return out, nil
+}
+
+// undoTIFFPredictor reverses horizontal differencing row by row.
+func undoTIFFPredictor(data []byte, rowBytes int, bytesPerSample int, order binary.ByteOrder) {
+	for row := 0; row+rowBytes <= len(data); row += rowBytes {
+		line := data[row : row+rowBytes]
+		for i := bytesPerSample; i+bytesPerSample <= len(line); i += bytesPerSample {
+			switch bytesPerSample {
+			case 1:
+				line[i] += line[i-1]
+			case 2:
+				order.PutUint16(line[i:], order.Uint16(line[i:])+order.Uint16(line[i-2:]))
+			case 4:
+				order.PutUint32(line[i:], order.Uint32(line[i:])+order.Uint32(line[i-4:]))
+			case 8:
+				order.PutUint64(line[i:], order.Uint64(line[i:])+order.Uint64(line[i-8:]))
+			}
+		}
+	}
+}
+
+// omeXML holds the parts of the OME-XML metadata used for the image geometry.
+type omeXML struct {
+	Images []struct {
+		Pixels struct {
+			SizeC             string `xml:"SizeC,attr"`
+			SizeT             string `xml:"SizeT,attr"`
+			PhysicalSizeX     string `xml:"PhysicalSizeX,attr"`
+			PhysicalSizeXUnit string `xml:"PhysicalSizeXUnit,attr"`
+			PhysicalSizeY     string `xml:"PhysicalSizeY,attr"`
+			PhysicalSizeYUnit string `xml:"PhysicalSizeYUnit,attr"`
+			PhysicalSizeZ     string `xml:"PhysicalSizeZ,attr"`
+			PhysicalSizeZUnit string `xml:"PhysicalSizeZUnit,attr"`
+		} `xml:"Pixels"`
+	} `xml:"Image"`
+}
+
+// getTIFFLengthScale returns the factor converting a length unit to millimetres.
+func getTIFFLengthScale(unit string) (float64, bool) {
+	switch unit {
+	case "", "µm", "μm", "um", "micron", "microns":
+		return 1e-3, true
+	case "nm":
+		return 1e-6, true
+	case "mm":
+		return 1, true
+	case "cm":
+		return 10, true
+	case "m":
+		return 1000, true
+	case "inch":
+		return 25.4, true
+	default:
+		return 0, false
+	}
+}
+
+// getTIFFSpacing returns the pixel spacing in millimetres from OME-XML or
+// ImageJ metadata, falling back to the resolution tags, or 1 if the file
+// gives no physical pixel size.
+func getTIFFSpacing(ifd *tiffIFD, dimension int) ([]float64, error) {
+	spacing := []float64{1, 1, 1}[:dimension]
+	description := ifd.getString(tiffTagImageDescription)
+
+	if strings.Contains(description, "<OME") {
+		var ome omeXML
+		if err := xml.Unmarshal([]byte(description), &ome); err != nil {
+			return nil, fmt.Errorf("failed to parse OME-XML: %v", err)
+		}
+		if len(ome.Images) > 1 {
+			return nil, fmt.Errorf("OME-TIFF files with multiple images are not supported")
+		}
+		if len(ome.Images) == 1 {
+			pixels := ome.Images[0].Pixels
+			for _, s := range []string{pixels.SizeC, pixels.SizeT} {
+				if s != "" && s != "1" {
+					return nil, fmt.Errorf("OME-TIFF images with multiple channels or time points are not supported")
+				}
+			}
+			sizes := []string{pixels.PhysicalSizeX, pixels.PhysicalSizeY, pixels.PhysicalSizeZ}
+			units := []string{pixels.PhysicalSizeXUnit, pixels.PhysicalSizeYUnit, pixels.PhysicalSizeZUnit}
+			for i := range spacing {
+				value, err := strconv.ParseFloat(sizes[i], 64)
+				scale, ok := getTIFFLengthScale(units[i])
+				if err == nil && ok && value > 0 {
+					spacing[i] = value * scale
+				}
+			}
+		}
+		return spacing, nil
+	}
+
+	// ImageJ stores the unit and slice spacing in the description and the
+	// pixel size as resolution in pixels per unit. Other files only give a
+	// pixel size when ResolutionUnit is present and is inch or centimetre;
+	// without it the resolution is usually a print setting such as 72 dpi.
+	resolutionScale := 0.0
+	switch ifd.getUint(tiffTagResolutionUnit, 1) {
+	case 2:
+		resolutionScale = 25.4
+	case 3:
+		resolutionScale = 10
+	}
+	if strings.HasPrefix(description, "ImageJ=") {
+		resolutionScale = 0
+		fields := make(map[string]string)
+		for _, line := range strings.Split(description, "\n") {
+			if key, value, ok := strings.Cut(line, "="); ok {
+				fields[key] = strings.TrimSpace(value)
+			}
+		}
+		if scale, ok := getTIFFLengthScale(fields["unit"]); ok && fields["unit"] != "" {
+			resolutionScale = scale
+			if value, err := strconv.ParseFloat(fields["spacing"], 64); err == nil && value > 0 && dimension == 3 {
+				spacing[2] = value * scale
+			}
+		}
+	}
+	if resolutionScale > 0 {
+		if resolution, ok := ifd.getRational(tiffTagXResolution); ok {
+			spacing[0] = resolutionScale / resolution
+		}
+		if resolution, ok := ifd.getRational(tiffTagYResolution); ok {
+			spacing[1] = resolutionScale / resolution
+		}
+	}
+	return spacing, nil
+}
+
+func getOMEPixelType(pixelType int) (string, error) {
+	switch pixelType {
+	case PixelTypeUInt8:
+		return "uint8", nil
+	case PixelTypeInt8:
+		return "int8", nil
+	case PixelTypeUInt16:
+		return "uint16", nil
+	case PixelTypeInt16:
+		return "int16", nil
+	case PixelTypeUInt32:
+		return "uint32", nil
+	case PixelTypeInt32:
+		return "int32", nil
+	case PixelTypeFloat32:
+		return "float", nil
+	case PixelTypeFloat64:
+		return "double", nil
+	default:
+		return "", fmt.Errorf("unsupported pixel type for OME-TIFF: %d", pixelType)
+	}
+}
+
+// saveImageTypeTIFF writes the image as an OME-TIFF file with one page per
+// slice. BigTIFF is used when the file would exceed the 4 GB offsets of classic
+// TIFF, leaving room for the header and IFDs after the pixel data. OME-TIFF
+// holds the spacing but not the origin or direction, so the origin is lost and
+// rotated images are rejected.
+func (img *Image) saveImageTypeTIFF(filename string, compressed bool) error {
+	bigTIFF := uint64(len(img.pixels))+1<<20 > math.MaxUint32
+	return img.writeTIFF(filename, compressed, bigTIFF)
+}
+
+func (img *Image) writeTIFF(filename string, compressed bool, bigTIFF bool) error {
+	if img.direction != [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1} {
+		return fmt.Errorf("TIFF files cannot hold the image direction %v", img.direction)
+	}
+	omeType, err := getOMEPixelType(img.pixelType)
+	if err != nil {
+		return err
+	}
+	size := img.GetSize()
+	numPages := 1
+	if img.dimension == 3 {
+		numPages = int(size[2])
+	}
+	sampleFormat := uint64(tiffSampleUInt)
+	switch img.pixelType {
+	case PixelTypeInt8, PixelTypeInt16, PixelTypeInt32:
+		sampleFormat = tiffSampleInt
+	case PixelTypeFloat32, PixelTypeFloat64:
+		sampleFormat = tiffSampleIEEE
+	}
+	compression := uint64(tiffCompressionNone)
+	if compressed {
+		compression = tiffCompressionAdobeDeflate
+	}
+
+	physicalSizes := ""
+	for i, axis := range []string{"X", "Y", "Z"}[:img.dimension] {
+		physicalSizes += fmt.Sprintf(` PhysicalSize%s="%g" PhysicalSize%sUnit="mm"`, axis, img.spacing[i], axis)
+	}
+	description := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>`+
+		`<OME xmlns="http://www.openmicroscopy.org/Schemas/OME/2016-06">`+
+		`<Image ID="Image:0"><Pixels ID="Pixels:0" DimensionOrder="XYZCT" Type="%s" SizeX="%d" SizeY="%d" SizeZ="%d" SizeC="1" SizeT="1"%s>`+
+		`<Channel ID="Channel:0:0" SamplesPerPixel="1"/><TiffData IFD="0" PlaneCount="%d"/></Pixels></Image></OME>`,
+		omeType, size[0], size[1], numPages, physicalSizes, numPages)
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create TIFF file: %v", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	// The pixel data of every page follows the header, then the IFDs.
+	headerSize := uint64(8)
+	if bigTIFF {
+		headerSize = 16
+	}
+	if _, err := writer.Write(make([]byte, headerSize)); err != nil {
+		return fmt.Errorf("failed to write TIFF file: %v", err)
+	}
+	offset := headerSize
+	pageBytes := len(img.pixels) / numPages
+	offsets := make([]uint64, numPages)
+	byteCounts := make([]uint64, numPages)
+	for k := 0; k < numPages; k++ {
+		page := img.pixels[k*pageBytes : (k+1)*pageBytes]
+		if compressed {
+			buffer := new(bytes.Buffer)
+			zw := zlib.NewWriter(buffer)
+			if _, err := zw.Write(page); err != nil {
+				return fmt.Errorf("failed to compress TIFF data: %v", err)
+			}
+			zw.Close()
+			page = buffer.Bytes()
+		}
+		if !bigTIFF && offset+uint64(len(page)) > math.MaxUint32 {
+			return fmt.Errorf("TIFF data exceeds 4 GB")
+		}
+		if _, err := writer.Write(page); err != nil {
+			return fmt.Errorf("failed to write TIFF file: %v", err)
+		}
+		offsets[k], byteCounts[k] = offset, uint64(len(page))
+		offset += uint64(len(page))
+		if offset%2 == 1 {
+			writer.WriteByte(0)
+			offset++
+		}
+	}
+
+	firstIFD := offset
+	for k := 0; k < numPages; k++ {
+		entries := []tiffWriteEntry{
+			{tiffTagImageWidth, tiffTypeLong, []uint64{uint64(size[0])}, ""},
+			{tiffTagImageLength, tiffTypeLong, []uint64{uint64(size[1])}, ""},
+			{tiffTagBitsPerSample, tiffTypeShort, []uint64{uint64(img.bytesPerPixel * 8)}, ""},
+			{tiffTagCompression, tiffTypeShort, []uint64{compression}, ""},
+			{tiffTagPhotometricInterpretation, tiffTypeShort, []uint64{1}, ""},
+			{tiffTagStripOffsets, tiffTypeLong, []uint64{offsets[k]}, ""},
+			{tiffTagSamplesPerPixel, tiffTypeShort, []uint64{1}, ""},
+			{tiffTagRowsPerStrip, tiffTypeLong, []uint64{uint64(size[1])}, ""},
+			{tiffTagStripByteCounts, tiffTypeLong, []uint64{byteCounts[k]}, ""},
+			{tiffTagPlanarConfiguration, tiffTypeShort, []uint64{1}, ""},
+			{tiffTagSampleFormat, tiffTypeShort, []uint64{sampleFormat}, ""},
+		}
+		if k == 0 {
+			entries = slices.Insert(entries, 5, tiffWriteEntry{tiffTagImageDescription, tiffTypeASCII, nil, description})
+		}
+		for i := range entries {
+			if bigTIFF && (entries[i].tag == tiffTagStripOffsets || entries[i].tag == tiffTagStripByteCounts) {
+				entries[i].fieldType = tiffTypeLong8
+			}
+		}
+
+		ifd := encodeTIFFIFD(entries, offset, 0, bigTIFF, binary.LittleEndian)
+		if k < numPages-1 {
+			ifd = encodeTIFFIFD(entries, offset, offset+uint64(len(ifd)), bigTIFF, binary.LittleEndian)
+		}
+		if !bigTIFF && offset+uint64(len(ifd)) > math.MaxUint32 {
+			return fmt.Errorf("TIFF data exceeds 4 GB")
+		}
+		if _, err := writer.Write(ifd); err != nil {
+			return fmt.Errorf("failed to write TIFF file: %v", err)
+		}
+		offset += uint64(len(ifd))
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write TIFF file: %v", err)
+	}
+
+	header := []byte("II")
+	if bigTIFF {
+		header = binary.LittleEndian.AppendUint16(header, 43)
+		header = binary.LittleEndian.AppendUint16(header, 8)
+		header = binary.LittleEndian.AppendUint16(header, 0)
+		header = binary.LittleEndian.AppendUint64(header, firstIFD)
+	} else {
+		header = binary.LittleEndian.AppendUint16(header, 42)
+		header = binary.LittleEndian.AppendUint32(header, uint32(firstIFD))
+	}
+	if _, err := file.WriteAt(header, 0); err != nil {
+		return fmt.Errorf("failed to write TIFF file: %v", err)
+	}
+	return nil
+}
+
+// tiffWriteEntry is an IFD entry to encode, holding either integer values or text.
+type tiffWriteEntry struct {
+	tag       uint16
+	fieldType uint16
+	values    []uint64
+	text      string
+}
+
+// encodeTIFFIFD encodes an IFD located at offset, with values that do not fit
+// in an entry stored directly after it. The length of the result does not
+// depend on the offsets. Rational values are given as numerator, denominator pairs.
+func encodeTIFFIFD(entries []tiffWriteEntry, offset uint64, next uint64, bigTIFF bool, order binary.AppendByteOrder) []byte {
+	countSize, entrySize, valueSize := 2, 12, 4
+	if bigTIFF {
+		countSize, entrySize, valueSize = 8, 20, 8
+	}
+	ifd := make([]byte, 0, countSize+len(entries)*entrySize+valueSize)
+	if bigTIFF {
+		ifd = order.AppendUint64(ifd, uint64(len(entries)))
+	} else {
+		ifd = order.AppendUint16(ifd, uint16(len(entries)))
+	}
+	extra := []byte{}
+	extraOffset := offset + uint64(countSize+len(entries)*entrySize+valueSize)
+
+	for _, entry := range entries {
+		var value []byte
+		count := uint64(len(entry.values))
+		if entry.fieldType == tiffTypeRational {
+			count /= 2
+		}
+		if entry.fieldType == tiffTypeASCII {
+			value = append([]byte(entry.text), 0)
+			count = uint64(len(value))
+		}
+		for _, v := range entry.values {
+			switch entry.fieldType {
+			case tiffTypeShort:
+				value = order.AppendUint16(value, uint16(v))
+			case tiffTypeLong, tiffTypeRational:
+				value = order.AppendUint32(value, uint32(v))
+			case tiffTypeLong8:
+				value = order.AppendUint64(value, v)
+			}
+		}
+
+		ifd = order.AppendUint16(ifd, entry.tag)
+		ifd = order.AppendUint16(ifd, entry.fieldType)
+		if bigTIFF {
+			ifd = order.AppendUint64(ifd, count)
+		} else {
+			ifd = order.AppendUint32(ifd, uint32(count))
+		}
+		if len(value) <= valueSize {
+			ifd = append(ifd, value...)
+			ifd = append(ifd, make([]byte, valueSize-len(value))...)
+			continue
+		}
+		location := extraOffset + uint64(len(extra))
+		if bigTIFF {
+			ifd = order.AppendUint64(ifd, location)
+		} else {
+			ifd = order.AppendUint32(ifd, uint32(location))
+		}
+		extra = append(extra, value...)
+		if len(extra)%2 == 1 {
+			extra = append(extra, 0)
+		}
+	}
+
+	if bigTIFF {
+		ifd = order.AppendUint64(ifd, next)
+	} else {
+		ifd = order.AppendUint32(ifd, uint32(next))
+	}
+	return append(ifd, extra...)
+}
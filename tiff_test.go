@@ -0,0 +1,341 @@
+package imagetk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTIFFRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	floatImg, err := NewImage([]uint32{5, 4}, PixelTypeFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(floatImg.NumPixels()); i++ {
+		floatImg.setLinearPixelFromFloat64(i, float64(i)*1.5-3)
+	}
+	floatImg.SetSpacing([]float64{0.002, 0.003})
+	// TIFF files hold the spacing but not the origin or direction.
+	volume := newNIfTITestImage(t)
+	volume.SetDirection([9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1})
+
+	tests := []struct {
+		name       string
+		img        *Image
+		compressed bool
+		bigTIFF    bool
+	}{
+		{name: "int16", img: volume},
+		{name: "int16 deflate", img: volume, compressed: true},
+		{name: "int16 bigtiff", img: volume, bigTIFF: true},
+		{name: "float32 2d", img: floatImg},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, "test.ome.tif")
+			if err := tt.img.writeTIFF(filename, tt.compressed, tt.bigTIFF); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			readImg, err := ReadImage(filename, ImageTypeTIFF, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if readImg.GetPixelType() != tt.img.GetPixelType() || readImg.GetDimension() != tt.img.GetDimension() {
+				t.Fatalf("expected pixel type %d dimension %d, got %d and %d", tt.img.GetPixelType(), tt.img.GetDimension(), readImg.GetPixelType(), readImg.GetDimension())
+			}
+			for i := range tt.img.GetSize() {
+				if readImg.GetSize()[i] != tt.img.GetSize()[i] || !almostEqual(readImg.GetSpacing()[i], tt.img.GetSpacing()[i], 1e-12) {
+					t.Fatalf("geometry mismatch: got size %v spacing %v", readImg.GetSize(), readImg.GetSpacing())
+				}
+				if readImg.GetOrigin()[i] != 0 {
+					t.Errorf("expected zero origin, got %v", readImg.GetOrigin())
+				}
+			}
+			if readImg.GetDirection() != tt.img.GetDirection() {
+				t.Errorf("expected direction %v, got %v", tt.img.GetDirection(), readImg.GetDirection())
+			}
+			if !bytes.Equal(readImg.pixels, tt.img.pixels) {
+				t.Errorf("pixel data mismatch")
+			}
+		})
+	}
+
+	if err := WriteImageCompressed(volume, filepath.Join(tempDir, "test.tif"), ImageTypeTIFF); err != nil {
+		t.Errorf("failed to write image: %v", err)
+	}
+	if err := WriteImage(newNIfTITestImage(t), filepath.Join(tempDir, "rotated.tif"), ImageTypeTIFF); err == nil {
+		t.Errorf("expected error for a rotated image")
+	}
+}
+
+// encodeTestTIFFLZW encodes data with TIFF LZW, growing the code width one
+// code late in the encoder so the decoder's early change matches.
+func encodeTestTIFFLZW(data []byte) []byte {
+	var out []byte
+	var acc uint64
+	bits, width := 0, 9
+	emit := func(code int) {
+		acc = acc<<uint(width) | uint64(code)
+		bits += width
+		for bits >= 8 {
+			out = append(out, byte(acc>>uint(bits-8)))
+			bits -= 8
+		}
+	}
+	table := make(map[string]int)
+	for i := 0; i < 256; i++ {
+		table[string([]byte{byte(i)})] = i
+	}
+	next := 258
+	emit(256)
+	w := ""
+	for _, c := range data {
+		wc := w + string([]byte{c})
+		if _, ok := table[wc]; ok {
+			w = wc
+			continue
+		}
+		emit(table[w])
+		table[wc] = next
+		next++
+		if next >= 1<<width && width < 12 {
+			width++
+		}
+		w = string([]byte{c})
+	}
+	emit(table[w])
+	next++
+	if next >= 1<<width && width < 12 {
+		width++
+	}
+	emit(257)
+	if bits > 0 {
+		out = append(out, byte(acc<<uint(8-bits)))
+	}
+	return out
+}
+
+func TestReadTIFFEncodings(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A 40x15 16-bit image with enough repetition to exercise LZW table growth.
+	const width, height = 40, 15
+	values := make([]uint16, width*height)
+	for i := range values {
+		values[i] = uint16((i%width)*(i/width)%97) + uint16(i%3)*1000
+	}
+	expected := new(bytes.Buffer)
+	binary.Write(expected, binary.LittleEndian, values)
+
+	tests := []struct {
+		name        string
+		order       binary.ByteOrder
+		compression uint64
+		predictor   uint64
+		tile        int
+	}{
+		{name: "big endian strips", order: binary.BigEndian, compression: tiffCompressionNone, predictor: 1},
+		{name: "lzw predictor strips", order: binary.LittleEndian, compression: tiffCompressionLZW, predictor: 2},
+		{name: "lzw big endian strips", order: binary.BigEndian, compression: tiffCompressionLZW, predictor: 1},
+		{name: "deflate tiles", order: binary.LittleEndian, compression: tiffCompressionDeflate, predictor: 2, tile: 16},
+		{name: "uncompressed tiles", order: binary.BigEndian, compression: tiffCompressionNone, predictor: 1, tile: 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunkWidth, chunkHeight := width, 4
+			if tt.tile > 0 {
+				chunkWidth, chunkHeight = tt.tile, tt.tile
+			}
+			var chunks [][]byte
+			for y0 := 0; y0 < height; y0 += chunkHeight {
+				for x0 := 0; x0 < width; x0 += chunkWidth {
+					rows := chunkHeight
+					if tt.tile == 0 {
+						rows = min(chunkHeight, height-y0)
+					}
+					chunk := make([]uint16, chunkWidth*rows)
+					for y := 0; y < rows; y++ {
+						for x := chunkWidth - 1; x >= 0; x-- {
+							if x0+x < width && y0+y < height {
+								chunk[y*chunkWidth+x] = values[(y0+y)*width+x0+x]
+							}
+							if tt.predictor == 2 && x > 0 && x0+x < width && y0+y < height {
+								chunk[y*chunkWidth+x] -= values[(y0+y)*width+x0+x-1]
+							}
+						}
+					}
+					raw := new(bytes.Buffer)
+					binary.Write(raw, tt.order, chunk)
+					data := raw.Bytes()
+					switch tt.compression {
+					case tiffCompressionLZW:
+						data = encodeTestTIFFLZW(data)
+					case tiffCompressionDeflate:
+						compressed := new(bytes.Buffer)
+						zw := zlib.NewWriter(compressed)
+						zw.Write(data)
+						zw.Close()
+						data = compressed.Bytes()
+					}
+					chunks = append(chunks, data)
+				}
+			}
+
+			entries := []tiffWriteEntry{
+				{tiffTagImageWidth, tiffTypeShort, []uint64{width}, ""},
+				{tiffTagImageLength, tiffTypeShort, []uint64{height}, ""},
+				{tiffTagBitsPerSample, tiffTypeShort, []uint64{16}, ""},
+				{tiffTagCompression, tiffTypeShort, []uint64{tt.compression}, ""},
+				{tiffTagImageDescription, tiffTypeASCII, nil, "ImageJ=1.54f\nunit=micron\n"},
+				{tiffTagXResolution, tiffTypeRational, []uint64{2, 1}, ""},
+				{tiffTagYResolution, tiffTypeRational, []uint64{4, 1}, ""},
+				{tiffTagPredictor, tiffTypeShort, []uint64{tt.predictor}, ""},
+			}
+			offsetsTag, countsTag := uint16(tiffTagStripOffsets), uint16(tiffTagStripByteCounts)
+			if tt.tile > 0 {
+				offsetsTag, countsTag = tiffTagTileOffsets, tiffTagTileByteCounts
+				entries = append(entries,
+					tiffWriteEntry{tiffTagTileWidth, tiffTypeShort, []uint64{uint64(tt.tile)}, ""},
+					tiffWriteEntry{tiffTagTileLength, tiffTypeShort, []uint64{uint64(tt.tile)}, ""})
+			} else {
+				entries = append(entries, tiffWriteEntry{tiffTagRowsPerStrip, tiffTypeShort, []uint64{uint64(chunkHeight)}, ""})
+			}
+
+			file := make([]byte, 8)
+			var offsets, counts []uint64
+			for _, chunk := range chunks {
+				offsets = append(offsets, uint64(len(file)))
+				counts = append(counts, uint64(len(chunk)))
+				file = append(file, chunk...)
+			}
+			if len(file)%2 == 1 {
+				file = append(file, 0)
+			}
+			entries = append(entries,
+				tiffWriteEntry{offsetsTag, tiffTypeLong, offsets, ""},
+				tiffWriteEntry{countsTag, tiffTypeLong, counts, ""})
+			sortTIFFWriteEntries(entries)
+			ifdOffset := uint64(len(file))
+			file = append(file, encodeTIFFIFD(entries, ifdOffset, 0, false, tt.order.(binary.AppendByteOrder))...)
+			if tt.order == binary.BigEndian {
+				copy(file, "MM")
+			} else {
+				copy(file, "II")
+			}
+			tt.order.PutUint16(file[2:], 42)
+			tt.order.PutUint32(file[4:], uint32(ifdOffset))
+
+			filename := filepath.Join(tempDir, "test.tif")
+			if err := os.WriteFile(filename, file, 0644); err != nil {
+				t.Fatal(err)
+			}
+			img, err := ReadImage(filename, ImageTypeTIFF, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if img.GetPixelType() != PixelTypeUInt16 || img.GetDimension() != 2 {
+				t.Fatalf("expected 2D uint16 image, got pixel type %d dimension %d", img.GetPixelType(), img.GetDimension())
+			}
+			if spacing := img.GetSpacing(); !almostEqual(spacing[0], 0.0005, 1e-12) || !almostEqual(spacing[1], 0.00025, 1e-12) {
+				t.Errorf("expected spacing [0.0005 0.00025], got %v", spacing)
+			}
+			if !bytes.Equal(img.pixels, expected.Bytes()) {
+				t.Errorf("pixel data mismatch")
+			}
+		})
+	}
+}
+
+func sortTIFFWriteEntries(entries []tiffWriteEntry) {
+	for i := 1; i < len(entries); i++ {
+		for j := i; j > 0 && entries[j].tag < entries[j-1].tag; j-- {
+			entries[j], entries[j-1] = entries[j-1], entries[j]
+		}
+	}
+}
+
+func TestTIFFResolutionSpacing(t *testing.T) {
+	rational := func(numerator uint32) tiffEntry {
+		return tiffEntry{fieldType: tiffTypeRational, count: 1, value: binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, numerator), 1)}
+	}
+	// A unit of 0 leaves the ResolutionUnit tag out.
+	tests := []struct {
+		name   string
+		unit   uint16
+		expect float64
+	}{
+		{name: "no resolution unit", expect: 1},
+		{name: "no absolute unit", unit: 1, expect: 1},
+		{name: "inch", unit: 2, expect: 25.4 / 72},
+		{name: "centimetre", unit: 3, expect: 10.0 / 72},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ifd := &tiffIFD{order: binary.LittleEndian, entries: map[uint16]tiffEntry{
+				tiffTagXResolution: rational(72),
+				tiffTagYResolution: rational(72),
+			}}
+			if tt.unit != 0 {
+				ifd.entries[tiffTagResolutionUnit] = tiffEntry{fieldType: tiffTypeShort, count: 1, value: binary.LittleEndian.AppendUint16(nil, tt.unit)}
+			}
+			spacing, err := getTIFFSpacing(ifd, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !almostEqual(spacing[0], tt.expect, 1e-12) || !almostEqual(spacing[1], tt.expect, 1e-12) {
+				t.Errorf("expected spacing %v, got %v", tt.expect, spacing)
+			}
+		})
+	}
+}
+
+func TestReadTIFFInvalidFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := newNIfTITestImage(t)
+	img.SetDirection([9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1})
+	valid := filepath.Join(tempDir, "valid.tif")
+	if err := WriteImage(img, valid, ImageTypeTIFF); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not tiff", []byte("this is not a TIFF file")},
+		{"truncated", data[:len(data)-20]},
+		{"ifd loop", append([]byte("II*\x00\x08\x00\x00\x00\x00\x00"), 8, 0, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, "test.tif")
+			if err := os.WriteFile(filename, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ReadImage(filename, ImageTypeTIFF, nil); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
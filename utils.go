@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"reflect"
+	"strconv"
 )
 
 type converter func(interface{}) interface{}
@@ -40,6 +42,24 @@ var pixelTypeConverters = map[int]converter{
 	PixelTypeFloat64: func(v interface{}) interface{} {
 		return float64(reflect.ValueOf(v).Convert(reflect.TypeOf(float64(0))).Float())
 	},
+	PixelTypeComplex64: func(v interface{}) interface{} {
+		return complex64(toComplex128(v))
+	},
+	PixelTypeComplex128: func(v interface{}) interface{} {
+		return toComplex128(v)
+	},
+}
+
+// toComplex128 converts a real or complex number to complex128.
+func toComplex128(v interface{}) complex128 {
+	switch v := v.(type) {
+	case complex64:
+		return complex128(v)
+	case complex128:
+		return v
+	default:
+		return complex(reflect.ValueOf(v).Convert(reflect.TypeOf(float64(0))).Float(), 0)
+	}
 }
 
 func getValueAsPixelType(value any, pixelType int) (any, error) {
@@ -47,6 +67,11 @@ func getValueAsPixelType(value any, pixelType int) (any, error) {
 		switch value.(type) {
 		case uint8, int8, uint16, int16, uint32, int32, uint64, int64, float32, float64, int:
 			return converter(value), nil
+		case complex64, complex128:
+			if !isComplexPixelType(pixelType) {
+				return nil, fmt.Errorf("cannot convert complex value to pixel type %d", pixelType)
+			}
+			return converter(value), nil
 		default:
 			return nil, fmt.Errorf("unsupported value type")
 		}
@@ -202,6 +227,22 @@ func flattenToBytes(data interface{}) ([]byte, error) {
 				panic(err)
 			}
 			bytesSlice = append(bytesSlice, buf.Bytes()...)
+		case reflect.Complex64:
+			buf := new(bytes.Buffer)
+			v := complex64(val.Complex())
+			err := binary.Write(buf, binary.LittleEndian, v)
+			if err != nil {
+				panic(err)
+			}
+			bytesSlice = append(bytesSlice, buf.Bytes()...)
+		case reflect.Complex128:
+			buf := new(bytes.Buffer)
+			v := val.Complex()
+			err := binary.Write(buf, binary.LittleEndian, v)
+			if err != nil {
+				panic(err)
+			}
+			bytesSlice = append(bytesSlice, buf.Bytes()...)
 		default:
 			return fmt.Errorf("unsupported value type")
 		}
@@ -211,6 +252,16 @@ func flattenToBytes(data interface{}) ([]byte, error) {
 	return bytesSlice, err
 }
 
+// arrayShape returns the shape of the nested slices holding the pixels of an
+// image of the given size, with the slowest varying dimension first.
+func arrayShape(size []uint32) []uint32 {
+	shape := make([]uint32, len(size))
+	for i, s := range size {
+		shape[len(size)-1-i] = s
+	}
+	return shape
+}
+
 // Reshape reshapes an n-dimensional nested slice into the specified shape.
 func reshape(data interface{}, shape []uint32) any {
 	if data == nil {
@@ -309,8 +360,214 @@ func getValueAsBytes(value any) ([]byte, error) {
 			panic(err)
 		}
 		return buf.Bytes(), nil
+	case complex64:
+		buf := new(bytes.Buffer)
+		err := binary.Write(buf, binary.LittleEndian, value)
+		if err != nil {
+			panic(err)
+		}
+		return buf.Bytes(), nil
+	case complex128:
+		buf := new(bytes.Buffer)
+		err := binary.Write(buf, binary.LittleEndian, value)
+		if err != nil {
+			panic(err)
+		}
+		return buf.Bytes(), nil
 	default:
 		return nil, fmt.Errorf("unsupported value type")
 	}
 
 }
+
+// getBytesPerPixel returns the number of bytes used to store one pixel of the given pixel type.
+func getBytesPerPixel(pixelType int) (int, error) {
+	switch pixelType {
+	case PixelTypeUInt8, PixelTypeInt8:
+		return 1, nil
+	case PixelTypeUInt16, PixelTypeInt16:
+		return 2, nil
+	case PixelTypeUInt32, PixelTypeInt32, PixelTypeFloat32:
+		return 4, nil
+	case PixelTypeUInt64, PixelTypeInt64, PixelTypeFloat64, PixelTypeComplex64:
+		return 8, nil
+	case PixelTypeComplex128:
+		return 16, nil
+	default:
+		return 0, fmt.Errorf("unsupported pixel type: %d", pixelType)
+	}
+}
+
+// integerPixelTypeRange returns the smallest and largest values of an integer
+// pixel type. ok is false for floating point and complex pixel types.
+func integerPixelTypeRange(pixelType int) (lowest int64, highest uint64, ok bool) {
+	switch pixelType {
+	case PixelTypeUInt8:
+		return 0, math.MaxUint8, true
+	case PixelTypeInt8:
+		return math.MinInt8, math.MaxInt8, true
+	case PixelTypeUInt16:
+		return 0, math.MaxUint16, true
+	case PixelTypeInt16:
+		return math.MinInt16, math.MaxInt16, true
+	case PixelTypeUInt32:
+		return 0, math.MaxUint32, true
+	case PixelTypeInt32:
+		return math.MinInt32, math.MaxInt32, true
+	case PixelTypeUInt64:
+		return 0, math.MaxUint64, true
+	case PixelTypeInt64:
+		return math.MinInt64, math.MaxInt64, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// swapBytes reverses the byte order of every word of the given width in data, in place.
+func swapBytes(data []byte, width int) {
+	if width < 2 {
+		return
+	}
+	for i := 0; i+width <= len(data); i += width {
+		for j, k := i, i+width-1; j < k; j, k = j+1, k-1 {
+			data[j], data[k] = data[k], data[j]
+		}
+	}
+}
+
+// swapPixelBytes reverses the byte order of every pixel value in data, in
+// place. The real and imaginary parts of complex values are swapped separately.
+func (img *Image) swapPixelBytes(data []byte) {
+	width := img.bytesPerPixel
+	if isComplexPixelType(img.pixelType) {
+		width /= 2
+	}
+	swapBytes(data, width)
+}
+
+// getLinearPixelAsFloat64 returns the pixel at the given linear index converted
+// to float64, or its real part for complex pixel types.
+func (img *Image) getLinearPixelAsFloat64(i int) float64 {
+	switch img.pixelType {
+	case PixelTypeUInt8:
+		return float64(img.pixels[i])
+	case PixelTypeInt8:
+		return float64(int8(img.pixels[i]))
+	case PixelTypeUInt16:
+		return float64(binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2]))
+	case PixelTypeInt16:
+		return float64(int16(binary.LittleEndian.Uint16(img.pixels[i*2 : i*2+2])))
+	case PixelTypeUInt32:
+		return float64(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4]))
+	case PixelTypeInt32:
+		return float64(int32(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4])))
+	case PixelTypeUInt64:
+		return float64(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
+	case PixelTypeInt64:
+		return float64(int64(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8])))
+	case PixelTypeFloat32:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(img.pixels[i*4 : i*4+4])))
+	case PixelTypeFloat64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(img.pixels[i*8 : i*8+8]))
+	case PixelTypeComplex64, PixelTypeComplex128:
+		return real(img.getLinearPixelAsComplex128(i))
+	default:
+		return 0
+	}
+}
+
+// setLinearPixelFromFloat64 stores value, converted to the pixel type of the image, at the given linear index.
+// Complex pixels get a zero imaginary part.
+func (img *Image) setLinearPixelFromFloat64(i int, value float64) {
+	switch img.pixelType {
+	case PixelTypeUInt8:
+		img.pixels[i] = uint8(value)
+	case PixelTypeInt8:
+		img.pixels[i] = byte(int8(value))
+	case PixelTypeUInt16:
+		binary.LittleEndian.PutUint16(img.pixels[i*2:i*2+2], uint16(value))
+	case PixelTypeInt16:
+		binary.LittleEndian.PutUint16(img.pixels[i*2:i*2+2], uint16(int16(value)))
+	case PixelTypeUInt32:
+		binary.LittleEndian.PutUint32(img.pixels[i*4:i*4+4], uint32(value))
+	case PixelTypeInt32:
+		binary.LittleEndian.PutUint32(img.pixels[i*4:i*4+4], uint32(int32(value)))
+	case PixelTypeUInt64:
+		binary.LittleEndian.PutUint64(img.pixels[i*8:i*8+8], uint64(value))
+	case PixelTypeInt64:
+		binary.LittleEndian.PutUint64(img.pixels[i*8:i*8+8], uint64(int64(value)))
+	case PixelTypeFloat32:
+		binary.LittleEndian.PutUint32(img.pixels[i*4:i*4+4], math.Float32bits(float32(value)))
+	case PixelTypeFloat64:
+		binary.LittleEndian.PutUint64(img.pixels[i*8:i*8+8], math.Float64bits(value))
+	case PixelTypeComplex64, PixelTypeComplex128:
+		img.setLinearComplexPixel(i, complex(value, 0))
+	}
+}
+
+// getLinearIntegerPixel returns the integer pixel at the given linear index as
+// the bits of an int64 for signed pixel types and of a uint64 for unsigned
+// ones, without the rounding of getLinearPixelAsFloat64.
+func (img *Image) getLinearIntegerPixel(i int) uint64 {
+	width := img.bytesPerPixel
+	var bits uint64
+	for j := width - 1; j >= 0; j-- {
+		bits = bits<<8 | uint64(img.pixels[i*width+j])
+	}
+	if isSignedPixelType(img.pixelType) && width < 8 {
+		// Sign-extend to 64 bits.
+		shift := 64 - 8*width
+		bits = uint64(int64(bits<<shift) >> shift)
+	}
+	return bits
+}
+
+// setLinearIntegerPixel stores the low bytes of bits at the given linear index
+// of an integer image.
+func (img *Image) setLinearIntegerPixel(i int, bits uint64) {
+	width := img.bytesPerPixel
+	for j := 0; j < width; j++ {
+		img.pixels[i*width+j] = byte(bits >> (8 * j))
+	}
+}
+
+// setLinearPixelFromText parses a decimal value into the pixel at the given
+// linear index, keeping full precision for 64-bit integers.
+func (img *Image) setLinearPixelFromText(i int, text string) error {
+	switch img.pixelType {
+	case PixelTypeUInt64:
+		value, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(img.pixels[i*8:i*8+8], value)
+	case PixelTypeInt64:
+		value, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(img.pixels[i*8:i*8+8], uint64(value))
+	default:
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		img.setLinearPixelFromFloat64(i, value)
+	}
+	return nil
+}
+
+// formatLinearPixel formats the pixel at the given linear index as a decimal
+// value, keeping full precision for 64-bit integers.
+func (img *Image) formatLinearPixel(i int) string {
+	switch img.pixelType {
+	case PixelTypeUInt64:
+		return strconv.FormatUint(binary.LittleEndian.Uint64(img.pixels[i*8:i*8+8]), 10)
+	case PixelTypeInt64:
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(img.pixels[i*8:i*8+8])), 10)
+	case PixelTypeFloat32:
+		return strconv.FormatFloat(img.getLinearPixelAsFloat64(i), 'g', -1, 32)
+	default:
+		return strconv.FormatFloat(img.getLinearPixelAsFloat64(i), 'g', -1, 64)
+	}
+}
@@ -0,0 +1,272 @@
+package imagetk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// Number is the set of Go types that can hold the pixels of an image, one for
+// each pixel type.
+type Number interface {
+	uint8 | int8 | uint16 | int16 | uint32 | int32 | uint64 | int64 | float32 | float64
+}
+
+// hostIsLittleEndian reports whether the host stores numbers in little endian
+// byte order, the order of Image pixel data.
+var hostIsLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// PixelTypeOf returns the pixel type of images whose pixels have the Go type T.
+//
+// Returns:
+//   - int: The pixel type, e.g. PixelTypeInt16 for int16
+func PixelTypeOf[T Number]() int {
+	var zero T
+	switch any(zero).(type) {
+	case uint8:
+		return PixelTypeUInt8
+	case int8:
+		return PixelTypeInt8
+	case uint16:
+		return PixelTypeUInt16
+	case int16:
+		return PixelTypeInt16
+	case uint32:
+		return PixelTypeUInt32
+	case int32:
+		return PixelTypeInt32
+	case uint64:
+		return PixelTypeUInt64
+	case int64:
+		return PixelTypeInt64
+	case float32:
+		return PixelTypeFloat32
+	default:
+		return PixelTypeFloat64
+	}
+}
+
+// View gives typed access to the pixels of an image without copying them.
+// Changes made through a view are changes to the image.
+//
+// Indexing a view outside the image panics, like indexing a slice, so that
+// View can be used in hot loops without checking errors.
+//
+// For multi-component images Pixels holds the components of each pixel next
+// to each other; use Vector to access them.
+type View[T Number] struct {
+	img    *Image
+	pixels []T
+}
+
+// NewView returns a typed view of the pixels of an image.
+//
+// Parameters:
+//   - img: The image to view
+//
+// Returns:
+//   - *View[T]: The view, sharing the pixel data of img
+//   - error: Error if T does not match the pixel type of img, or the host is big endian
+//
+// The view stays valid until the pixels of img are replaced, e.g. by SetPixels or Close.
+func NewView[T Number](img *Image) (*View[T], error) {
+	if PixelTypeOf[T]() != img.pixelType {
+		var zero T
+		return nil, fmt.Errorf("cannot view pixel type %d as %T", img.pixelType, zero)
+	}
+	if !hostIsLittleEndian {
+		return nil, fmt.Errorf("typed views require a little endian host")
+	}
+	pixels, ok := castPixels[T](img.pixels)
+	if !ok {
+		// A view shares the pixel data, so unaligned data is moved to an
+		// aligned buffer that becomes the pixel data of the image.
+		pixels = make([]T, len(img.pixels)/img.bytesPerPixel)
+		copy(pixelBytes(pixels), img.pixels)
+		img.pixels = pixelBytes(pixels)
+	}
+	return &View[T]{img: img, pixels: pixels}, nil
+}
+
+// Image returns the image the view belongs to.
+func (v *View[T]) Image() *Image {
+	return v.img
+}
+
+// Pixels returns the pixels of the image in memory order, with x varying fastest.
+func (v *View[T]) Pixels() []T {
+	return v.pixels
+}
+
+// Len returns the number of pixels.
+func (v *View[T]) Len() int {
+	return len(v.pixels)
+}
+
+// Index returns the position in Pixels of the pixel at the given index, or of
+// its first component for multi-component images.
+//
+// Parameters:
+//   - index: The index of the pixel, with one entry per dimension
+//
+// Returns:
+//   - int: The linear index of the pixel
+func (v *View[T]) Index(index []uint32) int {
+	size := v.img.size
+	if len(index) != len(size) {
+		panic(fmt.Sprintf("imagetk: invalid index length: %d", len(index)))
+	}
+	linear := 0
+	for i := len(index) - 1; i >= 0; i-- {
+		if index[i] >= size[i] {
+			panic(fmt.Sprintf("imagetk: index out of range: %v", index))
+		}
+		linear = linear*int(size[i]) + int(index[i])
+	}
+	return linear * v.img.GetNumberOfComponentsPerPixel()
+}
+
+// At returns the pixel at the given index. It panics for multi-component images.
+func (v *View[T]) At(index []uint32) T {
+	v.checkScalar()
+	return v.pixels[v.Index(index)]
+}
+
+// Set sets the pixel at the given index. It panics for multi-component images.
+func (v *View[T]) Set(index []uint32, value T) {
+	v.checkScalar()
+	v.pixels[v.Index(index)] = value
+}
+
+// Vector returns the components of the pixel at the given index, sharing the
+// pixel data of the image.
+func (v *View[T]) Vector(index []uint32) []T {
+	i := v.Index(index)
+	components := v.img.GetNumberOfComponentsPerPixel()
+	return v.pixels[i : i+components : i+components]
+}
+
+// checkScalar panics if the image has more than one component per pixel.
+func (v *View[T]) checkScalar() {
+	if v.img.GetNumberOfComponentsPerPixel() > 1 {
+		panic("imagetk: At and Set need a scalar image; use Vector")
+	}
+}
+
+// Fill sets all pixels to value.
+func (v *View[T]) Fill(value T) {
+	for i := range v.pixels {
+		v.pixels[i] = value
+	}
+}
+
+// ForEach calls fn for every pixel in memory order, and for every component of
+// multi-component images. The index slice is reused between calls and must be
+// copied if it is kept.
+func (v *View[T]) ForEach(fn func(index []uint32, value T)) {
+	size := v.img.size
+	components := v.img.GetNumberOfComponentsPerPixel()
+	index := make([]uint32, len(size))
+	for j, value := range v.pixels {
+		fn(index, value)
+		if (j+1)%components != 0 {
+			continue
+		}
+		for i := range index {
+			index[i]++
+			if index[i] < size[i] {
+				break
+			}
+			index[i] = 0
+		}
+	}
+}
+
+// Apply replaces every pixel with the result of fn.
+func (v *View[T]) Apply(fn func(value T) T) {
+	for i, value := range v.pixels {
+		v.pixels[i] = fn(value)
+	}
+}
+
+// castPixels reinterprets pixel data as a slice of T without copying it. It
+// reports false if the data is not aligned for T.
+func castPixels[T Number](data []byte) ([]T, bool) {
+	var zero T
+	n := len(data) / int(unsafe.Sizeof(zero))
+	if n == 0 {
+		return nil, true
+	}
+	if uintptr(unsafe.Pointer(&data[0]))%unsafe.Alignof(zero) != 0 {
+		return nil, false
+	}
+	return unsafe.Slice((*T)(unsafe.Pointer(&data[0])), n), true
+}
+
+// pixelBytes returns the memory of a slice of pixels as bytes.
+func pixelBytes[T Number](pixels []T) []byte {
+	if len(pixels) == 0 {
+		return nil
+	}
+	var zero T
+	return unsafe.Slice((*byte)(unsafe.Pointer(&pixels[0])), len(pixels)*int(unsafe.Sizeof(zero)))
+}
+
+// pixelsOf returns the pixels of img as a slice of T for reading. The slice
+// shares the pixel data when it is little endian and aligned for T, and is a
+// decoded copy otherwise. The pixel type of img must match T.
+func pixelsOf[T Number](img *Image) []T {
+	if PixelTypeOf[T]() != img.pixelType {
+		panic(fmt.Sprintf("imagetk: cannot read pixel type %d as %T", img.pixelType, *new(T)))
+	}
+	if hostIsLittleEndian {
+		if pixels, ok := castPixels[T](img.pixels); ok {
+			return pixels
+		}
+	}
+	pixels := make([]T, len(img.pixels)/img.bytesPerPixel)
+	data := pixelBytes(pixels)
+	copy(data, img.pixels)
+	if !hostIsLittleEndian {
+		swapBytes(data, img.bytesPerPixel)
+	}
+	return pixels
+}
+
+// setPixelsOf replaces the pixel data of img with values, which must have the
+// Go type of its pixel type.
+func setPixelsOf[T Number](img *Image, values []T) {
+	img.pixels = pixelBytes(values)
+	if !hostIsLittleEndian {
+		img.swapPixelBytes(img.pixels)
+	}
+}
+
+// parallelFor splits [0, n) into one range per CPU and calls fn for each range
+// concurrently, returning when all calls have returned.
+func parallelFor(n int, fn func(start, end int)) {
+	parallelForCost(n, 1, fn)
+}
+
+// parallelForCost is parallelFor for items that each cost about as much as
+// processing cost voxels, such as the image lines of a separable filter.
+// Small workloads run on the calling goroutine.
+func parallelForCost(n, cost int, fn func(start, end int)) {
+	numGoroutines := min(runtime.NumCPU(), n)
+	if n*cost < 1<<14 || numGoroutines <= 1 {
+		fn(0, n)
+		return
+	}
+	chunkSize := (n + numGoroutines - 1) / numGoroutines
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += chunkSize {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, min(start+chunkSize, n))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,130 @@
+package imagetk
+
+import (
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	img, err := NewImage([]uint32{4, 3, 2}, PixelTypeInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := NewView[int16](img)
+	if err != nil {
+		t.Fatalf("failed to create view: %v", err)
+	}
+	if view.Len() != 24 || view.Image() != img {
+		t.Fatalf("expected a view of 24 pixels of img, got %d", view.Len())
+	}
+
+	view.ForEach(func(index []uint32, value int16) {
+		view.Set(index, int16(index[2]*100+index[1]*10+index[0])-50)
+	})
+	i := 0
+	view.ForEach(func(index []uint32, value int16) {
+		expected, _ := img.GetPixelAsInt16(index)
+		if value != expected || view.Pixels()[i] != expected {
+			t.Fatalf("pixel %v: view has %d, image has %d", index, value, expected)
+		}
+		i++
+	})
+	if value := view.At([]uint32{3, 2, 1}); value != 73 {
+		t.Errorf("expected 73, got %d", value)
+	}
+	if err := img.SetPixel([]uint32{1, 1, 1}, int16(-7)); err != nil {
+		t.Fatal(err)
+	}
+	if value := view.At([]uint32{1, 1, 1}); value != -7 {
+		t.Errorf("expected the view to see -7 written to the image, got %d", value)
+	}
+	if index := view.Index([]uint32{1, 2, 1}); index != 21 {
+		t.Errorf("expected linear index 21, got %d", index)
+	}
+
+	view.Apply(func(value int16) int16 { return value * 2 })
+	if value, _ := img.GetPixelAsInt16([]uint32{1, 1, 1}); value != -14 {
+		t.Errorf("expected -14 after Apply, got %d", value)
+	}
+	view.Fill(5)
+	if img.Min().(int16) != 5 || img.Max().(int16) != 5 {
+		t.Errorf("expected all pixels 5 after Fill")
+	}
+
+	if _, err := NewView[float32](img); err == nil {
+		t.Errorf("expected error for mismatched pixel type")
+	}
+	for _, index := range [][]uint32{{4, 0, 0}, {0, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for index %v", index)
+				}
+			}()
+			view.At(index)
+		}()
+	}
+}
+
+func TestViewUnaligned(t *testing.T) {
+	img, err := NewImage([]uint32{3, 2}, PixelTypeFloat64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		img.setLinearPixelFromFloat64(i, float64(i)+0.5)
+	}
+	// Move the pixel data to an odd address, as for a header of odd length.
+	buffer := make([]byte, len(img.pixels)+1)
+	copy(buffer[1:], img.pixels)
+	img.pixels = buffer[1:]
+
+	// Reading decodes a copy and leaves the pixel data in place.
+	for i, value := range pixelsOf[float64](img) {
+		if value != float64(i)+0.5 {
+			t.Errorf("pixel %d: expected %v, got %v", i, float64(i)+0.5, value)
+		}
+	}
+	if &img.pixels[0] != &buffer[1] {
+		t.Errorf("expected reading the pixels to keep the pixel data of the image")
+	}
+
+	view, err := NewView[float64](img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range view.Pixels() {
+		if value != float64(i)+0.5 {
+			t.Errorf("pixel %d: expected %v, got %v", i, float64(i)+0.5, value)
+		}
+	}
+	view.Set([]uint32{2, 1}, -1)
+	if value, _ := img.GetPixelAsFloat64([]uint32{2, 1}); value != -1 {
+		t.Errorf("expected the image to see -1 written to the view, got %v", value)
+	}
+}
+
+func TestPixelTypeOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		got      int
+		expected int
+	}{
+		{"uint8", PixelTypeOf[uint8](), PixelTypeUInt8},
+		{"int8", PixelTypeOf[int8](), PixelTypeInt8},
+		{"uint16", PixelTypeOf[uint16](), PixelTypeUInt16},
+		{"int16", PixelTypeOf[int16](), PixelTypeInt16},
+		{"uint32", PixelTypeOf[uint32](), PixelTypeUInt32},
+		{"int32", PixelTypeOf[int32](), PixelTypeInt32},
+		{"uint64", PixelTypeOf[uint64](), PixelTypeUInt64},
+		{"int64", PixelTypeOf[int64](), PixelTypeInt64},
+		{"float32", PixelTypeOf[float32](), PixelTypeFloat32},
+		{"float64", PixelTypeOf[float64](), PixelTypeFloat64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("expected pixel type %d, got %d", tt.expected, tt.got)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package imagetk
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// ExtractVolume returns the 3D volume at an index along the fourth dimension
+// of a 4D image, such as one time point of an fMRI series.
+//
+// Parameters:
+//   - index: The index along the fourth dimension, starting at 0
+//
+// Returns:
+//   - *Image: A 3D image with the spatial geometry, pixel type and metadata of the image
+//   - error: Error if the image is not 4D or the index is out of range
+func (img *Image) ExtractVolume(index uint32) (*Image, error) {
+	if img.dimension != 4 {
+		return nil, fmt.Errorf("extracting a volume needs a 4D image, got %dD", img.dimension)
+	}
+	if index >= img.size[3] {
+		return nil, fmt.Errorf("volume index %d out of range for %d volumes", index, img.size[3])
+	}
+	volume, err := NewVectorImage(slices.Clone(img.size[:3]), img.pixelType, img.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+	copy(volume.spacing, img.spacing)
+	copy(volume.origin, img.origin)
+	volume.direction = img.direction
+	for j := 0; j < 3; j++ {
+		volume.origin[j] += float64(index) * img.spacing[3] * img.directionAt(3, j)
+	}
+	volume.copyMetaData(img)
+
+	volumeBytes := len(volume.pixels)
+	copy(volume.pixels, img.pixels[int(index)*volumeBytes:])
+	return volume, nil
+}
+
+// JoinVolumes stacks 3D volumes into a 4D image, such as the time points of a
+// series.
+//
+// Parameters:
+//   - volumes: The volumes in order along the fourth dimension, with the same size, pixel type and components
+//   - spacing: The spacing along the fourth dimension, e.g. the repetition time
+//   - origin: The coordinate of the first volume along the fourth dimension
+//
+// Returns:
+//   - *Image: The 4D image, with the spatial geometry and metadata of the first volume
+//   - error: Error if no volumes are given, they do not match or the spacing is not positive
+func JoinVolumes(volumes []*Image, spacing, origin float64) (*Image, error) {
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("no volumes to join")
+	}
+	if spacing <= 0 {
+		return nil, fmt.Errorf("invalid spacing: %f", spacing)
+	}
+	first := volumes[0]
+	for _, volume := range volumes {
+		if volume.dimension != 3 {
+			return nil, fmt.Errorf("joined volumes must be 3D, got %dD", volume.dimension)
+		}
+		if volume.pixelType != first.pixelType || volume.GetNumberOfComponentsPerPixel() != first.GetNumberOfComponentsPerPixel() {
+			return nil, fmt.Errorf("joined volumes must have the same pixel type and components")
+		}
+		if !reflect.DeepEqual(volume.size, first.size) {
+			return nil, fmt.Errorf("joined volumes must have the same size, got %v and %v", first.size, volume.size)
+		}
+	}
+
+	size := append(slices.Clone(first.size), uint32(len(volumes)))
+	img, err := NewVectorImage(size, first.pixelType, first.GetNumberOfComponentsPerPixel())
+	if err != nil {
+		return nil, err
+	}
+	copy(img.spacing, first.spacing)
+	copy(img.origin, first.origin)
+	img.spacing[3] = spacing
+	img.origin[3] = origin
+	img.direction = first.direction
+	img.copyMetaData(first)
+
+	volumeBytes := first.pixelDataSize()
+	for i, volume := range volumes {
+		copy(img.pixels[i*volumeBytes:(i+1)*volumeBytes], volume.pixels)
+	}
+	return img, nil
+}
@@ -0,0 +1,241 @@
+package imagetk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// new4DTestImage returns a 4x3x2x5 Int16 series with distinct pixel values.
+func new4DTestImage(t *testing.T) *Image {
+	t.Helper()
+	img, err := NewImage([]uint32{4, 3, 2, 5}, PixelTypeInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.SetSpacing([]float64{0.5, 0.75, 2, 1.5})
+	img.SetOrigin([]float64{-10, 20, 5, 3})
+	img.SetDirection([9]float64{0, 1, 0, -1, 0, 0, 0, 0, 1})
+	for i := 0; i < int(img.NumPixels()); i++ {
+		img.setLinearPixelFromFloat64(i, float64(i*7-100))
+	}
+	return img
+}
+
+func TestDirectionMatrix(t *testing.T) {
+	img := new4DTestImage(t)
+	want := []float64{
+		0, 1, 0, 0,
+		-1, 0, 0, 0,
+		0, 0, 1, 0,
+		0, 0, 0, 1,
+	}
+	if matrix := img.GetDirectionMatrix(); !reflect.DeepEqual(matrix, want) {
+		t.Errorf("expected %v, got %v", want, matrix)
+	}
+
+	want[15] = -1
+	if err := img.SetDirectionMatrix(want); err != nil {
+		t.Fatal(err)
+	}
+	if matrix := img.GetDirectionMatrix(); !reflect.DeepEqual(matrix, want) {
+		t.Errorf("expected %v, got %v", want, matrix)
+	}
+
+	img.SetDirection([9]float64{1, 0, 0, 0, 0, 1, 0, -1, 0})
+	want = []float64{
+		1, 0, 0, 0,
+		0, 0, 1, 0,
+		0, -1, 0, 0,
+		0, 0, 0, -1,
+	}
+	if matrix := img.GetDirectionMatrix(); !reflect.DeepEqual(matrix, want) {
+		t.Errorf("expected %v after SetDirection, got %v", want, matrix)
+	}
+	if !reflect.DeepEqual(img.directionND, want) {
+		t.Errorf("expected the stored matrix %v after SetDirection, got %v", want, img.directionND)
+	}
+	if err := img.SetDirectionMatrix(want[:9]); err == nil {
+		t.Errorf("expected error for a 3x3 matrix on a 4D image")
+	}
+
+	img2D, err := NewImage([]uint32{3, 2}, PixelTypeUInt8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := img2D.SetDirectionMatrix([]float64{0, 1, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if direction := img2D.GetDirection(); direction != [9]float64{0, 1, 0, 1, 0, 0, 0, 0, 1} {
+		t.Errorf("unexpected 2D direction %v", direction)
+	}
+}
+
+func TestExtractJoinVolumes(t *testing.T) {
+	img := new4DTestImage(t)
+	img.SetMetaData("Modality", "MR")
+
+	var volumes []*Image
+	for i := uint32(0); i < 5; i++ {
+		volume, err := img.ExtractVolume(i)
+		if err != nil {
+			t.Fatalf("failed to extract volume %d: %v", i, err)
+		}
+		if volume.GetDimension() != 3 || !reflect.DeepEqual(volume.GetSize(), []uint32{4, 3, 2}) {
+			t.Fatalf("expected a 4x3x2 volume, got %v", volume.GetSize())
+		}
+		if !reflect.DeepEqual(volume.GetSpacing(), []float64{0.5, 0.75, 2}) || volume.GetDirection() != img.GetDirection() {
+			t.Errorf("volume %d does not have the spatial geometry of the series", i)
+		}
+		value, _ := volume.GetPixel([]uint32{3, 2, 1})
+		want, _ := img.GetPixel([]uint32{3, 2, 1, i})
+		if value != want {
+			t.Errorf("volume %d: expected %v, got %v", i, want, value)
+		}
+		volumes = append(volumes, volume)
+	}
+
+	joined, err := JoinVolumes(volumes, 1.5, 3)
+	if err != nil {
+		t.Fatalf("failed to join volumes: %v", err)
+	}
+	if !bytes.Equal(joined.pixels, img.pixels) || !reflect.DeepEqual(joined.GetSize(), img.GetSize()) {
+		t.Errorf("joined series does not match the original")
+	}
+	if !reflect.DeepEqual(joined.GetSpacing(), img.GetSpacing()) || !reflect.DeepEqual(joined.GetOrigin(), img.GetOrigin()) {
+		t.Errorf("expected spacing %v and origin %v, got %v and %v", img.GetSpacing(), img.GetOrigin(), joined.GetSpacing(), joined.GetOrigin())
+	}
+	if modality, _ := joined.GetMetaData("Modality"); modality != "MR" {
+		t.Errorf("expected metadata of the first volume, got %q", modality)
+	}
+
+	if _, err := img.ExtractVolume(5); err == nil {
+		t.Errorf("expected error for volume index out of range")
+	}
+	if _, err := volumes[0].ExtractVolume(0); err == nil {
+		t.Errorf("expected error extracting a volume from a 3D image")
+	}
+	if _, err := JoinVolumes(nil, 1, 0); err == nil {
+		t.Errorf("expected error for no volumes")
+	}
+	other, err := NewImage([]uint32{4, 3, 3}, PixelTypeInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := JoinVolumes([]*Image{volumes[0], other}, 1, 0); err == nil {
+		t.Errorf("expected error for mismatched volumes")
+	}
+	if _, err := JoinVolumes(volumes, 0, 0); err == nil {
+		t.Errorf("expected error for zero spacing")
+	}
+}
+
+func Test4DImageIO(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_4d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	img := new4DTestImage(t)
+	for _, tt := range []struct {
+		filename  string
+		imageType int
+	}{
+		{"test.mhd", ImageTypeMHD},
+		{"test.mha", ImageTypeMHD},
+		{"test.nii", ImageTypeNIfTI},
+		{"test.nii.gz", ImageTypeNIfTI},
+		{"pair.hdr", ImageTypeNIfTI},
+	} {
+		t.Run(tt.filename, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := WriteImage(img, filename, tt.imageType); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			readImg, err := ReadImage(filename, tt.imageType, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if !reflect.DeepEqual(readImg.GetSize(), img.GetSize()) {
+				t.Fatalf("expected size %v, got %v", img.GetSize(), readImg.GetSize())
+			}
+			for i := range img.GetSpacing() {
+				if !almostEqual(readImg.GetSpacing()[i], img.GetSpacing()[i], 1e-6) || !almostEqual(readImg.GetOrigin()[i], img.GetOrigin()[i], 1e-5) {
+					t.Errorf("expected spacing %v and origin %v, got %v and %v", img.GetSpacing(), img.GetOrigin(), readImg.GetSpacing(), readImg.GetOrigin())
+					break
+				}
+			}
+			for i, value := range readImg.GetDirectionMatrix() {
+				if !almostEqual(value, img.GetDirectionMatrix()[i], 1e-6) {
+					t.Errorf("expected direction %v, got %v", img.GetDirectionMatrix(), readImg.GetDirectionMatrix())
+					break
+				}
+			}
+			if !bytes.Equal(readImg.pixels, img.pixels) {
+				t.Errorf("pixel data mismatch")
+			}
+		})
+	}
+
+	header, err := os.ReadFile(filepath.Join(tempDir, "test.mhd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(header), "TransformMatrix = 0 1 0 0 -1 0 0 0 0 0 1 0 0 0 0 1\n") {
+		t.Errorf("expected a 4x4 TransformMatrix in %s", header)
+	}
+
+	// A region spanning two time points.
+	region, err := ReadImageRegion(filepath.Join(tempDir, "test.nii"), ImageTypeNIfTI, []uint32{1, 1, 0, 2}, []uint32{2, 2, 2, 2})
+	if err != nil {
+		t.Fatalf("failed to read region: %v", err)
+	}
+	value, _ := region.GetPixel([]uint32{1, 1, 1, 1})
+	want, _ := img.GetPixel([]uint32{2, 2, 1, 3})
+	if value != want {
+		t.Errorf("expected region pixel %v, got %v", want, value)
+	}
+	if !almostEqual(region.GetOrigin()[3], 6, 1e-9) {
+		t.Errorf("expected region time origin 6, got %v", region.GetOrigin()[3])
+	}
+
+	// Multi-component series keep the components along the fifth NIfTI dimension.
+	field, err := NewVectorImage([]uint32{3, 2, 2, 4}, PixelTypeFloat32, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(field.pixels)/4; i++ {
+		field.setLinearPixelFromFloat64(i, float64(i)/4)
+	}
+	filename := filepath.Join(tempDir, "field.nii")
+	if err := WriteImage(field, filename, ImageTypeNIfTI); err != nil {
+		t.Fatal(err)
+	}
+	readField, err := ReadImage(filename, ImageTypeNIfTI, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readField.GetNumberOfComponentsPerPixel() != 3 || !reflect.DeepEqual(readField.GetSize(), field.GetSize()) || !bytes.Equal(readField.pixels, field.pixels) {
+		t.Errorf("multi-component series did not round trip")
+	}
+
+	for _, tt := range []struct {
+		filename  string
+		imageType int
+	}{
+		{"test.tif", ImageTypeTIFF},
+		{"test.nrrd", ImageTypeNRRD},
+		{"test.vti", ImageTypeVTK},
+	} {
+		if err := WriteImage(img, filepath.Join(tempDir, tt.filename), tt.imageType); err == nil {
+			t.Errorf("%s: expected error writing a 4D image", tt.filename)
+		}
+	}
+	if _, err := img.Resample(NearestInterpolator{}); err == nil {
+		t.Errorf("expected error resampling a 4D image")
+	}
+}
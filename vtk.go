@@ -0,0 +1,812 @@
+package imagetk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// VTKEncodingDefault writes appended raw data to .vti files and binary data to legacy files.
+	VTKEncodingDefault = iota
+	// VTKEncodingASCII writes the pixel values as text.
+	VTKEncodingASCII
+	// VTKEncodingBinary writes base64 data inline in .vti files and big endian binary data to legacy files.
+	VTKEncodingBinary
+	// VTKEncodingAppended writes raw data in the AppendedData section of .vti files.
+	VTKEncodingAppended
+)
+
+// vtiBlockSize is the uncompressed size of each zlib block, as used by VTK.
+const vtiBlockSize = 32768
+
+// VTKWriteOptions controls the encoding of VTK files.
+type VTKWriteOptions struct {
+	// Encoding is one of VTKEncodingDefault, VTKEncodingASCII, VTKEncodingBinary and VTKEncodingAppended.
+	Encoding int
+	// Compressed enables zlib compression of binary and appended .vti data.
+	Compressed bool
+}
+
+func isVTIFile(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".vti")
+}
+
+func readImageTypeVTK(filename string) (*Image, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open VTK file: %v", err)
+	}
+	if isVTIFile(filename) || bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return readVTI(data)
+	}
+	return readLegacyVTK(data)
+}
+
+// readLegacyVTK reads a legacy STRUCTURED_POINTS dataset with scalar point data.
+func readLegacyVTK(data []byte) (*Image, error) {
+	offset := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	scanner.Split(scanLinesWithOffset(&offset))
+
+	var lines []string
+	for len(lines) < 4 && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" || len(lines) == 1 {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[0], "# vtk DataFile") {
+		return nil, fmt.Errorf("not a VTK file")
+	}
+	binaryData := strings.EqualFold(lines[2], "BINARY")
+	if !binaryData && !strings.EqualFold(lines[2], "ASCII") {
+		return nil, fmt.Errorf("invalid VTK file format: %s", lines[2])
+	}
+	if fields := strings.Fields(lines[3]); len(fields) != 2 || !strings.EqualFold(fields[0], "DATASET") || !strings.EqualFold(fields[1], "STRUCTURED_POINTS") {
+		return nil, fmt.Errorf("unsupported VTK dataset: %s", lines[3])
+	}
+
+	dimensions := []uint32{}
+	spacing := []float64{1, 1, 1}
+	origin := []float64{0, 0, 0}
+	typeName := ""
+	numPoints := -1
+	for typeName == "" || !strings.HasPrefix(strings.ToUpper(lines[len(lines)-1]), "LOOKUP_TABLE") {
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("VTK file has no scalar point data")
+		}
+		line := strings.TrimSpace(scanner.Text())
+		lines = append(lines, line)
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "DIMENSIONS":
+			for _, field := range fields[1:] {
+				value, err := strconv.ParseUint(field, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid VTK dimensions: %v", err)
+				}
+				dimensions = append(dimensions, uint32(value))
+			}
+		case "SPACING", "ASPECT_RATIO", "ORIGIN":
+			values, err := parseFloats(fields[1:])
+			if err != nil || len(values) != 3 {
+				return nil, fmt.Errorf("invalid VTK %s: %s", strings.ToLower(fields[0]), line)
+			}
+			if strings.EqualFold(fields[0], "ORIGIN") {
+				origin = values
+			} else {
+				spacing = values
+			}
+		case "POINT_DATA":
+			value, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid VTK point data: %v", err)
+			}
+			numPoints = value
+		case "SCALARS":
+			if numPoints < 0 {
+				return nil, fmt.Errorf("VTK scalars must follow POINT_DATA")
+			}
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("invalid VTK scalars: %s", line)
+			}
+			if len(fields) > 3 && fields[3] != "1" {
+				return nil, fmt.Errorf("unsupported VTK scalar components: %s", fields[3])
+			}
+			typeName = strings.ToLower(fields[2])
+		case "LOOKUP_TABLE":
+		default:
+			return nil, fmt.Errorf("unsupported VTK keyword: %s", fields[0])
+		}
+	}
+	if len(dimensions) != 3 {
+		return nil, fmt.Errorf("invalid VTK dimensions")
+	}
+
+	pixelType, err := getPixelTypeFromVTKType(typeName)
+	if err != nil {
+		return nil, err
+	}
+	size := dimensions
+	if dimensions[2] == 1 {
+		size, spacing, origin = dimensions[:2], spacing[:2], origin[:2]
+	}
+	img, err := NewImage(size, pixelType)
+	if err != nil {
+		return nil, err
+	}
+	if numPoints != int(img.NumPixels()) {
+		return nil, fmt.Errorf("VTK point data size %d does not match dimensions %v", numPoints, dimensions)
+	}
+	if err := img.SetSpacing(spacing); err != nil {
+		return nil, err
+	}
+	img.SetOrigin(origin)
+
+	if binaryData {
+		if offset+len(img.pixels) > len(data) {
+			return nil, fmt.Errorf("VTK data is truncated")
+		}
+		copy(img.pixels, data[offset:])
+		img.swapPixelBytes(img.pixels)
+		return img, nil
+	}
+	values := strings.Fields(string(data[offset:]))
+	if len(values) < numPoints {
+		return nil, fmt.Errorf("VTK data is truncated: expected %d values, got %d", numPoints, len(values))
+	}
+	for i := 0; i < numPoints; i++ {
+		if err := img.setLinearPixelFromText(i, values[i]); err != nil {
+			return nil, fmt.Errorf("invalid VTK value: %v", err)
+		}
+	}
+	return img, nil
+}
+
+func parseFloats(fields []string) ([]float64, error) {
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func getPixelTypeFromVTKType(typeName string) (int, error) {
+	switch strings.ToLower(typeName) {
+	case "unsigned_char", "uint8":
+		return PixelTypeUInt8, nil
+	case "char", "signed_char", "int8":
+		return PixelTypeInt8, nil
+	case "unsigned_short", "uint16":
+		return PixelTypeUInt16, nil
+	case "short", "int16":
+		return PixelTypeInt16, nil
+	case "unsigned_int", "uint32":
+		return PixelTypeUInt32, nil
+	case "int", "int32":
+		return PixelTypeInt32, nil
+	case "unsigned_long", "vtktypeuint64", "uint64":
+		return PixelTypeUInt64, nil
+	case "long", "vtktypeint64", "int64":
+		return PixelTypeInt64, nil
+	case "float", "float32":
+		return PixelTypeFloat32, nil
+	case "double", "float64":
+		return PixelTypeFloat64, nil
+	default:
+		return PixelTypeUnknown, fmt.Errorf("unsupported VTK data type: %s", typeName)
+	}
+}
+
+func getLegacyVTKType(pixelType int) (string, error) {
+	switch pixelType {
+	case PixelTypeUInt8:
+		return "unsigned_char", nil
+	case PixelTypeInt8:
+		return "char", nil
+	case PixelTypeUInt16:
+		return "unsigned_short", nil
+	case PixelTypeInt16:
+		return "short", nil
+	case PixelTypeUInt32:
+		return "unsigned_int", nil
+	case PixelTypeInt32:
+		return "int", nil
+	case PixelTypeUInt64:
+		return "vtktypeuint64", nil
+	case PixelTypeInt64:
+		return "vtktypeint64", nil
+	case PixelTypeFloat32:
+		return "float", nil
+	case PixelTypeFloat64:
+		return "double", nil
+	default:
+		return "", fmt.Errorf("unsupported pixel type: %d", pixelType)
+	}
+}
+
+func getVTIType(pixelType int) (string, error) {
+	switch pixelType {
+	case PixelTypeUInt8:
+		return "UInt8", nil
+	case PixelTypeInt8:
+		return "Int8", nil
+	case PixelTypeUInt16:
+		return "UInt16", nil
+	case PixelTypeInt16:
+		return "Int16", nil
+	case PixelTypeUInt32:
+		return "UInt32", nil
+	case PixelTypeInt32:
+		return "Int32", nil
+	case PixelTypeUInt64:
+		return "UInt64", nil
+	case PixelTypeInt64:
+		return "Int64", nil
+	case PixelTypeFloat32:
+		return "Float32", nil
+	case PixelTypeFloat64:
+		return "Float64", nil
+	default:
+		return "", fmt.Errorf("unsupported pixel type: %d", pixelType)
+	}
+}
+
+// vtiDataArray is a point data array of a .vti file.
+type vtiDataArray struct {
+	name          string
+	typeName      string
+	format        string
+	offset        int
+	numComponents string
+	text          []byte
+}
+
+// readVTI reads a single piece XML ImageData file with scalar point data.
+func readVTI(data []byte) (*Image, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	attributes := make(map[string]string)
+	var arrays []*vtiDataArray
+	var current *vtiDataArray
+	scalarsName, appendedEncoding := "", ""
+	appendedOffset := -1
+	inPointData, numPieces := false, 0
+
+	for appendedOffset < 0 {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse VTI file: %v", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			attrs := make(map[string]string)
+			for _, attr := range token.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			switch token.Name.Local {
+			case "VTKFile":
+				if attrs["type"] != "ImageData" {
+					return nil, fmt.Errorf("unsupported VTK XML file type: %s", attrs["type"])
+				}
+				for _, key := range []string{"byte_order", "header_type", "compressor"} {
+					attributes[key] = attrs[key]
+				}
+			case "ImageData":
+				for _, key := range []string{"WholeExtent", "Origin", "Spacing", "Direction"} {
+					attributes[key] = attrs[key]
+				}
+			case "Piece":
+				numPieces++
+				if numPieces > 1 {
+					return nil, fmt.Errorf("VTI files with multiple pieces are not supported")
+				}
+			case "PointData":
+				inPointData = true
+				scalarsName = attrs["Scalars"]
+			case "DataArray":
+				if inPointData {
+					current = &vtiDataArray{name: attrs["Name"], typeName: attrs["type"], format: attrs["format"], numComponents: attrs["NumberOfComponents"]}
+					if offset, err := strconv.Atoi(attrs["offset"]); err == nil {
+						current.offset = offset
+					}
+					arrays = append(arrays, current)
+				}
+			case "AppendedData":
+				appendedEncoding = attrs["encoding"]
+				appendedOffset = int(decoder.InputOffset())
+			}
+		case xml.CharData:
+			if current != nil {
+				current.text = append(current.text, token...)
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "PointData":
+				inPointData = false
+			case "DataArray":
+				current = nil
+			}
+		}
+	}
+
+	var array *vtiDataArray
+	for _, candidate := range arrays {
+		if array == nil || candidate.name == scalarsName {
+			array = candidate
+		}
+	}
+	if array == nil {
+		return nil, fmt.Errorf("VTI file has no point data")
+	}
+	if array.numComponents != "" && array.numComponents != "1" {
+		return nil, fmt.Errorf("unsupported VTI number of components: %s", array.numComponents)
+	}
+
+	extent, err := parseFloats(strings.Fields(attributes["WholeExtent"]))
+	if err != nil || len(extent) != 6 {
+		return nil, fmt.Errorf("invalid VTI extent: %s", attributes["WholeExtent"])
+	}
+	dimensions := make([]uint32, 3)
+	for i := range dimensions {
+		if extent[2*i+1] < extent[2*i] {
+			return nil, fmt.Errorf("invalid VTI extent: %s", attributes["WholeExtent"])
+		}
+		dimensions[i] = uint32(extent[2*i+1]-extent[2*i]) + 1
+	}
+	spacing := []float64{1, 1, 1}
+	if values, err := parseFloats(strings.Fields(attributes["Spacing"])); err == nil && len(values) == 3 {
+		spacing = values
+	}
+	origin := []float64{0, 0, 0}
+	if values, err := parseFloats(strings.Fields(attributes["Origin"])); err == nil && len(values) == 3 {
+		origin = values
+	}
+	// The Direction matrix is row-major with the image axes as columns; the
+	// origin refers to extent index 0, so a non-zero extent start shifts it.
+	direction := [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+	if values, err := parseFloats(strings.Fields(attributes["Direction"])); err == nil && len(values) == 9 {
+		for k := 0; k < 3; k++ {
+			for j := 0; j < 3; j++ {
+				direction[k*3+j] = values[j*3+k]
+			}
+		}
+	}
+	for j := 0; j < 3; j++ {
+		for k := 0; k < 3; k++ {
+			origin[j] += extent[2*k] * spacing[k] * direction[k*3+j]
+		}
+	}
+
+	pixelType, err := getPixelTypeFromVTKType(array.typeName)
+	if err != nil {
+		return nil, err
+	}
+	size := dimensions
+	if dimensions[2] == 1 {
+		size, spacing, origin = dimensions[:2], spacing[:2], origin[:2]
+	}
+	img, err := NewImage(size, pixelType)
+	if err != nil {
+		return nil, err
+	}
+	if err := img.SetSpacing(spacing); err != nil {
+		return nil, err
+	}
+	img.SetOrigin(origin)
+	img.SetDirection(direction)
+
+	if array.format == "ascii" {
+		values := strings.Fields(string(array.text))
+		if len(values) < int(img.NumPixels()) {
+			return nil, fmt.Errorf("VTI data is truncated: expected %d values, got %d", img.NumPixels(), len(values))
+		}
+		for i := range values[:img.NumPixels()] {
+			if err := img.setLinearPixelFromText(i, values[i]); err != nil {
+				return nil, fmt.Errorf("invalid VTI value: %v", err)
+			}
+		}
+		return img, nil
+	}
+
+	headerSize := 4
+	switch attributes["header_type"] {
+	case "", "UInt32":
+	case "UInt64":
+		headerSize = 8
+	default:
+		return nil, fmt.Errorf("unsupported VTI header type: %s", attributes["header_type"])
+	}
+	compressed := false
+	switch attributes["compressor"] {
+	case "":
+	case "vtkZLibDataCompressor":
+		compressed = true
+	default:
+		return nil, fmt.Errorf("unsupported VTI compressor: %s", attributes["compressor"])
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if attributes["byte_order"] == "BigEndian" {
+		order = binary.BigEndian
+	}
+
+	var pixels []byte
+	switch array.format {
+	case "binary":
+		pixels, err = decodeVTIBase64(string(array.text), headerSize, order, compressed)
+	case "appended":
+		if appendedOffset < 0 {
+			return nil, fmt.Errorf("VTI file has no appended data")
+		}
+		start := bytes.IndexByte(data[appendedOffset:], '_')
+		if start < 0 {
+			return nil, fmt.Errorf("VTI appended data has no start marker")
+		}
+		appended := data[appendedOffset+start+1:]
+		if array.offset < 0 || array.offset > len(appended) {
+			return nil, fmt.Errorf("VTI appended data offset out of range")
+		}
+		if appendedEncoding == "base64" {
+			pixels, err = decodeVTIBase64(string(appended[array.offset:]), headerSize, order, compressed)
+		} else {
+			pixels, err = decodeVTIBlocks(appended[array.offset:], headerSize, order, compressed)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported VTI data format: %s", array.format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(pixels) < len(img.pixels) {
+		return nil, fmt.Errorf("VTI data is truncated: expected %d bytes, got %d", len(img.pixels), len(pixels))
+	}
+	copy(img.pixels, pixels)
+	if order == binary.BigEndian {
+		img.swapPixelBytes(img.pixels)
+	}
+	return img, nil
+}
+
+func readVTIHeaderValue(data []byte, headerSize int, order binary.ByteOrder) uint64 {
+	if headerSize == 8 {
+		return order.Uint64(data)
+	}
+	return uint64(order.Uint32(data))
+}
+
+// decodeVTIBlocks decodes raw appended data: a byte count followed by the data,
+// or for compressed data a block table followed by the zlib blocks.
+func decodeVTIBlocks(data []byte, headerSize int, order binary.ByteOrder, compressed bool) ([]byte, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("VTI data is truncated")
+	}
+	if !compressed {
+		length := readVTIHeaderValue(data, headerSize, order)
+		if uint64(len(data)-headerSize) < length {
+			return nil, fmt.Errorf("VTI data is truncated")
+		}
+		return data[headerSize : headerSize+int(length)], nil
+	}
+
+	numBlocks := int(readVTIHeaderValue(data, headerSize, order))
+	tableSize := (3 + numBlocks) * headerSize
+	if numBlocks < 0 || numBlocks > len(data) || len(data) < tableSize {
+		return nil, fmt.Errorf("VTI compression header is truncated")
+	}
+	offset := tableSize
+	out := new(bytes.Buffer)
+	for i := 0; i < numBlocks; i++ {
+		blockSize := int(readVTIHeaderValue(data[(3+i)*headerSize:], headerSize, order))
+		if blockSize < 0 || offset+blockSize > len(data) {
+			return nil, fmt.Errorf("VTI compressed block is truncated")
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(data[offset : offset+blockSize]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress VTI data: %v", err)
+		}
+		if _, err := io.Copy(out, reader); err != nil {
+			return nil, fmt.Errorf("failed to decompress VTI data: %v", err)
+		}
+		reader.Close()
+		offset += blockSize
+	}
+	return out.Bytes(), nil
+}
+
+// decodeVTIBase64 decodes base64 data. Uncompressed data is a single stream of
+// the byte count and the data; compressed data encodes the block table and the
+// blocks as separate streams.
+func decodeVTIBase64(text string, headerSize int, order binary.ByteOrder, compressed bool) ([]byte, error) {
+	text = strings.Join(strings.Fields(text), "")
+	encodedLength := func(n int) int { return (n + 2) / 3 * 4 }
+	decode := func(s string) ([]byte, error) {
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VTI base64 data: %v", err)
+		}
+		return decoded, nil
+	}
+	if len(text) < encodedLength(headerSize) {
+		return nil, fmt.Errorf("VTI data is truncated")
+	}
+	first, err := decode(text[:encodedLength(headerSize)])
+	if err != nil {
+		return nil, err
+	}
+	value := int(readVTIHeaderValue(first, headerSize, order))
+
+	if !compressed {
+		n := encodedLength(headerSize + value)
+		if value < 0 || n > len(text) {
+			return nil, fmt.Errorf("VTI data is truncated")
+		}
+		decoded, err := decode(text[:n])
+		if err != nil {
+			return nil, err
+		}
+		return decodeVTIBlocks(decoded, headerSize, order, false)
+	}
+
+	tableLength := encodedLength((3 + value) * headerSize)
+	if value < 0 || tableLength > len(text) {
+		return nil, fmt.Errorf("VTI compression header is truncated")
+	}
+	table, err := decode(text[:tableLength])
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	for i := 0; i < value; i++ {
+		total += int(readVTIHeaderValue(table[(3+i)*headerSize:], headerSize, order))
+	}
+	n := tableLength + encodedLength(total)
+	if n > len(text) {
+		return nil, fmt.Errorf("VTI compressed data is truncated")
+	}
+	blocks, err := decode(text[tableLength:n])
+	if err != nil {
+		return nil, err
+	}
+	return decodeVTIBlocks(append(table[:(3+value)*headerSize], blocks...), headerSize, order, true)
+}
+
+// WriteVTK writes an image as a legacy VTK STRUCTURED_POINTS file, or as an
+// XML ImageData file if the filename ends with .vti.
+//
+// Parameters:
+//   - img: The image to write
+//   - filename: Path to the output file
+//   - options: The encoding and compression of the data
+//
+// Returns:
+//   - error: Error if writing fails, or if a legacy file would lose a non-identity direction
+//
+// Legacy files cannot hold the direction and do not support appended data or
+// compression; write rotated images as .vti files instead.
+func WriteVTK(img *Image, filename string, options VTKWriteOptions) error {
+	if img.GetNumberOfComponentsPerPixel() > 1 {
+		return fmt.Errorf("writing multi-component images to VTK files is not supported")
+	}
+	if img.dimension > 3 {
+		return fmt.Errorf("writing %dD images to VTK files is not supported", img.dimension)
+	}
+	if isVTIFile(filename) {
+		return img.writeVTI(filename, options)
+	}
+	return img.writeLegacyVTK(filename, options)
+}
+
+func (img *Image) saveImageTypeVTK(filename string, compressed bool) error {
+	return WriteVTK(img, filename, VTKWriteOptions{Compressed: compressed && isVTIFile(filename)})
+}
+
+// getVTKGeometry returns the dimensions, spacing and origin padded to 3D.
+func (img *Image) getVTKGeometry() ([]uint32, []float64, []float64) {
+	dimensions := []uint32{1, 1, 1}
+	spacing := []float64{1, 1, 1}
+	origin := []float64{0, 0, 0}
+	copy(dimensions, img.size)
+	copy(spacing, img.spacing)
+	copy(origin, img.origin)
+	return dimensions, spacing, origin
+}
+
+func (img *Image) writeLegacyVTK(filename string, options VTKWriteOptions) error {
+	if img.direction != [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1} {
+		return fmt.Errorf("legacy VTK files cannot hold the image direction %v; write a .vti file instead", img.direction)
+	}
+	typeName, err := getLegacyVTKType(img.pixelType)
+	if err != nil {
+		return err
+	}
+	format := "BINARY"
+	switch options.Encoding {
+	case VTKEncodingDefault, VTKEncodingBinary:
+	case VTKEncodingASCII:
+		format = "ASCII"
+	default:
+		return fmt.Errorf("legacy VTK files only support ASCII and binary encodings")
+	}
+	if options.Compressed {
+		return fmt.Errorf("legacy VTK files do not support compression")
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create VTK file: %v", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	dimensions, spacing, origin := img.getVTKGeometry()
+	fmt.Fprintf(writer, "# vtk DataFile Version 3.0\nimagetk\n%s\nDATASET STRUCTURED_POINTS\n", format)
+	fmt.Fprintf(writer, "DIMENSIONS %d %d %d\n", dimensions[0], dimensions[1], dimensions[2])
+	fmt.Fprintf(writer, "SPACING %g %g %g\n", spacing[0], spacing[1], spacing[2])
+	fmt.Fprintf(writer, "ORIGIN %g %g %g\n", origin[0], origin[1], origin[2])
+	fmt.Fprintf(writer, "POINT_DATA %d\nSCALARS scalars %s 1\nLOOKUP_TABLE default\n", img.NumPixels(), typeName)
+
+	if format == "BINARY" {
+		data := make([]byte, len(img.pixels))
+		copy(data, img.pixels)
+		img.swapPixelBytes(data)
+		writer.Write(data)
+		writer.WriteString("\n")
+	} else {
+		for i := 0; i < int(img.NumPixels()); i++ {
+			writer.WriteString(img.formatLinearPixel(i))
+			if i%9 == 8 {
+				writer.WriteString("\n")
+			} else {
+				writer.WriteString(" ")
+			}
+		}
+		writer.WriteString("\n")
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write VTK file: %v", err)
+	}
+	return nil
+}
+
+// encodeVTIBlocks returns the byte count and data, or the block table and
+// zlib blocks for compressed data, with UInt64 header values.
+func encodeVTIBlocks(data []byte, compressed bool) ([]byte, []byte, error) {
+	if !compressed {
+		return binary.LittleEndian.AppendUint64(nil, uint64(len(data))), data, nil
+	}
+	numBlocks := (len(data) + vtiBlockSize - 1) / vtiBlockSize
+	lastBlockSize := len(data) - (numBlocks-1)*vtiBlockSize
+	if numBlocks == 0 {
+		lastBlockSize = 0
+	}
+	header := binary.LittleEndian.AppendUint64(nil, uint64(numBlocks))
+	header = binary.LittleEndian.AppendUint64(header, vtiBlockSize)
+	header = binary.LittleEndian.AppendUint64(header, uint64(lastBlockSize))
+	blocks := new(bytes.Buffer)
+	for i := 0; i < numBlocks; i++ {
+		start := blocks.Len()
+		writer := zlib.NewWriter(blocks)
+		if _, err := writer.Write(data[i*vtiBlockSize : min((i+1)*vtiBlockSize, len(data))]); err != nil {
+			return nil, nil, fmt.Errorf("failed to compress VTI data: %v", err)
+		}
+		writer.Close()
+		header = binary.LittleEndian.AppendUint64(header, uint64(blocks.Len()-start))
+	}
+	return header, blocks.Bytes(), nil
+}
+
+func (img *Image) writeVTI(filename string, options VTKWriteOptions) error {
+	typeName, err := getVTIType(img.pixelType)
+	if err != nil {
+		return err
+	}
+	format := "appended"
+	switch options.Encoding {
+	case VTKEncodingDefault, VTKEncodingAppended:
+	case VTKEncodingBinary:
+		format = "binary"
+	case VTKEncodingASCII:
+		format = "ascii"
+	default:
+		return fmt.Errorf("unknown VTK encoding: %d", options.Encoding)
+	}
+	compressed := options.Compressed && format != "ascii"
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create VTI file: %v", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	dimensions, spacing, origin := img.getVTKGeometry()
+	direction := make([]string, 9)
+	for j := 0; j < 3; j++ {
+		for k := 0; k < 3; k++ {
+			direction[j*3+k] = strconv.FormatFloat(img.direction[k*3+j], 'g', -1, 64)
+		}
+	}
+	if img.dimension == 2 {
+		direction = []string{
+			strconv.FormatFloat(img.direction[0], 'g', -1, 64), strconv.FormatFloat(img.direction[3], 'g', -1, 64), "0",
+			strconv.FormatFloat(img.direction[1], 'g', -1, 64), strconv.FormatFloat(img.direction[4], 'g', -1, 64), "0",
+			"0", "0", "1",
+		}
+	}
+	extent := fmt.Sprintf("0 %d 0 %d 0 %d", dimensions[0]-1, dimensions[1]-1, dimensions[2]-1)
+
+	compressor := ""
+	if compressed {
+		compressor = ` compressor="vtkZLibDataCompressor"`
+	}
+	fmt.Fprintf(writer, "<?xml version=\"1.0\"?>\n<VTKFile type=\"ImageData\" version=\"1.0\" byte_order=\"LittleEndian\" header_type=\"UInt64\"%s>\n", compressor)
+	fmt.Fprintf(writer, "  <ImageData WholeExtent=\"%s\" Origin=\"%g %g %g\" Spacing=\"%g %g %g\" Direction=\"%s\">\n",
+		extent, origin[0], origin[1], origin[2], spacing[0], spacing[1], spacing[2], strings.Join(direction, " "))
+	fmt.Fprintf(writer, "    <Piece Extent=\"%s\">\n      <PointData Scalars=\"scalars\">\n", extent)
+
+	var header, data []byte
+	if format != "ascii" {
+		if header, data, err = encodeVTIBlocks(img.pixels, compressed); err != nil {
+			return err
+		}
+	}
+	switch format {
+	case "ascii":
+		fmt.Fprintf(writer, "        <DataArray type=\"%s\" Name=\"scalars\" format=\"ascii\">\n", typeName)
+		for i := 0; i < int(img.NumPixels()); i++ {
+			if i%9 == 0 {
+				writer.WriteString("          ")
+			}
+			writer.WriteString(img.formatLinearPixel(i))
+			if i%9 == 8 || i == int(img.NumPixels())-1 {
+				writer.WriteString("\n")
+			} else {
+				writer.WriteString(" ")
+			}
+		}
+		writer.WriteString("        </DataArray>\n")
+	case "binary":
+		fmt.Fprintf(writer, "        <DataArray type=\"%s\" Name=\"scalars\" format=\"binary\">\n          ", typeName)
+		if compressed {
+			writer.WriteString(base64.StdEncoding.EncodeToString(header))
+			writer.WriteString(base64.StdEncoding.EncodeToString(data))
+		} else {
+			writer.WriteString(base64.StdEncoding.EncodeToString(append(header, data...)))
+		}
+		writer.WriteString("\n        </DataArray>\n")
+	case "appended":
+		fmt.Fprintf(writer, "        <DataArray type=\"%s\" Name=\"scalars\" format=\"appended\" offset=\"0\"/>\n", typeName)
+	}
+	writer.WriteString("      </PointData>\n      <CellData>\n      </CellData>\n    </Piece>\n  </ImageData>\n")
+	if format == "appended" {
+		writer.WriteString("  <AppendedData encoding=\"raw\">\n   _")
+		writer.Write(header)
+		writer.Write(data)
+		writer.WriteString("\n  </AppendedData>\n")
+	}
+	writer.WriteString("</VTKFile>\n")
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write VTI file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package imagetk
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVTKRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_vtk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	newFloatImage := func(direction [9]float64) *Image {
+		img, err := NewImage([]uint32{5, 4}, PixelTypeFloat32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < int(img.NumPixels()); i++ {
+			img.setLinearPixelFromFloat64(i, float64(i)*0.1-0.7)
+		}
+		img.SetSpacing([]float64{0.3, 0.6})
+		img.SetOrigin([]float64{1.5, -2})
+		img.SetDirection(direction)
+		return img
+	}
+	// Legacy files cannot hold the direction, so they are written without one.
+	identity := [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+	floatImg := newFloatImage([9]float64{0, 1, 0, -1, 0, 0, 0, 0, 1})
+	legacyFloatImg := newFloatImage(identity)
+	legacyImg := newNIfTITestImage(t)
+	legacyImg.SetDirection(identity)
+
+	longImg, err := NewImage([]uint32{3, 2, 2}, PixelTypeUInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(longImg.NumPixels()); i++ {
+		binary.LittleEndian.PutUint64(longImg.pixels[i*8:], 1<<63+uint64(i))
+	}
+
+	tests := []struct {
+		name     string
+		img      *Image
+		filename string
+		options  VTKWriteOptions
+	}{
+		{name: "legacy binary", img: legacyImg, filename: "test.vtk"},
+		{name: "legacy ascii", img: legacyImg, filename: "test.vtk", options: VTKWriteOptions{Encoding: VTKEncodingASCII}},
+		{name: "legacy ascii uint64", img: longImg, filename: "test.vtk", options: VTKWriteOptions{Encoding: VTKEncodingASCII}},
+		{name: "legacy binary 2d", img: legacyFloatImg, filename: "test.vtk"},
+		{name: "vti appended", img: newNIfTITestImage(t), filename: "test.vti"},
+		{name: "vti appended zlib", img: newNIfTITestImage(t), filename: "test.vti", options: VTKWriteOptions{Compressed: true}},
+		{name: "vti binary", img: newNIfTITestImage(t), filename: "test.vti", options: VTKWriteOptions{Encoding: VTKEncodingBinary}},
+		{name: "vti binary zlib", img: newNIfTITestImage(t), filename: "test.vti", options: VTKWriteOptions{Encoding: VTKEncodingBinary, Compressed: true}},
+		{name: "vti ascii", img: newNIfTITestImage(t), filename: "test.vti", options: VTKWriteOptions{Encoding: VTKEncodingASCII}},
+		{name: "vti ascii 2d", img: floatImg, filename: "test.vti", options: VTKWriteOptions{Encoding: VTKEncodingASCII}},
+		{name: "vti ascii uint64", img: longImg, filename: "test.vti", options: VTKWriteOptions{Encoding: VTKEncodingASCII}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := WriteVTK(tt.img, filename, tt.options); err != nil {
+				t.Fatalf("failed to write image: %v", err)
+			}
+			readImg, err := ReadImage(filename, ImageTypeVTK, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if readImg.GetPixelType() != tt.img.GetPixelType() || readImg.GetDimension() != tt.img.GetDimension() {
+				t.Fatalf("expected pixel type %d dimension %d, got %d and %d", tt.img.GetPixelType(), tt.img.GetDimension(), readImg.GetPixelType(), readImg.GetDimension())
+			}
+			for i := range tt.img.GetSize() {
+				if readImg.GetSize()[i] != tt.img.GetSize()[i] ||
+					!almostEqual(readImg.GetSpacing()[i], tt.img.GetSpacing()[i], 1e-12) ||
+					!almostEqual(readImg.GetOrigin()[i], tt.img.GetOrigin()[i], 1e-12) {
+					t.Fatalf("geometry mismatch: got size %v spacing %v origin %v", readImg.GetSize(), readImg.GetSpacing(), readImg.GetOrigin())
+				}
+			}
+			if readImg.GetDirection() != tt.img.GetDirection() {
+				t.Errorf("expected direction %v, got %v", tt.img.GetDirection(), readImg.GetDirection())
+			}
+			if !bytes.Equal(readImg.pixels, tt.img.pixels) {
+				t.Errorf("pixel data mismatch")
+			}
+		})
+	}
+
+	if err := WriteImageCompressed(newNIfTITestImage(t), filepath.Join(tempDir, "test.vti"), ImageTypeVTK); err != nil {
+		t.Errorf("failed to write image: %v", err)
+	}
+	if err := WriteVTK(newNIfTITestImage(t), filepath.Join(tempDir, "test.vtk"), VTKWriteOptions{Encoding: VTKEncodingAppended}); err == nil {
+		t.Errorf("expected error for appended legacy file")
+	}
+	if err := WriteVTK(floatImg, filepath.Join(tempDir, "test.vtk"), VTKWriteOptions{}); err == nil {
+		t.Errorf("expected error for a legacy file with a rotated direction")
+	}
+}
+
+func TestReadVTKFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_vtk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Big endian appended base64 data with a UInt32 byte count and an extent
+	// starting at 2 in x, which shifts the origin by two pixels.
+	appended := binary.BigEndian.AppendUint32(nil, 12)
+	for _, value := range []int16{-3, -2, -1, 0, 1, 2} {
+		appended = binary.BigEndian.AppendUint16(appended, uint16(value))
+	}
+	vti := `<?xml version="1.0"?>
+<VTKFile type="ImageData" version="0.1" byte_order="BigEndian">
+  <ImageData WholeExtent="2 4 0 1 0 0" Origin="1 2 0" Spacing="0.5 2 1">
+    <Piece Extent="2 4 0 1 0 0">
+      <PointData Scalars="values">
+        <DataArray type="Float32" Name="other" format="ascii">9 9 9 9 9 9</DataArray>
+        <DataArray type="Int16" Name="values" format="appended" offset="0"/>
+      </PointData>
+    </Piece>
+  </ImageData>
+  <AppendedData encoding="base64">
+   _` + base64.StdEncoding.EncodeToString(appended) + `
+  </AppendedData>
+</VTKFile>
+`
+	legacy := `# vtk DataFile Version 2.0
+
+ASCII
+DATASET STRUCTURED_POINTS
+DIMENSIONS 3 2 1
+ASPECT_RATIO 0.5 2 1
+ORIGIN 2 2 0
+POINT_DATA 6
+SCALARS values short
+LOOKUP_TABLE default
+-3 -2 -1
+0 1 2
+`
+	for _, tt := range []struct {
+		name     string
+		filename string
+		data     string
+	}{
+		{"vti", "test.vti", vti},
+		{"legacy", "test.vtk", legacy},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := os.WriteFile(filename, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			img, err := ReadImage(filename, ImageTypeVTK, nil)
+			if err != nil {
+				t.Fatalf("failed to read image: %v", err)
+			}
+			if img.GetPixelType() != PixelTypeInt16 || img.GetDimension() != 2 || img.GetSize()[0] != 3 || img.GetSize()[1] != 2 {
+				t.Fatalf("expected 3x2 int16 image, got pixel type %d size %v", img.GetPixelType(), img.GetSize())
+			}
+			if origin := img.GetOrigin(); origin[0] != 2 || origin[1] != 2 {
+				t.Errorf("expected origin [2 2], got %v", origin)
+			}
+			if spacing := img.GetSpacing(); spacing[0] != 0.5 || spacing[1] != 2 {
+				t.Errorf("expected spacing [0.5 2], got %v", spacing)
+			}
+			for i := 0; i < 6; i++ {
+				if value := img.getLinearPixelAsFloat64(i); value != float64(i-3) {
+					t.Errorf("pixel %d: expected %d, got %v", i, i-3, value)
+				}
+			}
+		})
+	}
+}
+
+func TestReadVTKInvalidFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_vtk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+	}{
+		{"not vtk", "test.vtk", "this is not a VTK file"},
+		{"polydata", "test.vtk", "# vtk DataFile Version 3.0\ntitle\nASCII\nDATASET POLYDATA\n"},
+		{"truncated ascii", "test.vtk", "# vtk DataFile Version 3.0\ntitle\nASCII\nDATASET STRUCTURED_POINTS\nDIMENSIONS 2 2 1\nPOINT_DATA 4\nSCALARS s float\nLOOKUP_TABLE default\n1 2 3\n"},
+		{"vectors", "test.vtk", "# vtk DataFile Version 3.0\ntitle\nASCII\nDATASET STRUCTURED_POINTS\nDIMENSIONS 2 2 1\nPOINT_DATA 4\nSCALARS s float 3\nLOOKUP_TABLE default\n"},
+		{"unstructured grid", "test.vti", `<VTKFile type="UnstructuredGrid"></VTKFile>`},
+		{"no point data", "test.vti", `<VTKFile type="ImageData"><ImageData WholeExtent="0 1 0 1 0 0"><Piece/></ImageData></VTKFile>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := os.WriteFile(filename, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ReadImage(filename, ImageTypeVTK, nil); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}